@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"massrouter.ai/backend/internal/config"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/internal/service"
+	"massrouter.ai/backend/pkg/database"
+	"massrouter.ai/backend/pkg/money"
+)
+
+var (
+	command = flag.String("command", "", "Ledger command: reconcile")
+	fix     = flag.Bool("fix", false, "Reset drifted account balances to the sum of their entries (reconcile)")
+)
+
+func main() {
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	dbConfig := database.Config{
+		Host:     cfg.Database.Host,
+		Port:     cfg.Database.Port,
+		User:     cfg.Database.User,
+		Password: cfg.Database.Password,
+		DBName:   cfg.Database.DBName,
+		SSLMode:  cfg.Database.SSLMode,
+	}
+
+	db, err := database.NewPostgresDB(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ledgerService := service.NewLedgerService(
+		repository.NewLedgerRepository(db.GetDB()),
+		repository.NewPaymentRecordRepository(db.GetDB()),
+		repository.NewBillingRecordRepository(db.GetDB()),
+	)
+
+	switch *command {
+	case "reconcile":
+		report, err := ledgerService.Reconcile(context.Background(), *fix)
+		if report != nil {
+			printReconciliation(report)
+		}
+		if err != nil {
+			log.Fatalf("Reconciliation failed: %v", err)
+		}
+		if len(report.Drifts) > 0 && !*fix {
+			// Let schedulers alert on drift
+			os.Exit(2)
+		}
+	default:
+		log.Fatal("Please specify a command: reconcile")
+	}
+}
+
+func printReconciliation(report *service.LedgerReconciliation) {
+	fmt.Printf("Checked %d accounts at %s\n", report.Accounts, report.CheckedAt.Format("2006-01-02 15:04:05"))
+	if len(report.Drifts) == 0 {
+		fmt.Println("✅ All balances match the ledger")
+		return
+	}
+
+	for _, drift := range report.Drifts {
+		status := "⚠️ Drift"
+		if drift.Fixed {
+			status = "✅ Fixed"
+		}
+		if drift.MissingAccount {
+			fmt.Printf("%s: user %s has ledger entries but no account (expected balance %s, held %s)\n",
+				status, drift.UserID, drift.ExpectedBalance, drift.ExpectedHeld)
+			continue
+		}
+		fmt.Printf("%s: user %s balance %s, ledger %s (%s); held %s, ledger %s (%s)\n",
+			status, drift.UserID,
+			drift.RecordedBalance, drift.ExpectedBalance, signed(drift.RecordedBalance-drift.ExpectedBalance),
+			drift.RecordedHeld, drift.ExpectedHeld, signed(drift.RecordedHeld-drift.ExpectedHeld))
+	}
+	fmt.Printf("%d of %d accounts drifted\n", len(report.Drifts), report.Accounts)
+}
+
+// signed formats a difference with its sign
+func signed(a money.Amount) string {
+	if a >= 0 {
+		return "+" + a.String()
+	}
+	return a.String()
+}
@@ -10,6 +10,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
 	"massrouter.ai/backend/pkg/utils"
 )
 
@@ -24,11 +25,11 @@ func main() {
 
 	fmt.Println("Seeding model providers...")
 	providers := []*model.ModelProvider{
-		{Name: "OpenAI", APIBaseURL: "https://api.openai.com/v1", APIKey: os.Getenv("OPENAI_API_KEY"), Config: model.JSONB{"description": "OpenAI API provider"}, Status: "active"},
-		{Name: "Anthropic", APIBaseURL: "https://api.anthropic.com", APIKey: os.Getenv("ANTHROPIC_API_KEY"), Config: model.JSONB{"description": "Anthropic Claude API"}, Status: "active"},
-		{Name: "Google", APIBaseURL: "https://generativelanguage.googleapis.com", APIKey: os.Getenv("GOOGLE_API_KEY"), Config: model.JSONB{"description": "Google Gemini API"}, Status: "active"},
-		{Name: "Meta", APIBaseURL: "https://api.meta.ai", APIKey: os.Getenv("META_API_KEY"), Config: model.JSONB{"description": "Meta Llama API"}, Status: "active"},
-		{Name: "Cohere", APIBaseURL: "https://api.cohere.ai", APIKey: os.Getenv("COHERE_API_KEY"), Config: model.JSONB{"description": "Cohere API"}, Status: "active"},
+		{Name: "OpenAI", APIBaseURL: "https://api.openai.com/v1", APIKey: os.Getenv("OPENAI_API_KEY"), Config: model.JSONB{"description": "OpenAI API provider", "type": "openai"}, Status: "active"},
+		{Name: "Anthropic", APIBaseURL: "https://api.anthropic.com", APIKey: os.Getenv("ANTHROPIC_API_KEY"), Config: model.JSONB{"description": "Anthropic Claude API", "type": "anthropic"}, Status: "active"},
+		{Name: "Google", APIBaseURL: "https://generativelanguage.googleapis.com", APIKey: os.Getenv("GOOGLE_API_KEY"), Config: model.JSONB{"description": "Google Gemini API", "type": "gemini"}, Status: "active"},
+		{Name: "Meta", APIBaseURL: "https://api.meta.ai", APIKey: os.Getenv("META_API_KEY"), Config: model.JSONB{"description": "Meta Llama API", "type": "openai"}, Status: "active"},
+		{Name: "Cohere", APIBaseURL: "https://api.cohere.ai", APIKey: os.Getenv("COHERE_API_KEY"), Config: model.JSONB{"description": "Cohere API", "type": "cohere"}, Status: "active"},
 	}
 
 	for _, p := range providers {
@@ -74,17 +75,17 @@ func main() {
 	fmt.Println("\nSeeding models...")
 	models := []*model.Model{
 		// OpenAI
-		{Name: "gpt-4o", Description: "OpenAI GPT-4 Omni", ProviderID: providerMap["OpenAI"], ContextLength: intPtr(128000), MaxTokens: intPtr(4096), InputPrice: 0.005, OutputPrice: 0.015, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "premium"},
-		{Name: "gpt-3.5-turbo", Description: "OpenAI GPT-3.5 Turbo", ProviderID: providerMap["OpenAI"], ContextLength: intPtr(16385), MaxTokens: intPtr(4096), InputPrice: 0.0005, OutputPrice: 0.0015, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{}, PricingTier: "standard"},
+		{Name: "gpt-4o", Description: "OpenAI GPT-4 Omni", ProviderID: providerMap["OpenAI"], ContextLength: intPtr(128000), MaxTokens: intPtr(4096), InputPrice: money.MustParse("0.005"), OutputPrice: money.MustParse("0.015"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "premium"},
+		{Name: "gpt-3.5-turbo", Description: "OpenAI GPT-3.5 Turbo", ProviderID: providerMap["OpenAI"], ContextLength: intPtr(16385), MaxTokens: intPtr(4096), InputPrice: money.MustParse("0.0005"), OutputPrice: money.MustParse("0.0015"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{}, PricingTier: "standard"},
 		// Anthropic
-		{Name: "claude-3-sonnet", Description: "Anthropic Claude 3 Sonnet", ProviderID: providerMap["Anthropic"], ContextLength: intPtr(200000), MaxTokens: intPtr(4096), InputPrice: 0.003, OutputPrice: 0.015, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "standard"},
-		{Name: "claude-3-haiku", Description: "Anthropic Claude 3 Haiku", ProviderID: providerMap["Anthropic"], ContextLength: intPtr(200000), MaxTokens: intPtr(4096), InputPrice: 0.00025, OutputPrice: 0.00125, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "economy"},
+		{Name: "claude-3-sonnet", Description: "Anthropic Claude 3 Sonnet", ProviderID: providerMap["Anthropic"], ContextLength: intPtr(200000), MaxTokens: intPtr(4096), InputPrice: money.MustParse("0.003"), OutputPrice: money.MustParse("0.015"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "standard"},
+		{Name: "claude-3-haiku", Description: "Anthropic Claude 3 Haiku", ProviderID: providerMap["Anthropic"], ContextLength: intPtr(200000), MaxTokens: intPtr(4096), InputPrice: money.MustParse("0.00025"), OutputPrice: money.MustParse("0.00125"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "economy"},
 		// Google
-		{Name: "gemini-1.5-pro", Description: "Google Gemini 1.5 Pro", ProviderID: providerMap["Google"], ContextLength: intPtr(1000000), MaxTokens: intPtr(8192), InputPrice: 0.00125, OutputPrice: 0.00375, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "premium"},
+		{Name: "gemini-1.5-pro", Description: "Google Gemini 1.5 Pro", ProviderID: providerMap["Google"], ContextLength: intPtr(1000000), MaxTokens: intPtr(8192), InputPrice: money.MustParse("0.00125"), OutputPrice: money.MustParse("0.00375"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{"vision": true}, PricingTier: "premium"},
 		// Meta
-		{Name: "llama-3-70b", Description: "Meta Llama 3 70B", ProviderID: providerMap["Meta"], ContextLength: intPtr(8192), MaxTokens: intPtr(4096), InputPrice: 0.0009, OutputPrice: 0.0009, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{}, PricingTier: "standard"},
+		{Name: "llama-3-70b", Description: "Meta Llama 3 70B", ProviderID: providerMap["Meta"], ContextLength: intPtr(8192), MaxTokens: intPtr(4096), InputPrice: money.MustParse("0.0009"), OutputPrice: money.MustParse("0.0009"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{}, PricingTier: "standard"},
 		// Cohere
-		{Name: "command-r", Description: "Cohere Command R", ProviderID: providerMap["Cohere"], ContextLength: intPtr(128000), MaxTokens: intPtr(4096), InputPrice: 0.0005, OutputPrice: 0.0015, IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{}, PricingTier: "standard"},
+		{Name: "command-r", Description: "Cohere Command R", ProviderID: providerMap["Cohere"], ContextLength: intPtr(128000), MaxTokens: intPtr(4096), InputPrice: money.MustParse("0.0005"), OutputPrice: money.MustParse("0.0015"), IsActive: true, IsFree: false, Category: "chat", Capabilities: model.JSONB{}, PricingTier: "standard"},
 	}
 
 	for _, m := range models {
@@ -256,28 +257,29 @@ func main() {
 					paidAtPtr = &paidAt
 				}
 
+				transactionID := fmt.Sprintf("txn_%s_%d_%d", user.ID[:8], i, j)
 				payment := &model.PaymentRecord{
 					UserID:        user.ID,
-					Amount:        float64((j+1)*50 + i*100), // Varying amounts
+					Amount:        money.FromInt(int64((j+1)*50 + i*100)), // Varying amounts
 					Currency:      "CNY",
 					PaymentMethod: paymentMethods[(i+j)%len(paymentMethods)],
-					TransactionID: fmt.Sprintf("txn_%s_%d_%d", user.ID[:8], i, j),
+					TransactionID: &transactionID,
 					Status:        status,
 					PaidAt:        paidAtPtr,
 					Metadata:      model.JSONB{"note": "Test payment"},
 				}
 
 				var existing model.PaymentRecord
-				if err := db.WithContext(ctx).Where("transaction_id = ?", payment.TransactionID).First(&existing).Error; err != nil {
+				if err := db.WithContext(ctx).Where("transaction_id = ?", transactionID).First(&existing).Error; err != nil {
 					if err == gorm.ErrRecordNotFound {
 						if err := db.WithContext(ctx).Create(payment).Error; err != nil {
 							log.Printf("Failed to create payment record: %v", err)
 						} else {
-							fmt.Printf("✅ Created payment: %s for user %s\n", payment.TransactionID, user.Email)
+							fmt.Printf("✅ Created payment: %s for user %s\n", transactionID, user.Email)
 						}
 					}
 				} else {
-					fmt.Printf("⚠️ Payment exists: %s\n", payment.TransactionID)
+					fmt.Printf("⚠️ Payment exists: %s\n", transactionID)
 				}
 			}
 		}
@@ -309,7 +311,8 @@ func main() {
 				totalTokens := requestTokens + responseTokens
 
 				// Calculate cost based on model pricing (simplified)
-				cost := (float64(requestTokens)/1000)*models[modelIdx].InputPrice + (float64(responseTokens)/1000)*models[modelIdx].OutputPrice
+				cost := models[modelIdx].InputPrice.MulDiv(int64(requestTokens), 1000, money.HalfUp) +
+					models[modelIdx].OutputPrice.MulDiv(int64(responseTokens), 1000, money.HalfUp)
 
 				billing := &model.BillingRecord{
 					UserID:         user.ID,
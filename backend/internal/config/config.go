@@ -15,6 +15,10 @@ type Config struct {
 	JWT      JWTConfig
 	CORS     CORSConfig
 	Log      LogConfig
+	Upstream UpstreamConfig
+	Payment  PaymentConfig
+	Billing  BillingConfig
+	Quota    QuotaConfig
 }
 
 type ServerConfig struct {
@@ -61,6 +65,42 @@ type LogConfig struct {
 	Format string
 }
 
+// UpstreamConfig tunes how calls to model providers are retried and when a
+// provider key's circuit breaker opens
+type UpstreamConfig struct {
+	MaxRetries     int           // Extra attempts per request after transient failures
+	RetryBaseDelay time.Duration // Backoff before the first retry, doubled for each one after
+	RetryMaxDelay  time.Duration // Longest backoff, and longest Retry-After that is waited out
+
+	BreakerThreshold   int           // Consecutive failures that open a breaker
+	BreakerOpenTimeout time.Duration // How long an open breaker fails fast before probing
+}
+
+// PaymentConfig holds what payment gateway webhooks are verified with. The
+// gateway is accepted only when it has a name and a secret or key.
+type PaymentConfig struct {
+	GatewayName         string        // Name the gateway's webhooks are posted under
+	GatewayHMACSecret   string        // Shared secret the gateway signs t=,v1= signatures with
+	GatewayRSAPublicKey string        // Or the RSA public key it signs with, PEM or base64 DER
+	WebhookTolerance    time.Duration // How old a signed webhook timestamp may be
+
+	SandboxEnabled bool   // Accept payments through the built-in sandbox gateway
+	SandboxSecret  string // HMAC secret of the sandbox; random when empty
+}
+
+// BillingConfig sizes the consumers of the billing stream each router
+// instance runs
+type BillingConfig struct {
+	Consumers int           // Consumers per process
+	BatchSize int           // Entries read, and records stored, per transaction
+	ClaimIdle time.Duration // How long an entry may stay unacknowledged before another consumer takes it over
+}
+
+// QuotaConfig controls the quota counters kept in Redis
+type QuotaConfig struct {
+	FlushInterval time.Duration // How often counted usage is written to the database
+}
+
 func getStringWithFallback(primaryKey, fallbackKey string) string {
 	value := viper.GetString(primaryKey)
 	if value == "" {
@@ -124,6 +164,20 @@ func Load() (*Config, error) {
 	viper.SetDefault("LOG_LEVEL", "info")
 	viper.SetDefault("LOG_FORMAT", "json")
 
+	viper.SetDefault("UPSTREAM_MAX_RETRIES", "2")
+	viper.SetDefault("UPSTREAM_RETRY_BASE_DELAY", "250ms")
+	viper.SetDefault("UPSTREAM_RETRY_MAX_DELAY", "5s")
+	viper.SetDefault("UPSTREAM_BREAKER_THRESHOLD", "5")
+	viper.SetDefault("UPSTREAM_BREAKER_OPEN_TIMEOUT", "30s")
+
+	viper.SetDefault("PAYMENT_WEBHOOK_TOLERANCE", "5m")
+	viper.SetDefault("PAYMENT_SANDBOX_ENABLED", "false")
+
+	viper.SetDefault("BILLING_CONSUMERS", "2")
+	viper.SetDefault("BILLING_BATCH_SIZE", "100")
+	viper.SetDefault("BILLING_CLAIM_IDLE", "2m")
+	viper.SetDefault("QUOTA_FLUSH_INTERVAL", "10s")
+
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			log.Printf("Error reading config file: %v", err)
@@ -169,6 +223,29 @@ func Load() (*Config, error) {
 			Level:  viper.GetString("LOG_LEVEL"),
 			Format: viper.GetString("LOG_FORMAT"),
 		},
+		Upstream: UpstreamConfig{
+			MaxRetries:         viper.GetInt("UPSTREAM_MAX_RETRIES"),
+			RetryBaseDelay:     viper.GetDuration("UPSTREAM_RETRY_BASE_DELAY"),
+			RetryMaxDelay:      viper.GetDuration("UPSTREAM_RETRY_MAX_DELAY"),
+			BreakerThreshold:   viper.GetInt("UPSTREAM_BREAKER_THRESHOLD"),
+			BreakerOpenTimeout: viper.GetDuration("UPSTREAM_BREAKER_OPEN_TIMEOUT"),
+		},
+		Payment: PaymentConfig{
+			GatewayName:         viper.GetString("PAYMENT_GATEWAY_NAME"),
+			GatewayHMACSecret:   viper.GetString("PAYMENT_GATEWAY_HMAC_SECRET"),
+			GatewayRSAPublicKey: viper.GetString("PAYMENT_GATEWAY_RSA_PUBLIC_KEY"),
+			WebhookTolerance:    viper.GetDuration("PAYMENT_WEBHOOK_TOLERANCE"),
+			SandboxEnabled:      viper.GetBool("PAYMENT_SANDBOX_ENABLED"),
+			SandboxSecret:       viper.GetString("PAYMENT_SANDBOX_SECRET"),
+		},
+		Billing: BillingConfig{
+			Consumers: viper.GetInt("BILLING_CONSUMERS"),
+			BatchSize: viper.GetInt("BILLING_BATCH_SIZE"),
+			ClaimIdle: viper.GetDuration("BILLING_CLAIM_IDLE"),
+		},
+		Quota: QuotaConfig{
+			FlushInterval: viper.GetDuration("QUOTA_FLUSH_INTERVAL"),
+		},
 	}
 
 	log.Printf("Server Port: %s", config.Server.Port)
@@ -18,6 +18,9 @@ func (c *Config) Validate() error {
 	if err := c.JWT.validate(); err != nil {
 		return fmt.Errorf("jwt config: %w", err)
 	}
+	if err := c.Upstream.validate(); err != nil {
+		return fmt.Errorf("upstream config: %w", err)
+	}
 	return nil
 }
 
@@ -110,3 +113,22 @@ func (c *LogConfig) validate() error {
 	}
 	return nil
 }
+
+func (c *UpstreamConfig) validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max retries cannot be negative")
+	}
+	if c.RetryBaseDelay <= 0 {
+		return fmt.Errorf("retry base delay must be positive")
+	}
+	if c.RetryMaxDelay < c.RetryBaseDelay {
+		return fmt.Errorf("retry max delay must be at least the base delay")
+	}
+	if c.BreakerThreshold <= 0 {
+		return fmt.Errorf("breaker threshold must be positive")
+	}
+	if c.BreakerOpenTimeout <= 0 {
+		return fmt.Errorf("breaker open timeout must be positive")
+	}
+	return nil
+}
@@ -1,22 +1,29 @@
 package admin
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"massrouter.ai/backend/internal/middleware"
+	"massrouter.ai/backend/internal/model"
 	"massrouter.ai/backend/internal/service"
 )
 
 type Controller struct {
-	adminService service.AdminService
-	validator    *validator.Validate
+	adminService   service.AdminService
+	billingService service.BillingService
+	ledgerService  service.LedgerService
+	validator      *validator.Validate
 }
 
-func NewController(adminService service.AdminService) *Controller {
+func NewController(adminService service.AdminService, billingService service.BillingService, ledgerService service.LedgerService) *Controller {
 	return &Controller{
-		adminService: adminService,
-		validator:    validator.New(),
+		adminService:   adminService,
+		billingService: billingService,
+		ledgerService:  ledgerService,
+		validator:      validator.New(),
 	}
 }
 
@@ -220,6 +227,110 @@ func (c *Controller) UpdateUser(ctx *gin.Context) {
 	})
 }
 
+// PostLedgerEntry godoc
+// @Summary Post ledger entry (admin)
+// @Description Refund, adjust, hold or release a user's balance with a ledger entry referencing the payment or billing record it concerns, or an admin-chosen request ID (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body service.PostLedgerEntryRequest true "Ledger entry"
+// @Success 201 {object} map[string]interface{} "Ledger entry posted successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Referenced record not found"
+// @Failure 409 {object} map[string]interface{} "Entry already posted for the reference"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/users/{id}/ledger-entries [post]
+func (c *Controller) PostLedgerEntry(ctx *gin.Context) {
+	userID := ctx.Param("id")
+	if userID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "User ID is required",
+			},
+		})
+		return
+	}
+
+	var req service.PostLedgerEntryRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	adminID, _ := middleware.GetUserID(ctx)
+	entry, posted, err := c.ledgerService.PostManualEntry(ctx.Request.Context(), userID, adminID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidLedgerEntry):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_VALIDATION",
+					"message": "Validation failed",
+					"details": err.Error(),
+				},
+			})
+		case errors.Is(err, service.ErrLedgerReferenceNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Referenced record not found",
+				},
+			})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_INTERNAL",
+					"message": "Failed to post ledger entry",
+				},
+			})
+		}
+		return
+	}
+
+	if !posted {
+		ctx.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_CONFLICT",
+				"message": "An entry of this type was already posted for the reference",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    entry,
+	})
+}
+
 // CreateModelProvider godoc
 // @Summary Create model provider (admin)
 // @Description Create a new model provider (admin only)
@@ -259,6 +370,19 @@ func (c *Controller) CreateModelProvider(ctx *gin.Context) {
 		return
 	}
 
+	// The provider's connection settings must be usable before they are saved
+	if _, err := model.ParseProviderHTTPSettings(req.Config); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Invalid provider config",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
 	provider, err := c.adminService.CreateModelProvider(ctx.Request.Context(), &req)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -330,6 +454,19 @@ func (c *Controller) UpdateModelProvider(ctx *gin.Context) {
 		return
 	}
 
+	// The provider's connection settings must be usable before they are saved
+	if _, err := model.ParseProviderHTTPSettings(req.Config); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Invalid provider config",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
 	if err := c.adminService.UpdateModelProvider(ctx.Request.Context(), providerID, &req); err != nil {
 		if err.Error() == "provider not found" {
 			ctx.JSON(http.StatusNotFound, gin.H{
@@ -360,22 +497,67 @@ func (c *Controller) UpdateModelProvider(ctx *gin.Context) {
 	})
 }
 
-// CreateModel godoc
-// @Summary Create model (admin)
-// @Description Create a new model (admin only)
+// ListProviderCredentials godoc
+// @Summary List provider credentials (admin)
+// @Description List a provider's upstream API keys with masked values (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Provider ID"
+// @Success 200 {object} map[string]interface{} "Provider credentials retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/providers/{id}/credentials [get]
+func (c *Controller) ListProviderCredentials(ctx *gin.Context) {
+	credentials, err := c.adminService.ListProviderCredentials(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		if err.Error() == "provider not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Provider not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to list provider credentials",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    credentials,
+	})
+}
+
+// CreateProviderCredential godoc
+// @Summary Create provider credential (admin)
+// @Description Add an upstream API key to a provider's rotation (admin only)
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body service.CreateModelRequest true "Model creation request"
-// @Success 201 {object} map[string]interface{} "Model created successfully"
+// @Param id path string true "Provider ID"
+// @Param request body service.CreateProviderCredentialRequest true "Provider credential creation request"
+// @Success 201 {object} map[string]interface{} "Provider credential created successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Provider not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /api/v1/admin/models [post]
-func (c *Controller) CreateModel(ctx *gin.Context) {
-	var req service.CreateModelRequest
+// @Router /api/v1/admin/providers/{id}/credentials [post]
+func (c *Controller) CreateProviderCredential(ctx *gin.Context) {
+	var req service.CreateProviderCredentialRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -399,13 +581,24 @@ func (c *Controller) CreateModel(ctx *gin.Context) {
 		return
 	}
 
-	model, err := c.adminService.CreateModel(ctx.Request.Context(), &req)
+	credential, err := c.adminService.CreateProviderCredential(ctx.Request.Context(), ctx.Param("id"), &req)
 	if err != nil {
+		if err.Error() == "provider not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Provider not found",
+				},
+			})
+			return
+		}
+
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_INTERNAL",
-				"message": "Failed to create model",
+				"message": "Failed to create provider credential",
 			},
 		})
 		return
@@ -413,70 +606,102 @@ func (c *Controller) CreateModel(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusCreated, gin.H{
 		"success": true,
-		"data":    model,
+		"data":    credential,
 	})
 }
 
-// UpdateModel godoc
-// @Summary Update model (admin)
-// @Description Update model information (admin only)
+// UpdateProviderCredential godoc
+// @Summary Update provider credential (admin)
+// @Description Update a credential's weight, budgets or status; re-enabling clears its failures (admin only)
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param id path string true "Model ID"
-// @Param request body service.UpdateModelRequest true "Model update request"
-// @Success 200 {object} map[string]interface{} "Model updated successfully"
+// @Param id path string true "Credential ID"
+// @Param request body service.UpdateProviderCredentialRequest true "Provider credential update request"
+// @Success 200 {object} map[string]interface{} "Provider credential updated successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
-// @Failure 404 {object} map[string]interface{} "Model not found"
+// @Failure 404 {object} map[string]interface{} "Provider credential not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /api/v1/admin/models/{id} [put]
-func (c *Controller) UpdateModel(ctx *gin.Context) {
-	modelID := ctx.Param("id")
-	if modelID == "" {
+// @Router /api/v1/admin/credentials/{id} [put]
+func (c *Controller) UpdateProviderCredential(ctx *gin.Context) {
+	var req service.UpdateProviderCredentialRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_BAD_REQUEST",
-				"message": "Model ID is required",
+				"message": "Invalid request body",
 			},
 		})
 		return
 	}
 
-	var req service.UpdateModelRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
+	if err := c.validator.Struct(req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code":    "ERR_BAD_REQUEST",
-				"message": "Invalid request body",
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
 			},
 		})
 		return
 	}
 
-	if err := c.validator.Struct(req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{
+	if err := c.adminService.UpdateProviderCredential(ctx.Request.Context(), ctx.Param("id"), &req); err != nil {
+		if err.Error() == "credential not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Provider credential not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code":    "ERR_VALIDATION",
-				"message": "Validation failed",
-				"details": err.Error(),
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to update provider credential",
 			},
 		})
 		return
 	}
 
-	if err := c.adminService.UpdateModel(ctx.Request.Context(), modelID, &req); err != nil {
-		if err.Error() == "model not found" {
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Provider credential updated successfully",
+		},
+	})
+}
+
+// DeleteProviderCredential godoc
+// @Summary Delete provider credential (admin)
+// @Description Remove an upstream API key from a provider's rotation (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Credential ID"
+// @Success 200 {object} map[string]interface{} "Provider credential deleted successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Provider credential not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/credentials/{id} [delete]
+func (c *Controller) DeleteProviderCredential(ctx *gin.Context) {
+	if err := c.adminService.DeleteProviderCredential(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		if err.Error() == "credential not found" {
 			ctx.JSON(http.StatusNotFound, gin.H{
 				"success": false,
 				"error": gin.H{
 					"code":    "ERR_NOT_FOUND",
-					"message": "Model not found",
+					"message": "Provider credential not found",
 				},
 			})
 			return
@@ -486,7 +711,7 @@ func (c *Controller) UpdateModel(ctx *gin.Context) {
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_INTERNAL",
-				"message": "Failed to update model",
+				"message": "Failed to delete provider credential",
 			},
 		})
 		return
@@ -495,7 +720,1031 @@ func (c *Controller) UpdateModel(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data": gin.H{
-			"message": "Model updated successfully",
+			"message": "Provider credential deleted successfully",
+		},
+	})
+}
+
+// CreateModel godoc
+// @Summary Create model (admin)
+// @Description Create a new model (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.CreateModelRequest true "Model creation request"
+// @Success 201 {object} map[string]interface{} "Model created successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/models [post]
+func (c *Controller) CreateModel(ctx *gin.Context) {
+	var req service.CreateModelRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	model, err := c.adminService.CreateModel(ctx.Request.Context(), &req)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to create model",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    model,
+	})
+}
+
+// UpdateModel godoc
+// @Summary Update model (admin)
+// @Description Update model information (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Model ID"
+// @Param request body service.UpdateModelRequest true "Model update request"
+// @Success 200 {object} map[string]interface{} "Model updated successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/models/{id} [put]
+func (c *Controller) UpdateModel(ctx *gin.Context) {
+	modelID := ctx.Param("id")
+	if modelID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Model ID is required",
+			},
+		})
+		return
+	}
+
+	var req service.UpdateModelRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	if err := c.adminService.UpdateModel(ctx.Request.Context(), modelID, &req); err != nil {
+		if err.Error() == "model not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to update model",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Model updated successfully",
+		},
+	})
+}
+
+// ListModelDeployments godoc
+// @Summary List model deployments (admin)
+// @Description List the deployments a model fails over between, in priority order (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Model ID"
+// @Success 200 {object} map[string]interface{} "Model deployments retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/models/{id}/deployments [get]
+func (c *Controller) ListModelDeployments(ctx *gin.Context) {
+	deployments, err := c.adminService.ListModelDeployments(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		if err.Error() == "model not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to list model deployments",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    deployments,
+	})
+}
+
+// CreateModelDeployment godoc
+// @Summary Create model deployment (admin)
+// @Description Add a provider deployment to a model's failover chain (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Model ID"
+// @Param request body service.CreateModelDeploymentRequest true "Model deployment creation request"
+// @Success 201 {object} map[string]interface{} "Model deployment created successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model or provider not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/models/{id}/deployments [post]
+func (c *Controller) CreateModelDeployment(ctx *gin.Context) {
+	var req service.CreateModelDeploymentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	deployment, err := c.adminService.CreateModelDeployment(ctx.Request.Context(), ctx.Param("id"), &req)
+	if err != nil {
+		if err.Error() == "model not found" || err.Error() == "provider not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model or provider not found",
+					"details": err.Error(),
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to create model deployment",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    deployment,
+	})
+}
+
+// UpdateModelDeployment godoc
+// @Summary Update model deployment (admin)
+// @Description Update a deployment's upstream model, priority, weight, prices or status (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Deployment ID"
+// @Param request body service.UpdateModelDeploymentRequest true "Model deployment update request"
+// @Success 200 {object} map[string]interface{} "Model deployment updated successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model deployment not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/deployments/{id} [put]
+func (c *Controller) UpdateModelDeployment(ctx *gin.Context) {
+	var req service.UpdateModelDeploymentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	if err := c.adminService.UpdateModelDeployment(ctx.Request.Context(), ctx.Param("id"), &req); err != nil {
+		if err.Error() == "deployment not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model deployment not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to update model deployment",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Model deployment updated successfully",
+		},
+	})
+}
+
+// DeleteModelDeployment godoc
+// @Summary Delete model deployment (admin)
+// @Description Remove a deployment from a model's failover chain (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Deployment ID"
+// @Success 200 {object} map[string]interface{} "Model deployment deleted successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model deployment not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/deployments/{id} [delete]
+func (c *Controller) DeleteModelDeployment(ctx *gin.Context) {
+	if err := c.adminService.DeleteModelDeployment(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		if err.Error() == "deployment not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model deployment not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to delete model deployment",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Model deployment deleted successfully",
+		},
+	})
+}
+
+// ListModelAliases godoc
+// @Summary List model aliases (admin)
+// @Description List all model aliases with the models they resolve to (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Model aliases retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/aliases [get]
+func (c *Controller) ListModelAliases(ctx *gin.Context) {
+	aliases, err := c.adminService.ListModelAliases(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to list model aliases",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    aliases,
+	})
+}
+
+// CreateModelAlias godoc
+// @Summary Create model alias (admin)
+// @Description Create a name clients can request that resolves to a model (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.CreateModelAliasRequest true "Model alias creation request"
+// @Success 201 {object} map[string]interface{} "Model alias created successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model not found"
+// @Failure 409 {object} map[string]interface{} "Alias or model with this name already exists"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/aliases [post]
+func (c *Controller) CreateModelAlias(ctx *gin.Context) {
+	var req service.CreateModelAliasRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	alias, err := c.adminService.CreateModelAlias(ctx.Request.Context(), &req)
+	if err != nil {
+		if err.Error() == "model not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model not found",
+				},
+			})
+			return
+		}
+
+		if err.Error() == "alias with this name already exists" || err.Error() == "model with this name already exists" {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_CONFLICT",
+					"message": "Name already in use",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to create model alias",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    alias,
+	})
+}
+
+// UpdateModelAlias godoc
+// @Summary Update model alias (admin)
+// @Description Point an alias at another model, or change its description or status (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Alias ID"
+// @Param request body service.UpdateModelAliasRequest true "Model alias update request"
+// @Success 200 {object} map[string]interface{} "Model alias updated successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model alias or model not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/aliases/{id} [put]
+func (c *Controller) UpdateModelAlias(ctx *gin.Context) {
+	var req service.UpdateModelAliasRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	if err := c.adminService.UpdateModelAlias(ctx.Request.Context(), ctx.Param("id"), &req); err != nil {
+		if err.Error() == "alias not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model alias not found",
+				},
+			})
+			return
+		}
+
+		if err.Error() == "model not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to update model alias",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Model alias updated successfully",
+		},
+	})
+}
+
+// DeleteModelAlias godoc
+// @Summary Delete model alias (admin)
+// @Description Delete a model alias (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Alias ID"
+// @Success 200 {object} map[string]interface{} "Model alias deleted successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model alias not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/aliases/{id} [delete]
+func (c *Controller) DeleteModelAlias(ctx *gin.Context) {
+	if err := c.adminService.DeleteModelAlias(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		if err.Error() == "alias not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model alias not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to delete model alias",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Model alias deleted successfully",
+		},
+	})
+}
+
+// ListRoutingRules godoc
+// @Summary List routing rules (admin)
+// @Description List routing rules in the order they are checked (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Routing rules retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/routing-rules [get]
+func (c *Controller) ListRoutingRules(ctx *gin.Context) {
+	rules, err := c.adminService.ListRoutingRules(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to list routing rules",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rules,
+	})
+}
+
+// CreateRoutingRule godoc
+// @Summary Create routing rule (admin)
+// @Description Create a rule that sends matching requests to a model (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.CreateRoutingRuleRequest true "Routing rule creation request"
+// @Success 201 {object} map[string]interface{} "Routing rule created successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Model not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/routing-rules [post]
+func (c *Controller) CreateRoutingRule(ctx *gin.Context) {
+	var req service.CreateRoutingRuleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	rule, err := c.adminService.CreateRoutingRule(ctx.Request.Context(), &req)
+	if err != nil {
+		if err.Error() == "model not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to create routing rule",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// UpdateRoutingRule godoc
+// @Summary Update routing rule (admin)
+// @Description Update a routing rule's conditions, target, priority or status (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Routing rule ID"
+// @Param request body service.UpdateRoutingRuleRequest true "Routing rule update request"
+// @Success 200 {object} map[string]interface{} "Routing rule updated successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Routing rule or model not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/routing-rules/{id} [put]
+func (c *Controller) UpdateRoutingRule(ctx *gin.Context) {
+	var req service.UpdateRoutingRuleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_BAD_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
+	if err := c.adminService.UpdateRoutingRule(ctx.Request.Context(), ctx.Param("id"), &req); err != nil {
+		if err.Error() == "rule not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Routing rule not found",
+				},
+			})
+			return
+		}
+
+		if err.Error() == "model not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Model not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to update routing rule",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Routing rule updated successfully",
+		},
+	})
+}
+
+// DeleteRoutingRule godoc
+// @Summary Delete routing rule (admin)
+// @Description Delete a routing rule (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Routing rule ID"
+// @Success 200 {object} map[string]interface{} "Routing rule deleted successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Routing rule not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/routing-rules/{id} [delete]
+func (c *Controller) DeleteRoutingRule(ctx *gin.Context) {
+	if err := c.adminService.DeleteRoutingRule(ctx.Request.Context(), ctx.Param("id")); err != nil {
+		if err.Error() == "rule not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_NOT_FOUND",
+					"message": "Routing rule not found",
+				},
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to delete routing rule",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Routing rule deleted successfully",
+		},
+	})
+}
+
+// GetBillingQueueStatus godoc
+// @Summary Get billing queue status (admin)
+// @Description Get the backlog of the billing stream, its consumers, retries and dead letters (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Queue status retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/billing/queue [get]
+func (c *Controller) GetBillingQueueStatus(ctx *gin.Context) {
+	status, err := c.billingService.GetQueueStatus(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to get billing queue status",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// ListBillingDeadLetters godoc
+// @Summary List billing dead letters (admin)
+// @Description List the billing jobs the worker gave up on, latest first (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Dead letters retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/billing/dead-letters [get]
+func (c *Controller) ListBillingDeadLetters(ctx *gin.Context) {
+	letters, err := c.billingService.ListBillingDeadLetters(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to list dead letters",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"dead_letters": letters,
+			"total":        len(letters),
+		},
+	})
+}
+
+// ReplayBillingDeadLetters godoc
+// @Summary Replay billing dead letters (admin)
+// @Description Queue dead letters for billing again with fresh retries: the one in the path, those listed in the body, or all of them (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string false "Dead letter ID"
+// @Param request body service.BillingDeadLettersRequest false "Dead letters to replay"
+// @Success 200 {object} map[string]interface{} "Dead letters replayed successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Dead letter not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/billing/dead-letters/replay [post]
+// @Router /api/v1/admin/billing/dead-letters/{id}/replay [post]
+func (c *Controller) ReplayBillingDeadLetters(ctx *gin.Context) {
+	ids, ok := c.deadLetterIDs(ctx)
+	if !ok {
+		return
+	}
+
+	replayed, err := c.billingService.ReplayBillingDeadLetters(ctx.Request.Context(), ids...)
+	if err != nil {
+		c.deadLetterError(ctx, err, "Failed to replay dead letters")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"replayed": replayed,
+		},
+	})
+}
+
+// PurgeBillingDeadLetters godoc
+// @Summary Purge billing dead letters (admin)
+// @Description Drop dead letters without billing them: the one in the path, those listed in the body, or all of them (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string false "Dead letter ID"
+// @Param request body service.BillingDeadLettersRequest false "Dead letters to purge"
+// @Success 200 {object} map[string]interface{} "Dead letters purged successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden - admin access required"
+// @Failure 404 {object} map[string]interface{} "Dead letter not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/admin/billing/dead-letters [delete]
+// @Router /api/v1/admin/billing/dead-letters/{id} [delete]
+func (c *Controller) PurgeBillingDeadLetters(ctx *gin.Context) {
+	ids, ok := c.deadLetterIDs(ctx)
+	if !ok {
+		return
+	}
+
+	purged, err := c.billingService.PurgeBillingDeadLetters(ctx.Request.Context(), ids...)
+	if err != nil {
+		c.deadLetterError(ctx, err, "Failed to purge dead letters")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"purged": purged,
+		},
+	})
+}
+
+// deadLetterIDs reads the dead letters a request selects: the ID in the path,
+// else the IDs in the body. No IDs select all dead letters.
+func (c *Controller) deadLetterIDs(ctx *gin.Context) ([]string, bool) {
+	if id := ctx.Param("id"); id != "" {
+		return []string{id}, true
+	}
+
+	var req service.BillingDeadLettersRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_BAD_REQUEST",
+					"message": "Invalid request body",
+					"details": err.Error(),
+				},
+			})
+			return nil, false
+		}
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return nil, false
+	}
+	return req.IDs, true
+}
+
+func (c *Controller) deadLetterError(ctx *gin.Context, err error, message string) {
+	if err.Error() == "dead letter not found" {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_NOT_FOUND",
+				"message": "Dead letter not found",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code":    "ERR_INTERNAL",
+			"message": message,
 		},
 	})
 }
@@ -1,22 +1,30 @@
 package billing
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"massrouter.ai/backend/internal/service"
+	"massrouter.ai/backend/pkg/money"
+	"massrouter.ai/backend/pkg/tokenizer"
 )
 
 type Controller struct {
 	billingService service.BillingService
+	ledgerService  service.LedgerService
 	validator      *validator.Validate
 }
 
-func NewController(billingService service.BillingService) *Controller {
+func NewController(billingService service.BillingService, ledgerService service.LedgerService) *Controller {
 	return &Controller{
 		billingService: billingService,
+		ledgerService:  ledgerService,
 		validator:      validator.New(),
 	}
 }
@@ -64,13 +72,21 @@ func (c *Controller) GetBalance(ctx *gin.Context) {
 
 // GetPaymentHistory godoc
 // @Summary Get payment history
-// @Description Get paginated payment history for current user
+// @Description Get the current user's payments a page at a time. Pass next_cursor from a page as cursor to get the next one.
 // @Tags billing
 // @Produce json
 // @Security BearerAuth
-// @Param page query integer false "Page number" default(1) minimum(1)
+// @Param cursor query string false "next_cursor of the previous page"
 // @Param limit query integer false "Items per page" default(20) minimum(1) maximum(100)
+// @Param from query string false "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC 3339, or YYYY-MM-DD to include that day)"
+// @Param status query string false "Filter by status (pending, completed, failed)"
+// @Param payment_method query string false "Filter by payment method"
+// @Param min_amount query string false "Smallest amount"
+// @Param sort_by query string false "Sort field (created_at, amount)" default(created_at)
+// @Param sort_order query string false "Sort order (asc, desc)" default(desc)
 // @Success 200 {object} map[string]interface{} "Payment history retrieved successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid parameters"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/billing/payments [get]
@@ -87,18 +103,31 @@ func (c *Controller) GetPaymentHistory(ctx *gin.Context) {
 		return
 	}
 
-	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
-	if err != nil || page < 1 {
-		page = 1
+	req := service.PaymentHistoryRequest{
+		Cursor:        ctx.Query("cursor"),
+		Status:        ctx.Query("status"),
+		PaymentMethod: ctx.Query("payment_method"),
+		SortBy:        ctx.Query("sort_by"),
+		SortOrder:     ctx.Query("sort_order"),
 	}
-
-	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
-	if err != nil || limit < 1 || limit > 100 {
-		limit = 20
+	var err error
+	if req.Limit, req.From, req.To, err = historyQuery(ctx); err == nil {
+		req.MinAmount, err = amountQuery(ctx, "min_amount")
+	}
+	if err == nil {
+		err = c.validator.Struct(req)
+	}
+	if err != nil {
+		historyValidationError(ctx, err)
+		return
 	}
 
-	response, err := c.billingService.GetPaymentHistory(ctx.Request.Context(), userID.(string), page, limit)
+	response, err := c.billingService.GetPaymentHistory(ctx.Request.Context(), userID.(string), &req)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) || err.Error() == "from must be before to" {
+			historyValidationError(ctx, err)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -166,8 +195,35 @@ func (c *Controller) CreatePayment(ctx *gin.Context) {
 		return
 	}
 
+	currency, err := money.LookupCurrency(req.Currency)
+	if err == nil && !currency.Exact(req.Amount) {
+		err = fmt.Errorf("amount must have at most %d decimal places for %s", currency.Digits, currency.Code)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+
 	paymentInfo, err := c.billingService.CreatePayment(ctx.Request.Context(), userID.(string), &req)
 	if err != nil {
+		if err.Error() == "unsupported payment method" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_VALIDATION",
+					"message": "Validation failed",
+					"details": err.Error(),
+				},
+			})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
@@ -186,18 +242,19 @@ func (c *Controller) CreatePayment(ctx *gin.Context) {
 
 // ProcessPaymentWebhook godoc
 // @Summary Process payment webhook
-// @Description Process payment webhook from payment provider (requires signature verification)
+// @Description Receive a payment gateway's notice that a payment succeeded or failed. Public: the request is authenticated by its signature, and repeated deliveries are applied once.
 // @Tags billing
 // @Accept json
 // @Produce json
-// @Security BearerAuth
+// @Param gateway path string true "Payment gateway: the configured PAYMENT_GATEWAY_NAME or sandbox"
 // @Param X-Signature header string true "Webhook signature"
 // @Param payload body string true "Webhook payload"
 // @Success 200 {object} map[string]interface{} "Webhook processed successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - missing signature or invalid payload"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 400 {object} map[string]interface{} "Bad request - missing signature, invalid payload or payment mismatch"
+// @Failure 401 {object} map[string]interface{} "Invalid signature"
+// @Failure 404 {object} map[string]interface{} "Unknown gateway or payment"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
-// @Router /api/v1/billing/webhook [post]
+// @Router /api/v1/billing/webhooks/{gateway} [post]
 func (c *Controller) ProcessPaymentWebhook(ctx *gin.Context) {
 	signature := ctx.GetHeader("X-Signature")
 	if signature == "" {
@@ -223,34 +280,136 @@ func (c *Controller) ProcessPaymentWebhook(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.billingService.ProcessPaymentWebhook(ctx.Request.Context(), payload, signature); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
+	if err := c.billingService.ProcessPaymentWebhook(ctx.Request.Context(), ctx.Param("gateway"), payload, signature); err != nil {
+		c.paymentError(ctx, err, "Failed to process webhook")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"message": "Webhook processed successfully",
+		},
+	})
+}
+
+// SimulateSandboxPayment godoc
+// @Summary Settle a sandbox payment
+// @Description Succeed or fail one of the current user's sandbox payments. The sandbox gateway signs a webhook that goes through the same processing as a real gateway's. Only available when the sandbox gateway is enabled.
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Payment ID"
+// @Param request body service.SandboxPaymentRequest false "Outcome, succeeded by default"
+// @Success 200 {object} map[string]interface{} "Payment settled"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid outcome"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "Payment not found or sandbox disabled"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/billing/payments/{id}/sandbox [post]
+func (c *Controller) SimulateSandboxPayment(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"error": gin.H{
-				"code":    "ERR_INTERNAL",
-				"message": "Failed to process webhook",
+				"code":    "ERR_UNAUTHORIZED",
+				"message": "Authentication required",
+			},
+		})
+		return
+	}
+
+	req := service.SandboxPaymentRequest{Outcome: "succeeded"}
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_BAD_REQUEST",
+					"message": "Invalid request body",
+					"details": err.Error(),
+				},
+			})
+			return
+		}
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_VALIDATION",
+				"message": "Validation failed",
+				"details": err.Error(),
 			},
 		})
 		return
 	}
 
+	paymentItem, err := c.billingService.SimulateSandboxPayment(ctx.Request.Context(), userID.(string), ctx.Param("id"), req.Outcome == "succeeded")
+	if err != nil {
+		c.paymentError(ctx, err, "Failed to settle sandbox payment")
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data": gin.H{
-			"message": "Webhook processed successfully",
+		"data":    paymentItem,
+	})
+}
+
+// paymentError responds to a failed webhook. Gateways retry deliveries that
+// get a 5xx, so only errors a retry could fix are reported as one.
+func (c *Controller) paymentError(ctx *gin.Context, err error, message string) {
+	status, code := http.StatusInternalServerError, "ERR_INTERNAL"
+	switch msg := err.Error(); {
+	case msg == "unknown payment gateway" || msg == "payment not found" || msg == "sandbox payments are not enabled":
+		status, code = http.StatusNotFound, "ERR_NOT_FOUND"
+	case strings.HasPrefix(msg, "invalid webhook signature"):
+		status, code = http.StatusUnauthorized, "ERR_INVALID_SIGNATURE"
+	case strings.HasPrefix(msg, "invalid webhook payload") ||
+		msg == "payment amount mismatch" || msg == "payment transaction mismatch":
+		status, code = http.StatusBadRequest, "ERR_BAD_REQUEST"
+	}
+	if status == http.StatusInternalServerError {
+		ctx.JSON(status, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    code,
+				"message": message,
+			},
+		})
+		return
+	}
+
+	ctx.JSON(status, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code":    code,
+			"message": message,
+			"details": err.Error(),
 		},
 	})
 }
 
 // GetBillingRecords godoc
 // @Summary Get billing records
-// @Description Get paginated billing records (usage charges) for current user
+// @Description Get the current user's billing records (usage charges) a page at a time, with their models and providers. Pass next_cursor from a page as cursor to get the next one.
 // @Tags billing
 // @Produce json
 // @Security BearerAuth
-// @Param page query integer false "Page number" default(1) minimum(1)
+// @Param cursor query string false "next_cursor of the previous page"
 // @Param limit query integer false "Items per page" default(20) minimum(1) maximum(100)
+// @Param from query string false "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC 3339, or YYYY-MM-DD to include that day)"
+// @Param model_id query string false "Filter by model ID"
+// @Param api_key_id query string false "Filter by API key ID"
+// @Param min_cost query string false "Smallest cost"
+// @Param sort_by query string false "Sort field (created_at, cost, total_tokens)" default(created_at)
+// @Param sort_order query string false "Sort order (asc, desc)" default(desc)
 // @Success 200 {object} map[string]interface{} "Billing records retrieved successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid parameters"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/v1/billing/records [get]
@@ -267,6 +426,126 @@ func (c *Controller) GetBillingRecords(ctx *gin.Context) {
 		return
 	}
 
+	req := service.BillingRecordsRequest{
+		Cursor:    ctx.Query("cursor"),
+		ModelID:   ctx.Query("model_id"),
+		APIKeyID:  ctx.Query("api_key_id"),
+		SortBy:    ctx.Query("sort_by"),
+		SortOrder: ctx.Query("sort_order"),
+	}
+	var err error
+	if req.Limit, req.From, req.To, err = historyQuery(ctx); err == nil {
+		req.MinCost, err = amountQuery(ctx, "min_cost")
+	}
+	if err == nil {
+		err = c.validator.Struct(req)
+	}
+	if err != nil {
+		historyValidationError(ctx, err)
+		return
+	}
+
+	response, err := c.billingService.GetBillingRecords(ctx.Request.Context(), userID.(string), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) || err.Error() == "from must be before to" {
+			historyValidationError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to get billing records",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
+
+// historyQuery reads the page size and date range shared by the history
+// endpoints. A date without a time is midnight UTC; as the end of the range
+// it includes that whole day.
+func historyQuery(ctx *gin.Context) (limit int, from, to *time.Time, err error) {
+	limit, err = strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("limit must be a number")
+	}
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := ctx.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", value); err != nil {
+				return 0, nil, nil, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", bound.name)
+			}
+			if bound.name == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		*bound.dest = &t
+	}
+	return limit, from, to, nil
+}
+
+// amountQuery reads an optional amount query parameter
+func amountQuery(ctx *gin.Context, name string) (*money.Amount, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := money.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a decimal amount", name)
+	}
+	return &amount, nil
+}
+
+func historyValidationError(ctx *gin.Context, err error) {
+	ctx.JSON(http.StatusBadRequest, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code":    "ERR_VALIDATION",
+			"message": "Invalid request parameters",
+			"details": err.Error(),
+		},
+	})
+}
+
+// GetLedgerEntries godoc
+// @Summary Get ledger entries
+// @Description Get the current user's balance ledger, newest first: credits, debits, holds, refunds and adjustments with the balance after each
+// @Tags billing
+// @Produce json
+// @Security BearerAuth
+// @Param page query integer false "Page number" default(1) minimum(1)
+// @Param limit query integer false "Items per page" default(20) minimum(1) maximum(100)
+// @Success 200 {object} map[string]interface{} "Ledger entries retrieved successfully"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/billing/ledger [get]
+func (c *Controller) GetLedgerEntries(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_UNAUTHORIZED",
+				"message": "Authentication required",
+			},
+		})
+		return
+	}
+
 	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
 	if err != nil || page < 1 {
 		page = 1
@@ -277,13 +556,13 @@ func (c *Controller) GetBillingRecords(ctx *gin.Context) {
 		limit = 20
 	}
 
-	response, err := c.billingService.GetBillingRecords(ctx.Request.Context(), userID.(string), page, limit)
+	response, err := c.ledgerService.GetEntries(ctx.Request.Context(), userID.(string), page, limit)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_INTERNAL",
-				"message": "Failed to get billing records",
+				"message": "Failed to get ledger entries",
 			},
 		})
 		return
@@ -297,13 +576,17 @@ func (c *Controller) GetBillingRecords(ctx *gin.Context) {
 
 // CalculateCost godoc
 // @Summary Calculate cost
-// @Description Calculate cost for using a model with given token counts
+// @Description Calculate cost for using a model with given token counts. When a prompt
+// @Description (text, messages and/or tools) is posted, its input tokens are counted with
+// @Description the model's tokenizer instead of taken from input_tokens.
 // @Tags billing
+// @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param model_id query string true "Model ID"
 // @Param input_tokens query integer false "Input tokens" default(0) minimum(0)
 // @Param output_tokens query integer false "Output tokens" default(0) minimum(0)
+// @Param request body tokenizer.Prompt false "Prompt to count input tokens from"
 // @Success 200 {object} map[string]interface{} "Cost calculated successfully"
 // @Failure 400 {object} map[string]interface{} "Bad request - missing or invalid parameters"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
@@ -347,7 +630,27 @@ func (c *Controller) CalculateCost(ctx *gin.Context) {
 		return
 	}
 
-	calculation, err := c.billingService.CalculateCost(ctx.Request.Context(), modelID, inputTokens, outputTokens)
+	var prompt tokenizer.Prompt
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&prompt); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_BAD_REQUEST",
+					"message": "Invalid request body",
+					"details": err.Error(),
+				},
+			})
+			return
+		}
+	}
+
+	var calculation *service.CostCalculation
+	if prompt.Text != "" || len(prompt.Messages) > 0 || len(prompt.Tools) > 0 {
+		calculation, err = c.billingService.CalculatePromptCost(ctx.Request.Context(), modelID, &prompt, outputTokens)
+	} else {
+		calculation, err = c.billingService.CalculateCost(ctx.Request.Context(), modelID, inputTokens, outputTokens)
+	}
 	if err != nil {
 		status := http.StatusInternalServerError
 		errorCode := "ERR_INTERNAL"
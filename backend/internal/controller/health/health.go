@@ -1,10 +1,12 @@
 package health
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/service"
 	"massrouter.ai/backend/pkg/cache"
 	"massrouter.ai/backend/pkg/database"
 )
@@ -12,6 +14,7 @@ import (
 type Controller struct {
 	db        *database.Database
 	redis     *cache.RedisClient
+	breakers  service.CircuitBreakerService
 	startedAt time.Time
 }
 
@@ -19,6 +22,8 @@ type HealthStatus struct {
 	Status    string           `json:"status"`
 	Timestamp time.Time        `json:"timestamp"`
 	Checks    map[string]Check `json:"checks,omitempty"`
+
+	CircuitBreakers []*service.CircuitBreakerStatus `json:"circuit_breakers,omitempty"`
 }
 
 type Check struct {
@@ -27,10 +32,11 @@ type Check struct {
 	Error   string `json:"error,omitempty"`
 }
 
-func NewController(db *database.Database, redis *cache.RedisClient) *Controller {
+func NewController(db *database.Database, redis *cache.RedisClient, breakers service.CircuitBreakerService) *Controller {
 	return &Controller{
 		db:        db,
 		redis:     redis,
+		breakers:  breakers,
 		startedAt: time.Now(),
 	}
 }
@@ -85,6 +91,24 @@ func (c *Controller) HealthCheck(ctx *gin.Context) {
 		Latency: time.Since(c.startedAt).String(),
 	}
 
+	// Open breakers mean some provider keys are failing fast. Requests can
+	// still fail over to the others, so the system as a whole stays healthy.
+	status.CircuitBreakers = c.breakers.Snapshot()
+	open := 0
+	for _, breaker := range status.CircuitBreakers {
+		if breaker.State != service.BreakerStateClosed {
+			open++
+		}
+	}
+	if open > 0 {
+		status.Checks["upstream"] = Check{
+			Status: "degraded",
+			Error:  fmt.Sprintf("%d of %d circuit breakers open", open, len(status.CircuitBreakers)),
+		}
+	} else {
+		status.Checks["upstream"] = Check{Status: "healthy"}
+	}
+
 	if status.Status == "healthy" {
 		ctx.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"massrouter.ai/backend/internal/service"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type Controller struct {
@@ -174,13 +175,13 @@ func (c *Controller) SearchModels(ctx *gin.Context) {
 	}
 
 	if minPriceStr := ctx.Query("min_price"); minPriceStr != "" {
-		if minPrice, err := strconv.ParseFloat(minPriceStr, 64); err == nil {
+		if minPrice, err := money.Parse(minPriceStr); err == nil {
 			filters.MinPrice = minPrice
 		}
 	}
 
 	if maxPriceStr := ctx.Query("max_price"); maxPriceStr != "" {
-		if maxPrice, err := strconv.ParseFloat(maxPriceStr, 64); err == nil {
+		if maxPrice, err := money.Parse(maxPriceStr); err == nil {
 			filters.MaxPrice = maxPrice
 		}
 	}
@@ -266,3 +267,32 @@ func (c *Controller) GetModelCategories(ctx *gin.Context) {
 		},
 	})
 }
+
+// ListModelAliases godoc
+// @Summary List model aliases
+// @Description Get the aliases that can be requested in place of a model name, with the model each resolves to
+// @Tags model
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Aliases retrieved successfully"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /api/v1/models/aliases [get]
+func (c *Controller) ListModelAliases(ctx *gin.Context) {
+	aliases, err := c.modelService.ListModelAliases(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_INTERNAL",
+				"message": "Failed to get model aliases",
+			},
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"aliases": aliases,
+		},
+	})
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/model"
+)
+
+// DefaultAdapterType is used for providers whose config has no "type" key.
+// Most hosted models speak the OpenAI chat completions protocol.
+const DefaultAdapterType = "openai"
+
+// ProviderAdapter translates between the OpenAI chat completion format the
+// proxy exposes and a provider's native API.
+type ProviderAdapter interface {
+	// Type is the ModelProvider.Config "type" value that selects this adapter
+	Type() string
+
+	// BuildRequest creates the upstream HTTP request for a chat completion
+	BuildRequest(ctx context.Context, target *UpstreamTarget, req *ChatCompletionRequest) (*http.Request, error)
+
+	// ParseResponse converts a successful non-streaming response body into an
+	// OpenAI chat.completion body and extracts the token usage, if reported
+	ParseResponse(target *UpstreamTarget, body []byte) ([]byte, *Usage, error)
+
+	// NewStreamTranslator returns a translator for the streaming response to
+	// req
+	NewStreamTranslator(target *UpstreamTarget, req *ChatCompletionRequest) StreamTranslator
+
+	// MapError converts a non-2xx provider response into an OpenAI-style error
+	MapError(statusCode int, body []byte) *ProviderError
+}
+
+// StreamTranslator converts a provider's server-sent events into OpenAI
+// chat.completion.chunk payloads.
+type StreamTranslator interface {
+	// Translate returns zero or more chunk payloads for one provider event.
+	// done reports that the provider signalled the end of the stream.
+	Translate(event *SSEEvent) (chunks [][]byte, done bool, err error)
+}
+
+// UpstreamTarget identifies where and as what a request is sent upstream
+type UpstreamTarget struct {
+	Provider *model.ModelProvider
+	// Model is the provider's identifier for the model
+	Model string
+	// APIKey is the credential used to authenticate with the provider
+	APIKey string
+}
+
+// endpoint joins path onto the provider's base URL
+func (t *UpstreamTarget) endpoint(path string) string {
+	return strings.TrimSuffix(t.Provider.APIBaseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// ProviderError is an upstream failure expressed in the OpenAI error format
+type ProviderError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("provider error (%d): %s", e.StatusCode, e.Message)
+}
+
+// Body renders the error as an OpenAI error response body
+func (e *ProviderError) Body() gin.H {
+	body := gin.H{
+		"message": e.Message,
+		"type":    e.Type,
+	}
+	if e.Code != "" {
+		body["code"] = e.Code
+	}
+	return gin.H{"error": body}
+}
+
+// errorTypeForStatus returns the OpenAI error type matching an HTTP status
+func errorTypeForStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return "authentication_error"
+	case statusCode == http.StatusForbidden:
+		return "permission_error"
+	case statusCode == http.StatusNotFound:
+		return "not_found_error"
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case statusCode >= 500:
+		return "api_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// newProviderError builds a ProviderError, falling back to the raw body when
+// the provider did not supply a message
+func newProviderError(statusCode int, message, code string, body []byte) *ProviderError {
+	if message == "" {
+		message = strings.TrimSpace(string(body))
+	}
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return &ProviderError{
+		StatusCode: statusCode,
+		Type:       errorTypeForStatus(statusCode),
+		Code:       code,
+		Message:    message,
+	}
+}
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = make(map[string]ProviderAdapter)
+)
+
+// RegisterAdapter makes an adapter available under its Type. Registering the
+// same type twice replaces the earlier adapter.
+func RegisterAdapter(adapter ProviderAdapter) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	adapters[adapter.Type()] = adapter
+}
+
+// AdapterTypes lists the registered adapter types
+func AdapterTypes() []string {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+
+	types := make([]string, 0, len(adapters))
+	for t := range adapters {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// AdapterFor returns the adapter selected by the provider's config "type" key.
+// The display name is deliberately ignored so that renaming a provider never
+// changes how it is called.
+func AdapterFor(provider *model.ModelProvider) (ProviderAdapter, error) {
+	adapterType := DefaultAdapterType
+	if t, ok := provider.Config["type"].(string); ok && strings.TrimSpace(t) != "" {
+		adapterType = strings.ToLower(strings.TrimSpace(t))
+	}
+
+	adaptersMu.RLock()
+	adapter, ok := adapters[adapterType]
+	adaptersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider type: %s", adapterType)
+	}
+	return adapter, nil
+}
+
+func init() {
+	RegisterAdapter(&openAIAdapter{})
+	RegisterAdapter(&anthropicAdapter{})
+	RegisterAdapter(&geminiAdapter{})
+	RegisterAdapter(&cohereAdapter{})
+}
+
+// chunkBuilder produces the chat.completion.chunk payloads of one translated
+// stream, keeping the id and timestamp stable across chunks
+type chunkBuilder struct {
+	id      string
+	model   string
+	created int64
+}
+
+func newChunkBuilder(id, modelName string) *chunkBuilder {
+	if id == "" {
+		id = "chatcmpl-" + generateRequestID()
+	}
+	return &chunkBuilder{id: id, model: modelName, created: time.Now().Unix()}
+}
+
+func (b *chunkBuilder) delta(delta ChatCompletionDelta, finishReason *string) []byte {
+	return b.choiceDelta(0, delta, finishReason)
+}
+
+// choiceDelta produces a delta for one of several choices generated at once
+func (b *chunkBuilder) choiceDelta(index int, delta ChatCompletionDelta, finishReason *string) []byte {
+	return b.marshal([]ChatCompletionChunkChoice{
+		{Index: index, Delta: delta, FinishReason: finishReason},
+	}, nil)
+}
+
+// usage produces the trailing usage-only chunk sent when include_usage is set
+func (b *chunkBuilder) usage(usage *Usage) []byte {
+	return b.marshal([]ChatCompletionChunkChoice{}, usage)
+}
+
+func (b *chunkBuilder) marshal(choices []ChatCompletionChunkChoice, usage *Usage) []byte {
+	// Marshalling these plain structs cannot fail
+	data, _ := json.Marshal(&ChatCompletionChunk{
+		ID:      b.id,
+		Object:  "chat.completion.chunk",
+		Created: b.created,
+		Model:   b.model,
+		Choices: choices,
+		Usage:   usage,
+	})
+	return data
+}
@@ -0,0 +1,534 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// anthropicDefaultVersion is sent as the anthropic-version header unless
+	// the provider config sets "anthropic_version"
+	anthropicDefaultVersion = "2023-06-01"
+
+	// anthropicDefaultMaxTokens is used when the client omits max_tokens,
+	// which the Messages API requires
+	anthropicDefaultMaxTokens = 4096
+)
+
+// anthropicAdapter translates to Anthropic's Messages API
+type anthropicAdapter struct{}
+
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	System        string               `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Metadata      *anthropicMetadata   `json:"metadata,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of any type; only the fields relevant to
+// its type are set
+type anthropicBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image
+	Source *anthropicImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// promptTokens counts cached prompt tokens as input, since they are billed
+func (u anthropicUsage) promptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+func (a *anthropicAdapter) Type() string {
+	return "anthropic"
+}
+
+func (a *anthropicAdapter) BuildRequest(ctx context.Context, target *UpstreamTarget, req *ChatCompletionRequest) (*http.Request, error) {
+	upstreamReq, err := toAnthropicRequest(target.Model, req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(upstreamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target.endpoint("v1/messages"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	version := anthropicDefaultVersion
+	if v, ok := target.Provider.Config["anthropic_version"].(string); ok && v != "" {
+		version = v
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", target.APIKey)
+	httpReq.Header.Set("anthropic-version", version)
+	return httpReq, nil
+}
+
+// toAnthropicRequest converts an OpenAI chat request into a Messages request
+func toAnthropicRequest(modelName string, req *ChatCompletionRequest) (*anthropicRequest, error) {
+	out := &anthropicRequest{
+		Model:       modelName,
+		MaxTokens:   anthropicDefaultMaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	if limit := req.OutputTokenLimit(); limit != nil {
+		out.MaxTokens = *limit
+	}
+	if req.N != nil && *req.N > 1 {
+		return nil, fmt.Errorf("n > 1 is not supported by this provider")
+	}
+	if req.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: req.User}
+	}
+
+	stop, err := req.StopSequences()
+	if err != nil {
+		return nil, err
+	}
+	out.StopSequences = stop
+
+	var system []string
+	for _, msg := range req.Messages {
+		var (
+			role   string
+			blocks []anthropicBlock
+		)
+
+		switch msg.Role {
+		case "system", "developer":
+			// Anthropic takes the system prompt as a top-level field
+			system = append(system, msg.Content.String())
+			continue
+		case "user":
+			role = "user"
+			parts, err := anthropicContentBlocks(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			blocks = parts
+		case "assistant":
+			role = "assistant"
+			if text := msg.Content.String(); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+		case "tool":
+			// Tool results are sent back to Anthropic as user content
+			role = "user"
+			blocks = []anthropicBlock{{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content.String(),
+			}}
+		default:
+			return nil, fmt.Errorf("unsupported message role: %s", msg.Role)
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// The Messages API requires alternating roles, so consecutive messages
+		// from the same side (e.g. several tool results) are merged.
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+			continue
+		}
+		out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	if len(req.ToolChoice) > 0 {
+		choice, err := toAnthropicToolChoice(req.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		if choice.Type == "none" {
+			// Without tools there is nothing for the model to call
+			out.Tools = nil
+		} else {
+			out.ToolChoice = choice
+		}
+	}
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls && len(out.Tools) > 0 {
+		if out.ToolChoice == nil {
+			out.ToolChoice = &anthropicToolChoice{Type: "auto"}
+		}
+		out.ToolChoice.DisableParallelToolUse = true
+	}
+
+	return out, nil
+}
+
+// anthropicContentBlocks converts user message content into content blocks
+func anthropicContentBlocks(content MessageContent) ([]anthropicBlock, error) {
+	if content.Parts == nil {
+		if text := content.String(); text != "" {
+			return []anthropicBlock{{Type: "text", Text: text}}, nil
+		}
+		return nil, nil
+	}
+
+	blocks := make([]anthropicBlock, 0, len(content.Parts))
+	for _, part := range content.Parts {
+		switch part.Type {
+		case "text":
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+		case "image_url":
+			if part.ImageURL == nil {
+				return nil, fmt.Errorf("image_url part is missing its url")
+			}
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: anthropicImage(part.ImageURL.URL)})
+		default:
+			return nil, fmt.Errorf("unsupported content part type: %s", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// anthropicImage converts an image URL, which may be a base64 data URL, into
+// an image source
+func anthropicImage(url string) *anthropicImageSource {
+	if mediaType, data, ok := parseDataURL(url); ok {
+		return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	return &anthropicImageSource{Type: "url", URL: url}
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
+
+// toAnthropicToolChoice maps OpenAI's tool_choice onto Anthropic's
+func toAnthropicToolChoice(raw json.RawMessage) (*anthropicToolChoice, error) {
+	var mode string
+	if json.Unmarshal(raw, &mode) == nil {
+		switch mode {
+		case "auto":
+			return &anthropicToolChoice{Type: "auto"}, nil
+		case "required":
+			return &anthropicToolChoice{Type: "any"}, nil
+		case "none":
+			return &anthropicToolChoice{Type: "none"}, nil
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice: %s", mode)
+		}
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return nil, fmt.Errorf("invalid tool_choice")
+	}
+	return &anthropicToolChoice{Type: "tool", Name: named.Function.Name}, nil
+}
+
+func (a *anthropicAdapter) ParseResponse(target *UpstreamTarget, body []byte) ([]byte, *Usage, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	message := ChatCompletionMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			var args bytes.Buffer
+			if err := json.Compact(&args, block.Input); err != nil {
+				args.WriteString("{}")
+			}
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: FunctionCall{
+					Name:      block.Name,
+					Arguments: args.String(),
+				},
+			})
+		}
+	}
+	if text.Len() > 0 || len(message.ToolCalls) == 0 {
+		message.Content = NewTextContent(text.String())
+	}
+
+	usage := newUsage(resp.Usage.promptTokens(), resp.Usage.OutputTokens)
+	out, err := json.Marshal(&ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   target.Model,
+		Choices: []ChatCompletionChoice{
+			{
+				Index:        0,
+				Message:      message,
+				FinishReason: anthropicFinishReason(resp.StopReason),
+			},
+		},
+		Usage: usage,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, usage, nil
+}
+
+func (a *anthropicAdapter) NewStreamTranslator(target *UpstreamTarget, req *ChatCompletionRequest) StreamTranslator {
+	return &anthropicStreamTranslator{
+		chunks:     newChunkBuilder("", target.Model),
+		toolBlocks: make(map[int]int),
+	}
+}
+
+func (a *anthropicAdapter) MapError(statusCode int, body []byte) *ProviderError {
+	var resp struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	return newProviderError(statusCode, resp.Error.Message, resp.Error.Type, body)
+}
+
+// anthropicFinishReason maps a stop_reason onto OpenAI's finish_reason
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		// end_turn, stop_sequence and pause_turn
+		return "stop"
+	}
+}
+
+// anthropicStreamTranslator converts Messages API stream events
+type anthropicStreamTranslator struct {
+	chunks *chunkBuilder
+	usage  anthropicUsage
+	// toolBlocks maps content block indexes to OpenAI tool call indexes
+	toolBlocks map[int]int
+}
+
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message *struct {
+		ID    string         `json:"id"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock *anthropicBlock `json:"content_block"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (t *anthropicStreamTranslator) Translate(event *SSEEvent) ([][]byte, bool, error) {
+	if len(event.Data) == 0 {
+		return nil, false, nil
+	}
+
+	var e anthropicStreamEvent
+	if err := json.Unmarshal(event.Data, &e); err != nil {
+		return nil, false, fmt.Errorf("failed to decode anthropic stream event: %w", err)
+	}
+
+	switch e.Type {
+	case "message_start":
+		if e.Message != nil {
+			if e.Message.ID != "" {
+				t.chunks.id = e.Message.ID
+			}
+			t.usage = e.Message.Usage
+		}
+		return [][]byte{t.chunks.delta(ChatCompletionDelta{Role: "assistant"}, nil)}, false, nil
+
+	case "content_block_start":
+		if e.ContentBlock == nil || e.ContentBlock.Type != "tool_use" {
+			return nil, false, nil
+		}
+		index := len(t.toolBlocks)
+		t.toolBlocks[e.Index] = index
+		return [][]byte{t.chunks.delta(ChatCompletionDelta{
+			ToolCalls: []ToolCallDelta{{
+				Index:    index,
+				ID:       e.ContentBlock.ID,
+				Type:     "function",
+				Function: FunctionCallDelta{Name: e.ContentBlock.Name},
+			}},
+		}, nil)}, false, nil
+
+	case "content_block_delta":
+		if e.Delta == nil {
+			return nil, false, nil
+		}
+		switch e.Delta.Type {
+		case "text_delta":
+			return [][]byte{t.chunks.delta(ChatCompletionDelta{Content: e.Delta.Text}, nil)}, false, nil
+		case "input_json_delta":
+			index, ok := t.toolBlocks[e.Index]
+			if !ok || e.Delta.PartialJSON == "" {
+				return nil, false, nil
+			}
+			return [][]byte{t.chunks.delta(ChatCompletionDelta{
+				ToolCalls: []ToolCallDelta{{
+					Index:    index,
+					Function: FunctionCallDelta{Arguments: e.Delta.PartialJSON},
+				}},
+			}, nil)}, false, nil
+		}
+		return nil, false, nil
+
+	case "message_delta":
+		if e.Usage != nil {
+			t.usage.OutputTokens = e.Usage.OutputTokens
+		}
+		if e.Delta == nil || e.Delta.StopReason == "" {
+			return nil, false, nil
+		}
+		reason := anthropicFinishReason(e.Delta.StopReason)
+		return [][]byte{t.chunks.delta(ChatCompletionDelta{}, &reason)}, false, nil
+
+	case "message_stop":
+		usage := newUsage(t.usage.promptTokens(), t.usage.OutputTokens)
+		return [][]byte{t.chunks.usage(usage)}, true, nil
+
+	case "error":
+		if e.Error != nil {
+			return nil, true, fmt.Errorf("anthropic stream error (%s): %s", e.Error.Type, e.Error.Message)
+		}
+		return nil, true, fmt.Errorf("anthropic stream error")
+
+	default:
+		// ping and content_block_stop
+		return nil, false, nil
+	}
+}
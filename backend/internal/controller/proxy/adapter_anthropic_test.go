@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+// fakeAnthropic serves canned Messages API responses and records the last
+// request it received
+type fakeAnthropic struct {
+	t        *testing.T
+	response string
+	stream   string
+	lastReq  anthropicRequest
+	lastHdr  http.Header
+}
+
+func (f *fakeAnthropic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/messages" {
+		http.NotFound(w, r)
+		return
+	}
+	f.lastHdr = r.Header.Clone()
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &f.lastReq); err != nil {
+		f.t.Errorf("fake server got invalid JSON: %v", err)
+	}
+
+	if r.Header.Get("x-api-key") != "test-key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+		return
+	}
+
+	if f.lastReq.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, f.stream)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, f.response)
+}
+
+func newAnthropicTarget(baseURL, apiKey string) *UpstreamTarget {
+	return &UpstreamTarget{
+		Provider: &model.ModelProvider{
+			Name:       "Renamed Provider",
+			APIBaseURL: baseURL,
+			Config:     model.JSONB{"type": "anthropic"},
+		},
+		Model:  "claude-3-haiku",
+		APIKey: apiKey,
+	}
+}
+
+func doAnthropic(t *testing.T, target *UpstreamTarget, req *ChatCompletionRequest) *http.Response {
+	t.Helper()
+	adapter, err := AdapterFor(target.Provider)
+	if err != nil {
+		t.Fatalf("AdapterFor() error = %v", err)
+	}
+	httpReq, err := adapter.BuildRequest(context.Background(), target, req)
+	if err != nil {
+		t.Fatalf("BuildRequest() error = %v", err)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestAnthropicAdapter_Completion(t *testing.T) {
+	fake := &fakeAnthropic{t: t, response: `{
+		"id": "msg_01",
+		"type": "message",
+		"role": "assistant",
+		"content": [
+			{"type": "text", "text": "Let me check."},
+			{"type": "tool_use", "id": "toolu_01", "name": "get_weather", "input": {"city": "Paris"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 42, "output_tokens": 17}
+	}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(`{
+		"model": "claude-3-haiku",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "Weather in Paris?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "toolu_00", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "toolu_00", "content": "sunny"},
+			{"role": "user", "content": "And tomorrow?"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "required"
+	}`), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+
+	target := newAnthropicTarget(server.URL, "test-key")
+	resp := doAnthropic(t, target, &req)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	if got := fake.lastHdr.Get("anthropic-version"); got != anthropicDefaultVersion {
+		t.Errorf("anthropic-version = %q, want %q", got, anthropicDefaultVersion)
+	}
+	sent := fake.lastReq
+	if sent.System != "Be brief." {
+		t.Errorf("system = %q, want hoisted system prompt", sent.System)
+	}
+	if sent.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("max_tokens = %d, want default %d", sent.MaxTokens, anthropicDefaultMaxTokens)
+	}
+	if len(sent.Messages) != 3 {
+		t.Fatalf("sent %d messages, want 3 alternating messages", len(sent.Messages))
+	}
+	if img := sent.Messages[0].Content[1]; img.Type != "image" || img.Source == nil || img.Source.Type != "base64" || img.Source.MediaType != "image/png" {
+		t.Errorf("image block = %+v, want base64 image/png source", img)
+	}
+	if use := sent.Messages[1].Content[0]; use.Type != "tool_use" || use.ID != "toolu_00" || string(use.Input) != `{"city":"Paris"}` {
+		t.Errorf("tool_use block = %+v", use)
+	}
+	last := sent.Messages[2]
+	if last.Role != "user" || len(last.Content) != 2 || last.Content[0].Type != "tool_result" || last.Content[0].ToolUseID != "toolu_00" {
+		t.Errorf("tool result and follow-up should merge into one user message, got %+v", last)
+	}
+	if sent.ToolChoice == nil || sent.ToolChoice.Type != "any" {
+		t.Errorf("tool_choice = %+v, want any", sent.ToolChoice)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	out, usage, err := (&anthropicAdapter{}).ParseResponse(target, body)
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if usage == nil || usage.PromptTokens != 42 || usage.CompletionTokens != 17 || usage.TotalTokens != 59 {
+		t.Errorf("usage = %+v, want 42/17/59", usage)
+	}
+
+	var completion ChatCompletionResponse
+	if err := json.Unmarshal(out, &completion); err != nil {
+		t.Fatalf("translated response is not valid JSON: %v", err)
+	}
+	choice := completion.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", choice.FinishReason)
+	}
+	if choice.Message.Content.String() != "Let me check." {
+		t.Errorf("content = %q", choice.Message.Content.String())
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool_calls = %+v", choice.Message.ToolCalls)
+	}
+}
+
+func TestAnthropicAdapter_Stream(t *testing.T) {
+	fake := &fakeAnthropic{t: t, stream: strings.Join([]string{
+		"event: message_start",
+		`data: {"type":"message_start","message":{"id":"msg_02","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		"",
+		"event: content_block_start",
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		"",
+		"event: ping",
+		`data: {"type":"ping"}`,
+		"",
+		"event: content_block_delta",
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		"",
+		"event: content_block_delta",
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		"",
+		"event: content_block_start",
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_02","name":"lookup","input":{}}}`,
+		"",
+		"event: content_block_delta",
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		"",
+		"event: content_block_delta",
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+		"",
+		"event: message_delta",
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":9}}`,
+		"",
+		"event: message_stop",
+		`data: {"type":"message_stop"}`,
+		"",
+	}, "\n")}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	req := &ChatCompletionRequest{
+		Model:    "claude-3-haiku",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: NewTextContent("hi")}},
+		Stream:   true,
+	}
+	target := newAnthropicTarget(server.URL, "test-key")
+	resp := doAnthropic(t, target, req)
+	defer resp.Body.Close()
+
+	translator := (&anthropicAdapter{}).NewStreamTranslator(target, req)
+	reader := newSSEReader(resp.Body)
+
+	var (
+		content   strings.Builder
+		arguments strings.Builder
+		finish    string
+		usage     *Usage
+		done      bool
+	)
+	for !done {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+
+		var chunks [][]byte
+		chunks, done, err = translator.Translate(event)
+		if err != nil {
+			t.Fatalf("Translate() error = %v", err)
+		}
+		for _, data := range chunks {
+			var chunk ChatCompletionChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				t.Fatalf("chunk is not valid JSON: %v", err)
+			}
+			if chunk.ID != "msg_02" || chunk.Object != "chat.completion.chunk" {
+				t.Errorf("chunk id/object = %q/%q", chunk.ID, chunk.Object)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			for _, choice := range chunk.Choices {
+				content.WriteString(choice.Delta.Content)
+				for _, call := range choice.Delta.ToolCalls {
+					arguments.WriteString(call.Function.Arguments)
+				}
+				if choice.FinishReason != nil {
+					finish = *choice.FinishReason
+				}
+			}
+		}
+	}
+
+	if !done {
+		t.Error("stream ended without message_stop")
+	}
+	if content.String() != "Hello" {
+		t.Errorf("content = %q, want Hello", content.String())
+	}
+	if arguments.String() != `{"q":"x"}` {
+		t.Errorf("tool arguments = %q", arguments.String())
+	}
+	if finish != "stop" {
+		t.Errorf("finish_reason = %q, want stop", finish)
+	}
+	if usage == nil || usage.PromptTokens != 12 || usage.CompletionTokens != 9 {
+		t.Errorf("usage = %+v, want 12/9", usage)
+	}
+}
+
+func TestAnthropicAdapter_MapError(t *testing.T) {
+	server := httptest.NewServer(&fakeAnthropic{t: t})
+	defer server.Close()
+
+	req := &ChatCompletionRequest{
+		Model:    "claude-3-haiku",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: NewTextContent("hi")}},
+	}
+	resp := doAnthropic(t, newAnthropicTarget(server.URL, "wrong-key"), req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	perr := (&anthropicAdapter{}).MapError(resp.StatusCode, body)
+	if perr.StatusCode != http.StatusUnauthorized || perr.Type != "authentication_error" || perr.Message != "invalid x-api-key" {
+		t.Errorf("MapError() = %+v", perr)
+	}
+}
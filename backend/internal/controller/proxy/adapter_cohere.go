@@ -0,0 +1,323 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cohereAdapter translates to Cohere's v2 Chat API
+type cohereAdapter struct{}
+
+type cohereRequest struct {
+	Model            string                `json:"model"`
+	Messages         []cohereMessage       `json:"messages"`
+	Stream           bool                  `json:"stream,omitempty"`
+	MaxTokens        *int                  `json:"max_tokens,omitempty"`
+	Temperature      *float64              `json:"temperature,omitempty"`
+	P                *float64              `json:"p,omitempty"`
+	StopSequences    []string              `json:"stop_sequences,omitempty"`
+	Seed             *int64                `json:"seed,omitempty"`
+	PresencePenalty  *float64              `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64              `json:"frequency_penalty,omitempty"`
+	ResponseFormat   *cohereResponseFormat `json:"response_format,omitempty"`
+	// Cohere accepts tool definitions in the OpenAI shape
+	Tools      []Tool `json:"tools,omitempty"`
+	ToolChoice string `json:"tool_choice,omitempty"`
+}
+
+// cohereMessage uses the OpenAI shapes for content, tool calls and tool
+// results, which the v2 API shares
+type cohereMessage struct {
+	Role       string          `json:"role"`
+	Content    *MessageContent `json:"content,omitempty"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+type cohereResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema json.RawMessage `json:"json_schema,omitempty"`
+}
+
+type cohereResponse struct {
+	ID           string `json:"id"`
+	FinishReason string `json:"finish_reason"`
+	Message      struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		ToolCalls []ToolCall `json:"tool_calls"`
+	} `json:"message"`
+	Usage *cohereUsage `json:"usage"`
+}
+
+type cohereUsage struct {
+	BilledUnits *cohereTokens `json:"billed_units"`
+	Tokens      *cohereTokens `json:"tokens"`
+}
+
+type cohereTokens struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// toUsage prefers the billed units, which are what Cohere charges for
+func (u *cohereUsage) toUsage() *Usage {
+	if u == nil {
+		return nil
+	}
+	t := u.BilledUnits
+	if t == nil {
+		t = u.Tokens
+	}
+	if t == nil {
+		return nil
+	}
+	return newUsage(t.InputTokens, t.OutputTokens)
+}
+
+func (a *cohereAdapter) Type() string {
+	return "cohere"
+}
+
+func (a *cohereAdapter) BuildRequest(ctx context.Context, target *UpstreamTarget, req *ChatCompletionRequest) (*http.Request, error) {
+	upstreamReq, err := toCohereRequest(target.Model, req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(upstreamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target.endpoint("v2/chat"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+target.APIKey)
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	return httpReq, nil
+}
+
+// toCohereRequest converts an OpenAI chat request into a v2 chat request
+func toCohereRequest(modelName string, req *ChatCompletionRequest) (*cohereRequest, error) {
+	if req.N != nil && *req.N > 1 {
+		return nil, fmt.Errorf("n > 1 is not supported by this provider")
+	}
+	stop, err := req.StopSequences()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cohereRequest{
+		Model:            modelName,
+		Stream:           req.Stream,
+		MaxTokens:        req.OutputTokenLimit(),
+		Temperature:      req.Temperature,
+		P:                req.TopP,
+		StopSequences:    stop,
+		Seed:             req.Seed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Tools:            req.Tools,
+	}
+
+	for _, msg := range req.Messages {
+		m := cohereMessage{
+			Role:       msg.Role,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+		if msg.Role == "developer" {
+			m.Role = "system"
+		}
+		if !msg.Content.IsNull() {
+			content := msg.Content
+			m.Content = &content
+		}
+		out.Messages = append(out.Messages, m)
+	}
+
+	if len(req.ResponseFormat) > 0 {
+		var format struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		}
+		if err := json.Unmarshal(req.ResponseFormat, &format); err != nil {
+			return nil, fmt.Errorf("invalid response_format: %w", err)
+		}
+		switch format.Type {
+		case "json_object":
+			out.ResponseFormat = &cohereResponseFormat{Type: "json_object"}
+		case "json_schema":
+			out.ResponseFormat = &cohereResponseFormat{Type: "json_object", JSONSchema: format.JSONSchema.Schema}
+		}
+	}
+
+	if len(req.ToolChoice) > 0 {
+		var mode string
+		if err := json.Unmarshal(req.ToolChoice, &mode); err != nil {
+			return nil, fmt.Errorf("tool_choice naming a function is not supported by this provider")
+		}
+		switch mode {
+		case "auto":
+		case "required":
+			out.ToolChoice = "REQUIRED"
+		case "none":
+			out.ToolChoice = "NONE"
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice: %s", mode)
+		}
+	}
+
+	return out, nil
+}
+
+func (a *cohereAdapter) ParseResponse(target *UpstreamTarget, body []byte) ([]byte, *Usage, error) {
+	var resp cohereResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	var content strings.Builder
+	for _, part := range resp.Message.Content {
+		if part.Type == "text" {
+			content.WriteString(part.Text)
+		}
+	}
+
+	message := ChatCompletionMessage{Role: "assistant", ToolCalls: resp.Message.ToolCalls}
+	if content.Len() > 0 || len(message.ToolCalls) == 0 {
+		message.Content = NewTextContent(content.String())
+	}
+
+	usage := resp.Usage.toUsage()
+	out, err := json.Marshal(&ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   target.Model,
+		Choices: []ChatCompletionChoice{
+			{
+				Index:        0,
+				Message:      message,
+				FinishReason: cohereFinishReason(resp.FinishReason),
+			},
+		},
+		Usage: usage,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, usage, nil
+}
+
+func (a *cohereAdapter) NewStreamTranslator(target *UpstreamTarget, req *ChatCompletionRequest) StreamTranslator {
+	return &cohereStreamTranslator{chunks: newChunkBuilder("", target.Model)}
+}
+
+func (a *cohereAdapter) MapError(statusCode int, body []byte) *ProviderError {
+	var resp struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &resp)
+	return newProviderError(statusCode, resp.Message, "", body)
+}
+
+// cohereFinishReason maps a Cohere finish reason onto OpenAI's vocabulary
+func cohereFinishReason(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "TOOL_CALL":
+		return "tool_calls"
+	case "ERROR":
+		return "error"
+	default:
+		// COMPLETE and STOP_SEQUENCE
+		return "stop"
+	}
+}
+
+// cohereStreamTranslator converts Cohere v2 stream events
+type cohereStreamTranslator struct {
+	chunks *chunkBuilder
+}
+
+type cohereStreamEvent struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Delta struct {
+		Message struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			ToolCalls struct {
+				ID       string       `json:"id"`
+				Type     string       `json:"type"`
+				Function FunctionCall `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string       `json:"finish_reason"`
+		Usage        *cohereUsage `json:"usage"`
+	} `json:"delta"`
+}
+
+func (t *cohereStreamTranslator) Translate(event *SSEEvent) ([][]byte, bool, error) {
+	if len(event.Data) == 0 {
+		return nil, false, nil
+	}
+
+	var e cohereStreamEvent
+	if err := json.Unmarshal(event.Data, &e); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cohere stream event: %w", err)
+	}
+
+	switch e.Type {
+	case "message-start":
+		if e.ID != "" {
+			t.chunks.id = e.ID
+		}
+		return [][]byte{t.chunks.delta(ChatCompletionDelta{Role: "assistant"}, nil)}, false, nil
+	case "content-delta":
+		text := e.Delta.Message.Content.Text
+		if text == "" {
+			return nil, false, nil
+		}
+		return [][]byte{t.chunks.delta(ChatCompletionDelta{Content: text}, nil)}, false, nil
+	case "tool-call-start", "tool-call-delta":
+		call := e.Delta.Message.ToolCalls
+		delta := ToolCallDelta{
+			Index:    e.Index,
+			Function: FunctionCallDelta{Arguments: call.Function.Arguments},
+		}
+		if e.Type == "tool-call-start" {
+			delta.ID = call.ID
+			delta.Type = "function"
+			delta.Function.Name = call.Function.Name
+		}
+		return [][]byte{t.chunks.delta(ChatCompletionDelta{ToolCalls: []ToolCallDelta{delta}}, nil)}, false, nil
+	case "message-end":
+		reason := cohereFinishReason(e.Delta.FinishReason)
+		chunks := [][]byte{t.chunks.delta(ChatCompletionDelta{}, &reason)}
+		if usage := e.Delta.Usage.toUsage(); usage != nil {
+			chunks = append(chunks, t.chunks.usage(usage))
+		}
+		return chunks, true, nil
+	default:
+		return nil, false, nil
+	}
+}
@@ -0,0 +1,581 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// geminiDefaultAPIVersion is used unless the provider config sets "api_version"
+const geminiDefaultAPIVersion = "v1beta"
+
+// geminiAdapter translates to Google's Gemini generateContent API
+type geminiAdapter struct{}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is a part of any kind; exactly one field is set
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"topP,omitempty"`
+	MaxOutputTokens    *int            `json:"maxOutputTokens,omitempty"`
+	CandidateCount     *int            `json:"candidateCount,omitempty"`
+	StopSequences      []string        `json:"stopSequences,omitempty"`
+	PresencePenalty    *float64        `json:"presencePenalty,omitempty"`
+	FrequencyPenalty   *float64        `json:"frequencyPenalty,omitempty"`
+	Seed               *int64          `json:"seed,omitempty"`
+	ResponseLogprobs   bool            `json:"responseLogprobs,omitempty"`
+	Logprobs           *int            `json:"logprobs,omitempty"`
+	ResponseMimeType   string          `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema json.RawMessage `json:"responseJsonSchema,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiResponse struct {
+	ResponseID string            `json:"responseId"`
+	Candidates []geminiCandidate `json:"candidates"`
+	Usage      *geminiUsage      `json:"usageMetadata"`
+}
+
+type geminiCandidate struct {
+	Index        int           `json:"index"`
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+}
+
+// toUsage bills thinking tokens as output, which is how Google charges them
+func (u *geminiUsage) toUsage() *Usage {
+	if u == nil {
+		return nil
+	}
+	return newUsage(u.PromptTokenCount, u.CandidatesTokenCount+u.ThoughtsTokenCount)
+}
+
+func (a *geminiAdapter) Type() string {
+	return "gemini"
+}
+
+func (a *geminiAdapter) BuildRequest(ctx context.Context, target *UpstreamTarget, req *ChatCompletionRequest) (*http.Request, error) {
+	upstreamReq, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(upstreamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	version := geminiDefaultAPIVersion
+	if v, ok := target.Provider.Config["api_version"].(string); ok && v != "" {
+		version = v
+	}
+	modelPath := target.Model
+	if !strings.HasPrefix(modelPath, "models/") {
+		modelPath = "models/" + modelPath
+	}
+	url := target.endpoint(version + "/" + modelPath + ":generateContent")
+	if req.Stream {
+		url = target.endpoint(version + "/" + modelPath + ":streamGenerateContent?alt=sse")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	// The key goes in a header rather than the query string so that it never
+	// appears in logged or echoed URLs.
+	httpReq.Header.Set("x-goog-api-key", target.APIKey)
+	return httpReq, nil
+}
+
+// toGeminiRequest converts an OpenAI chat request into a generateContent request
+func toGeminiRequest(req *ChatCompletionRequest) (*geminiRequest, error) {
+	config, err := toGeminiGenerationConfig(req)
+	if err != nil {
+		return nil, err
+	}
+	out := &geminiRequest{GenerationConfig: config}
+
+	// Gemini answers function calls by name rather than by call id
+	toolNames := make(map[string]string)
+
+	var system []geminiPart
+	for _, msg := range req.Messages {
+		var (
+			role  string
+			parts []geminiPart
+		)
+
+		switch msg.Role {
+		case "system", "developer":
+			if text := msg.Content.String(); text != "" {
+				system = append(system, geminiPart{Text: text})
+			}
+			continue
+		case "user":
+			role = "user"
+			converted, err := geminiParts(msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			parts = converted
+		case "assistant":
+			role = "model"
+			if text := msg.Content.String(); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				args := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+		case "tool":
+			role = "user"
+			name, ok := toolNames[msg.ToolCallID]
+			if !ok {
+				return nil, fmt.Errorf("tool message references unknown tool_call_id: %s", msg.ToolCallID)
+			}
+			parts = []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: geminiFunctionResult(msg.Content.String()),
+			}}}
+		default:
+			return nil, fmt.Errorf("unsupported message role: %s", msg.Role)
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		// Merge consecutive turns from the same side, e.g. parallel tool results
+		if n := len(out.Contents); n > 0 && out.Contents[n-1].Role == role {
+			out.Contents[n-1].Parts = append(out.Contents[n-1].Parts, parts...)
+			continue
+		}
+		out.Contents = append(out.Contents, geminiContent{Role: role, Parts: parts})
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(req.Tools) > 0 {
+		tool := geminiTool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			})
+		}
+		out.Tools = []geminiTool{tool}
+	}
+
+	if len(req.ToolChoice) > 0 {
+		config, err := toGeminiToolConfig(req.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		out.ToolConfig = config
+	}
+
+	return out, nil
+}
+
+// toGeminiGenerationConfig collects the sampling and output parameters, or
+// returns nil when the request sets none of them
+func toGeminiGenerationConfig(req *ChatCompletionRequest) (*geminiGenerationConfig, error) {
+	stop, err := req.StopSequences()
+	if err != nil {
+		return nil, err
+	}
+
+	config := geminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxOutputTokens:  req.OutputTokenLimit(),
+		CandidateCount:   req.N,
+		StopSequences:    stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Seed:             req.Seed,
+		Logprobs:         req.TopLogprobs,
+	}
+	if req.Logprobs != nil && *req.Logprobs {
+		config.ResponseLogprobs = true
+	}
+
+	if len(req.ResponseFormat) > 0 {
+		var format struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		}
+		if err := json.Unmarshal(req.ResponseFormat, &format); err != nil {
+			return nil, fmt.Errorf("invalid response_format: %w", err)
+		}
+		switch format.Type {
+		case "json_object":
+			config.ResponseMimeType = "application/json"
+		case "json_schema":
+			config.ResponseMimeType = "application/json"
+			config.ResponseJSONSchema = format.JSONSchema.Schema
+		}
+	}
+
+	if reflect.ValueOf(config).IsZero() {
+		return nil, nil
+	}
+	return &config, nil
+}
+
+// geminiParts converts user message content into parts
+func geminiParts(content MessageContent) ([]geminiPart, error) {
+	if content.Parts == nil {
+		if text := content.String(); text != "" {
+			return []geminiPart{{Text: text}}, nil
+		}
+		return nil, nil
+	}
+
+	parts := make([]geminiPart, 0, len(content.Parts))
+	for _, part := range content.Parts {
+		switch part.Type {
+		case "text":
+			parts = append(parts, geminiPart{Text: part.Text})
+		case "image_url":
+			if part.ImageURL == nil {
+				return nil, fmt.Errorf("image_url part is missing its url")
+			}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}})
+			} else {
+				parts = append(parts, geminiPart{FileData: &geminiFileData{
+					MimeType: mime.TypeByExtension(path.Ext(part.ImageURL.URL)),
+					FileURI:  part.ImageURL.URL,
+				}})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content part type: %s", part.Type)
+		}
+	}
+	return parts, nil
+}
+
+// geminiFunctionResult wraps a tool result as the object Gemini expects,
+// passing JSON object results through unchanged
+func geminiFunctionResult(result string) json.RawMessage {
+	trimmed := strings.TrimSpace(result)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"content": result})
+	return wrapped
+}
+
+// toGeminiToolConfig maps OpenAI's tool_choice onto a function calling config
+func toGeminiToolConfig(raw json.RawMessage) (*geminiToolConfig, error) {
+	var mode string
+	if json.Unmarshal(raw, &mode) == nil {
+		switch mode {
+		case "auto":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "AUTO"}}, nil
+		case "required":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "ANY"}}, nil
+		case "none":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "NONE"}}, nil
+		default:
+			return nil, fmt.Errorf("unsupported tool_choice: %s", mode)
+		}
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return nil, fmt.Errorf("invalid tool_choice")
+	}
+	return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{
+		Mode:                 "ANY",
+		AllowedFunctionNames: []string{named.Function.Name},
+	}}, nil
+}
+
+func (a *geminiAdapter) ParseResponse(target *UpstreamTarget, body []byte) ([]byte, *Usage, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	id := resp.ResponseID
+	if id == "" {
+		id = "chatcmpl-" + generateRequestID()
+	}
+
+	choices := make([]ChatCompletionChoice, 0, len(resp.Candidates))
+	for _, candidate := range resp.Candidates {
+		message := ChatCompletionMessage{Role: "assistant"}
+		var text strings.Builder
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				message.ToolCalls = append(message.ToolCalls, geminiToolCall(part.FunctionCall, len(message.ToolCalls)))
+				continue
+			}
+			text.WriteString(part.Text)
+		}
+		if text.Len() > 0 || len(message.ToolCalls) == 0 {
+			message.Content = NewTextContent(text.String())
+		}
+		choices = append(choices, ChatCompletionChoice{
+			Index:        candidate.Index,
+			Message:      message,
+			FinishReason: geminiFinishReason(candidate.FinishReason, len(message.ToolCalls) > 0),
+		})
+	}
+
+	usage := resp.Usage.toUsage()
+	out, err := json.Marshal(&ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   target.Model,
+		Choices: choices,
+		Usage:   usage,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, usage, nil
+}
+
+// geminiToolCall converts a function call part. Gemini does not assign call
+// ids, so one is generated for the client to reference in its tool message.
+func geminiToolCall(call *geminiFunctionCall, index int) ToolCall {
+	args := "{}"
+	if len(call.Args) > 0 {
+		var compact bytes.Buffer
+		if json.Compact(&compact, call.Args) == nil {
+			args = compact.String()
+		}
+	}
+	return ToolCall{
+		ID:   fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), index),
+		Type: "function",
+		Function: FunctionCall{
+			Name:      call.Name,
+			Arguments: args,
+		},
+	}
+}
+
+func (a *geminiAdapter) NewStreamTranslator(target *UpstreamTarget, req *ChatCompletionRequest) StreamTranslator {
+	candidates := 1
+	if req.N != nil && *req.N > 1 {
+		candidates = *req.N
+	}
+	return &geminiStreamTranslator{
+		chunks:     newChunkBuilder("", target.Model),
+		candidates: make([]geminiStreamCandidate, candidates),
+	}
+}
+
+func (a *geminiAdapter) MapError(statusCode int, body []byte) *ProviderError {
+	// Error bodies are sometimes wrapped in a single-element array
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var list []json.RawMessage
+		if json.Unmarshal(trimmed, &list) == nil && len(list) > 0 {
+			trimmed = list[0]
+		}
+	}
+
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	json.Unmarshal(trimmed, &resp)
+	return newProviderError(statusCode, resp.Error.Message, resp.Error.Status, body)
+}
+
+// geminiFinishReason maps a Gemini finish reason onto OpenAI's vocabulary
+func geminiFinishReason(reason string, calledTools bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	default:
+		if calledTools {
+			return "tool_calls"
+		}
+		return "stop"
+	}
+}
+
+// geminiStreamTranslator converts streamGenerateContent events. Each event is
+// a partial GenerateContentResponse with parts of one or more candidates, each
+// of which carries a finish reason in its last event.
+type geminiStreamTranslator struct {
+	chunks     *chunkBuilder
+	started    bool
+	candidates []geminiStreamCandidate // One per choice requested
+	finished   int
+	usage      *geminiUsage
+}
+
+// geminiStreamCandidate tracks one candidate, streamed as the choice at its
+// index
+type geminiStreamCandidate struct {
+	started   bool
+	toolCalls int
+	finished  bool
+}
+
+func (t *geminiStreamTranslator) Translate(event *SSEEvent) ([][]byte, bool, error) {
+	if len(event.Data) == 0 {
+		return nil, false, nil
+	}
+
+	var resp geminiResponse
+	if err := json.Unmarshal(event.Data, &resp); err != nil {
+		return nil, false, fmt.Errorf("failed to decode gemini stream event: %w", err)
+	}
+	if resp.Usage != nil {
+		t.usage = resp.Usage
+	}
+	if !t.started {
+		t.started = true
+		if resp.ResponseID != "" {
+			t.chunks.id = resp.ResponseID
+		}
+	}
+
+	var chunks [][]byte
+	for _, candidate := range resp.Candidates {
+		if candidate.Index < 0 || candidate.Index >= len(t.candidates) {
+			return chunks, false, fmt.Errorf("gemini stream has unexpected candidate index %d", candidate.Index)
+		}
+		state := &t.candidates[candidate.Index]
+		if state.finished {
+			continue
+		}
+		if !state.started {
+			state.started = true
+			chunks = append(chunks, t.chunks.choiceDelta(candidate.Index, ChatCompletionDelta{Role: "assistant"}, nil))
+		}
+
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				call := geminiToolCall(part.FunctionCall, state.toolCalls)
+				chunks = append(chunks, t.chunks.choiceDelta(candidate.Index, ChatCompletionDelta{
+					ToolCalls: []ToolCallDelta{{
+						Index:    state.toolCalls,
+						ID:       call.ID,
+						Type:     call.Type,
+						Function: FunctionCallDelta{Name: call.Function.Name, Arguments: call.Function.Arguments},
+					}},
+				}, nil))
+				state.toolCalls++
+				continue
+			}
+			if part.Text != "" {
+				chunks = append(chunks, t.chunks.choiceDelta(candidate.Index, ChatCompletionDelta{Content: part.Text}, nil))
+			}
+		}
+
+		if candidate.FinishReason != "" {
+			reason := geminiFinishReason(candidate.FinishReason, state.toolCalls > 0)
+			chunks = append(chunks, t.chunks.choiceDelta(candidate.Index, ChatCompletionDelta{}, &reason))
+			state.finished = true
+			t.finished++
+		}
+	}
+
+	// The stream is over once every candidate has finished
+	done := t.finished == len(t.candidates)
+	if done {
+		if usage := t.usage.toUsage(); usage != nil {
+			chunks = append(chunks, t.chunks.usage(usage))
+		}
+	}
+	return chunks, done, nil
+}
@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+// fakeGemini serves canned generateContent responses and records the last
+// request it received
+type fakeGemini struct {
+	t        *testing.T
+	response string
+	stream   string
+	lastReq  geminiRequest
+	lastURL  string
+	lastHdr  http.Header
+}
+
+func (f *fakeGemini) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lastURL = r.URL.String()
+	f.lastHdr = r.Header.Clone()
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &f.lastReq); err != nil {
+		f.t.Errorf("fake server got invalid JSON: %v", err)
+	}
+
+	if r.Header.Get("x-goog-api-key") != "test-key" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `[{"error":{"code":400,"message":"API key not valid.","status":"INVALID_ARGUMENT"}}]`)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1beta/models/gemini-2.0-flash:generateContent":
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, f.response)
+	case "/v1beta/models/gemini-2.0-flash:streamGenerateContent":
+		if r.URL.Query().Get("alt") != "sse" {
+			f.t.Errorf("stream requested without alt=sse: %s", f.lastURL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, f.stream)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newGeminiTarget(baseURL, apiKey string) *UpstreamTarget {
+	return &UpstreamTarget{
+		Provider: &model.ModelProvider{
+			Name:       "Renamed Provider",
+			APIBaseURL: baseURL,
+			Config:     model.JSONB{"type": "gemini"},
+		},
+		Model:  "gemini-2.0-flash",
+		APIKey: apiKey,
+	}
+}
+
+func doGemini(t *testing.T, target *UpstreamTarget, req *ChatCompletionRequest) *http.Response {
+	t.Helper()
+	adapter, err := AdapterFor(target.Provider)
+	if err != nil {
+		t.Fatalf("AdapterFor() error = %v", err)
+	}
+	httpReq, err := adapter.BuildRequest(context.Background(), target, req)
+	if err != nil {
+		t.Fatalf("BuildRequest() error = %v", err)
+	}
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestGeminiAdapter_Completion(t *testing.T) {
+	fake := &fakeGemini{t: t, response: `{
+		"responseId": "resp_01",
+		"candidates": [{
+			"index": 0,
+			"content": {"role": "model", "parts": [
+				{"text": "Let me check."},
+				{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}
+			]},
+			"finishReason": "STOP"
+		}],
+		"usageMetadata": {"promptTokenCount": 42, "candidatesTokenCount": 17, "thoughtsTokenCount": 5}
+	}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(`{
+		"model": "gemini-2.0-flash",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [
+				{"type": "text", "text": "Weather in Paris?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_00", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_00", "content": "sunny"},
+			{"role": "user", "content": "And tomorrow?"}
+		],
+		"temperature": 0.5,
+		"max_tokens": 256,
+		"stop": "END",
+		"response_format": {"type": "json_object"},
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "required"
+	}`), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+
+	target := newGeminiTarget(server.URL, "test-key")
+	resp := doGemini(t, target, &req)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	if got := fake.lastHdr.Get("x-goog-api-key"); got != "test-key" {
+		t.Errorf("x-goog-api-key = %q, want the provider key", got)
+	}
+	if strings.Contains(fake.lastURL, "key=") {
+		t.Errorf("API key leaked into the URL: %s", fake.lastURL)
+	}
+	sent := fake.lastReq
+	if sent.SystemInstruction == nil || len(sent.SystemInstruction.Parts) != 1 || sent.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("systemInstruction = %+v, want hoisted system prompt", sent.SystemInstruction)
+	}
+	if len(sent.Contents) != 3 {
+		t.Fatalf("sent %d contents, want 3 alternating turns", len(sent.Contents))
+	}
+	if img := sent.Contents[0].Parts[1]; img.InlineData == nil || img.InlineData.MimeType != "image/png" || img.InlineData.Data != "iVBORw0KGgo=" {
+		t.Errorf("image part = %+v, want inline image/png data", img)
+	}
+	if call := sent.Contents[1]; call.Role != "model" || call.Parts[0].FunctionCall == nil || call.Parts[0].FunctionCall.Name != "get_weather" {
+		t.Errorf("function call turn = %+v", call)
+	}
+	last := sent.Contents[2]
+	if last.Role != "user" || len(last.Parts) != 2 || last.Parts[0].FunctionResponse == nil || string(last.Parts[0].FunctionResponse.Response) != `{"content":"sunny"}` {
+		t.Errorf("tool result and follow-up should merge into one user turn, got %+v", last)
+	}
+
+	config := sent.GenerationConfig
+	if config == nil || config.Temperature == nil || *config.Temperature != 0.5 || config.MaxOutputTokens == nil || *config.MaxOutputTokens != 256 {
+		t.Fatalf("generationConfig = %+v, want temperature 0.5 and maxOutputTokens 256", config)
+	}
+	if len(config.StopSequences) != 1 || config.StopSequences[0] != "END" || config.ResponseMimeType != "application/json" {
+		t.Errorf("generationConfig = %+v, want stop END and JSON output", config)
+	}
+	if sent.ToolConfig == nil || sent.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+		t.Errorf("toolConfig = %+v, want ANY", sent.ToolConfig)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	out, usage, err := (&geminiAdapter{}).ParseResponse(target, body)
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	// Thinking tokens are billed as output
+	if usage == nil || usage.PromptTokens != 42 || usage.CompletionTokens != 22 || usage.TotalTokens != 64 {
+		t.Errorf("usage = %+v, want 42/22/64", usage)
+	}
+
+	var completion ChatCompletionResponse
+	if err := json.Unmarshal(out, &completion); err != nil {
+		t.Fatalf("translated response is not valid JSON: %v", err)
+	}
+	if completion.ID != "resp_01" {
+		t.Errorf("id = %q, want resp_01", completion.ID)
+	}
+	choice := completion.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", choice.FinishReason)
+	}
+	if choice.Message.Content.String() != "Let me check." {
+		t.Errorf("content = %q", choice.Message.Content.String())
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool_calls = %+v", choice.Message.ToolCalls)
+	}
+}
+
+func TestGeminiAdapter_Stream(t *testing.T) {
+	// Two candidates, the first finishing before the second
+	fake := &fakeGemini{t: t, stream: strings.Join([]string{
+		`data: {"responseId":"resp_02","candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"Hel"}]}},{"index":1,"content":{"role":"model","parts":[{"text":"Hi"}]}}]}`,
+		"",
+		`data: {"responseId":"resp_02","candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"STOP"}]}`,
+		"",
+		`data: {"responseId":"resp_02","candidates":[{"index":1,"content":{"role":"model","parts":[{"functionCall":{"name":"lookup","args":{"q":"x"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":9}}`,
+		"",
+	}, "\n")}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	n := 2
+	req := &ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: NewTextContent("hi")}},
+		N:        &n,
+		Stream:   true,
+	}
+	target := newGeminiTarget(server.URL, "test-key")
+	resp := doGemini(t, target, req)
+	defer resp.Body.Close()
+	if fake.lastReq.GenerationConfig == nil || fake.lastReq.GenerationConfig.CandidateCount == nil || *fake.lastReq.GenerationConfig.CandidateCount != 2 {
+		t.Errorf("generationConfig = %+v, want candidateCount 2", fake.lastReq.GenerationConfig)
+	}
+
+	translator := (&geminiAdapter{}).NewStreamTranslator(target, req)
+	reader := newSSEReader(resp.Body)
+
+	var (
+		content   [2]strings.Builder
+		toolCalls [2][]ToolCallDelta
+		finish    [2]string
+		usage     *Usage
+		done      bool
+	)
+	for events := 0; !done; events++ {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+
+		var chunks [][]byte
+		chunks, done, err = translator.Translate(event)
+		if err != nil {
+			t.Fatalf("Translate() error = %v", err)
+		}
+		if done && events != 2 {
+			t.Errorf("stream ended at event %d, before every candidate finished", events)
+		}
+		for _, data := range chunks {
+			var chunk ChatCompletionChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				t.Fatalf("chunk is not valid JSON: %v", err)
+			}
+			if chunk.ID != "resp_02" || chunk.Object != "chat.completion.chunk" {
+				t.Errorf("chunk id/object = %q/%q", chunk.ID, chunk.Object)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			for _, choice := range chunk.Choices {
+				content[choice.Index].WriteString(choice.Delta.Content)
+				toolCalls[choice.Index] = append(toolCalls[choice.Index], choice.Delta.ToolCalls...)
+				if choice.FinishReason != nil {
+					finish[choice.Index] = *choice.FinishReason
+				}
+			}
+		}
+	}
+
+	if !done {
+		t.Error("stream ended without every candidate finishing")
+	}
+	if content[0].String() != "Hello" || content[1].String() != "Hi" {
+		t.Errorf("content = %q/%q, want Hello/Hi", content[0].String(), content[1].String())
+	}
+	if len(toolCalls[0]) != 0 || len(toolCalls[1]) != 1 || toolCalls[1][0].Index != 0 || toolCalls[1][0].Function.Arguments != `{"q":"x"}` {
+		t.Errorf("tool calls = %+v, want one call on the second choice", toolCalls)
+	}
+	if finish[0] != "stop" || finish[1] != "tool_calls" {
+		t.Errorf("finish_reason = %q/%q, want stop/tool_calls", finish[0], finish[1])
+	}
+	if usage == nil || usage.PromptTokens != 12 || usage.CompletionTokens != 9 {
+		t.Errorf("usage = %+v, want 12/9", usage)
+	}
+}
+
+func TestGeminiAdapter_MapError(t *testing.T) {
+	server := httptest.NewServer(&fakeGemini{t: t})
+	defer server.Close()
+
+	req := &ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: NewTextContent("hi")}},
+	}
+	resp := doGemini(t, newGeminiTarget(server.URL, "wrong-key"), req)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	perr := (&geminiAdapter{}).MapError(resp.StatusCode, body)
+	if perr.StatusCode != http.StatusBadRequest || perr.Code != "INVALID_ARGUMENT" || perr.Message != "API key not valid." {
+		t.Errorf("MapError() = %+v", perr)
+	}
+}
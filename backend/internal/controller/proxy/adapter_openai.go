@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// openAIAdapter speaks the OpenAI chat completions protocol, which is also
+// served by many other vendors and self-hosted gateways. Responses are passed
+// through unchanged.
+type openAIAdapter struct{}
+
+func (a *openAIAdapter) Type() string {
+	return "openai"
+}
+
+func (a *openAIAdapter) BuildRequest(ctx context.Context, target *UpstreamTarget, req *ChatCompletionRequest) (*http.Request, error) {
+	upstreamReq := *req
+	upstreamReq.Model = target.Model
+	// Always ask for the final usage chunk on streams so billing can use the
+	// provider's counts; the relay hides it from clients that didn't ask.
+	if req.Stream {
+		upstreamReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	body, err := json.Marshal(&upstreamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target.endpoint("chat/completions"), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+target.APIKey)
+	return httpReq, nil
+}
+
+func (a *openAIAdapter) ParseResponse(target *UpstreamTarget, body []byte) ([]byte, *Usage, error) {
+	var resp struct {
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, nil, err
+	}
+	return body, resp.Usage, nil
+}
+
+func (a *openAIAdapter) NewStreamTranslator(target *UpstreamTarget, req *ChatCompletionRequest) StreamTranslator {
+	return openAIStreamTranslator{}
+}
+
+func (a *openAIAdapter) MapError(statusCode int, body []byte) *ProviderError {
+	var resp struct {
+		Error struct {
+			Message string      `json:"message"`
+			Type    string      `json:"type"`
+			Code    interface{} `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+
+	perr := newProviderError(statusCode, resp.Error.Message, "", body)
+	if resp.Error.Type != "" {
+		perr.Type = resp.Error.Type
+	}
+	if code, ok := resp.Error.Code.(string); ok {
+		perr.Code = code
+	}
+	return perr
+}
+
+// openAIStreamTranslator forwards chunks as they are
+type openAIStreamTranslator struct{}
+
+func (openAIStreamTranslator) Translate(event *SSEEvent) ([][]byte, bool, error) {
+	if bytes.Equal(event.Data, sseDone) {
+		return nil, true, nil
+	}
+	if len(event.Data) == 0 {
+		return nil, false, nil
+	}
+	return [][]byte{event.Data}, false, nil
+}
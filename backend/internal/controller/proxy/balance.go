@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
+)
+
+// balanceHold is the balance reserved for a call. Once the call is billed,
+// billing settles the hold; otherwise it must be released.
+type balanceHold struct {
+	userID string
+	id     string // Empty when no hold was placed
+	billed bool
+}
+
+// releaseHold releases the hold of a call that was not billed
+func (c *Controller) releaseHold(ginCtx *gin.Context, hold *balanceHold) {
+	if hold.billed || hold.id == "" {
+		return
+	}
+	ctx := context.WithoutCancel(ginCtx.Request.Context())
+	if err := c.billingService.ReleaseBalance(ctx, hold.userID, hold.id); err != nil {
+		// The hold expires on its own
+		fmt.Printf("Failed to release balance hold: %v\n", err)
+	}
+}
+
+// maxCost is the cost of a call at the priciest of the deployments it may
+// fail over to
+func (c *Controller) maxCost(ctx context.Context, modelObj *model.Model, deployments []*model.ModelDeployment, inputTokens, outputTokens int) (money.Amount, error) {
+	var highest money.Amount
+	for _, deployment := range deployments {
+		cost, err := c.billingService.CalculateDeploymentCost(ctx, modelObj, deployment, inputTokens, outputTokens)
+		if err != nil {
+			return 0, err
+		}
+		highest = max(highest, cost.TotalCost)
+	}
+	return highest, nil
+}
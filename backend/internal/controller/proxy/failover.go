@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/model"
+)
+
+// upstreamCall is a provider response together with the deployment and
+// credential that produced it
+type upstreamCall struct {
+	deployment *model.ModelDeployment
+	credential *model.ProviderCredential
+	adapter    ProviderAdapter
+	target     *UpstreamTarget
+	resp       *http.Response
+}
+
+// upstreamFailure is the response sent to the client when no deployment
+// produced a usable response
+type upstreamFailure struct {
+	status int
+	body   gin.H
+}
+
+func newUpstreamFailure(status int, code, message, details string) *upstreamFailure {
+	return &upstreamFailure{
+		status: status,
+		body: gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    code,
+				"message": message,
+				"details": details,
+			},
+		},
+	}
+}
+
+// callUpstream sends the request to each deployment in turn until one answers
+// with a response that is not worth retrying elsewhere. Within a deployment,
+// a key that is rate limited or rejected upstream is swapped for another of
+// the provider's keys, and keys whose circuit breaker is open are skipped.
+// Connection failures and server errors are retried on the same key with
+// backoff while the request's retry budget lasts; after that the deployment
+// is skipped. If all deployments fail, the last failure is returned.
+func (c *Controller) callUpstream(ctx *gin.Context, req *ChatCompletionRequest, modelObj *model.Model, deployments []*model.ModelDeployment) (*upstreamCall, *upstreamFailure) {
+	retries := 0
+	failure := newUpstreamFailure(http.StatusInternalServerError, "ERR_500", "Model provider not found", "")
+	for _, deployment := range deployments {
+		provider := &deployment.Provider
+
+		// Select the adapter that speaks this provider's API
+		adapter, err := AdapterFor(provider)
+		if err != nil {
+			failure = newUpstreamFailure(http.StatusInternalServerError, "ERR_500", "Model provider not supported", err.Error())
+			continue
+		}
+
+		// Calls share the provider's connection pool
+		client, err := c.clients.get(provider)
+		if err != nil {
+			failure = newUpstreamFailure(http.StatusInternalServerError, "ERR_500", "Model provider misconfigured", err.Error())
+			continue
+		}
+
+		// A key that was rate limited with a short Retry-After is waited for
+		// once the provider's other keys are spent
+		var limited *model.ProviderCredential
+		var limitedFor time.Duration
+
+		tried := make(map[string]bool)
+	credentials:
+		for {
+			credential, err := c.credentialService.Acquire(ctx.Request.Context(), provider, tried)
+			if err != nil {
+				failure = newUpstreamFailure(http.StatusInternalServerError, "ERR_500", "Failed to select provider credential", err.Error())
+				break
+			}
+			if credential == nil {
+				if limited != nil && retries < c.retry.MaxRetries {
+					retries++
+					if sleep(ctx.Request.Context(), limitedFor) != nil {
+						return nil, failure
+					}
+					delete(tried, limited.ID)
+					limited = nil
+					continue
+				}
+				if len(tried) == 0 {
+					failure = noCredentialFailure(provider)
+				}
+				break
+			}
+			tried[credential.ID] = true
+
+			if !c.breakers.Allow(provider, credential) {
+				failure = newUpstreamFailure(http.StatusServiceUnavailable, "ERR_503", "Provider temporarily unavailable",
+					fmt.Sprintf("Circuit breaker open for provider %s after repeated failures", provider.Name))
+				continue
+			}
+
+			target := &UpstreamTarget{
+				Provider: provider,
+				Model:    deployment.UpstreamModelName(modelObj),
+				APIKey:   credential.APIKey,
+			}
+
+			for {
+				// The request context is cancelled when the client disconnects,
+				// which also aborts the upstream call.
+				providerReq, err := adapter.BuildRequest(ctx.Request.Context(), target, req)
+				if err != nil {
+					// Translation fails on requests the provider's API cannot express
+					failure = newUpstreamFailure(http.StatusBadRequest, "ERR_400", "Request not supported by model provider", err.Error())
+					break credentials
+				}
+
+				resp, err := client.do(providerReq, req.Stream)
+				if err != nil {
+					failure = newUpstreamFailure(http.StatusBadGateway, "ERR_502", "Provider request failed", err.Error())
+					if ctx.Request.Context().Err() != nil {
+						// The client has gone; there is no one left to fail over for
+						return nil, failure
+					}
+					c.breakers.RecordFailure(provider, credential, err.Error())
+
+					// Only a connection that was never made is safe to retry; a
+					// request that may have reached the provider goes elsewhere
+					if isConnectError(err) && c.backOff(ctx.Request.Context(), &retries, provider, credential, 0) {
+						fmt.Printf("Provider %s unreachable for model %s, retrying: %v\n", provider.Name, modelObj.Name, err)
+						continue
+					}
+					fmt.Printf("Provider %s failed for model %s, failing over: %v\n", provider.Name, modelObj.Name, err)
+					break credentials
+				}
+
+				if err := c.credentialService.ReportResponse(ctx.Request.Context(), credential, resp.StatusCode, retryAfter(resp.Header)); err != nil {
+					fmt.Printf("Failed to update credential %s of provider %s: %v\n", credential.MaskedKey, provider.Name, err)
+				}
+				if resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout {
+					c.breakers.RecordFailure(provider, credential, fmt.Sprintf("upstream returned %d", resp.StatusCode))
+				} else {
+					c.breakers.RecordSuccess(provider, credential)
+				}
+
+				if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusUnauthorized || isRetryableStatus(resp.StatusCode) {
+					body, _ := io.ReadAll(resp.Body)
+					resp.Body.Close()
+					perr := adapter.MapError(resp.StatusCode, body)
+					failure = &upstreamFailure{status: perr.StatusCode, body: perr.Body()}
+
+					// Rate limits and rejected keys are specific to the key, so
+					// another key of the same provider may still succeed
+					if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusUnauthorized {
+						if wait := retryAfter(resp.Header); resp.StatusCode == http.StatusTooManyRequests && wait > 0 && wait <= c.retry.MaxDelay {
+							limited, limitedFor = credential, wait
+						}
+						fmt.Printf("Provider %s returned %d for credential %s, trying another\n", provider.Name, resp.StatusCode, credential.MaskedKey)
+						continue credentials
+					}
+					if c.backOff(ctx.Request.Context(), &retries, provider, credential, retryAfter(resp.Header)) {
+						fmt.Printf("Provider %s returned %d for model %s, retrying\n", provider.Name, resp.StatusCode, modelObj.Name)
+						continue
+					}
+					fmt.Printf("Provider %s returned %d for model %s, failing over\n", provider.Name, resp.StatusCode, modelObj.Name)
+					break credentials
+				}
+
+				return &upstreamCall{
+					deployment: deployment,
+					credential: credential,
+					adapter:    adapter,
+					target:     target,
+					resp:       resp,
+				}, nil
+			}
+		}
+	}
+
+	return nil, failure
+}
+
+// backOff waits before a key is called again after a transient failure. It
+// reports false, without waiting, when the request has no retries left, the
+// key's breaker has opened, or the upstream asked for a longer wait than the
+// retry policy allows.
+func (c *Controller) backOff(ctx context.Context, retries *int, provider *model.ModelProvider, credential *model.ProviderCredential, requested time.Duration) bool {
+	if *retries >= c.retry.MaxRetries || requested > c.retry.MaxDelay || !c.breakers.Allow(provider, credential) {
+		return false
+	}
+
+	wait := c.retry.Backoff(*retries)
+	if requested > wait {
+		wait = requested
+	}
+	*retries++
+	return sleep(ctx, wait) == nil
+}
+
+// noCredentialFailure describes a provider none of whose keys could be used
+func noCredentialFailure(provider *model.ModelProvider) *upstreamFailure {
+	if len(provider.Credentials) == 0 {
+		return newUpstreamFailure(http.StatusServiceUnavailable, "ERR_503", "Provider not configured",
+			fmt.Sprintf("API key not configured for provider: %s", provider.Name))
+	}
+	// Every key is cooling down or has spent its per-minute budget
+	return newUpstreamFailure(http.StatusTooManyRequests, "ERR_429", "Provider capacity exhausted",
+		fmt.Sprintf("All API keys for provider %s are rate limited", provider.Name))
+}
+
+// retryAfter reads a Retry-After header given in seconds
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// isRetryableStatus reports whether another deployment might succeed where
+// this response failed: overload, rate limiting and server errors
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= 500
+}
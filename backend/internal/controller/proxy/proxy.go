@@ -1,8 +1,8 @@
 package proxy
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,45 +11,47 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"massrouter.ai/backend/internal/middleware"
 	"massrouter.ai/backend/internal/model"
 	"massrouter.ai/backend/internal/service"
+	"massrouter.ai/backend/pkg/tokenizer"
+	"massrouter.ai/backend/pkg/utils"
 )
 
 type Controller struct {
-	modelService   service.ModelService
-	billingService service.BillingService
-	quotaService   service.QuotaService
-	validator      *validator.Validate
+	billingService    service.BillingService
+	quotaService      service.QuotaService
+	apiKeyPolicy      service.APIKeyPolicyService
+	routingService    service.RoutingService
+	credentialService service.CredentialService
+	breakers          service.CircuitBreakerService
+	retry             RetryPolicy
+	clients           *providerClients
+	validator         *validator.Validate
 }
 
 func NewController(
-	modelService service.ModelService,
 	billingService service.BillingService,
 	quotaService service.QuotaService,
+	apiKeyPolicy service.APIKeyPolicyService,
+	routingService service.RoutingService,
+	credentialService service.CredentialService,
+	breakers service.CircuitBreakerService,
+	retry RetryPolicy,
 ) *Controller {
 	return &Controller{
-		modelService:   modelService,
-		billingService: billingService,
-		quotaService:   quotaService,
-		validator:      validator.New(),
+		billingService:    billingService,
+		quotaService:      quotaService,
+		apiKeyPolicy:      apiKeyPolicy,
+		routingService:    routingService,
+		credentialService: credentialService,
+		breakers:          breakers,
+		retry:             retry,
+		clients:           newProviderClients(),
+		validator:         validator.New(),
 	}
 }
 
-// ChatCompletionRequest represents the OpenAI-compatible chat completion request
-type ChatCompletionRequest struct {
-	Model       string                  `json:"model" binding:"required"`
-	Messages    []ChatCompletionMessage `json:"messages" binding:"required"`
-	MaxTokens   *int                    `json:"max_tokens,omitempty"`
-	Temperature *float64                `json:"temperature,omitempty"`
-	TopP        *float64                `json:"top_p,omitempty"`
-	Stream      bool                    `json:"stream,omitempty"`
-}
-
-type ChatCompletionMessage struct {
-	Role    string `json:"role" binding:"required"`
-	Content string `json:"content" binding:"required"`
-}
-
 // ChatCompletion handles chat completion requests
 func (c *Controller) ChatCompletion(ctx *gin.Context) {
 	// Get user from context (set by auth middleware)
@@ -92,67 +94,163 @@ func (c *Controller) ChatCompletion(ctx *gin.Context) {
 		return
 	}
 
-	// Marshal request back to JSON for forwarding
-	requestBody, err := json.Marshal(req)
+	// The API key was resolved by the API key auth middleware
+	apiKeyID, _ := middleware.GetAPIKeyID(ctx)
+	apiKey, hasAPIKey := middleware.GetAPIKey(ctx)
+	apiKeyPrefix := ""
+	if hasAPIKey {
+		apiKeyPrefix = apiKey.Prefix
+	}
+
+	// Count the prompt with the tokenizer the requested name implies. Once
+	// routing settles the model, it is recounted if that model's differs.
+	prompt := req.prompt()
+	tok := tokenizer.ForModel(req.Model, "")
+	inputTokens := tok.CountPrompt(prompt)
+	outputTokens := 0
+	if limit := req.OutputTokenLimit(); limit != nil {
+		outputTokens = *limit
+	} else {
+		outputTokens = 100 // default
+	}
+	if req.N != nil && *req.N > 1 {
+		// Each choice is generated and billed separately
+		outputTokens *= *req.N
+	}
+
+	// Resolve the requested model, alias or routing rule to the deployments
+	// that can serve it
+	userRole, _ := middleware.GetRole(ctx)
+	routingReq := &model.RoutingRequest{
+		Model:        req.Model,
+		APIKeyID:     apiKeyID,
+		UserRole:     userRole,
+		HasTools:     len(req.Tools) > 0,
+		HasImages:    req.HasImages(),
+		JSONMode:     req.JSONMode(),
+		Stream:       req.Stream,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+	}
+	if req.Routing != nil {
+		routingReq.MaxInputPrice = req.Routing.MaxInputPrice
+		routingReq.MaxOutputPrice = req.Routing.MaxOutputPrice
+		routingReq.MaxLatencyMs = req.Routing.MaxLatencyMs
+	}
+	if hasAPIKey {
+		// Auto routing only considers models the key may use
+		routingReq.AllowModel = func(m *model.Model) bool {
+			return c.apiKeyPolicy.Permits(apiKey, m, model.ActionChat)
+		}
+	}
+	route, err := c.routingService.ResolveRoute(ctx, routingReq)
 	if err != nil {
+		if errors.Is(err, service.ErrNoCapableModel) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_422",
+					"message": "No model meets the request's requirements",
+					"details": err.Error(),
+				},
+			})
+			return
+		}
+
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_500",
-				"message": "Failed to marshal request",
+				"message": "Failed to resolve model",
 			},
 		})
 		return
 	}
 
-	// Get API key from header
-	apiKey := ctx.GetHeader("X-API-Key")
-	if apiKey == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code":    "ERR_400",
-				"message": "API key required",
-				"details": "Provide API key in X-API-Key header",
-			},
-		})
-		return
-	}
-
-	// Verify API key belongs to user and is active
-	// This would be done through a service call
-	// For now, we'll just log it
-	fmt.Printf("User %s using API key: %s\n", userID, apiKey[:min(8, len(apiKey))])
-
-	// Get model details by name (validate model exists and get provider info)
-	modelObj, provider, err := c.findModelByName(ctx, req.Model)
-	if err != nil {
+	if route == nil {
 		ctx.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_404",
 				"message": "Model not found",
-				"details": err.Error(),
+				"details": fmt.Sprintf("model not found: %s", req.Model),
 			},
 		})
 		return
 	}
+	modelObj := route.Model
+	primary := route.Deployments[0]
 
-	if provider == nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code":    "ERR_500",
-				"message": "Model provider not found",
-			},
-		})
-		return
+	if modelTok := tokenizer.ForModel(modelObj.Name, modelObj.TokenizerEncoding()); modelTok != tok {
+		tok = modelTok
+		inputTokens = tok.CountPrompt(prompt)
+	}
+
+	// Tell the client which model the request was routed to
+	ctx.Header("X-MassRouter-Model", modelObj.Name)
+
+	// Enforce the API key's permission set before anything reaches the
+	// provider. Unless the call's usage is recorded, what it reserved against
+	// the key's caps is given back on the way out.
+	keyUsage := &apiKeyHold{}
+	defer c.releaseAPIKeyUsage(ctx, keyUsage)
+	if hasAPIKey {
+		authz, err := c.apiKeyPolicy.Authorize(ctx, apiKey, modelObj, model.ActionChat, inputTokens+outputTokens)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_500",
+					"message": "Failed to check API key permissions",
+				},
+			})
+			return
+		}
+
+		if authz.MissingPermission != nil {
+			ctx.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":               "ERR_403",
+					"message":            "API key permission denied",
+					"details":            authz.Reason,
+					"missing_permission": authz.MissingPermission,
+				},
+			})
+			return
+		}
+
+		if !authz.Allowed {
+			ctx.JSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_429",
+					"message": "API key limit exceeded",
+					"details": authz.Reason,
+					"limit":   authz.ExceededLimit,
+					"limits": gin.H{
+						"monthly_requests": gin.H{
+							"used":  authz.MonthlyRequests,
+							"limit": authz.MonthlyRequestsLimit,
+						},
+						"monthly_tokens": gin.H{
+							"used":  authz.MonthlyTokens,
+							"limit": authz.MonthlyTokensLimit,
+						},
+					},
+					"next_reset": authz.NextReset,
+				},
+			})
+			return
+		}
+		keyUsage.reservation = authz.Reservation
 	}
 
 	// Check if provider has API key configured
 	// Development mode simulation for empty or test API keys
-	if gin.Mode() == gin.DebugMode && (provider.APIKey == "" || strings.HasPrefix(provider.APIKey, "sk-test-")) {
+	if provider := &primary.Provider; gin.Mode() == gin.DebugMode && !hasLiveAPIKey(provider) {
 		// Return simulated response for development
+		simulatedContent := fmt.Sprintf("This is a simulated response from %s in development mode. Model: %s", provider.Name, req.Model)
 		simulatedResponse := gin.H{
 			"id":      "chatcmpl-simulated-123",
 			"object":  "chat.completion",
@@ -163,7 +261,7 @@ func (c *Controller) ChatCompletion(ctx *gin.Context) {
 					"index": 0,
 					"message": gin.H{
 						"role":    "assistant",
-						"content": fmt.Sprintf("This is a simulated response from %s in development mode. Model: %s", provider.Name, req.Model),
+						"content": simulatedContent,
 					},
 					"finish_reason": "stop",
 				},
@@ -174,33 +272,16 @@ func (c *Controller) ChatCompletion(ctx *gin.Context) {
 				"total_tokens":      30,
 			},
 		}
+		if req.Stream {
+			writeSimulatedStream(ctx, req.Model, simulatedContent)
+			return
+		}
 		ctx.JSON(http.StatusOK, simulatedResponse)
 		return
 	}
 
-	if provider.APIKey == "" {
-		ctx.JSON(http.StatusServiceUnavailable, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code":    "ERR_503",
-				"message": "Provider not configured",
-				"details": fmt.Sprintf("API key not configured for provider: %s", provider.Name),
-			},
-		})
-		return
-	}
-
-	// Calculate token count (simplified)
-	inputTokens := estimateTokens(req.Messages)
-	outputTokens := 0
-	if req.MaxTokens != nil {
-		outputTokens = *req.MaxTokens
-	} else {
-		outputTokens = 100 // default
-	}
-
-	// Calculate cost
-	costResp, err := c.billingService.CalculateCost(ctx, modelObj.ID, inputTokens, outputTokens)
+	// Calculate cost, estimated at the rates of the first deployment
+	costResp, err := c.billingService.CalculateDeploymentCost(ctx, modelObj, primary, inputTokens, outputTokens)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -214,7 +295,7 @@ func (c *Controller) ChatCompletion(ctx *gin.Context) {
 
 	// Check quota limits
 	totalTokens := inputTokens + outputTokens
-	quotaCheck, err := c.quotaService.CheckQuota(ctx, userID.(string), totalTokens, costResp.TotalCost)
+	quotaCheck, err := c.quotaService.CheckQuota(ctx, userID.(string), modelObj.ID, totalTokens, costResp.TotalCost)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -265,14 +346,42 @@ func (c *Controller) ChatCompletion(ctx *gin.Context) {
 						"remaining": quotaCheck.MonthlyCostLimit - quotaCheck.MonthlyCost,
 					},
 				},
-				"next_reset": quotaCheck.NextReset,
+				"model_limit": quotaCheck.ModelLimit,
+				"next_reset":  quotaCheck.NextReset,
+			},
+		})
+		return
+	}
+
+	// Unless the call's usage is recorded, its quota is given back on the way out
+	quota := &quotaHold{reservation: quotaCheck.Reservation}
+	defer c.releaseQuota(ctx, quota)
+
+	// Without a limit from the client, the call may produce as much as the
+	// model allows
+	maxOutputTokens := outputTokens
+	if req.OutputTokenLimit() == nil && modelObj.MaxTokens != nil && *modelObj.MaxTokens > 0 {
+		maxOutputTokens = *modelObj.MaxTokens
+		if req.N != nil && *req.N > 1 {
+			maxOutputTokens *= *req.N
+		}
+	}
+
+	// Hold the most the call can cost before sending it, so that concurrent
+	// calls cannot together spend more than the balance
+	holdCost, err := c.maxCost(ctx, modelObj, route.Deployments, inputTokens, maxOutputTokens)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "ERR_500",
+				"message": "Failed to calculate cost",
 			},
 		})
 		return
 	}
 
-	// Check user balance
-	balance, err := c.billingService.GetBalance(ctx, userID.(string))
+	reservation, err := c.billingService.ReserveBalance(ctx, userID.(string), holdCost)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -284,223 +393,241 @@ func (c *Controller) ChatCompletion(ctx *gin.Context) {
 		return
 	}
 
-	if balance.Balance < costResp.TotalCost {
+	if !reservation.Allowed {
 		ctx.JSON(http.StatusPaymentRequired, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_402",
 				"message": "Insufficient balance",
-				"details": fmt.Sprintf("Required: %.6f, Available: %.2f", costResp.TotalCost, balance.Balance),
+				"details": fmt.Sprintf("Required: %s, Available: %s", holdCost, reservation.Available),
 			},
 		})
 		return
 	}
 
-	// Forward request to provider based on provider type
-	providerURL, authField, authValue := buildProviderRequestInfo(provider, modelObj.Name)
+	// Unless the call is billed, its hold is released on the way out
+	hold := &balanceHold{userID: userID.(string), id: reservation.HoldID}
+	defer c.releaseHold(ctx, hold)
+
+	// Send the request, failing over between deployments
+	started := time.Now()
+	call, failure := c.callUpstream(ctx, &req, modelObj, route.Deployments)
+	if failure != nil {
+		// Requests the provider cannot express say nothing about its health
+		if failure.status != http.StatusBadRequest {
+			if err := c.routingService.RecordOutcome(context.WithoutCancel(ctx.Request.Context()), modelObj.ID, 0, time.Since(started), false); err != nil {
+				fmt.Printf("Failed to record model outcome: %v\n", err)
+			}
+		}
+		ctx.JSON(failure.status, failure.body)
+		return
+	}
+	resp := call.resp
+	defer resp.Body.Close()
+
+	usage := &usageRecord{
+		userID:       userID.(string),
+		model:        modelObj,
+		requested:    req.Model,
+		route:        route,
+		latency:      time.Since(started),
+		deployment:   call.deployment,
+		credential:   call.credential,
+		provider:     &call.deployment.Provider,
+		apiKeyID:     apiKeyID,
+		apiKeyPrefix: apiKeyPrefix,
+		tokenizer:    tok,
+		inputTokens:  inputTokens,
+		outputTokens: outputTokens,
+		hold:         hold,
+		quota:        quota,
+		keyUsage:     keyUsage,
+	}
 
-	// Create request to provider
-	providerReq, err := http.NewRequestWithContext(ctx, "POST", providerURL, bytes.NewReader(requestBody))
+	if req.Stream && resp.StatusCode == http.StatusOK {
+		c.relayStream(ctx, resp, &req, call.adapter.NewStreamTranslator(call.target, &req), usage)
+		return
+	}
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_500",
-				"message": "Failed to create provider request",
+				"message": "Failed to read provider response",
 			},
 		})
 		return
 	}
 
-	// Set headers
-	providerReq.Header.Set("Content-Type", "application/json")
-	if authField != "" && authValue != "" {
-		providerReq.Header.Set(authField, authValue)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		perr := call.adapter.MapError(resp.StatusCode, body)
+		ctx.JSON(perr.StatusCode, perr.Body())
+		return
 	}
 
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(providerReq)
+	// Translate the response and extract actual token usage
+	respBody, providerUsage, err := call.adapter.ParseResponse(call.target, body)
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{
 			"success": false,
 			"error": gin.H{
 				"code":    "ERR_502",
-				"message": "Provider request failed",
+				"message": "Invalid provider response",
 				"details": err.Error(),
 			},
 		})
 		return
 	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error": gin.H{
-				"code":    "ERR_500",
-				"message": "Failed to read provider response",
-			},
-		})
-		return
+	if providerUsage != nil {
+		usage.inputTokens = providerUsage.PromptTokens
+		usage.outputTokens = providerUsage.CompletionTokens
+	} else {
+		usage.outputTokens = tok.Count(completionText(respBody))
 	}
 
-	// Parse response to get token counts
-	var providerResp map[string]interface{}
-	json.Unmarshal(body, &providerResp)
+	c.recordUsage(ctx, usage)
 
-	// Extract actual token usage from response
-	actualInputTokens := inputTokens
-	actualOutputTokens := outputTokens
+	// Return provider response
+	ctx.Data(http.StatusOK, "application/json", respBody)
+}
 
-	if usage, ok := providerResp["usage"].(map[string]interface{}); ok {
-		if prompt, ok := usage["prompt_tokens"].(float64); ok {
-			actualInputTokens = int(prompt)
-		}
-		if completion, ok := usage["completion_tokens"].(float64); ok {
-			actualOutputTokens = int(completion)
-		}
+// usageRecord carries what is needed to bill a completed provider call.
+type usageRecord struct {
+	userID       string
+	model        *model.Model
+	requested    string // Model name as requested, possibly an alias
+	route        *service.Route
+	latency      time.Duration // Until the provider started responding
+	deployment   *model.ModelDeployment
+	credential   *model.ProviderCredential
+	provider     *model.ModelProvider
+	apiKeyID     string
+	apiKeyPrefix string
+	tokenizer    *tokenizer.Tokenizer // Counts what the provider did not report
+	inputTokens  int
+	outputTokens int
+	hold         *balanceHold
+	quota        *quotaHold
+	keyUsage     *apiKeyHold
+}
+
+// recordUsage creates the billing record and quota usage for a completed call.
+// It runs detached from the request context so that a client hanging up at the
+// end of a stream does not cancel billing for tokens already produced.
+func (c *Controller) recordUsage(ginCtx *gin.Context, u *usageRecord) {
+	ctx := context.WithoutCancel(ginCtx.Request.Context())
+
+	// Let the rate limiter count the tokens against tokens-per-minute
+	middleware.SetTokensUsed(ginCtx, u.inputTokens+u.outputTokens)
+
+	// Bill at the rates of the deployment that served the call
+	costResp, err := c.billingService.CalculateDeploymentCost(ctx, u.model, u.deployment, u.inputTokens, u.outputTokens)
+	if err != nil {
+		fmt.Printf("Failed to calculate cost for billing: %v\n", err)
+		return
 	}
 
-	// Create billing record asynchronously via Redis queue
-	actualTotalTokens := actualInputTokens + actualOutputTokens
+	// Create billing record asynchronously via Redis queue. The request ID
+	// keeps the record from being stored twice when the queue redelivers it.
+	requestID := generateRequestID()
+	totalTokens := u.inputTokens + u.outputTokens
+	var apiKeyID *string
+	if u.apiKeyID != "" {
+		apiKeyID = &u.apiKeyID
+	}
+	metadata := map[string]interface{}{
+		"provider":       u.provider.Name,
+		"model_name":     u.model.Name,
+		"upstream_model": u.deployment.UpstreamModelName(u.model),
+		"api_key":        u.apiKeyPrefix,
+		"request_id":     requestID,
+	}
+	if u.deployment.ID != "" {
+		metadata["deployment_id"] = u.deployment.ID
+	}
+	if u.requested != u.model.Name {
+		metadata["requested_model"] = u.requested
+	}
+	if u.route.Auto {
+		metadata["auto_routed"] = true
+	}
+	if u.route.Rule != nil {
+		metadata["routing_rule_id"] = u.route.Rule.ID
+	}
+	if u.route.Alias != nil {
+		metadata["model_alias"] = u.route.Alias.Name
+	}
 	if err := c.billingService.CreateBillingRecord(ctx, &service.CreateBillingRecordRequest{
-		UserID:         userID.(string),
-		APIKeyID:       nil, // TODO: Get API key ID from validation
-		ModelID:        modelObj.ID,
-		RequestTokens:  actualInputTokens,
-		ResponseTokens: actualOutputTokens,
-		TotalTokens:    actualTotalTokens,
+		UserID:         u.userID,
+		APIKeyID:       apiKeyID,
+		ModelID:        u.model.ID,
+		RequestID:      requestID,
+		RequestTokens:  u.inputTokens,
+		ResponseTokens: u.outputTokens,
+		TotalTokens:    totalTokens,
 		Cost:           costResp.TotalCost,
-		Metadata: map[string]interface{}{
-			"provider":   provider.Name,
-			"model_name": modelObj.Name,
-			"api_key":    ctx.GetHeader("X-API-Key")[:min(8, len(ctx.GetHeader("X-API-Key")))],
-			"request_id": generateRequestID(),
-		},
+		Metadata:       metadata,
+		HoldID:         u.hold.id,
 	}); err != nil {
 		// Log the error but don't fail the request
 		fmt.Printf("Failed to create billing record (async): %v\n", err)
+	} else {
+		// Billing settles the hold from here on
+		u.hold.billed = true
 	}
 
-	// Record usage for quota tracking (actualTotalTokens is already declared above)
-	if err := c.quotaService.RecordUsage(ctx, userID.(string), modelObj.ID, actualTotalTokens, costResp.TotalCost); err != nil {
+	// Correct the quota reserved for the call to its actual usage. A failed
+	// correction leaves the estimate counted rather than nothing.
+	u.quota.settled = true
+	if err := c.quotaService.SettleQuota(ctx, u.quota.reservation, totalTokens, costResp.TotalCost); err != nil {
 		// Log the error but don't fail the request - quota was already checked
 		fmt.Printf("Failed to record quota usage: %v\n", err)
 	}
 
-	// Return provider response
-	ctx.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
-}
-
-// estimateTokens estimates token count (simplified)
-func estimateTokens(messages []ChatCompletionMessage) int {
-	total := 0
-	for _, msg := range messages {
-		// Rough estimate: 1 token ≈ 4 characters for English
-		total += len(msg.Content)/4 + 1
+	// Feed the model's statistics used by auto routing
+	if err := c.routingService.RecordOutcome(ctx, u.model.ID, totalTokens, u.latency, true); err != nil {
+		fmt.Printf("Failed to record model outcome: %v\n", err)
 	}
-	return total
-}
 
-// findModelByName finds a model by its name (e.g., "gpt-4o")
-func (c *Controller) findModelByName(ctx *gin.Context, modelName string) (*model.Model, *model.ModelProvider, error) {
-	// Get all active models
-	modelsResp, err := c.modelService.ListModels(ctx, &service.ListModelsRequest{
-		Page:  1,
-		Limit: 100,
-	})
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list models: %w", err)
+	// Count the tokens against the upstream key's per-minute budget
+	if err := c.credentialService.RecordTokens(ctx, u.credential, totalTokens); err != nil {
+		fmt.Printf("Failed to record provider credential usage: %v\n", err)
 	}
 
-	// Find model by name
-	for _, modelInfo := range modelsResp.Models {
-		if modelInfo.Name == modelName {
-			// Get model details with provider info
-			modelDetails, err := c.modelService.GetModelDetails(ctx, modelInfo.ID)
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to get model details: %w", err)
-			}
-			return modelDetails.Model, modelDetails.Provider, nil
-		}
+	// Correct the call's usage against the API key's monthly caps
+	u.keyUsage.settled = true
+	if err := c.apiKeyPolicy.RecordUsage(ctx, u.keyUsage.reservation, totalTokens); err != nil {
+		fmt.Printf("Failed to record API key usage: %v\n", err)
 	}
-
-	return nil, nil, fmt.Errorf("model not found: %s", modelName)
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// buildProviderRequestInfo returns the provider URL, authentication header field, and value
-// based on the provider type and model name
-func buildProviderRequestInfo(provider *model.ModelProvider, modelName string) (string, string, string) {
-	baseURL := provider.APIBaseURL
-	if !strings.HasSuffix(baseURL, "/") {
-		baseURL += "/"
-	}
-
-	// Default to OpenAI-compatible format
-	url := baseURL + "chat/completions"
-	authField := "Authorization"
-	authValue := "Bearer " + provider.APIKey
-
-	// Handle different provider types
-	switch strings.ToLower(provider.Name) {
-	case "openai":
-		// OpenAI uses standard chat/completions endpoint
-		url = baseURL + "chat/completions"
-		authField = "Authorization"
-		authValue = "Bearer " + provider.APIKey
-	case "anthropic":
-		// Anthropic uses messages endpoint
-		url = baseURL + "v1/messages"
-		// Anthropic uses x-api-key header instead of Authorization
-		authField = "x-api-key"
-		authValue = provider.APIKey
-	case "google":
-		// Google uses generateContent endpoint
-		// Extract model name from full model ID (e.g., models/gemini-1.5-pro)
-		modelPath := modelName
-		if strings.Contains(modelName, "/") {
-			// Already has models/ prefix
-			modelPath = modelName
-		} else {
-			modelPath = "models/" + modelName
+// hasLiveAPIKey reports whether the provider has a key that is neither empty
+// nor a test key
+func hasLiveAPIKey(provider *model.ModelProvider) bool {
+	// A provider's own key is only used when it has no credential pool
+	keys := []string{provider.APIKey}
+	if len(provider.Credentials) > 0 {
+		keys = keys[:0]
+		for _, credential := range provider.Credentials {
+			keys = append(keys, credential.APIKey)
 		}
-		url = baseURL + "v1beta/" + modelPath + ":generateContent"
-		// Google uses API key in query parameter, not header
-		// Add API key as query parameter
-		if provider.APIKey != "" {
-			if strings.Contains(url, "?") {
-				url += "&key=" + provider.APIKey
-			} else {
-				url += "?key=" + provider.APIKey
-			}
+	}
+	for _, key := range keys {
+		if key != "" && !strings.HasPrefix(key, "sk-test-") {
+			return true
 		}
-		authField = "" // No authorization header for Google
-		authValue = ""
-	case "meta":
-		// Meta (Llama) likely uses OpenAI-compatible API
-		url = baseURL + "chat/completions"
-		authField = "Authorization"
-		authValue = "Bearer " + provider.APIKey
-	case "cohere":
-		// Cohere uses generate endpoint
-		url = baseURL + "v1/generate"
-		authField = "Authorization"
-		authValue = "Bearer " + provider.APIKey
-	}
-
-	return url, authField, authValue
+	}
+	return false
 }
 
 func generateRequestID() string {
-	return fmt.Sprintf("req_%d_%d", time.Now().UnixNano(), time.Now().Unix())
+	// The random part keeps IDs unique across router instances
+	suffix, err := utils.GenerateRandomString(12)
+	if err != nil {
+		return fmt.Sprintf("req_%d_%d", time.Now().UnixNano(), time.Now().Unix())
+	}
+	return fmt.Sprintf("req_%d_%s", time.Now().UnixNano(), suffix)
 }
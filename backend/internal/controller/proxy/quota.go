@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/service"
+)
+
+// quotaHold is the quota reserved for a call. Once the call's usage is
+// recorded, the reservation is settled to it; otherwise it must be released.
+type quotaHold struct {
+	reservation *service.QuotaReservation
+	settled     bool
+}
+
+// releaseQuota gives back the quota reserved for a call that was not recorded
+func (c *Controller) releaseQuota(ginCtx *gin.Context, hold *quotaHold) {
+	if hold.settled || hold.reservation == nil {
+		return
+	}
+	ctx := context.WithoutCancel(ginCtx.Request.Context())
+	if err := c.quotaService.ReleaseQuota(ctx, hold.reservation); err != nil {
+		// The estimate stays counted until the window resets
+		fmt.Printf("Failed to release quota reservation: %v\n", err)
+	}
+}
+
+// apiKeyHold is the usage reserved for a call against its API key's monthly
+// caps, settled or released like a quotaHold
+type apiKeyHold struct {
+	reservation *service.APIKeyReservation
+	settled     bool
+}
+
+// releaseAPIKeyUsage gives back the usage reserved for a call that was not
+// recorded
+func (c *Controller) releaseAPIKeyUsage(ginCtx *gin.Context, hold *apiKeyHold) {
+	if hold.settled || hold.reservation == nil {
+		return
+	}
+	ctx := context.WithoutCancel(ginCtx.Request.Context())
+	if err := c.apiKeyPolicy.ReleaseUsage(ctx, hold.reservation); err != nil {
+		// The estimate stays counted until the month ends
+		fmt.Printf("Failed to release API key usage reservation: %v\n", err)
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// RetryPolicy bounds how often and how patiently a request is retried
+// against the same provider key after a transient failure
+type RetryPolicy struct {
+	MaxRetries int           // Retries per request, across all deployments
+	BaseDelay  time.Duration // Backoff before the first retry
+	MaxDelay   time.Duration // Longest backoff, and longest Retry-After honoured
+}
+
+// Backoff returns how long to wait before the given retry (0 for the first).
+// The delay doubles with each retry up to MaxDelay, and is jittered over its
+// upper half so that clients failing together do not retry together.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 0; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// sleep waits for d, returning early with the context's error if the client
+// goes away first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isConnectError reports whether a transport error happened while dialing,
+// before the provider could have seen the request, so that sending it again
+// cannot run it twice
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
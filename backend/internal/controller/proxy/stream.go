@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var sseDone = []byte("[DONE]")
+
+// SSEEvent is one server-sent event read from a provider stream
+type SSEEvent struct {
+	// Event is the event type, empty for unnamed events
+	Event string
+	// Data holds the event's data lines joined by newlines
+	Data []byte
+}
+
+// sseReader splits a text/event-stream body into events
+type sseReader struct {
+	reader *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next event, or io.EOF once the stream has ended
+func (r *sseReader) Next() (*SSEEvent, error) {
+	var (
+		event   SSEEvent
+		hasData bool
+	)
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+
+		if len(line) == 0 {
+			if hasData || event.Event != "" {
+				return &event, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(field) {
+		case "event":
+			event.Event = string(value)
+		case "data":
+			if hasData {
+				event.Data = append(event.Data, '\n')
+			}
+			event.Data = append(event.Data, value...)
+			hasData = true
+		}
+		// Comments (empty field name), id and retry carry nothing the proxy needs
+
+		if err != nil {
+			// A final event without its terminating blank line still counts
+			if hasData || event.Event != "" {
+				return &event, nil
+			}
+			return nil, err
+		}
+	}
+}
+
+// streamChunk is the subset of an OpenAI chat.completion.chunk the proxy
+// inspects while relaying a stream.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string          `json:"content"`
+			ToolCalls []ToolCallDelta `json:"tool_calls"`
+			// OpenAI-compatible providers stream reasoning under either name
+			Reasoning        string `json:"reasoning"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// writeCompletion appends everything the chunk generated, which is counted
+// when the provider does not report usage
+func (c *streamChunk) writeCompletion(completion *strings.Builder) {
+	for _, choice := range c.Choices {
+		completion.WriteString(choice.Delta.ReasoningContent)
+		completion.WriteString(choice.Delta.Reasoning)
+		completion.WriteString(choice.Delta.Content)
+		for _, call := range choice.Delta.ToolCalls {
+			completion.WriteString(call.Function.Name)
+			completion.WriteString(call.Function.Arguments)
+		}
+	}
+}
+
+// relayStream reads the provider's event stream, translates each event into
+// OpenAI chunks with the adapter and sends them to the client, flushing after
+// each one. Billing runs once the stream ends, using the provider's usage when
+// reported and a local estimate of the streamed completion otherwise.
+func (c *Controller) relayStream(ctx *gin.Context, resp *http.Response, req *ChatCompletionRequest, translator StreamTranslator, usage *usageRecord) {
+	setStreamHeaders(ctx)
+	ctx.Status(http.StatusOK)
+
+	// The server-wide write timeout is sized for buffered responses; lift it
+	// so long generations aren't cut off mid-stream.
+	_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+
+	clientWantsUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+
+	var (
+		completion    strings.Builder
+		providerUsage bool
+		streamed      bool
+		clientGone    bool
+	)
+
+	reader := newSSEReader(resp.Body)
+	for !clientGone {
+		event, err := reader.Next()
+		if err != nil {
+			if err != io.EOF && ctx.Request.Context().Err() == nil {
+				fmt.Printf("Stream from provider %s ended with error: %v\n", usage.provider.Name, err)
+			}
+			break
+		}
+
+		chunks, done, err := translator.Translate(event)
+		if err != nil {
+			fmt.Printf("Failed to translate stream event from provider %s: %v\n", usage.provider.Name, err)
+		}
+
+		for _, data := range chunks {
+			var chunk streamChunk
+			if json.Unmarshal(data, &chunk) == nil {
+				chunk.writeCompletion(&completion)
+				if chunk.Usage != nil {
+					usage.inputTokens = chunk.Usage.PromptTokens
+					usage.outputTokens = chunk.Usage.CompletionTokens
+					providerUsage = true
+					// The usage-only chunk was requested by the proxy, not
+					// the client.
+					if !clientWantsUsage && len(chunk.Choices) == 0 {
+						continue
+					}
+				}
+			}
+
+			if !writeEvent(ctx, data) {
+				clientGone = true
+				break
+			}
+			streamed = true
+		}
+
+		if done {
+			break
+		}
+	}
+
+	if streamed && !clientGone {
+		writeEvent(ctx, sseDone)
+	}
+
+	if !streamed && completion.Len() == 0 {
+		// Nothing reached the client, so there is nothing to bill.
+		return
+	}
+
+	if !providerUsage {
+		usage.outputTokens = usage.tokenizer.Count(completion.String())
+	}
+	c.recordUsage(ctx, usage)
+}
+
+// writeEvent writes one data event to the client and flushes it. It returns
+// false once the client has gone away.
+func writeEvent(ctx *gin.Context, data []byte) bool {
+	if ctx.Request.Context().Err() != nil {
+		return false
+	}
+	if _, err := fmt.Fprintf(ctx.Writer, "data: %s\n\n", data); err != nil {
+		return false
+	}
+	ctx.Writer.Flush()
+	return true
+}
+
+func setStreamHeaders(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Disable response buffering in nginx-style reverse proxies
+	ctx.Header("X-Accel-Buffering", "no")
+}
+
+// writeSimulatedStream emits a development-mode completion as SSE chunks.
+func writeSimulatedStream(ctx *gin.Context, modelName, content string) {
+	setStreamHeaders(ctx)
+	ctx.Status(http.StatusOK)
+
+	created := time.Now().Unix()
+	chunk := func(delta gin.H, finishReason interface{}) gin.H {
+		return gin.H{
+			"id":      "chatcmpl-simulated-123",
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   modelName,
+			"choices": []gin.H{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
+			},
+		}
+	}
+
+	events := []gin.H{chunk(gin.H{"role": "assistant", "content": ""}, nil)}
+	for _, word := range strings.SplitAfter(content, " ") {
+		events = append(events, chunk(gin.H{"content": word}, nil))
+	}
+	events = append(events, chunk(gin.H{}, "stop"))
+
+	for _, e := range events {
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(ctx.Writer, "data: %s\n\n", data)
+		ctx.Writer.Flush()
+	}
+	fmt.Fprint(ctx.Writer, "data: [DONE]\n\n")
+	ctx.Writer.Flush()
+}
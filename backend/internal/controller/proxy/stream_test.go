@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/service"
+	"massrouter.ai/backend/pkg/money"
+	"massrouter.ai/backend/pkg/tokenizer"
+)
+
+// fakeStreamBilling records the billing records created for relayed streams
+type fakeStreamBilling struct {
+	service.BillingService
+	mu      sync.Mutex
+	records []*service.CreateBillingRecordRequest
+}
+
+func (f *fakeStreamBilling) CalculateDeploymentCost(ctx context.Context, modelObj *model.Model, deployment *model.ModelDeployment, inputTokens, outputTokens int) (*service.CostCalculation, error) {
+	return &service.CostCalculation{InputTokens: inputTokens, OutputTokens: outputTokens}, nil
+}
+
+func (f *fakeStreamBilling) CreateBillingRecord(ctx context.Context, req *service.CreateBillingRecordRequest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, req)
+	return nil
+}
+
+type fakeStreamQuota struct{ service.QuotaService }
+
+func (fakeStreamQuota) SettleQuota(ctx context.Context, reservation *service.QuotaReservation, tokens int, cost money.Amount) error {
+	return nil
+}
+
+type fakeStreamRouting struct{ service.RoutingService }
+
+func (fakeStreamRouting) RecordOutcome(ctx context.Context, modelID string, tokens int, latency time.Duration, success bool) error {
+	return nil
+}
+
+type fakeStreamCredentials struct{ service.CredentialService }
+
+func (fakeStreamCredentials) RecordTokens(ctx context.Context, credential *model.ProviderCredential, tokens int) error {
+	return nil
+}
+
+type fakeStreamAPIKeyPolicy struct{ service.APIKeyPolicyService }
+
+func (fakeStreamAPIKeyPolicy) RecordUsage(ctx context.Context, reservation *service.APIKeyReservation, tokens int) error {
+	return nil
+}
+
+// streamTokenizer counts completions the provider reported no usage for
+var streamTokenizer = tokenizer.ForModel("gpt-4o", "")
+
+// relayThrough serves a route that relays the upstream handler's stream to
+// the client the way ChatCompletion does. The returned channel is closed once
+// the relay, including billing, has returned.
+func relayThrough(t *testing.T, upstream http.HandlerFunc, req *ChatCompletionRequest) (*httptest.Server, *fakeStreamBilling, <-chan struct{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	provider := httptest.NewServer(upstream)
+	t.Cleanup(provider.Close)
+
+	billing := &fakeStreamBilling{}
+	c := &Controller{
+		billingService:    billing,
+		quotaService:      fakeStreamQuota{},
+		apiKeyPolicy:      fakeStreamAPIKeyPolicy{},
+		routingService:    fakeStreamRouting{},
+		credentialService: fakeStreamCredentials{},
+	}
+
+	done := make(chan struct{})
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(ctx *gin.Context) {
+		defer close(done)
+		resp, err := http.Get(provider.URL)
+		if err != nil {
+			t.Errorf("upstream request failed: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		c.relayStream(ctx, resp, req, openAIStreamTranslator{}, &usageRecord{
+			userID:       "user-1",
+			model:        &model.Model{ID: "model-1", Name: "gpt-4o"},
+			requested:    "gpt-4o",
+			route:        &service.Route{},
+			deployment:   &model.ModelDeployment{},
+			provider:     &model.ModelProvider{Name: "fake"},
+			tokenizer:    streamTokenizer,
+			inputTokens:  10,
+			outputTokens: 100,
+			hold:         &balanceHold{},
+			quota:        &quotaHold{},
+			keyUsage:     &apiKeyHold{},
+		})
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, billing, done
+}
+
+func writeUpstreamEvent(w http.ResponseWriter, data string) {
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	w.(http.Flusher).Flush()
+}
+
+func contentChunk(content string) string {
+	return `{"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"` + content + `"}}]}`
+}
+
+func waitRelay(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay did not return")
+	}
+}
+
+func nextEvent(t *testing.T, reader *sseReader) string {
+	t.Helper()
+	event, err := reader.Next()
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	return string(event.Data)
+}
+
+func TestRelayStream_ProviderUsage(t *testing.T) {
+	for _, includeUsage := range []bool{false, true} {
+		t.Run(fmt.Sprintf("include_usage=%v", includeUsage), func(t *testing.T) {
+			usageChunk := `{"id":"chatcmpl-1","object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`
+
+			// The second chunk is held back until the client has read the
+			// first, which it only can if the first was flushed on its own
+			firstRead := make(chan struct{})
+			upstream := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				writeUpstreamEvent(w, contentChunk("Hello"))
+				select {
+				case <-firstRead:
+				case <-time.After(5 * time.Second):
+					t.Error("client never received the first chunk")
+				}
+				writeUpstreamEvent(w, contentChunk(" there"))
+				writeUpstreamEvent(w, usageChunk)
+				writeUpstreamEvent(w, "[DONE]")
+			}
+			req := &ChatCompletionRequest{Model: "gpt-4o", Stream: true}
+			if includeUsage {
+				req.StreamOptions = &StreamOptions{IncludeUsage: true}
+			}
+			server, billing, done := relayThrough(t, upstream, req)
+
+			resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", nil)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Errorf("Content-Type = %q, want text/event-stream", got)
+			}
+
+			reader := newSSEReader(resp.Body)
+			if got := nextEvent(t, reader); got != contentChunk("Hello") {
+				t.Errorf("first event = %s", got)
+			}
+			close(firstRead)
+			if got := nextEvent(t, reader); got != contentChunk(" there") {
+				t.Errorf("second event = %s", got)
+			}
+			if includeUsage {
+				if got := nextEvent(t, reader); got != usageChunk {
+					t.Errorf("usage event = %s, want the provider's usage chunk", got)
+				}
+			}
+			if got := nextEvent(t, reader); got != "[DONE]" {
+				t.Errorf("last event = %s, want [DONE]", got)
+			}
+			if _, err := reader.Next(); err != io.EOF {
+				t.Errorf("stream continues after [DONE]: %v", err)
+			}
+
+			waitRelay(t, done)
+			if len(billing.records) != 1 {
+				t.Fatalf("billed %d times, want once", len(billing.records))
+			}
+			if r := billing.records[0]; r.RequestTokens != 7 || r.ResponseTokens != 3 {
+				t.Errorf("billed %d/%d tokens, want the provider's 7/3", r.RequestTokens, r.ResponseTokens)
+			}
+		})
+	}
+}
+
+func TestRelayStream_EstimatesMissingUsage(t *testing.T) {
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeUpstreamEvent(w, contentChunk("Hello"))
+		writeUpstreamEvent(w, contentChunk(" there"))
+		writeUpstreamEvent(w, "[DONE]")
+	}
+	server, billing, done := relayThrough(t, upstream, &ChatCompletionRequest{Model: "gpt-4o", Stream: true})
+
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	want := "data: " + contentChunk("Hello") + "\n\ndata: " + contentChunk(" there") + "\n\ndata: [DONE]\n\n"
+	if string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+
+	waitRelay(t, done)
+	if len(billing.records) != 1 {
+		t.Fatalf("billed %d times, want once", len(billing.records))
+	}
+	r := billing.records[0]
+	if want := streamTokenizer.Count("Hello there"); r.ResponseTokens != want {
+		t.Errorf("billed %d completion tokens, want %d counted locally", r.ResponseTokens, want)
+	}
+	if r.RequestTokens != 10 {
+		t.Errorf("billed %d prompt tokens, want the estimate of 10", r.RequestTokens)
+	}
+}
+
+func TestRelayStream_ClientDisconnects(t *testing.T) {
+	// The provider streams until the relay stops reading
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 1000; i++ {
+			if r.Context().Err() != nil {
+				return
+			}
+			writeUpstreamEvent(w, contentChunk("word "))
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	server, billing, done := relayThrough(t, upstream, &ChatCompletionRequest{Model: "gpt-4o", Stream: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	httpReq, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v1/chat/completions", nil)
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	nextEvent(t, newSSEReader(resp.Body))
+	cancel()
+	resp.Body.Close()
+
+	waitRelay(t, done)
+	if len(billing.records) != 1 {
+		t.Fatalf("billed %d times, want once", len(billing.records))
+	}
+	if r := billing.records[0]; r.ResponseTokens == 0 || r.ResponseTokens >= 1000 {
+		t.Errorf("billed %d completion tokens, want those streamed before the client left", r.ResponseTokens)
+	}
+}
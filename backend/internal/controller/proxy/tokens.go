@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+
+	"massrouter.ai/backend/pkg/tokenizer"
+)
+
+// prompt reduces the request to what the tokenizer counts: the messages and
+// the tool definitions
+func (r *ChatCompletionRequest) prompt() *tokenizer.Prompt {
+	p := &tokenizer.Prompt{
+		Messages: make([]tokenizer.Message, len(r.Messages)),
+	}
+	for i, msg := range r.Messages {
+		m := tokenizer.Message{
+			Role:       msg.Role,
+			Name:       msg.Name,
+			Content:    msg.Content.String(),
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, part := range msg.Content.Parts {
+			if part.Type == "image_url" && part.ImageURL != nil {
+				m.Images = append(m.Images, tokenizer.Image{Detail: part.ImageURL.Detail})
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, tokenizer.ToolCall{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			})
+		}
+		p.Messages[i] = m
+	}
+	for _, tool := range r.Tools {
+		p.Tools = append(p.Tools, tokenizer.Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	return p
+}
+
+// completionText returns the generated text of an OpenAI chat.completion
+// body, for counting when the provider does not report usage
+func completionText(body []byte) string {
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, choice := range resp.Choices {
+		text.WriteString(choice.Message.Content.String())
+		for _, call := range choice.Message.ToolCalls {
+			text.WriteString(call.Function.Name)
+			text.WriteString(call.Function.Arguments)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+// providerClients keeps one pooled HTTP client per provider so that calls
+// reuse connections. A provider's client is rebuilt when its http config
+// changes.
+type providerClients struct {
+	mu      sync.Mutex
+	clients map[string]*providerClient
+}
+
+// providerClient is a provider's connection pool and the settings it was
+// built with
+type providerClient struct {
+	config   string // The provider's http config, as JSON
+	client   *http.Client
+	settings *model.ProviderHTTPSettings
+}
+
+func newProviderClients() *providerClients {
+	return &providerClients{clients: make(map[string]*providerClient)}
+}
+
+// get returns the provider's client, building it on first use
+func (p *providerClients) get(provider *model.ModelProvider) (*providerClient, error) {
+	config, err := json.Marshal(provider.Config["http"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid http config: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing, ok := p.clients[provider.ID]
+	if ok && existing.config == string(config) {
+		return existing, nil
+	}
+
+	settings, err := provider.HTTPSettings()
+	if err != nil {
+		return nil, err
+	}
+	pc := &providerClient{
+		config:   string(config),
+		client:   &http.Client{Transport: newTransport(settings)},
+		settings: settings,
+	}
+	if ok {
+		// Calls in flight keep their connections; idle ones are not reused
+		existing.client.CloseIdleConnections()
+	}
+	p.clients[provider.ID] = pc
+	return pc, nil
+}
+
+func newTransport(settings *model.ProviderHTTPSettings) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   settings.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	idleConns := 32
+	if settings.MaxConnections > 0 {
+		idleConns = settings.MaxConnections
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   settings.ConnectTimeout,
+		MaxConnsPerHost:       settings.MaxConnections,
+		MaxIdleConnsPerHost:   idleConns,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		ForceAttemptHTTP2:     settings.HTTP2,
+		ExpectContinueTimeout: time.Second,
+	}
+	if settings.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(settings.ProxyURL)
+	}
+	if settings.CABundle != "" {
+		// The bundle was checked when the settings were parsed
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM([]byte(settings.CABundle))
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	if !settings.HTTP2 {
+		// A non-nil empty map stops the transport from upgrading to HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
+
+// errUpstreamTimeout is the cancellation cause of a call that ran out of time
+type errUpstreamTimeout struct {
+	what    string
+	timeout time.Duration
+}
+
+func (e *errUpstreamTimeout) Error() string {
+	return fmt.Sprintf("provider %s within %s", e.what, e.timeout)
+}
+
+// do sends a request with the provider's static headers. A buffered call must
+// complete, body included, within RequestTimeout. A stream must send its
+// headers within FirstByteTimeout and then never go longer than IdleTimeout
+// without a chunk, however long it runs in total.
+func (pc *providerClient) do(req *http.Request, stream bool) (*http.Response, error) {
+	for name, value := range pc.settings.Headers {
+		// Headers the adapter set, such as authentication, take precedence
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	req = req.WithContext(ctx)
+
+	cause := &errUpstreamTimeout{what: "did not respond", timeout: pc.settings.RequestTimeout}
+	if stream {
+		cause.timeout = pc.settings.FirstByteTimeout
+	}
+	timer := time.AfterFunc(cause.timeout, func() { cancel(cause) })
+
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		timer.Stop()
+		cancel(nil)
+		if timeout, ok := context.Cause(ctx).(*errUpstreamTimeout); ok {
+			return nil, timeout
+		}
+		return nil, err
+	}
+
+	body := &timedBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, timer: timer}
+	if stream {
+		body.idle = &errUpstreamTimeout{what: "sent nothing", timeout: pc.settings.IdleTimeout}
+		timer.Stop()
+		body.timer = time.AfterFunc(body.idle.timeout, func() { cancel(body.idle) })
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// timedBody is a response body whose call is cancelled by a timer. For
+// streams, each read that returns data restarts the timer. Closing the body
+// releases the call.
+type timedBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	timer  *time.Timer
+	idle   *errUpstreamTimeout // nil for buffered calls
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.idle != nil {
+		b.timer.Reset(b.idle.timeout)
+	}
+	if err != nil && err != io.EOF {
+		if timeout, ok := context.Cause(b.ctx).(*errUpstreamTimeout); ok {
+			return n, timeout
+		}
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+func TestProviderClientTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Org") != "acme" {
+			t.Errorf("X-Org header = %q, want acme", r.Header.Get("X-Org"))
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for _, chunk := range []string{"data: 1\n\n", "data: 2\n\n"} {
+			time.Sleep(30 * time.Millisecond)
+			_, _ = io.WriteString(w, chunk)
+			w.(http.Flusher).Flush()
+		}
+		// Stall until the client gives up
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	clients := newProviderClients()
+	provider := &model.ModelProvider{ID: "p", Config: model.JSONB{"http": map[string]interface{}{
+		"idle_timeout":    "100ms",
+		"request_timeout": "50ms",
+		"headers":         map[string]interface{}{"X-Org": "acme"},
+	}}}
+	pc, err := clients.get(provider)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if again, _ := clients.get(provider); again != pc {
+		t.Error("get() built a new client for an unchanged config")
+	}
+
+	t.Run("stream outlives the request timeout until it stalls", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := pc.do(req, true)
+		if err != nil {
+			t.Fatalf("do() error = %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		var timeout *errUpstreamTimeout
+		if !errors.As(err, &timeout) || timeout.timeout != 100*time.Millisecond {
+			t.Fatalf("ReadAll() error = %v, want the idle timeout", err)
+		}
+		if string(body) != "data: 1\n\ndata: 2\n\n" {
+			t.Errorf("body = %q, want both chunks", body)
+		}
+	})
+
+	t.Run("buffered call is bounded in total", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := pc.do(req, false)
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		var timeout *errUpstreamTimeout
+		if !errors.As(err, &timeout) || timeout.timeout != 50*time.Millisecond {
+			t.Errorf("error = %v, want the request timeout", err)
+		}
+	})
+}
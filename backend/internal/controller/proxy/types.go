@@ -0,0 +1,368 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+// ChatCompletionRequest represents the OpenAI-compatible chat completion request
+type ChatCompletionRequest struct {
+	Model               string                  `json:"model" binding:"required"`
+	Messages            []ChatCompletionMessage `json:"messages" binding:"required"`
+	MaxTokens           *int                    `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                    `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64                `json:"temperature,omitempty"`
+	TopP                *float64                `json:"top_p,omitempty"`
+	N                   *int                    `json:"n,omitempty"`
+	Stream              bool                    `json:"stream,omitempty"`
+	// Stop is either a single string or an array of up to four strings
+	Stop             json.RawMessage    `json:"stop,omitempty"`
+	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
+	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
+	Logprobs         *bool              `json:"logprobs,omitempty"`
+	TopLogprobs      *int               `json:"top_logprobs,omitempty"`
+	Seed             *int64             `json:"seed,omitempty"`
+	User             string             `json:"user,omitempty"`
+	// ResponseFormat is kept raw so json_schema definitions pass through
+	// untouched
+	ResponseFormat    json.RawMessage `json:"response_format,omitempty"`
+	Tools             []Tool          `json:"tools,omitempty"`
+	ParallelToolCalls *bool           `json:"parallel_tool_calls,omitempty"`
+	// ToolChoice is either a string ("auto", "none", "required") or an object
+	// naming a function; it is kept raw so both forms survive re-marshalling.
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+	// StreamOptions mirrors OpenAI's stream_options; include_usage asks the
+	// provider to send a final chunk carrying token usage.
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+
+	// Routing holds the client's hints for auto routing. It is read from the
+	// "routing" member and never sent upstream.
+	Routing *RoutingHints `json:"-"`
+
+	// Extra holds request fields this type doesn't model. They are forwarded
+	// as-is to OpenAI-compatible providers.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// RoutingHints are a client's limits on the model auto routing may choose
+type RoutingHints struct {
+	MaxInputPrice  *money.Amount `json:"max_input_price,omitempty"`  // Per 1K tokens
+	MaxOutputPrice *money.Amount `json:"max_output_price,omitempty"` // Per 1K tokens
+	MaxLatencyMs   *float64      `json:"max_latency_ms,omitempty"`
+}
+
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(data, r)
+	if err != nil {
+		return err
+	}
+	if raw, ok := extra["routing"]; ok {
+		if err := json.Unmarshal(raw, &r.Routing); err != nil {
+			return fmt.Errorf("invalid routing hints: %w", err)
+		}
+		delete(extra, "routing")
+	}
+	r.Extra = extra
+	return nil
+}
+
+func (r ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionRequest
+	return marshalWithExtra(plain(r), r.Extra)
+}
+
+// OutputTokenLimit returns the requested completion token limit, preferring
+// max_completion_tokens over the deprecated max_tokens
+func (r *ChatCompletionRequest) OutputTokenLimit() *int {
+	if r.MaxCompletionTokens != nil {
+		return r.MaxCompletionTokens
+	}
+	return r.MaxTokens
+}
+
+// HasImages reports whether any message carries image content
+func (r *ChatCompletionRequest) HasImages() bool {
+	for _, msg := range r.Messages {
+		for _, part := range msg.Content.Parts {
+			if part.Type == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JSONMode reports whether the response format asks for JSON output
+func (r *ChatCompletionRequest) JSONMode() bool {
+	var format struct {
+		Type string `json:"type"`
+	}
+	if len(r.ResponseFormat) == 0 || json.Unmarshal(r.ResponseFormat, &format) != nil {
+		return false
+	}
+	return format.Type == "json_object" || format.Type == "json_schema"
+}
+
+// StopSequences returns the stop parameter as a list
+func (r *ChatCompletionRequest) StopSequences() ([]string, error) {
+	if len(r.Stop) == 0 || bytes.Equal(bytes.TrimSpace(r.Stop), []byte("null")) {
+		return nil, nil
+	}
+	var single string
+	if json.Unmarshal(r.Stop, &single) == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(r.Stop, &list); err != nil {
+		return nil, fmt.Errorf("stop must be a string or an array of strings")
+	}
+	return list, nil
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+type ChatCompletionMessage struct {
+	Role    string         `json:"role" binding:"required"`
+	Content MessageContent `json:"content"`
+	Name    string         `json:"name,omitempty"`
+	// ToolCalls is set on assistant messages that invoke tools
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID links a tool message to the call it answers
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Refusal is set on assistant messages the model declined to answer
+	Refusal string `json:"refusal,omitempty"`
+
+	// Extra holds message fields this type doesn't model
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (m *ChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionMessage
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(data, m)
+	if err != nil {
+		return err
+	}
+	m.Extra = extra
+	return nil
+}
+
+func (m ChatCompletionMessage) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionMessage
+	return marshalWithExtra(plain(m), m.Extra)
+}
+
+// MessageContent is a message's content, which OpenAI accepts either as a
+// plain string or as an array of typed parts. It may also be null, as on
+// assistant messages that only call tools.
+type MessageContent struct {
+	// Text holds string content
+	Text *string
+	// Parts holds array content
+	Parts []ContentPart
+}
+
+// NewTextContent returns plain string content
+func NewTextContent(text string) MessageContent {
+	return MessageContent{Text: &text}
+}
+
+// IsNull reports whether the content was null or absent
+func (c MessageContent) IsNull() bool {
+	return c.Text == nil && c.Parts == nil
+}
+
+// String returns the text of the content, joining text parts and skipping
+// any non-text parts
+func (c MessageContent) String() string {
+	if c.Text != nil {
+		return *c.Text
+	}
+	var text strings.Builder
+	for _, part := range c.Parts {
+		if part.Type == "text" {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
+
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	switch {
+	case c.Parts != nil:
+		return json.Marshal(c.Parts)
+	case c.Text != nil:
+		return json.Marshal(*c.Text)
+	default:
+		return []byte("null"), nil
+	}
+}
+
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	*c = MessageContent{}
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		c.Text = &text
+		return nil
+	case len(data) > 0 && data[0] == '[':
+		parts := []ContentPart{}
+		if err := json.Unmarshal(data, &parts); err != nil {
+			return err
+		}
+		c.Parts = parts
+		return nil
+	default:
+		return fmt.Errorf("message content must be a string, an array of parts or null")
+	}
+}
+
+// ContentPart is one element of array message content
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+
+	// Extra holds the payload of part types this type doesn't model, such
+	// as input_audio or file
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (p *ContentPart) UnmarshalJSON(data []byte) error {
+	type plain ContentPart
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	extra, err := unknownFields(data, p)
+	if err != nil {
+		return err
+	}
+	p.Extra = extra
+	return nil
+}
+
+func (p ContentPart) MarshalJSON() ([]byte, error) {
+	type plain ContentPart
+	return marshalWithExtra(plain(p), p.Extra)
+}
+
+type ImageURL struct {
+	// URL is either an http(s) URL or a base64 data URL
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Tool is a function the model may call
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a tool invocation made by the model
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name string `json:"name"`
+	// Arguments is the JSON-encoded argument object
+	Arguments string `json:"arguments"`
+}
+
+// ChatCompletionResponse represents the OpenAI-compatible chat completion response
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *Usage                 `json:"usage,omitempty"`
+	// SystemFingerprint is reported by OpenAI alongside seed
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int                   `json:"index"`
+	Message      ChatCompletionMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
+	Logprobs     json.RawMessage       `json:"logprobs,omitempty"`
+}
+
+// ChatCompletionChunk represents one chat.completion.chunk event of a stream
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Object  string                      `json:"object"`
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	Usage   *Usage                      `json:"usage,omitempty"`
+}
+
+type ChatCompletionChunkChoice struct {
+	Index        int                 `json:"index"`
+	Delta        ChatCompletionDelta `json:"delta"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+type ChatCompletionDelta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta is a streamed fragment of a tool call. The id, type and
+// function name arrive with the first fragment of each call; later fragments
+// only extend the arguments.
+type ToolCallDelta struct {
+	Index    int               `json:"index"`
+	ID       string            `json:"id,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Function FunctionCallDelta `json:"function"`
+}
+
+type FunctionCallDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// Usage is the token accounting reported for a completion
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func newUsage(promptTokens, completionTokens int) *Usage {
+	return &Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
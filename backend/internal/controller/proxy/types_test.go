@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+func TestChatCompletionRequest_RoundTrip(t *testing.T) {
+	input := `{
+		"model": "gpt-4o",
+		"messages": [
+			{"role": "system", "content": "You are helpful."},
+			{"role": "user", "name": "alice", "content": [
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": {"url": "https://example.com/cat.png", "detail": "low"}},
+				{"type": "input_audio", "input_audio": {"data": "AAAA", "format": "wav"}}
+			]},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"},
+			{"role": "user", "content": "thanks", "cache_hint": true}
+		],
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object", "properties": {"q": {"type": "string"}}}}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}},
+		"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}},
+		"stop": ["END"],
+		"seed": 7,
+		"n": 2,
+		"logprobs": true,
+		"top_logprobs": 3,
+		"user": "user-123",
+		"reasoning_effort": "low",
+		"metadata": {"trace": "abc"}
+	}`
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(input), &req); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if !req.Messages[2].Content.IsNull() {
+		t.Errorf("assistant tool call content should stay null")
+	}
+	if req.Messages[1].Content.String() != "What is in this image?" {
+		t.Errorf("text of content parts = %q", req.Messages[1].Content.String())
+	}
+	if stop, err := req.StopSequences(); err != nil || len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("StopSequences() = %v, %v", stop, err)
+	}
+	if _, ok := req.Extra["reasoning_effort"]; !ok {
+		t.Errorf("unknown request field was dropped: %v", req.Extra)
+	}
+	if _, ok := req.Messages[4].Extra["cache_hint"]; !ok {
+		t.Errorf("unknown message field was dropped: %v", req.Messages[4].Extra)
+	}
+
+	out, err := json.Marshal(&req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var want, got interface{}
+	json.Unmarshal([]byte(input), &want)
+	json.Unmarshal(out, &got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("round trip changed the request\n got: %s", out)
+	}
+}
+
+func TestMessageContent_RejectsInvalidType(t *testing.T) {
+	var msg ChatCompletionMessage
+	if err := json.Unmarshal([]byte(`{"role": "user", "content": 42}`), &msg); err == nil {
+		t.Error("expected an error for numeric content")
+	}
+}
+
+func TestChatCompletionRequest_RoutingHintsStayLocal(t *testing.T) {
+	input := `{
+		"model": "massrouter/auto",
+		"messages": [{"role": "user", "content": "hi"}],
+		"response_format": {"type": "json_object"},
+		"routing": {"max_input_price": 0.001, "max_latency_ms": 2000}
+	}`
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(input), &req); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if req.Routing == nil || req.Routing.MaxInputPrice == nil || *req.Routing.MaxInputPrice != money.MustParse("0.001") {
+		t.Fatalf("Routing = %+v, want max_input_price 0.001", req.Routing)
+	}
+	if !req.JSONMode() {
+		t.Errorf("JSONMode() = false, want true")
+	}
+
+	out, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if _, ok := fields["routing"]; ok {
+		t.Errorf("routing hints were forwarded upstream: %s", out)
+	}
+}
+
+func TestStreamChunkCompletion(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"delta":{"role":"assistant","reasoning_content":"Look it up."}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"q\":\"cat\"}"}}]}}]}`,
+		`{"choices":[{"delta":{"content":"Done"}}]}`,
+	}
+
+	var completion strings.Builder
+	for _, data := range chunks {
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Unmarshal(%s) failed: %v", data, err)
+		}
+		chunk.writeCompletion(&completion)
+	}
+	if want := `Look it up.lookup{"q":"cat"}Done`; completion.String() != want {
+		t.Errorf("completion = %q, want %q", completion.String(), want)
+	}
+}
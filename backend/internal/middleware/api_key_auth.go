@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+)
+
+const (
+	APIKeyIDKey = "api_key_id"
+	APIKeyKey   = "api_key"
+)
+
+// APIKeyAuth authenticates requests with a MassRouter API key, taken from the
+// X-API-Key header or, OpenAI SDK style, from "Authorization: Bearer <key>".
+// X-API-Key wins when both are sent, so the portal can keep sending its JWT
+// alongside the key.
+func APIKeyAuth(apiKeyRepo repository.UserAPIKeyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := extractAPIKey(c)
+		if apiKey == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_401",
+					"message": "API key required",
+					"details": "Provide API key in X-API-Key header or as a Bearer token",
+				},
+			})
+			return
+		}
+
+		key, err := apiKeyRepo.ValidateKey(c.Request.Context(), apiKey)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_500",
+					"message": "Failed to validate API key",
+				},
+			})
+			return
+		}
+
+		if key == nil || !key.IsActive || (key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now())) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_401",
+					"message": "Authentication failed",
+					"details": "Invalid, inactive or expired API key",
+				},
+			})
+			return
+		}
+
+		// The owning user is preloaded with the key; a deleted or suspended
+		// user's keys stop working with them.
+		if key.User.ID == "" || key.User.Status != "active" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ERR_403",
+					"message": "Account is not active",
+				},
+			})
+			return
+		}
+
+		c.Set(UserIDKey, key.UserID)
+		c.Set(UserKey, key.User.Username)
+		c.Set(RoleKey, key.User.Role)
+		c.Set(IsAdminKey, key.User.Role == "admin")
+		c.Set(APIKeyIDKey, key.ID)
+		c.Set(APIKeyKey, key)
+
+		c.Next()
+	}
+}
+
+func extractAPIKey(c *gin.Context) string {
+	if apiKey := strings.TrimSpace(c.GetHeader("X-API-Key")); apiKey != "" {
+		return apiKey
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if token, ok := strings.CutPrefix(authHeader, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func GetAPIKeyID(c *gin.Context) (string, bool) {
+	keyID, exists := c.Get(APIKeyIDKey)
+	if !exists {
+		return "", false
+	}
+	return keyID.(string), true
+}
+
+func GetAPIKey(c *gin.Context) (*model.UserAPIKey, bool) {
+	key, exists := c.Get(APIKeyKey)
+	if !exists {
+		return nil, false
+	}
+	return key.(*model.UserAPIKey), true
+}
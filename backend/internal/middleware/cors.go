@@ -18,7 +18,7 @@ func CORS() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Disposition")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Disposition, X-MassRouter-Model")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -0,0 +1,321 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+)
+
+// TokensUsedKey holds the tokens a request consumed, set by the handler once
+// usage is known so the limiter can count it against tokens-per-minute.
+const TokensUsedKey = "tokens_used"
+
+// rateLimitCacheTTL is how long a user's limits are reused before they are
+// loaded again, so quota changes take effect without a restart.
+const rateLimitCacheTTL = 30 * time.Second
+
+// slidingWindowScript checks every window in KEYS and, only when all of them
+// have room, records the request in each. A rejected request is not counted.
+// ARGV holds the current time in milliseconds and a unique member, followed by
+// a limit and window length (ms) per key. It returns the allowed flag followed
+// by the count and milliseconds until the oldest entry expires for each key.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+local allowed = 1
+local result = {}
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[1 + i * 2])
+	local window = tonumber(ARGV[2 + i * 2])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	local reset = window
+	if count > 0 then
+		local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+		reset = tonumber(oldest[2]) + window - now
+	end
+	if count >= limit then
+		allowed = 0
+	end
+	table.insert(result, count)
+	table.insert(result, reset)
+end
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		redis.call('ZADD', key, now, member)
+		redis.call('PEXPIRE', key, ARGV[2 + i * 2])
+	end
+end
+table.insert(result, 1, allowed)
+return result
+`)
+
+// rateLimits are the ceilings that apply to one proxied request. A zero value
+// leaves that dimension unlimited.
+type rateLimits struct {
+	KeyRequestsPerMinute  int
+	UserRequestsPerMinute int
+	UserRequestsPerHour   int
+	UserTokensPerMinute   int
+}
+
+type cachedRateLimits struct {
+	quota     model.UserQuota
+	expiresAt time.Time
+}
+
+// UsageRateLimiter enforces the request and token rate limits stored with each
+// API key and user quota, so plans can be given different ceilings.
+type UsageRateLimiter struct {
+	client    *redis.Client
+	quotaRepo repository.UserQuotaRepository
+
+	mu     sync.Mutex
+	quotas map[string]cachedRateLimits
+	// Expired entries are swept out at most once per rateLimitCacheTTL, so
+	// users who stop calling don't stay cached
+	nextSweep time.Time
+}
+
+func NewUsageRateLimiter(client *redis.Client, quotaRepo repository.UserQuotaRepository) *UsageRateLimiter {
+	return &UsageRateLimiter{
+		client:    client,
+		quotaRepo: quotaRepo,
+		quotas:    make(map[string]cachedRateLimits),
+	}
+}
+
+// requestWindow is one sliding window of requests checked for a call
+type requestWindow struct {
+	key    string
+	limit  int
+	window time.Duration
+}
+
+// Limit must run after APIKeyAuth, which supplies the key and user.
+func (rl *UsageRateLimiter) Limit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString(UserIDKey)
+		if rl.client == nil || userID == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		limits := rl.limitsFor(ctx, c)
+
+		// Tokens are only known once the call completes, so the check is
+		// against what earlier calls used in the current minute.
+		var tokensKey string
+		if limits.UserTokensPerMinute > 0 {
+			tokensKey = userTokensKey(userID, time.Now())
+			used, err := rl.client.Get(ctx, tokensKey).Int64()
+			if err != nil && err != redis.Nil {
+				// Fail open when Redis is unavailable, like the other limiters
+				tokensKey = ""
+			} else {
+				remaining := int64(limits.UserTokensPerMinute) - used
+				reset := timeToNextMinute(time.Now())
+				setTokenRateLimitHeaders(c, limits.UserTokensPerMinute, remaining, reset)
+				if remaining <= 0 {
+					abortRateLimited(c, reset, fmt.Sprintf("Limit: %d tokens per minute", limits.UserTokensPerMinute))
+					return
+				}
+			}
+		}
+
+		windows := make([]requestWindow, 0, 3)
+		if key, ok := GetAPIKey(c); ok && limits.KeyRequestsPerMinute > 0 {
+			windows = append(windows, requestWindow{"rate_limit:key:" + key.ID + ":minute", limits.KeyRequestsPerMinute, time.Minute})
+		}
+		if limits.UserRequestsPerMinute > 0 {
+			windows = append(windows, requestWindow{"rate_limit:user:" + userID + ":minute", limits.UserRequestsPerMinute, time.Minute})
+		}
+		if limits.UserRequestsPerHour > 0 {
+			windows = append(windows, requestWindow{"rate_limit:user:" + userID + ":hour", limits.UserRequestsPerHour, time.Hour})
+		}
+
+		if len(windows) > 0 {
+			allowed, tightest, err := rl.hit(ctx, windows, c.ClientIP())
+			if err == nil {
+				setRequestRateLimitHeaders(c, tightest)
+				if !allowed {
+					abortRateLimited(c, tightest.reset, fmt.Sprintf("Limit: %d requests per %v", tightest.limit, tightest.window))
+					return
+				}
+			}
+		}
+
+		c.Next()
+
+		if tokensKey != "" {
+			if tokens := c.GetInt(TokensUsedKey); tokens > 0 {
+				pipe := rl.client.Pipeline()
+				pipe.IncrBy(context.WithoutCancel(ctx), tokensKey, int64(tokens))
+				pipe.Expire(context.WithoutCancel(ctx), tokensKey, 2*time.Minute)
+				_, _ = pipe.Exec(context.WithoutCancel(ctx))
+			}
+		}
+	}
+}
+
+// limitsFor returns the limits for the request's API key and user. The user's
+// quota is cached briefly; a failed lookup falls back to the default quota.
+func (rl *UsageRateLimiter) limitsFor(ctx context.Context, c *gin.Context) rateLimits {
+	quota := rl.userQuota(ctx, c.GetString(UserIDKey))
+
+	limits := rateLimits{
+		UserRequestsPerMinute: quota.PerMinuteRateLimit,
+		UserRequestsPerHour:   quota.PerHourRateLimit,
+		UserTokensPerMinute:   quota.PerMinuteTokenLimit,
+	}
+	if key, ok := GetAPIKey(c); ok {
+		limits.KeyRequestsPerMinute = key.RateLimit
+	}
+	return limits
+}
+
+func (rl *UsageRateLimiter) userQuota(ctx context.Context, userID string) model.UserQuota {
+	now := time.Now()
+
+	rl.mu.Lock()
+	cached, ok := rl.quotas[userID]
+	if ok && !now.Before(cached.expiresAt) {
+		delete(rl.quotas, userID)
+		ok = false
+	}
+	rl.mu.Unlock()
+	if ok {
+		return cached.quota
+	}
+
+	quota := model.DefaultQuota()
+	if rl.quotaRepo != nil {
+		if found, err := rl.quotaRepo.FindByUserID(ctx, userID); err == nil {
+			quota = *found
+		} else {
+			// Don't cache the fallback so the next request retries
+			return quota
+		}
+	}
+
+	rl.mu.Lock()
+	rl.quotas[userID] = cachedRateLimits{quota: quota, expiresAt: now.Add(rateLimitCacheTTL)}
+	rl.sweepLocked(now)
+	rl.mu.Unlock()
+	return quota
+}
+
+// sweepLocked drops expired quotas once per rateLimitCacheTTL. rl.mu must be
+// held.
+func (rl *UsageRateLimiter) sweepLocked(now time.Time) {
+	if now.Before(rl.nextSweep) {
+		return
+	}
+	for userID, cached := range rl.quotas {
+		if !now.Before(cached.expiresAt) {
+			delete(rl.quotas, userID)
+		}
+	}
+	rl.nextSweep = now.Add(rateLimitCacheTTL)
+}
+
+// windowState is the state of the window closest to its limit
+type windowState struct {
+	limit     int
+	remaining int
+	window    time.Duration
+	reset     time.Duration
+}
+
+// hit records a request in all windows if each has room. It reports whether
+// the request is allowed and the state of the most constrained window.
+func (rl *UsageRateLimiter) hit(ctx context.Context, windows []requestWindow, clientIP string) (bool, windowState, error) {
+	now := time.Now()
+	keys := make([]string, len(windows))
+	args := []interface{}{now.UnixMilli(), fmt.Sprintf("%d:%s", now.UnixNano(), clientIP)}
+	for i, w := range windows {
+		keys[i] = w.key
+		args = append(args, w.limit, w.window.Milliseconds())
+	}
+
+	values, err := slidingWindowScript.Run(ctx, rl.client, keys, args...).Int64Slice()
+	if err != nil {
+		return false, windowState{}, err
+	}
+
+	allowed := values[0] == 1
+	var tightest windowState
+	for i, w := range windows {
+		count := int(values[1+i*2])
+		if allowed {
+			count++
+		}
+		state := windowState{
+			limit:     w.limit,
+			remaining: max(w.limit-count, 0),
+			window:    w.window,
+			reset:     time.Duration(values[2+i*2]) * time.Millisecond,
+		}
+		if i == 0 || state.remaining < tightest.remaining {
+			tightest = state
+		}
+	}
+	return allowed, tightest, nil
+}
+
+// SetTokensUsed records the tokens a request consumed for the limiter
+func SetTokensUsed(c *gin.Context, tokens int) {
+	c.Set(TokensUsedKey, tokens)
+}
+
+func userTokensKey(userID string, now time.Time) string {
+	return "rate_limit:user:" + userID + ":tokens:" + strconv.FormatInt(now.Unix()/60, 10)
+}
+
+func timeToNextMinute(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+func setRequestRateLimitHeaders(c *gin.Context, state windowState) {
+	h := c.Writer.Header()
+	h.Set("x-ratelimit-limit-requests", strconv.Itoa(state.limit))
+	h.Set("x-ratelimit-remaining-requests", strconv.Itoa(state.remaining))
+	h.Set("x-ratelimit-reset-requests", formatReset(state.reset))
+}
+
+func setTokenRateLimitHeaders(c *gin.Context, limit int, remaining int64, reset time.Duration) {
+	h := c.Writer.Header()
+	h.Set("x-ratelimit-limit-tokens", strconv.Itoa(limit))
+	h.Set("x-ratelimit-remaining-tokens", strconv.FormatInt(max(remaining, 0), 10))
+	h.Set("x-ratelimit-reset-tokens", formatReset(reset))
+}
+
+func abortRateLimited(c *gin.Context, retryAfter time.Duration, details string) {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code":    "ERR_429",
+			"message": "Rate limit exceeded",
+			"details": details,
+		},
+	})
+}
+
+// formatReset renders a reset duration the way OpenAI does, e.g. "1m30s"
+func formatReset(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"time"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+// ModelDeployment is one place a public model can be served from: a provider
+// and the provider's identifier for the model. A model's deployments form its
+// failover chain; they are tried in Priority order, and deployments sharing a
+// priority split traffic by Weight.
+type ModelDeployment struct {
+	ID         string `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	ModelID    string `gorm:"type:uuid;not null;index" json:"model_id"`
+	ProviderID string `gorm:"type:uuid;not null;index" json:"provider_id"`
+
+	// UpstreamModel is the provider's identifier for the model. Empty means
+	// the public model name.
+	UpstreamModel string `gorm:"type:varchar(255)" json:"upstream_model,omitempty"`
+
+	Priority int `gorm:"not null;default:0" json:"priority"` // Lower is tried first
+	Weight   int `gorm:"not null;default:1" json:"weight"`   // Share of traffic within a priority
+
+	// Prices override the model's prices for calls this deployment serves
+	InputPrice  *money.Amount `gorm:"type:decimal(18,8)" json:"input_price,omitempty"`
+	OutputPrice *money.Amount `gorm:"type:decimal(18,8)" json:"output_price,omitempty"`
+
+	IsActive  bool      `gorm:"not null;default:true;index" json:"is_active"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
+
+	Model    Model         `gorm:"foreignKey:ModelID" json:"-"`
+	Provider ModelProvider `gorm:"foreignKey:ProviderID" json:"provider,omitempty"`
+}
+
+func (ModelDeployment) TableName() string {
+	return "model_deployments"
+}
+
+// DefaultDeployment describes how a model without deployments is served: by
+// its own provider, under its own name and prices. It has no ID.
+func DefaultDeployment(m *Model) *ModelDeployment {
+	return &ModelDeployment{
+		ModelID:       m.ID,
+		ProviderID:    m.ProviderID,
+		UpstreamModel: m.Name,
+		Weight:        1,
+		IsActive:      true,
+		Model:         *m,
+		Provider:      m.Provider,
+	}
+}
+
+// UpstreamModelName returns the identifier to send to the provider
+func (d *ModelDeployment) UpstreamModelName(m *Model) string {
+	if d.UpstreamModel != "" {
+		return d.UpstreamModel
+	}
+	return m.Name
+}
+
+// Prices returns the per-1K-token input and output prices for calls served by
+// this deployment, falling back to the model's prices
+func (d *ModelDeployment) Prices(m *Model) (money.Amount, money.Amount) {
+	inputPrice, outputPrice := m.InputPrice, m.OutputPrice
+	if d.InputPrice != nil {
+		inputPrice = *d.InputPrice
+	}
+	if d.OutputPrice != nil {
+		outputPrice = *d.OutputPrice
+	}
+	return inputPrice, outputPrice
+}
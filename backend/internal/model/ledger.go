@@ -0,0 +1,107 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+// Ledger entry types. Credits, debits, refunds and adjustments change an
+// account's balance; holds and releases change the part of it that is held.
+const (
+	LedgerEntryCredit     = "credit"     // Money paid in
+	LedgerEntryDebit      = "debit"      // Usage charged
+	LedgerEntryRefund     = "refund"     // Money paid back out
+	LedgerEntryAdjustment = "adjustment" // Manual correction, either way
+	LedgerEntryHold       = "hold"       // Balance set aside
+	LedgerEntryRelease    = "release"    // Held balance freed
+)
+
+// Sources ledger entries reference
+const (
+	LedgerRefPaymentRecord = "payment_record"
+	LedgerRefBillingRecord = "billing_record"
+	LedgerRefAdminRequest  = "admin_request" // An admin's manual entry, by an ID the admin picks
+)
+
+// LedgerAccount is a user's running balance, kept in step with the sum of
+// their ledger entries
+type LedgerAccount struct {
+	UserID    string       `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Balance   money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"balance"`
+	Held      money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"held"`
+	CreatedAt time.Time    `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time    `gorm:"not null" json:"updated_at"`
+}
+
+// LedgerEntry is one change to an account. Entries are append-only; a
+// mistake is corrected with another entry. Amount is signed: credits and
+// holds are positive, debits, refunds and releases negative, and adjustments
+// either. An entry with a reference is posted at most once per type.
+type LedgerEntry struct {
+	ID            string       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	UserID        string       `gorm:"type:uuid;not null;index" json:"user_id"`
+	Type          string       `gorm:"type:varchar(20);not null" json:"type"`
+	Amount        money.Amount `gorm:"type:decimal(18,8);not null" json:"amount"`
+	BalanceAfter  money.Amount `gorm:"type:decimal(18,8);not null" json:"balance_after"`
+	HeldAfter     money.Amount `gorm:"type:decimal(18,8);not null" json:"held_after"`
+	ReferenceType string       `gorm:"type:varchar(50)" json:"reference_type,omitempty"`
+	ReferenceID   *string      `gorm:"type:uuid" json:"reference_id,omitempty"`
+	Description   string       `gorm:"type:text" json:"description,omitempty"`
+	Metadata      JSONB        `gorm:"type:jsonb;not null;default:'{}'" json:"metadata"`
+	CreatedAt     time.Time    `gorm:"not null;index" json:"created_at"`
+}
+
+func (LedgerAccount) TableName() string {
+	return "ledger_accounts"
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// IsHoldEntry reports whether the entry changes the held balance rather than
+// the balance
+func (e *LedgerEntry) IsHoldEntry() bool {
+	return e.Type == LedgerEntryHold || e.Type == LedgerEntryRelease
+}
+
+// Validate checks that the entry's amount has the sign its type requires
+func (e *LedgerEntry) Validate() error {
+	switch e.Type {
+	case LedgerEntryCredit, LedgerEntryHold:
+		if e.Amount <= 0 {
+			return fmt.Errorf("%s amount must be positive", e.Type)
+		}
+	case LedgerEntryDebit, LedgerEntryRefund, LedgerEntryRelease:
+		if e.Amount >= 0 {
+			return fmt.Errorf("%s amount must be negative", e.Type)
+		}
+	case LedgerEntryAdjustment:
+		if e.Amount == 0 {
+			return fmt.Errorf("%s amount cannot be zero", e.Type)
+		}
+	default:
+		return fmt.Errorf("unknown ledger entry type: %s", e.Type)
+	}
+	if e.UserID == "" {
+		return fmt.Errorf("ledger entry has no account")
+	}
+	if (e.ReferenceType == "") != (e.ReferenceID == nil) {
+		return fmt.Errorf("ledger entry reference needs both a type and an id")
+	}
+	return nil
+}
+
+// Apply adds the entry to the account and records the resulting balances on
+// the entry
+func (a *LedgerAccount) Apply(e *LedgerEntry) {
+	if e.IsHoldEntry() {
+		a.Held += e.Amount
+	} else {
+		a.Balance += e.Amount
+	}
+	e.BalanceAfter = a.Balance
+	e.HeldAfter = a.Held
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+func TestLedgerEntry_Validate(t *testing.T) {
+	ref := "3f0c6a52-5b1e-4c8e-9a53-2f7d2b8e8a10"
+	tests := []struct {
+		name    string
+		entry   LedgerEntry
+		wantErr bool
+	}{
+		{"credit", LedgerEntry{UserID: "u", Type: LedgerEntryCredit, Amount: money.MustParse("10")}, false},
+		{"negative credit", LedgerEntry{UserID: "u", Type: LedgerEntryCredit, Amount: money.MustParse("-10")}, true},
+		{"debit", LedgerEntry{UserID: "u", Type: LedgerEntryDebit, Amount: money.MustParse("-0.5")}, false},
+		{"positive debit", LedgerEntry{UserID: "u", Type: LedgerEntryDebit, Amount: money.MustParse("0.5")}, true},
+		{"refund", LedgerEntry{UserID: "u", Type: LedgerEntryRefund, Amount: money.MustParse("-5")}, false},
+		{"hold", LedgerEntry{UserID: "u", Type: LedgerEntryHold, Amount: money.MustParse("1")}, false},
+		{"positive release", LedgerEntry{UserID: "u", Type: LedgerEntryRelease, Amount: money.MustParse("1")}, true},
+		{"adjustment down", LedgerEntry{UserID: "u", Type: LedgerEntryAdjustment, Amount: money.MustParse("-3")}, false},
+		{"zero adjustment", LedgerEntry{UserID: "u", Type: LedgerEntryAdjustment}, true},
+		{"unknown type", LedgerEntry{UserID: "u", Type: "bonus", Amount: money.MustParse("1")}, true},
+		{"no account", LedgerEntry{Type: LedgerEntryCredit, Amount: money.MustParse("1")}, true},
+		{"reference", LedgerEntry{UserID: "u", Type: LedgerEntryCredit, Amount: money.MustParse("1"), ReferenceType: LedgerRefPaymentRecord, ReferenceID: &ref}, false},
+		{"reference without id", LedgerEntry{UserID: "u", Type: LedgerEntryCredit, Amount: money.MustParse("1"), ReferenceType: LedgerRefPaymentRecord}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLedgerAccount_Apply(t *testing.T) {
+	account := &LedgerAccount{UserID: "u"}
+	entries := []*LedgerEntry{
+		{Type: LedgerEntryCredit, Amount: money.MustParse("20")},
+		{Type: LedgerEntryHold, Amount: money.MustParse("5")},
+		{Type: LedgerEntryDebit, Amount: money.MustParse("-2.5")},
+		{Type: LedgerEntryRelease, Amount: money.MustParse("-5")},
+	}
+	for _, entry := range entries {
+		account.Apply(entry)
+	}
+
+	if account.Balance != money.MustParse("17.5") || account.Held != 0 {
+		t.Errorf("account = %s held %s, want 17.5 held 0", account.Balance, account.Held)
+	}
+	if entries[1].BalanceAfter != money.FromInt(20) || entries[1].HeldAfter != money.FromInt(5) {
+		t.Errorf("hold entry after = %s held %s, want 20 held 5", entries[1].BalanceAfter, entries[1].HeldAfter)
+	}
+	if entries[2].BalanceAfter != money.MustParse("17.5") {
+		t.Errorf("debit entry balance after = %s, want 17.5", entries[2].BalanceAfter)
+	}
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"time"
+
+	"massrouter.ai/backend/pkg/money"
 )
 
 type ModelProvider struct {
@@ -14,25 +16,26 @@ type ModelProvider struct {
 	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
 	UpdatedAt  time.Time `gorm:"not null" json:"updated_at"`
 
-	Models []Model `gorm:"foreignKey:ProviderID" json:"models,omitempty"`
+	Models      []Model              `gorm:"foreignKey:ProviderID" json:"models,omitempty"`
+	Credentials []ProviderCredential `gorm:"foreignKey:ProviderID" json:"-"`
 }
 
 type Model struct {
-	ID            string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
-	ProviderID    string    `gorm:"type:uuid;not null;index" json:"provider_id"`
-	Name          string    `gorm:"type:varchar(255);not null" json:"name"`
-	Description   string    `gorm:"type:text" json:"description,omitempty"`
-	ContextLength *int      `gorm:"type:integer" json:"context_length,omitempty"`
-	MaxTokens     *int      `gorm:"type:integer" json:"max_tokens,omitempty"`
-	Capabilities  JSONB     `gorm:"type:jsonb;not null;default:'{}'" json:"capabilities"`
-	Category      string    `gorm:"type:varchar(100);index" json:"category,omitempty"`
-	PricingTier   string    `gorm:"type:varchar(50)" json:"pricing_tier,omitempty"`
-	InputPrice    float64   `gorm:"type:decimal(10,8);not null;default:0" json:"input_price"`
-	OutputPrice   float64   `gorm:"type:decimal(10,8);not null;default:0" json:"output_price"`
-	IsFree        bool      `gorm:"not null;default:false" json:"is_free"`
-	IsActive      bool      `gorm:"not null;default:true;index" json:"is_active"`
-	CreatedAt     time.Time `gorm:"not null" json:"created_at"`
-	UpdatedAt     time.Time `gorm:"not null" json:"updated_at"`
+	ID            string       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	ProviderID    string       `gorm:"type:uuid;not null;index" json:"provider_id"`
+	Name          string       `gorm:"type:varchar(255);not null" json:"name"`
+	Description   string       `gorm:"type:text" json:"description,omitempty"`
+	ContextLength *int         `gorm:"type:integer" json:"context_length,omitempty"`
+	MaxTokens     *int         `gorm:"type:integer" json:"max_tokens,omitempty"`
+	Capabilities  JSONB        `gorm:"type:jsonb;not null;default:'{}'" json:"capabilities"`
+	Category      string       `gorm:"type:varchar(100);index" json:"category,omitempty"`
+	PricingTier   string       `gorm:"type:varchar(50)" json:"pricing_tier,omitempty"`
+	InputPrice    money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"input_price"`
+	OutputPrice   money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"output_price"`
+	IsFree        bool         `gorm:"not null;default:false" json:"is_free"`
+	IsActive      bool         `gorm:"not null;default:true;index" json:"is_active"`
+	CreatedAt     time.Time    `gorm:"not null" json:"created_at"`
+	UpdatedAt     time.Time    `gorm:"not null" json:"updated_at"`
 
 	Provider        ModelProvider    `gorm:"foreignKey:ProviderID" json:"provider,omitempty"`
 	BillingRecords  []BillingRecord  `gorm:"foreignKey:ModelID" json:"billing_records,omitempty"`
@@ -71,6 +74,23 @@ func (Model) TableName() string {
 	return "models"
 }
 
+// HasCapability reports whether a model's capabilities flag the feature
+func (m *Model) HasCapability(name string) bool {
+	enabled, _ := m.Capabilities[name].(bool)
+	return enabled
+}
+
+// TokenizerEncoding returns the tokenizer encoding set as "tokenizer" in the
+// model's capabilities or, failing that, its provider's config. Empty means
+// the encoding is inferred from the model name.
+func (m *Model) TokenizerEncoding() string {
+	if encoding, ok := m.Capabilities["tokenizer"].(string); ok && encoding != "" {
+		return encoding
+	}
+	encoding, _ := m.Provider.Config["tokenizer"].(string)
+	return encoding
+}
+
 func (UserAPIKey) TableName() string {
 	return "user_api_keys"
 }
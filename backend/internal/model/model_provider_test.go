@@ -3,6 +3,8 @@ package model
 import (
 	"testing"
 	"time"
+
+	"massrouter.ai/backend/pkg/money"
 )
 
 func TestModelProvider_TableName(t *testing.T) {
@@ -118,8 +120,8 @@ func TestModel_Validate(t *testing.T) {
 				Capabilities:  JSONB{"vision": true},
 				Category:      "chat",
 				PricingTier:   "premium",
-				InputPrice:    0.005,
-				OutputPrice:   0.015,
+				InputPrice:    money.MustParse("0.005"),
+				OutputPrice:   money.MustParse("0.015"),
 				IsFree:        false,
 				IsActive:      true,
 				CreatedAt:     now,
@@ -21,6 +21,15 @@ type Permission struct {
 	Constraints map[string]interface{} `json:"constraints,omitempty"`
 }
 
+// ActionChat is the operation of generating completions with a model
+const ActionChat = "chat"
+
+// impliedActions lists the actions that also grant an action. Keys created
+// before "chat" existed were given "write" to call models.
+var impliedActions = map[string][]string{
+	ActionChat: {"write", "admin"},
+}
+
 // PermissionSet represents a collection of permissions for an API key
 type PermissionSet struct {
 	Permissions []Permission `json:"permissions"`
@@ -130,6 +139,20 @@ func (ps *PermissionSet) CheckModelAccess(modelID, operation string) bool {
 	return ps.HasPermission("model", modelID, operation)
 }
 
+// Allows checks a permission like HasPermission, also accepting the actions
+// that imply the requested one
+func (ps *PermissionSet) Allows(resourceType, resourceID, action string) bool {
+	if ps.HasPermission(resourceType, resourceID, action) {
+		return true
+	}
+	for _, implied := range impliedActions[action] {
+		if ps.HasPermission(resourceType, resourceID, implied) {
+			return true
+		}
+	}
+	return false
+}
+
 // ToJSONB converts PermissionSet to JSONB for database storage
 func (ps *PermissionSet) ToJSONB() JSONB {
 	data, _ := json.Marshal(ps)
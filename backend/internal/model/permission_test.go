@@ -0,0 +1,64 @@
+package model
+
+import "testing"
+
+func TestPermissionSet_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		ps       *PermissionSet
+		modelID  string
+		action   string
+		expected bool
+	}{
+		{
+			name:     "full access allows chat",
+			ps:       NewFullAccessPermissionSet(),
+			modelID:  "model-1",
+			action:   ActionChat,
+			expected: true,
+		},
+		{
+			name:     "explicit chat permission",
+			ps:       NewModelSpecificPermissionSet([]string{"model-1"}, []string{ActionChat}),
+			modelID:  "model-1",
+			action:   ActionChat,
+			expected: true,
+		},
+		{
+			name:     "write implies chat",
+			ps:       NewModelSpecificPermissionSet([]string{"*"}, []string{"write"}),
+			modelID:  "model-1",
+			action:   ActionChat,
+			expected: true,
+		},
+		{
+			name:     "read does not imply chat",
+			ps:       NewModelSpecificPermissionSet([]string{"*"}, []string{"read"}),
+			modelID:  "model-1",
+			action:   ActionChat,
+			expected: false,
+		},
+		{
+			name:     "other model denied",
+			ps:       NewModelSpecificPermissionSet([]string{"model-1"}, []string{ActionChat}),
+			modelID:  "model-2",
+			action:   ActionChat,
+			expected: false,
+		},
+		{
+			name:     "chat does not imply write",
+			ps:       NewModelSpecificPermissionSet([]string{"model-1"}, []string{ActionChat}),
+			modelID:  "model-1",
+			action:   "write",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ps.Allows("model", tt.modelID, tt.action); got != tt.expected {
+				t.Errorf("Allows() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	CredentialStatusActive   = "active"
+	CredentialStatusDisabled = "disabled"
+)
+
+// Credential selection strategies, set per provider as config.credential_strategy
+const (
+	CredentialStrategyRoundRobin  = "round_robin"
+	CredentialStrategyLeastLoaded = "least_loaded"
+)
+
+// ProviderCredential is one of the upstream API keys a provider's calls are
+// spread across; a provider without credentials uses its own APIKey. A key
+// that is rate limited upstream is rested until CooldownUntil, and one that
+// keeps failing authentication is disabled.
+type ProviderCredential struct {
+	ID         string `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	ProviderID string `gorm:"type:uuid;not null;index" json:"provider_id"`
+	Name       string `gorm:"type:varchar(255);not null" json:"name"`
+	APIKey     string `gorm:"type:varchar(512);not null" json:"-"`
+	MaskedKey  string `gorm:"type:varchar(32);not null" json:"masked_key"`
+	Weight     int    `gorm:"not null;default:1" json:"weight"`
+	Status     string `gorm:"type:varchar(50);not null;default:'active';index" json:"status"`
+
+	// Budgets the upstream grants this key (0 = unlimited)
+	RPMLimit int `gorm:"not null;default:0" json:"rpm_limit"`
+	TPMLimit int `gorm:"not null;default:0" json:"tpm_limit"`
+
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	AuthFailures  int        `gorm:"not null;default:0" json:"auth_failures"` // Consecutive 401s
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt     time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"not null" json:"updated_at"`
+}
+
+func (ProviderCredential) TableName() string {
+	return "provider_credentials"
+}
+
+// Available reports whether the credential can be used at the given time
+func (c *ProviderCredential) Available(now time.Time) bool {
+	if c.Status != CredentialStatusActive {
+		return false
+	}
+	return c.CooldownUntil == nil || !now.Before(*c.CooldownUntil)
+}
+
+// MaskAPIKey returns a form of an API key that is safe to display, keeping
+// only enough characters to tell keys apart
+func MaskAPIKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
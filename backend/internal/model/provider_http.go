@@ -0,0 +1,138 @@
+package model
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Defaults for ProviderHTTPSettings fields a provider's config leaves out
+const (
+	DefaultProviderConnectTimeout   = 10 * time.Second
+	DefaultProviderFirstByteTimeout = 60 * time.Second
+	DefaultProviderIdleTimeout      = 60 * time.Second
+	DefaultProviderRequestTimeout   = 10 * time.Minute
+	DefaultProviderIdleConnTimeout  = 90 * time.Second
+)
+
+// ProviderHTTPSettings tunes the connection pool a provider is called
+// through. It is read from the "http" object of ModelProvider.Config, where
+// timeouts are duration strings such as "30s" or numbers of seconds:
+//
+//	{"http": {"connect_timeout": "5s", "max_connections": 64,
+//	          "proxy_url": "http://egress:3128", "headers": {"X-Org": "acme"}}}
+type ProviderHTTPSettings struct {
+	ConnectTimeout   time.Duration // Dialing and the TLS handshake
+	FirstByteTimeout time.Duration // Until a stream's response headers arrive
+	IdleTimeout      time.Duration // Longest wait for the next chunk of a stream
+	RequestTimeout   time.Duration // Whole buffered (non-streaming) call
+	IdleConnTimeout  time.Duration // How long an unused pooled connection is kept
+
+	MaxConnections int  // Per host, 0 = unlimited
+	HTTP2          bool // Negotiate HTTP/2 over TLS (default true)
+
+	ProxyURL *url.URL          // Outbound proxy; nil uses the environment's
+	CABundle string            // PEM certificates trusted instead of the system roots
+	Headers  map[string]string // Sent with every request
+}
+
+// providerHTTPConfig is the stored form of ProviderHTTPSettings
+type providerHTTPConfig struct {
+	ConnectTimeout   interface{}       `json:"connect_timeout"`
+	FirstByteTimeout interface{}       `json:"first_byte_timeout"`
+	IdleTimeout      interface{}       `json:"idle_timeout"`
+	RequestTimeout   interface{}       `json:"request_timeout"`
+	IdleConnTimeout  interface{}       `json:"idle_conn_timeout"`
+	MaxConnections   int               `json:"max_connections"`
+	HTTP2            *bool             `json:"http2"`
+	ProxyURL         string            `json:"proxy_url"`
+	CABundle         string            `json:"ca_bundle"`
+	Headers          map[string]string `json:"headers"`
+}
+
+// HTTPSettings parses the provider's "http" config, filling in defaults
+func (p *ModelProvider) HTTPSettings() (*ProviderHTTPSettings, error) {
+	return ParseProviderHTTPSettings(p.Config)
+}
+
+// ParseProviderHTTPSettings parses the "http" object of a provider config,
+// filling in defaults. It fails on values the transport could not use.
+func ParseProviderHTTPSettings(config map[string]interface{}) (*ProviderHTTPSettings, error) {
+	var raw providerHTTPConfig
+	if section, ok := config["http"]; ok && section != nil {
+		data, err := json.Marshal(section)
+		if err != nil {
+			return nil, fmt.Errorf("http: %w", err)
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("http: %w", err)
+		}
+	}
+
+	settings := &ProviderHTTPSettings{
+		MaxConnections: raw.MaxConnections,
+		HTTP2:          raw.HTTP2 == nil || *raw.HTTP2,
+		CABundle:       raw.CABundle,
+		Headers:        raw.Headers,
+	}
+
+	timeouts := []struct {
+		name  string
+		value interface{}
+		def   time.Duration
+		dst   *time.Duration
+	}{
+		{"connect_timeout", raw.ConnectTimeout, DefaultProviderConnectTimeout, &settings.ConnectTimeout},
+		{"first_byte_timeout", raw.FirstByteTimeout, DefaultProviderFirstByteTimeout, &settings.FirstByteTimeout},
+		{"idle_timeout", raw.IdleTimeout, DefaultProviderIdleTimeout, &settings.IdleTimeout},
+		{"request_timeout", raw.RequestTimeout, DefaultProviderRequestTimeout, &settings.RequestTimeout},
+		{"idle_conn_timeout", raw.IdleConnTimeout, DefaultProviderIdleConnTimeout, &settings.IdleConnTimeout},
+	}
+	for _, t := range timeouts {
+		d, err := parseTimeout(t.value, t.def)
+		if err != nil {
+			return nil, fmt.Errorf("http.%s: %w", t.name, err)
+		}
+		*t.dst = d
+	}
+
+	if settings.MaxConnections < 0 {
+		return nil, fmt.Errorf("http.max_connections cannot be negative")
+	}
+	if raw.ProxyURL != "" {
+		proxyURL, err := url.Parse(raw.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("http.proxy_url must be an absolute URL")
+		}
+		settings.ProxyURL = proxyURL
+	}
+	if settings.CABundle != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(settings.CABundle)) {
+		return nil, fmt.Errorf("http.ca_bundle contains no PEM certificates")
+	}
+	return settings, nil
+}
+
+// parseTimeout reads a duration string or a number of seconds
+func parseTimeout(value interface{}, def time.Duration) (time.Duration, error) {
+	var d time.Duration
+	switch v := value.(type) {
+	case nil:
+		return def, nil
+	case float64:
+		d = time.Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, err
+		}
+		d = parsed
+	default:
+		return 0, fmt.Errorf("must be a duration string or a number of seconds")
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProviderHTTPSettings(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		settings, err := ParseProviderHTTPSettings(JSONB{"type": "openai"})
+		if err != nil {
+			t.Fatalf("ParseProviderHTTPSettings() error = %v", err)
+		}
+		if settings.ConnectTimeout != DefaultProviderConnectTimeout || settings.RequestTimeout != DefaultProviderRequestTimeout {
+			t.Errorf("timeouts = %s/%s, want defaults", settings.ConnectTimeout, settings.RequestTimeout)
+		}
+		if !settings.HTTP2 || settings.ProxyURL != nil {
+			t.Errorf("HTTP2 = %v, ProxyURL = %v, want HTTP/2 and no proxy", settings.HTTP2, settings.ProxyURL)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		settings, err := ParseProviderHTTPSettings(JSONB{"http": map[string]interface{}{
+			"connect_timeout": "3s",
+			"idle_timeout":    float64(90),
+			"max_connections": float64(16),
+			"http2":           false,
+			"proxy_url":       "http://egress.internal:3128",
+			"headers":         map[string]interface{}{"X-Org": "acme"},
+		}})
+		if err != nil {
+			t.Fatalf("ParseProviderHTTPSettings() error = %v", err)
+		}
+		if settings.ConnectTimeout != 3*time.Second || settings.IdleTimeout != 90*time.Second {
+			t.Errorf("timeouts = %s/%s, want 3s/1m30s", settings.ConnectTimeout, settings.IdleTimeout)
+		}
+		if settings.MaxConnections != 16 || settings.HTTP2 || settings.ProxyURL.Host != "egress.internal:3128" || settings.Headers["X-Org"] != "acme" {
+			t.Errorf("settings = %+v", settings)
+		}
+	})
+
+	invalid := map[string]map[string]interface{}{
+		"bad duration":    {"request_timeout": "soon"},
+		"zero timeout":    {"idle_timeout": float64(0)},
+		"negative pool":   {"max_connections": float64(-1)},
+		"relative proxy":  {"proxy_url": "egress:3128"},
+		"not a CA bundle": {"ca_bundle": "not a certificate"},
+	}
+	for name, config := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseProviderHTTPSettings(JSONB{"http": config}); err == nil {
+				t.Error("ParseProviderHTTPSettings() error = nil, want an error")
+			}
+		})
+	}
+}
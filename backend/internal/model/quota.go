@@ -1,7 +1,10 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
+
+	"massrouter.ai/backend/pkg/money"
 )
 
 // UserQuota represents the quota limits for a user
@@ -10,23 +13,25 @@ type UserQuota struct {
 	UserID string `gorm:"type:uuid;not null;uniqueIndex" json:"user_id"`
 
 	// Daily limits
-	DailyRequestLimit int     `gorm:"not null;default:100" json:"daily_request_limit"`                   // Maximum requests per day
-	DailyTokenLimit   int     `gorm:"not null;default:100000" json:"daily_token_limit"`                  // Maximum tokens per day
-	DailyCostLimit    float64 `gorm:"type:decimal(10,4);not null;default:10.00" json:"daily_cost_limit"` // Maximum cost per day
+	DailyRequestLimit int          `gorm:"not null;default:100" json:"daily_request_limit"`                   // Maximum requests per day
+	DailyTokenLimit   int          `gorm:"not null;default:100000" json:"daily_token_limit"`                  // Maximum tokens per day
+	DailyCostLimit    money.Amount `gorm:"type:decimal(18,8);not null;default:10.00" json:"daily_cost_limit"` // Maximum cost per day
 
 	// Monthly limits
-	MonthlyRequestLimit int     `gorm:"not null;default:3000" json:"monthly_request_limit"`                   // Maximum requests per month
-	MonthlyTokenLimit   int     `gorm:"not null;default:3000000" json:"monthly_token_limit"`                  // Maximum tokens per month
-	MonthlyCostLimit    float64 `gorm:"type:decimal(10,4);not null;default:300.00" json:"monthly_cost_limit"` // Maximum cost per month
+	MonthlyRequestLimit int          `gorm:"not null;default:3000" json:"monthly_request_limit"`                   // Maximum requests per month
+	MonthlyTokenLimit   int          `gorm:"not null;default:3000000" json:"monthly_token_limit"`                  // Maximum tokens per month
+	MonthlyCostLimit    money.Amount `gorm:"type:decimal(18,8);not null;default:300.00" json:"monthly_cost_limit"` // Maximum cost per month
 
-	// Model-specific limits (stored as JSON for flexibility)
+	// Model-specific limits (stored as JSON for flexibility, see ModelLimits)
 	ModelLimits JSONB `gorm:"type:jsonb;not null;default:'{}'" json:"model_limits"`
 
 	// Rate limiting
-	PerMinuteRateLimit int `gorm:"not null;default:60" json:"per_minute_rate_limit"` // Requests per minute
-	PerHourRateLimit   int `gorm:"not null;default:1000" json:"per_hour_rate_limit"` // Requests per hour
+	PerMinuteRateLimit  int `gorm:"not null;default:60" json:"per_minute_rate_limit"`     // Requests per minute
+	PerHourRateLimit    int `gorm:"not null;default:1000" json:"per_hour_rate_limit"`     // Requests per hour
+	PerMinuteTokenLimit int `gorm:"not null;default:40000" json:"per_minute_token_limit"` // Tokens per minute (0 = unlimited)
 
-	// Reset configuration
+	// Reset configuration. Days start at midnight in Timezone, and billing
+	// cycles on ResetDay, or the last day of months shorter than that.
 	ResetDay int    `gorm:"not null;default:1" json:"reset_day"`                      // Day of month for monthly reset (1-31)
 	Timezone string `gorm:"type:varchar(100);not null;default:'UTC'" json:"timezone"` // Timezone for reset calculations
 
@@ -42,12 +47,12 @@ type UserQuota struct {
 type UserUsage struct {
 	ID     string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	UserID string    `gorm:"type:uuid;not null;index" json:"user_id"`
-	Date   time.Time `gorm:"type:date;not null;index" json:"date"` // Date for daily usage
+	Date   time.Time `gorm:"type:date;not null;index" json:"date"` // Date for daily usage, in the quota's timezone
 
 	// Daily usage counts
-	RequestCount int     `gorm:"not null;default:0" json:"request_count"`
-	TokenCount   int     `gorm:"not null;default:0" json:"token_count"`
-	TotalCost    float64 `gorm:"type:decimal(10,8);not null;default:0" json:"total_cost"`
+	RequestCount int          `gorm:"not null;default:0" json:"request_count"`
+	TokenCount   int          `gorm:"not null;default:0" json:"token_count"`
+	TotalCost    money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"total_cost"`
 
 	// Model-specific usage (stored as JSON for flexibility)
 	ModelUsage JSONB `gorm:"type:jsonb;not null;default:'{}'" json:"model_usage"`
@@ -68,12 +73,12 @@ type UserUsage struct {
 type MonthlyUsage struct {
 	ID        string `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	UserID    string `gorm:"type:uuid;not null;index" json:"user_id"`
-	YearMonth string `gorm:"type:varchar(7);not null;index" json:"year_month"` // Format: "2025-01"
+	YearMonth string `gorm:"type:varchar(7);not null;index" json:"year_month"` // Month the billing cycle starts in, format: "2025-01"
 
 	// Monthly usage counts
-	RequestCount int     `gorm:"not null;default:0" json:"request_count"`
-	TokenCount   int     `gorm:"not null;default:0" json:"token_count"`
-	TotalCost    float64 `gorm:"type:decimal(10,4);not null;default:0" json:"total_cost"`
+	RequestCount int          `gorm:"not null;default:0" json:"request_count"`
+	TokenCount   int          `gorm:"not null;default:0" json:"token_count"`
+	TotalCost    money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"total_cost"`
 
 	// Model-specific usage (stored as JSON for flexibility)
 	ModelUsage JSONB `gorm:"type:jsonb;not null;default:'{}'" json:"model_usage"`
@@ -86,6 +91,117 @@ type MonthlyUsage struct {
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
+// Quota periods
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+// Why a quota snapshot was taken
+const (
+	QuotaSnapshotRollover = "rollover" // The window ended
+	QuotaSnapshotReset    = "reset"    // The window's usage was cleared
+)
+
+// QuotaSnapshot records a user's usage in one daily or monthly window, with
+// the limits that applied to it, as it stood when the window ended or was
+// reset
+type QuotaSnapshot struct {
+	ID       string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	UserID   string    `gorm:"type:uuid;not null;index" json:"user_id"`
+	Period   string    `gorm:"type:varchar(10);not null" json:"period"` // QuotaPeriodDaily or QuotaPeriodMonthly
+	Bucket   string    `gorm:"type:varchar(10);not null" json:"bucket"` // UserUsage date or MonthlyUsage year_month
+	Reason   string    `gorm:"type:varchar(20);not null" json:"reason"` // QuotaSnapshotRollover or QuotaSnapshotReset
+	Timezone string    `gorm:"type:varchar(100);not null" json:"timezone"`
+	StartsAt time.Time `gorm:"not null" json:"starts_at"`
+	EndsAt   time.Time `gorm:"not null" json:"ends_at"`
+
+	RequestCount int          `gorm:"not null;default:0" json:"request_count"`
+	TokenCount   int          `gorm:"not null;default:0" json:"token_count"`
+	TotalCost    money.Amount `gorm:"type:decimal(18,8);not null;default:0" json:"total_cost"`
+	ModelUsage   JSONB        `gorm:"type:jsonb;not null;default:'{}'" json:"model_usage"`
+
+	RequestLimit int          `gorm:"not null" json:"request_limit"`
+	TokenLimit   int          `gorm:"not null" json:"token_limit"`
+	CostLimit    money.Amount `gorm:"type:decimal(18,8);not null" json:"cost_limit"`
+	IsExceeded   bool         `gorm:"not null;default:false" json:"is_exceeded"` // True if usage passed any of the limits
+
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+// ModelLimit caps the usage of one model or model category. Zero values are
+// unlimited.
+type ModelLimit struct {
+	DailyRequests   int          `json:"daily_requests,omitempty"`
+	DailyTokens     int          `json:"daily_tokens,omitempty"`
+	DailyCost       money.Amount `json:"daily_cost,omitempty"`
+	MonthlyRequests int          `json:"monthly_requests,omitempty"`
+	MonthlyTokens   int          `json:"monthly_tokens,omitempty"`
+	MonthlyCost     money.Amount `json:"monthly_cost,omitempty"`
+}
+
+// ModelLimits is the schema of UserQuota.ModelLimits, e.g.
+// {"models": {"<model id>": {"daily_requests": 50}}, "categories": {"chat": {"monthly_cost": 20}}}
+type ModelLimits struct {
+	// Models are keyed by model ID
+	Models map[string]ModelLimit `json:"models,omitempty"`
+
+	// Categories are keyed by Model.Category and cover every model in it
+	Categories map[string]ModelLimit `json:"categories,omitempty"`
+}
+
+// ModelUsageEntry is one entry of UserUsage.ModelUsage and
+// MonthlyUsage.ModelUsage, keyed by model ID or by CategoryUsageKey
+type ModelUsageEntry struct {
+	Requests int          `json:"requests"`
+	Tokens   int          `json:"tokens"`
+	Cost     money.Amount `json:"cost"`
+}
+
+// CategoryUsageKey is the ModelUsage key under which a category's usage is
+// accumulated, kept apart from model IDs
+func CategoryUsageKey(category string) string {
+	return "category:" + category
+}
+
+// ModelLimitsFromJSONB parses UserQuota.ModelLimits
+func ModelLimitsFromJSONB(j JSONB) (*ModelLimits, error) {
+	var limits ModelLimits
+	if len(j) == 0 {
+		return &limits, nil
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &limits); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// IsEmpty reports whether no model or category is limited
+func (l *ModelLimits) IsEmpty() bool {
+	return len(l.Models) == 0 && len(l.Categories) == 0
+}
+
+// ModelUsageEntryFromJSONB returns the usage recorded under key, or zero usage
+func ModelUsageEntryFromJSONB(j JSONB, key string) ModelUsageEntry {
+	var entry ModelUsageEntry
+	value, ok := j[key]
+	if !ok {
+		return entry
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return entry
+	}
+	_ = json.Unmarshal(data, &entry)
+	return entry
+}
+
 // QuotaExceededError represents a quota limit exceeded error
 type QuotaExceededError struct {
 	LimitType string    `json:"limit_type"` // "daily_requests", "daily_tokens", "daily_cost", "monthly_requests", "monthly_tokens", "monthly_cost"
@@ -111,17 +227,22 @@ func (MonthlyUsage) TableName() string {
 	return "monthly_usage"
 }
 
+func (QuotaSnapshot) TableName() string {
+	return "quota_snapshots"
+}
+
 // DefaultQuota returns the default quota configuration
 func DefaultQuota() UserQuota {
 	return UserQuota{
 		DailyRequestLimit:   100,
 		DailyTokenLimit:     100000,
-		DailyCostLimit:      10.00,
+		DailyCostLimit:      money.FromInt(10),
 		MonthlyRequestLimit: 3000,
 		MonthlyTokenLimit:   3000000,
-		MonthlyCostLimit:    300.00,
+		MonthlyCostLimit:    money.FromInt(300),
 		PerMinuteRateLimit:  60,
 		PerHourRateLimit:    1000,
+		PerMinuteTokenLimit: 40000,
 		ResetDay:            1,
 		Timezone:            "UTC",
 		ModelLimits:         JSONB{},
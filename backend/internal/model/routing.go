@@ -0,0 +1,146 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+// ModelAlias is a stable name clients can request, such as "fast" or
+// "team-default", that resolves to whichever model an admin points it at.
+type ModelAlias struct {
+	ID          string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	Name        string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	ModelID     string    `gorm:"type:uuid;not null;index" json:"model_id"`
+	IsActive    bool      `gorm:"not null;default:true;index" json:"is_active"`
+	CreatedAt   time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"not null" json:"updated_at"`
+
+	Model Model `gorm:"foreignKey:ModelID" json:"model,omitempty"`
+}
+
+func (ModelAlias) TableName() string {
+	return "model_aliases"
+}
+
+// RoutingRule sends requests that meet its conditions to a target model.
+// Active rules are checked in Priority order and the first match wins.
+type RoutingRule struct {
+	ID            string    `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	Name          string    `gorm:"type:varchar(255);not null" json:"name"`
+	Description   string    `gorm:"type:text" json:"description,omitempty"`
+	Priority      int       `gorm:"not null;default:0;index" json:"priority"` // Lower is checked first
+	Conditions    JSONB     `gorm:"type:jsonb;not null;default:'{}'" json:"conditions"`
+	TargetModelID string    `gorm:"type:uuid;not null;index" json:"target_model_id"`
+	IsActive      bool      `gorm:"not null;default:true;index" json:"is_active"`
+	CreatedAt     time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"not null" json:"updated_at"`
+
+	TargetModel Model `gorm:"foreignKey:TargetModelID" json:"target_model,omitempty"`
+}
+
+func (RoutingRule) TableName() string {
+	return "routing_rules"
+}
+
+// RoutingConditions is the shape of RoutingRule.Conditions. Every condition
+// that is set must hold; a list matches when it contains the request's value.
+type RoutingConditions struct {
+	Models    []string `json:"models,omitempty"` // Requested model names or aliases
+	APIKeyIDs []string `json:"api_key_ids,omitempty"`
+	UserRoles []string `json:"user_roles,omitempty"`
+	HasTools  *bool    `json:"has_tools,omitempty"`
+	HasImages *bool    `json:"has_images,omitempty"`
+	Stream    *bool    `json:"stream,omitempty"`
+}
+
+// AutoModelName is the virtual model that picks the cheapest model able to
+// serve each request
+const AutoModelName = "massrouter/auto"
+
+// Model capabilities, as flags in Model.Capabilities
+const (
+	CapabilityVision   = "vision"
+	CapabilityTools    = "tools"
+	CapabilityJSONMode = "json_mode"
+)
+
+// RoutingRequest is what routing knows about a request
+type RoutingRequest struct {
+	Model     string // As requested, possibly an alias
+	APIKeyID  string
+	UserRole  string
+	HasTools  bool
+	HasImages bool
+	JSONMode  bool
+	Stream    bool
+
+	// Estimated size of the call, used to check context length and rank
+	// models by cost when auto routing
+	InputTokens  int
+	OutputTokens int
+
+	// Optional client limits for auto routing
+	MaxInputPrice  *money.Amount // Per 1K tokens
+	MaxOutputPrice *money.Amount // Per 1K tokens
+	MaxLatencyMs   *float64
+
+	// AllowModel reports whether the caller may use a model; nil allows all
+	AllowModel func(*Model) bool
+}
+
+// Matches reports whether a request meets all of the conditions
+func (c *RoutingConditions) Matches(req *RoutingRequest) bool {
+	if len(c.Models) > 0 && !slices.Contains(c.Models, req.Model) {
+		return false
+	}
+	if len(c.APIKeyIDs) > 0 && !slices.Contains(c.APIKeyIDs, req.APIKeyID) {
+		return false
+	}
+	if len(c.UserRoles) > 0 && !slices.Contains(c.UserRoles, req.UserRole) {
+		return false
+	}
+	if c.HasTools != nil && *c.HasTools != req.HasTools {
+		return false
+	}
+	if c.HasImages != nil && *c.HasImages != req.HasImages {
+		return false
+	}
+	if c.Stream != nil && *c.Stream != req.Stream {
+		return false
+	}
+	return true
+}
+
+// ToJSONB converts the conditions for storage in RoutingRule.Conditions
+func (c *RoutingConditions) ToJSONB() (JSONB, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var j JSONB
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// RoutingConditionsFromJSONB parses RoutingRule.Conditions
+func RoutingConditionsFromJSONB(j JSONB) (*RoutingConditions, error) {
+	var conditions RoutingConditions
+	if len(j) == 0 {
+		return &conditions, nil
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &conditions); err != nil {
+		return nil, err
+	}
+	return &conditions, nil
+}
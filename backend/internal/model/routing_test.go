@@ -0,0 +1,36 @@
+package model
+
+import "testing"
+
+func TestRoutingConditions_Matches(t *testing.T) {
+	yes := true
+	req := &RoutingRequest{
+		Model:     "fast",
+		APIKeyID:  "key-1",
+		UserRole:  "user",
+		HasTools:  true,
+		HasImages: false,
+	}
+
+	tests := []struct {
+		name       string
+		conditions RoutingConditions
+		want       bool
+	}{
+		{name: "empty conditions match everything", conditions: RoutingConditions{}, want: true},
+		{name: "requested alias", conditions: RoutingConditions{Models: []string{"smart", "fast"}}, want: true},
+		{name: "other alias", conditions: RoutingConditions{Models: []string{"smart"}}, want: false},
+		{name: "API key and role", conditions: RoutingConditions{APIKeyIDs: []string{"key-1"}, UserRoles: []string{"user"}}, want: true},
+		{name: "other role", conditions: RoutingConditions{UserRoles: []string{"admin"}}, want: false},
+		{name: "tools required", conditions: RoutingConditions{HasTools: &yes}, want: true},
+		{name: "images required", conditions: RoutingConditions{HasImages: &yes}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.conditions.Matches(req); got != tt.want {
+				t.Errorf("RoutingConditions.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
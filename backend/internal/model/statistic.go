@@ -12,8 +12,8 @@ type ModelStatistic struct {
 	Date            time.Time `gorm:"type:date;not null;index" json:"date"`
 	TotalRequests   int       `gorm:"not null;default:0" json:"total_requests"`
 	TotalTokens     int       `gorm:"not null;default:0" json:"total_tokens"`
-	AvgResponseTime float64   `gorm:"type:decimal(10,3);not null;default:0" json:"avg_response_time"`
-	SuccessRate     float64   `gorm:"type:decimal(5,2);not null;default:0" json:"success_rate"`
+	AvgResponseTime float64   `gorm:"type:decimal(10,3);not null;default:0" json:"avg_response_time"` // Milliseconds
+	SuccessRate     float64   `gorm:"type:decimal(5,2);not null;default:0" json:"success_rate"`       // Percent
 	CreatedAt       time.Time `gorm:"not null" json:"created_at"`
 
 	Model Model `gorm:"foreignKey:ModelID" json:"model,omitempty"`
@@ -3,10 +3,13 @@ package repository
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type billingRecordRepository struct {
@@ -34,6 +37,66 @@ func (r *billingRecordRepository) FindByUserID(ctx context.Context, userID strin
 	return records, nil
 }
 
+// billingRecordSorts are the fields billing records can be sorted by
+var billingRecordSorts = map[string]sortField{
+	"created_at":   timeSortField("created_at"),
+	"cost":         amountSortField("cost"),
+	"total_tokens": intSortField("total_tokens"),
+}
+
+func (r *billingRecordRepository) FindPage(ctx context.Context, filter *BillingRecordFilter) ([]*model.BillingRecord, string, error) {
+	field, sortBy, order, err := normalizeSort(billingRecordSorts, filter.SortBy, filter.SortOrder)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := r.db.WithContext(ctx).Where("user_id = ?", filter.UserID)
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.ModelID != "" {
+		query = query.Where("model_id = ?", filter.ModelID)
+	}
+	if filter.APIKeyID != "" {
+		query = query.Where("api_key_id = ?", filter.APIKeyID)
+	}
+	if filter.MinCost != nil {
+		query = query.Where("cost >= ?", *filter.MinCost)
+	}
+
+	query, err = keysetPage(query, field, sortBy, order, filter.Cursor, filter.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records []*model.BillingRecord
+	err = query.
+		Preload("Model").
+		Preload("Model.Provider").
+		Find(&records).Error
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find billing records: %w", err)
+	}
+
+	var next string
+	if len(records) > filter.Limit {
+		records = records[:filter.Limit]
+		last := records[len(records)-1]
+		value := last.CreatedAt.Format(time.RFC3339Nano)
+		switch sortBy {
+		case "cost":
+			value = last.Cost.String()
+		case "total_tokens":
+			value = strconv.Itoa(last.TotalTokens)
+		}
+		next = encodeCursor(sortBy, order, value, last.ID)
+	}
+	return records, next, nil
+}
+
 func (r *billingRecordRepository) FindByAPIKeyID(ctx context.Context, apiKeyID string) ([]*model.BillingRecord, error) {
 	var records []*model.BillingRecord
 	err := r.db.WithContext(ctx).
@@ -82,8 +145,8 @@ func (r *billingRecordRepository) GetUserUsage(ctx context.Context, userID strin
 	return records, nil
 }
 
-func (r *billingRecordRepository) GetTotalCostByUser(ctx context.Context, userID string) (float64, error) {
-	var totalCost float64
+func (r *billingRecordRepository) GetTotalCostByUser(ctx context.Context, userID string) (money.Amount, error) {
+	var totalCost money.Amount
 	
 	err := r.db.WithContext(ctx).
 		Model(&model.BillingRecord{}).
@@ -113,3 +176,71 @@ func (r *billingRecordRepository) GetDailyUsage(ctx context.Context, userID stri
 	}
 	return records, nil
 }
+
+func (r *billingRecordRepository) GetAPIKeyUsage(ctx context.Context, apiKeyID string, since time.Time) (int64, int64, error) {
+	var usage struct {
+		Requests int64
+		Tokens   int64
+	}
+
+	err := r.db.WithContext(ctx).
+		Model(&model.BillingRecord{}).
+		Where("api_key_id = ? AND created_at >= ?", apiKeyID, since).
+		Select("COUNT(*) AS requests, COALESCE(SUM(total_tokens), 0) AS tokens").
+		Scan(&usage).Error
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get API key usage: %w", err)
+	}
+	return usage.Requests, usage.Tokens, nil
+}
+
+func (r *billingRecordRepository) CreateBatchTx(ctx context.Context, tx *gorm.DB, records []*model.BillingRecord) ([]*model.BillingRecord, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	// Written out rather than left to Create, which would match the rows
+	// RETURNING reports to the records by position; with conflicts skipped
+	// they no longer line up
+	var query strings.Builder
+	query.WriteString("INSERT INTO billing_records " +
+		"(user_id, api_key_id, model_id, request_id, request_tokens, response_tokens, total_tokens, cost, metadata, created_at) VALUES ")
+	args := make([]interface{}, 0, len(records)*10)
+	byRequestID := make(map[string]*model.BillingRecord, len(records))
+	for i, record := range records {
+		if record.RequestID == nil || *record.RequestID == "" {
+			return nil, fmt.Errorf("billing record has no request ID")
+		}
+		byRequestID[*record.RequestID] = record
+
+		metadata := record.Metadata
+		if metadata == nil {
+			metadata = model.JSONB{}
+		}
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, record.UserID, record.APIKeyID, record.ModelID, *record.RequestID,
+			record.RequestTokens, record.ResponseTokens, record.TotalTokens, record.Cost, metadata, record.CreatedAt)
+	}
+	query.WriteString(" ON CONFLICT (request_id) DO NOTHING RETURNING id, request_id")
+
+	var rows []struct {
+		ID        string
+		RequestID string
+	}
+	if err := tx.WithContext(ctx).Raw(query.String(), args...).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to create billing records: %w", err)
+	}
+
+	inserted := make([]*model.BillingRecord, 0, len(rows))
+	for _, row := range rows {
+		if record := byRequestID[row.RequestID]; record != nil {
+			record.ID = row.ID
+			inserted = append(inserted, record)
+		}
+	}
+	return inserted, nil
+}
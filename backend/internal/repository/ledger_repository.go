@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
+)
+
+type ledgerRepository struct {
+	*GormRepository[model.LedgerEntry]
+}
+
+func NewLedgerRepository(db *gorm.DB) LedgerRepository {
+	return &ledgerRepository{
+		GormRepository: NewGormRepository[model.LedgerEntry](db),
+	}
+}
+
+func (r *ledgerRepository) Post(ctx context.Context, entry *model.LedgerEntry) (bool, error) {
+	var posted bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		posted, err = r.PostTx(ctx, tx, entry)
+		return err
+	})
+	return posted, err
+}
+
+func (r *ledgerRepository) PostTx(ctx context.Context, tx *gorm.DB, entry *model.LedgerEntry) (bool, error) {
+	if err := entry.Validate(); err != nil {
+		return false, err
+	}
+	tx = tx.WithContext(ctx)
+
+	// Locking the account serializes postings to it, which keeps the running
+	// balance and the duplicate check below exact
+	account, err := r.lockAccount(tx, entry.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	if entry.ReferenceID != nil {
+		var count int64
+		err := tx.Model(&model.LedgerEntry{}).
+			Where("reference_type = ? AND reference_id = ? AND type = ?", entry.ReferenceType, *entry.ReferenceID, entry.Type).
+			Count(&count).Error
+		if err != nil {
+			return false, fmt.Errorf("failed to check ledger reference: %w", err)
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+
+	now := time.Now()
+	account.Apply(entry)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+	if entry.Metadata == nil {
+		entry.Metadata = model.JSONB{}
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return false, fmt.Errorf("failed to create ledger entry: %w", err)
+	}
+
+	err = tx.Model(&model.LedgerAccount{}).
+		Where("user_id = ?", account.UserID).
+		Updates(map[string]interface{}{
+			"balance":    account.Balance,
+			"held":       account.Held,
+			"updated_at": now,
+		}).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to update ledger account: %w", err)
+	}
+	return true, nil
+}
+
+// lockAccount returns the user's account locked for update, opening it first
+// if needed
+func (r *ledgerRepository) lockAccount(tx *gorm.DB, userID string) (*model.LedgerAccount, error) {
+	now := time.Now()
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.LedgerAccount{UserID: userID, CreatedAt: now, UpdatedAt: now}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger account: %w", err)
+	}
+
+	var account model.LedgerAccount
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		First(&account).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock ledger account: %w", err)
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) FindAccount(ctx context.Context, userID string) (*model.LedgerAccount, error) {
+	var account model.LedgerAccount
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		First(&account).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find ledger account: %w", err)
+	}
+	return &account, nil
+}
+
+func (r *ledgerRepository) FindAccountsWithSums(ctx context.Context) ([]*model.LedgerAccount, map[string]*model.LedgerAccount, error) {
+	var (
+		accounts []*model.LedgerAccount
+		sums     map[string]*model.LedgerAccount
+	)
+	// Both reads see the same snapshot, so a posting between them does not
+	// show up as drift
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if accounts, err = findAccounts(tx); err != nil {
+			return err
+		}
+		sums, err = sumByUser(tx)
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return accounts, sums, nil
+}
+
+func findAccounts(tx *gorm.DB) ([]*model.LedgerAccount, error) {
+	var accounts []*model.LedgerAccount
+	err := tx.
+		Order("user_id").
+		Find(&accounts).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find ledger accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+func (r *ledgerRepository) FindEntriesByUserID(ctx context.Context, userID string, limit, offset int) ([]*model.LedgerEntry, int64, error) {
+	query := r.db.WithContext(ctx).
+		Model(&model.LedgerEntry{}).
+		Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count ledger entries: %w", err)
+	}
+
+	var entries []*model.LedgerEntry
+	err := query.
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&entries).Error
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find ledger entries: %w", err)
+	}
+	return entries, total, nil
+}
+
+// sumByUser recomputes every account's balances from its entries
+func sumByUser(tx *gorm.DB) (map[string]*model.LedgerAccount, error) {
+	var rows []struct {
+		UserID  string
+		Balance money.Amount
+		Held    money.Amount
+	}
+
+	err := tx.
+		Model(&model.LedgerEntry{}).
+		Select(`user_id,
+			COALESCE(SUM(amount) FILTER (WHERE type NOT IN (?, ?)), 0) AS balance,
+			COALESCE(SUM(amount) FILTER (WHERE type IN (?, ?)), 0) AS held`,
+			model.LedgerEntryHold, model.LedgerEntryRelease,
+			model.LedgerEntryHold, model.LedgerEntryRelease).
+		Group("user_id").
+		Scan(&rows).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum ledger entries: %w", err)
+	}
+
+	sums := make(map[string]*model.LedgerAccount, len(rows))
+	for _, row := range rows {
+		sums[row.UserID] = &model.LedgerAccount{UserID: row.UserID, Balance: row.Balance, Held: row.Held}
+	}
+	return sums, nil
+}
+
+func (r *ledgerRepository) RebuildAccount(ctx context.Context, userID string) (*model.LedgerAccount, error) {
+	var account *model.LedgerAccount
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if account, err = r.lockAccount(tx, userID); err != nil {
+			return err
+		}
+
+		var sums struct {
+			Balance money.Amount
+			Held    money.Amount
+		}
+		err = tx.Model(&model.LedgerEntry{}).
+			Where("user_id = ?", userID).
+			Select(`COALESCE(SUM(amount) FILTER (WHERE type NOT IN (?, ?)), 0) AS balance,
+				COALESCE(SUM(amount) FILTER (WHERE type IN (?, ?)), 0) AS held`,
+				model.LedgerEntryHold, model.LedgerEntryRelease,
+				model.LedgerEntryHold, model.LedgerEntryRelease).
+			Scan(&sums).Error
+		if err != nil {
+			return fmt.Errorf("failed to sum ledger entries: %w", err)
+		}
+
+		account.Balance = sums.Balance
+		account.Held = sums.Held
+		account.UpdatedAt = time.Now()
+		if err := tx.Save(account).Error; err != nil {
+			return fmt.Errorf("failed to update ledger account: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
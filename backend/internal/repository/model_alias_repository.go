@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"massrouter.ai/backend/internal/model"
+)
+
+type modelAliasRepository struct {
+	*GormRepository[model.ModelAlias]
+}
+
+func NewModelAliasRepository(db *gorm.DB) ModelAliasRepository {
+	return &modelAliasRepository{
+		GormRepository: NewGormRepository[model.ModelAlias](db),
+	}
+}
+
+func (r *modelAliasRepository) FindByName(ctx context.Context, name string) (*model.ModelAlias, error) {
+	var alias model.ModelAlias
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&alias).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find alias by name: %w", err)
+	}
+	return &alias, nil
+}
+
+func (r *modelAliasRepository) FindActiveByName(ctx context.Context, name string) (*model.ModelAlias, error) {
+	var alias model.ModelAlias
+	err := r.db.WithContext(ctx).Where("name = ? AND is_active = ?", name, true).First(&alias).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find active alias by name: %w", err)
+	}
+	return &alias, nil
+}
+
+func (r *modelAliasRepository) FindAllWithModels(ctx context.Context, activeOnly bool) ([]*model.ModelAlias, error) {
+	var aliases []*model.ModelAlias
+	db := r.db.WithContext(ctx).Preload("Model").Preload("Model.Provider")
+	if activeOnly {
+		db = db.Joins("JOIN models ON models.id = model_aliases.model_id").
+			Where("model_aliases.is_active = ? AND models.is_active = ?", true, true)
+	}
+
+	if err := db.Order("model_aliases.name ASC").Find(&aliases).Error; err != nil {
+		return nil, fmt.Errorf("failed to find aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+func (r *modelAliasRepository) FindActiveByModelIDs(ctx context.Context, modelIDs []string) ([]*model.ModelAlias, error) {
+	var aliases []*model.ModelAlias
+	if len(modelIDs) == 0 {
+		return aliases, nil
+	}
+
+	err := r.db.WithContext(ctx).
+		Where("model_id IN ? AND is_active = ?", modelIDs, true).
+		Order("name ASC").
+		Find(&aliases).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find aliases by models: %w", err)
+	}
+	return aliases, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"massrouter.ai/backend/internal/model"
+)
+
+type modelDeploymentRepository struct {
+	*GormRepository[model.ModelDeployment]
+}
+
+func NewModelDeploymentRepository(db *gorm.DB) ModelDeploymentRepository {
+	return &modelDeploymentRepository{
+		GormRepository: NewGormRepository[model.ModelDeployment](db),
+	}
+}
+
+func (r *modelDeploymentRepository) FindByModelID(ctx context.Context, modelID string) ([]*model.ModelDeployment, error) {
+	var deployments []*model.ModelDeployment
+	err := r.db.WithContext(ctx).
+		Where("model_id = ?", modelID).
+		Preload("Provider").
+		Order("priority ASC, created_at ASC").
+		Find(&deployments).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deployments by model: %w", err)
+	}
+	return deployments, nil
+}
+
+func (r *modelDeploymentRepository) FindActiveByModelID(ctx context.Context, modelID string) ([]*model.ModelDeployment, error) {
+	var deployments []*model.ModelDeployment
+	err := r.db.WithContext(ctx).
+		Joins("JOIN model_providers ON model_providers.id = model_deployments.provider_id").
+		Where("model_deployments.model_id = ? AND model_deployments.is_active = ? AND model_providers.status = ?", modelID, true, "active").
+		Preload("Provider").
+		Preload("Provider.Credentials", "status = ?", model.CredentialStatusActive).
+		Order("model_deployments.priority ASC, model_deployments.created_at ASC").
+		Find(&deployments).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active deployments by model: %w", err)
+	}
+	return deployments, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type modelRepository struct {
@@ -33,6 +34,57 @@ func (r *modelRepository) FindByProviderAndName(ctx context.Context, providerID
 	return &modelObj, nil
 }
 
+func (r *modelRepository) FindActiveByName(ctx context.Context, name string) (*model.Model, error) {
+	var modelObj model.Model
+	err := r.db.WithContext(ctx).
+		Where("name = ? AND is_active = ?", name, true).
+		Preload("Provider").
+		Preload("Provider.Credentials", "status = ?", model.CredentialStatusActive).
+		Order("created_at ASC").
+		First(&modelObj).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find model by name: %w", err)
+	}
+	return &modelObj, nil
+}
+
+func (r *modelRepository) FindActiveByID(ctx context.Context, id string) (*model.Model, error) {
+	var modelObj model.Model
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND is_active = ?", id, true).
+		Preload("Provider").
+		Preload("Provider.Credentials", "status = ?", model.CredentialStatusActive).
+		First(&modelObj).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find model by id: %w", err)
+	}
+	return &modelObj, nil
+}
+
+func (r *modelRepository) FindByIDWithProvider(ctx context.Context, id string) (*model.Model, error) {
+	var modelObj model.Model
+	err := r.db.WithContext(ctx).
+		Where("id = ?", id).
+		Preload("Provider").
+		First(&modelObj).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find model by id: %w", err)
+	}
+	return &modelObj, nil
+}
+
 func (r *modelRepository) FindActiveModels(ctx context.Context) ([]*model.Model, error) {
 	var models []*model.Model
 	err := r.db.WithContext(ctx).
@@ -85,7 +137,7 @@ func (r *modelRepository) SearchModels(ctx context.Context, query string, limit,
 	return models, nil
 }
 
-func (r *modelRepository) UpdatePricing(ctx context.Context, modelID string, inputPrice, outputPrice float64) error {
+func (r *modelRepository) UpdatePricing(ctx context.Context, modelID string, inputPrice, outputPrice money.Amount) error {
 	result := r.db.WithContext(ctx).Model(&model.Model{}).
 		Where("id = ?", modelID).
 		Updates(map[string]interface{}{
@@ -135,3 +135,53 @@ func (r *modelStatisticRepository) GetTopModels(ctx context.Context, limit int,
 	}
 	return statistics, nil
 }
+
+// RecordRequest adds one request to a model's statistics for the day. It
+// upserts in a single statement so concurrent requests are all counted.
+func (r *modelStatisticRepository) RecordRequest(ctx context.Context, modelID string, date time.Time, tokens int, responseTimeMs float64, success bool) error {
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	successRate := 0.0
+	if success {
+		successRate = 100
+	}
+
+	err := r.db.WithContext(ctx).Exec(`
+		INSERT INTO model_statistics (model_id, date, total_requests, total_tokens, avg_response_time, success_rate, created_at)
+		VALUES (?, ?, 1, ?, ?, ?, NOW())
+		ON CONFLICT (model_id, date) DO UPDATE SET
+			total_requests = model_statistics.total_requests + 1,
+			total_tokens = model_statistics.total_tokens + EXCLUDED.total_tokens,
+			avg_response_time = (model_statistics.avg_response_time * model_statistics.total_requests + EXCLUDED.avg_response_time) / (model_statistics.total_requests + 1),
+			success_rate = (model_statistics.success_rate * model_statistics.total_requests + EXCLUDED.success_rate) / (model_statistics.total_requests + 1)`,
+		modelID, startOfDay, tokens, responseTimeMs, successRate).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to record model request: %w", err)
+	}
+	return nil
+}
+
+// SummarizeSince combines each model's daily statistics from the given date
+// on, weighting averages by request count. The result is keyed by model ID.
+func (r *modelStatisticRepository) SummarizeSince(ctx context.Context, since time.Time) (map[string]*model.ModelStatistic, error) {
+	var statistics []*model.ModelStatistic
+	err := r.db.WithContext(ctx).
+		Model(&model.ModelStatistic{}).
+		Select(`model_id, SUM(total_requests) AS total_requests, SUM(total_tokens) AS total_tokens,
+			SUM(avg_response_time * total_requests) / NULLIF(SUM(total_requests), 0) AS avg_response_time,
+			SUM(success_rate * total_requests) / NULLIF(SUM(total_requests), 0) AS success_rate`).
+		Where("date >= ?", since.Format("2006-01-02")).
+		Group("model_id").
+		Having("SUM(total_requests) > 0").
+		Scan(&statistics).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize model statistics: %w", err)
+	}
+
+	summaries := make(map[string]*model.ModelStatistic, len(statistics))
+	for _, stat := range statistics {
+		summaries[stat.ModelID] = stat
+	}
+	return summaries, nil
+}
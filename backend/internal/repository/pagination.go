@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"massrouter.ai/backend/pkg/money"
+)
+
+// Sort orders
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ErrInvalidCursor is returned for a cursor that is malformed or came from
+// another listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortField is a column rows can be paged by. Rows are ordered by it and then
+// by ID, so that rows with the same value keep a stable order across pages.
+type sortField struct {
+	column string
+	parse  func(value string) (interface{}, error) // Reads a value written to a cursor
+}
+
+func timeSortField(column string) sortField {
+	return sortField{column: column, parse: func(value string) (interface{}, error) {
+		return time.Parse(time.RFC3339Nano, value)
+	}}
+}
+
+func amountSortField(column string) sortField {
+	return sortField{column: column, parse: func(value string) (interface{}, error) {
+		return money.Parse(value)
+	}}
+}
+
+func intSortField(column string) sortField {
+	return sortField{column: column, parse: func(value string) (interface{}, error) {
+		return strconv.ParseInt(value, 10, 64)
+	}}
+}
+
+// pageCursor marks the last row of a page by its sort value and ID. It also
+// records the order the page was read in, since it means nothing in another.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// encodeCursor returns the opaque cursor of the row after which the next
+// page starts
+func encodeCursor(sortBy, order, value, id string) string {
+	data, _ := json.Marshal(pageCursor{Sort: sortBy, Order: order, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// normalizeSort checks a sort field and order against fields, defaulting to
+// the newest rows first
+func normalizeSort(fields map[string]sortField, sortBy, order string) (sortField, string, string, error) {
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	if order == "" {
+		order = SortDesc
+	}
+	field, ok := fields[sortBy]
+	if !ok {
+		return sortField{}, "", "", fmt.Errorf("invalid sort field")
+	}
+	if order != SortAsc && order != SortDesc {
+		return sortField{}, "", "", fmt.Errorf("invalid sort order")
+	}
+	return field, sortBy, order, nil
+}
+
+// keysetPage orders query by field and ID, starts it after the cursor's row
+// and reads one row past limit, which tells whether another page follows
+func keysetPage(query *gorm.DB, field sortField, sortBy, order, cursor string, limit int) (*gorm.DB, error) {
+	op, direction := "<", "DESC"
+	if order == SortAsc {
+		op, direction = ">", "ASC"
+	}
+
+	if cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		var c pageCursor
+		if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+			return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+		}
+		if c.Sort != sortBy || c.Order != order {
+			return nil, fmt.Errorf("%w: it continues another sort order", ErrInvalidCursor)
+		}
+		after, err := field.parse(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", field.column, op), after, c.ID)
+	}
+
+	return query.
+		Order(fmt.Sprintf("%s %s, id %s", field.column, direction, direction)).
+		Limit(limit + 1), nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"massrouter.ai/backend/internal/model"
+)
+
+func TestKeysetCursor(t *testing.T) {
+	fields := map[string]sortField{
+		"created_at": timeSortField("created_at"),
+		"cost":       amountSortField("cost"),
+	}
+
+	field, sortBy, order, err := normalizeSort(fields, "", "")
+	if err != nil || field.column != "created_at" || sortBy != "created_at" || order != SortDesc {
+		t.Fatalf("normalizeSort() = %q, %q, %q, %v, want created_at desc", field.column, sortBy, order, err)
+	}
+	if _, _, _, err := normalizeSort(fields, "id; DROP TABLE users", ""); err == nil {
+		t.Error("normalizeSort() accepted an unknown field")
+	}
+	if _, _, _, err := normalizeSort(fields, "cost", "sideways"); err == nil {
+		t.Error("normalizeSort() accepted an unknown order")
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	at := time.Date(2026, 10, 16, 12, 0, 0, 123456789, time.UTC)
+	cursor := encodeCursor("created_at", SortDesc, at.Format(time.RFC3339Nano), "row-1")
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		query, err := keysetPage(tx.Model(&model.BillingRecord{}), field, "created_at", SortDesc, cursor, 20)
+		if err != nil {
+			t.Fatalf("keysetPage() error = %v", err)
+		}
+		var records []*model.BillingRecord
+		return query.Find(&records)
+	})
+	for _, want := range []string{"(created_at, id) < ('2026-10-16 12:00:00.123', 'row-1')", "ORDER BY created_at DESC, id DESC", "LIMIT 21"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("keysetPage() SQL = %s, want it to contain %s", sql, want)
+		}
+	}
+
+	// A cursor only continues the listing it came from
+	tests := []struct {
+		name   string
+		field  string
+		order  string
+		cursor string
+	}{
+		{"other order", "created_at", SortAsc, cursor},
+		{"other field", "cost", SortDesc, cursor},
+		{"garbage", "created_at", SortDesc, "not-a-cursor"},
+		{"bad value", "cost", SortDesc, encodeCursor("cost", SortDesc, "lots", "row-1")},
+	}
+	for _, tt := range tests {
+		_, err := keysetPage(db, fields[tt.field], tt.field, tt.order, tt.cursor, 20)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: keysetPage() error = %v, want invalid cursor", tt.name, err)
+		}
+	}
+}
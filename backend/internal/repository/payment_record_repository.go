@@ -7,6 +7,7 @@ import (
 
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type paymentRecordRepository struct {
@@ -32,6 +33,58 @@ func (r *paymentRecordRepository) FindByUserID(ctx context.Context, userID strin
 	return records, nil
 }
 
+// paymentRecordSorts are the fields payments can be sorted by
+var paymentRecordSorts = map[string]sortField{
+	"created_at": timeSortField("created_at"),
+	"amount":     amountSortField("amount"),
+}
+
+func (r *paymentRecordRepository) FindPage(ctx context.Context, filter *PaymentRecordFilter) ([]*model.PaymentRecord, string, error) {
+	field, sortBy, order, err := normalizeSort(paymentRecordSorts, filter.SortBy, filter.SortOrder)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := r.db.WithContext(ctx).Where("user_id = ?", filter.UserID)
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.PaymentMethod != "" {
+		query = query.Where("payment_method = ?", filter.PaymentMethod)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+
+	query, err = keysetPage(query, field, sortBy, order, filter.Cursor, filter.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records []*model.PaymentRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to find payment records: %w", err)
+	}
+
+	var next string
+	if len(records) > filter.Limit {
+		records = records[:filter.Limit]
+		last := records[len(records)-1]
+		value := last.CreatedAt.Format(time.RFC3339Nano)
+		if sortBy == "amount" {
+			value = last.Amount.String()
+		}
+		next = encodeCursor(sortBy, order, value, last.ID)
+	}
+	return records, next, nil
+}
+
 func (r *paymentRecordRepository) FindByTransactionID(ctx context.Context, transactionID string) (*model.PaymentRecord, error) {
 	var record model.PaymentRecord
 	err := r.db.WithContext(ctx).
@@ -60,31 +113,38 @@ func (r *paymentRecordRepository) FindByStatus(ctx context.Context, status strin
 	return records, nil
 }
 
-func (r *paymentRecordRepository) UpdateStatus(ctx context.Context, paymentID, status string, paidAt *time.Time) error {
+// UpdateStatus moves a payment to status, recording the gateway's transaction
+// ID when one is given. With from statuses, only a payment in one of them is
+// changed, so of two deliveries of the same webhook only one applies; it
+// reports whether the payment changed.
+func (r *paymentRecordRepository) UpdateStatus(ctx context.Context, paymentID, status string, transactionID *string, paidAt *time.Time, from ...string) (bool, error) {
 	updates := map[string]interface{}{
 		"status": status,
 	}
 
+	if transactionID != nil {
+		updates["transaction_id"] = *transactionID
+	}
 	if paidAt != nil {
 		updates["paid_at"] = paidAt
 	}
 
-	result := r.db.WithContext(ctx).
+	query := r.db.WithContext(ctx).
 		Model(&model.PaymentRecord{}).
-		Where("id = ?", paymentID).
-		Updates(updates)
+		Where("id = ?", paymentID)
+	if len(from) > 0 {
+		query = query.Where("status IN ?", from)
+	}
 
+	result := query.Updates(updates)
 	if result.Error != nil {
-		return fmt.Errorf("failed to update payment status: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("payment record not found")
+		return false, fmt.Errorf("failed to update payment status: %w", result.Error)
 	}
-	return nil
+	return result.RowsAffected > 0, nil
 }
 
-func (r *paymentRecordRepository) GetUserTotalPaid(ctx context.Context, userID string) (float64, error) {
-	var totalPaid float64
+func (r *paymentRecordRepository) GetUserTotalPaid(ctx context.Context, userID string) (money.Amount, error) {
+	var totalPaid money.Amount
 
 	err := r.db.WithContext(ctx).
 		Model(&model.PaymentRecord{}).
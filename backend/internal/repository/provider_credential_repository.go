@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"massrouter.ai/backend/internal/model"
+)
+
+type providerCredentialRepository struct {
+	*GormRepository[model.ProviderCredential]
+}
+
+func NewProviderCredentialRepository(db *gorm.DB) ProviderCredentialRepository {
+	return &providerCredentialRepository{
+		GormRepository: NewGormRepository[model.ProviderCredential](db),
+	}
+}
+
+func (r *providerCredentialRepository) FindByProviderID(ctx context.Context, providerID string) ([]*model.ProviderCredential, error) {
+	var credentials []*model.ProviderCredential
+	err := r.db.WithContext(ctx).
+		Where("provider_id = ?", providerID).
+		Order("created_at ASC").
+		Find(&credentials).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to find credentials by provider: %w", err)
+	}
+	return credentials, nil
+}
+
+func (r *providerCredentialRepository) SetCooldown(ctx context.Context, id string, until time.Time, lastError string) error {
+	err := r.db.WithContext(ctx).
+		Model(&model.ProviderCredential{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"cooldown_until": until,
+			"last_error":     lastError,
+			"updated_at":     time.Now(),
+		}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to set credential cooldown: %w", err)
+	}
+	return nil
+}
+
+// RecordAuthFailure counts a failed authentication and disables the credential
+// once disableAfter consecutive failures have been seen. The count is updated
+// in the database so concurrent requests cannot lose increments.
+func (r *providerCredentialRepository) RecordAuthFailure(ctx context.Context, id string, disableAfter int, lastError string) error {
+	err := r.db.WithContext(ctx).
+		Model(&model.ProviderCredential{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"auth_failures": gorm.Expr("auth_failures + 1"),
+			"status": gorm.Expr("CASE WHEN auth_failures + 1 >= ? THEN ? ELSE status END",
+				disableAfter, model.CredentialStatusDisabled),
+			"last_error": lastError,
+			"updated_at": time.Now(),
+		}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to record credential auth failure: %w", err)
+	}
+	return nil
+}
+
+func (r *providerCredentialRepository) ResetAuthFailures(ctx context.Context, id string) error {
+	err := r.db.WithContext(ctx).
+		Model(&model.ProviderCredential{}).
+		Where("id = ? AND auth_failures > 0", id).
+		Updates(map[string]interface{}{
+			"auth_failures": 0,
+			"updated_at":    time.Now(),
+		}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to reset credential auth failures: %w", err)
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type userQuotaRepository struct {
@@ -55,6 +56,7 @@ func (r *userQuotaRepository) UpdateQuota(ctx context.Context, userID string, qu
 			"model_limits",
 			"per_minute_rate_limit",
 			"per_hour_rate_limit",
+			"per_minute_token_limit",
 			"reset_day",
 			"timezone",
 			"is_active",
@@ -95,6 +97,21 @@ func (r *userQuotaRepository) FindActiveQuotas(ctx context.Context) ([]*model.Us
 	return quotas, nil
 }
 
+// mergeModelUsageSQL returns an expression that adds the requests, tokens and
+// cost of each entry in EXCLUDED.model_usage to the table's existing entries,
+// keeping entries that appear on only one side.
+func mergeModelUsageSQL(table string) string {
+	return fmt.Sprintf(`(
+				SELECT COALESCE(jsonb_object_agg(key, jsonb_build_object(
+					'requests', COALESCE((cur.value->>'requests')::bigint, 0) + COALESCE((inc.value->>'requests')::bigint, 0),
+					'tokens', COALESCE((cur.value->>'tokens')::bigint, 0) + COALESCE((inc.value->>'tokens')::bigint, 0),
+					'cost', COALESCE((cur.value->>'cost')::numeric, 0) + COALESCE((inc.value->>'cost')::numeric, 0)
+				)), '{}'::jsonb)
+				FROM jsonb_each(%s.model_usage) AS cur
+				FULL OUTER JOIN jsonb_each(EXCLUDED.model_usage) AS inc USING (key)
+			)`, table)
+}
+
 type userUsageRepository struct {
 	*GormRepository[model.UserUsage]
 }
@@ -147,7 +164,7 @@ func (r *userUsageRepository) FindByUserID(ctx context.Context, userID string, l
 	return usage, nil
 }
 
-func (r *userUsageRepository) IncrementUsage(ctx context.Context, userID string, date time.Time, requests, tokens int, cost float64, modelUsage model.JSONB) error {
+func (r *userUsageRepository) IncrementUsage(ctx context.Context, userID string, date time.Time, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error {
 	// Use PostgreSQL-specific UPDATE with atomic increment
 	result := r.db.WithContext(ctx).Exec(`
 		INSERT INTO user_usage (user_id, date, request_count, token_count, total_cost, model_usage, created_at, updated_at)
@@ -157,7 +174,7 @@ func (r *userUsageRepository) IncrementUsage(ctx context.Context, userID string,
 			request_count = user_usage.request_count + EXCLUDED.request_count,
 			token_count = user_usage.token_count + EXCLUDED.token_count,
 			total_cost = user_usage.total_cost + EXCLUDED.total_cost,
-			model_usage = user_usage.model_usage || EXCLUDED.model_usage,
+			model_usage = `+mergeModelUsageSQL("user_usage")+`,
 			updated_at = NOW()
 	`, userID, date.Format("2006-01-02"), requests, tokens, cost, modelUsage)
 
@@ -258,7 +275,7 @@ func (r *monthlyUsageRepository) FindByUserID(ctx context.Context, userID string
 	return usage, nil
 }
 
-func (r *monthlyUsageRepository) IncrementUsage(ctx context.Context, userID string, yearMonth string, requests, tokens int, cost float64, modelUsage model.JSONB) error {
+func (r *monthlyUsageRepository) IncrementUsage(ctx context.Context, userID string, yearMonth string, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error {
 	// Use PostgreSQL-specific UPDATE with atomic increment
 	result := r.db.WithContext(ctx).Exec(`
 		INSERT INTO monthly_usage (user_id, year_month, request_count, token_count, total_cost, model_usage, created_at, updated_at)
@@ -268,7 +285,7 @@ func (r *monthlyUsageRepository) IncrementUsage(ctx context.Context, userID stri
 			request_count = monthly_usage.request_count + EXCLUDED.request_count,
 			token_count = monthly_usage.token_count + EXCLUDED.token_count,
 			total_cost = monthly_usage.total_cost + EXCLUDED.total_cost,
-			model_usage = monthly_usage.model_usage || EXCLUDED.model_usage,
+			model_usage = `+mergeModelUsageSQL("monthly_usage")+`,
 			updated_at = NOW()
 	`, userID, yearMonth, requests, tokens, cost, modelUsage)
 
@@ -278,6 +295,19 @@ func (r *monthlyUsageRepository) IncrementUsage(ctx context.Context, userID stri
 	return nil
 }
 
+func (r *monthlyUsageRepository) GetUsageForMonths(ctx context.Context, userID string, startMonth, endMonth string) ([]*model.MonthlyUsage, error) {
+	var usage []*model.MonthlyUsage
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND year_month BETWEEN ? AND ?", userID, startMonth, endMonth).
+		Order("year_month ASC").
+		Find(&usage).Error
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage for months: %w", err)
+	}
+	return usage, nil
+}
+
 func (r *monthlyUsageRepository) GetMonthlySummary(ctx context.Context, yearMonth string) ([]*model.MonthlyUsage, error) {
 	var usage []*model.MonthlyUsage
 	err := r.db.WithContext(ctx).
@@ -303,3 +333,56 @@ func (r *monthlyUsageRepository) ResetMonthlyUsage(ctx context.Context, yearMont
 	}
 	return nil
 }
+
+type quotaSnapshotRepository struct {
+	*GormRepository[model.QuotaSnapshot]
+}
+
+func NewQuotaSnapshotRepository(db *gorm.DB) QuotaSnapshotRepository {
+	return &quotaSnapshotRepository{
+		GormRepository: NewGormRepository[model.QuotaSnapshot](db),
+	}
+}
+
+func (r *quotaSnapshotRepository) Record(ctx context.Context, snapshot *model.QuotaSnapshot) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(snapshot)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record quota snapshot: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *quotaSnapshotRepository) FindByUserID(ctx context.Context, userID string, limit, offset int) ([]*model.QuotaSnapshot, error) {
+	var snapshots []*model.QuotaSnapshot
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	if err := query.Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to find quota snapshots by user ID: %w", err)
+	}
+	return snapshots, nil
+}
+
+func (r *quotaSnapshotRepository) FindLatestBucket(ctx context.Context, userID, period string) (string, error) {
+	var buckets []string
+	err := r.db.WithContext(ctx).
+		Model(&model.QuotaSnapshot{}).
+		Where("user_id = ? AND period = ? AND reason = ?", userID, period, model.QuotaSnapshotRollover).
+		Order("bucket DESC").
+		Limit(1).
+		Pluck("bucket", &buckets).Error
+
+	if err != nil {
+		return "", fmt.Errorf("failed to find latest quota snapshot: %w", err)
+	}
+	if len(buckets) == 0 {
+		return "", nil
+	}
+	return buckets[0], nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type BaseRepository[T any] interface {
@@ -55,13 +56,43 @@ type ModelProviderRepository interface {
 type ModelRepository interface {
 	BaseRepository[model.Model]
 	FindByProviderAndName(ctx context.Context, providerID string, name string) (*model.Model, error)
+	FindActiveByName(ctx context.Context, name string) (*model.Model, error)
+	FindActiveByID(ctx context.Context, id string) (*model.Model, error)
+	FindByIDWithProvider(ctx context.Context, id string) (*model.Model, error)
 	FindActiveModels(ctx context.Context) ([]*model.Model, error)
 	FindByCategory(ctx context.Context, category string) ([]*model.Model, error)
 	SearchModels(ctx context.Context, query string, limit, offset int) ([]*model.Model, error)
-	UpdatePricing(ctx context.Context, modelID string, inputPrice, outputPrice float64) error
+	UpdatePricing(ctx context.Context, modelID string, inputPrice, outputPrice money.Amount) error
 	UpdateStatus(ctx context.Context, modelID string, isActive bool) error
 }
 
+type ModelDeploymentRepository interface {
+	BaseRepository[model.ModelDeployment]
+	FindByModelID(ctx context.Context, modelID string) ([]*model.ModelDeployment, error)
+	FindActiveByModelID(ctx context.Context, modelID string) ([]*model.ModelDeployment, error)
+}
+
+type ProviderCredentialRepository interface {
+	BaseRepository[model.ProviderCredential]
+	FindByProviderID(ctx context.Context, providerID string) ([]*model.ProviderCredential, error)
+	SetCooldown(ctx context.Context, id string, until time.Time, lastError string) error
+	RecordAuthFailure(ctx context.Context, id string, disableAfter int, lastError string) error
+	ResetAuthFailures(ctx context.Context, id string) error
+}
+
+type ModelAliasRepository interface {
+	BaseRepository[model.ModelAlias]
+	FindByName(ctx context.Context, name string) (*model.ModelAlias, error)
+	FindActiveByName(ctx context.Context, name string) (*model.ModelAlias, error)
+	FindAllWithModels(ctx context.Context, activeOnly bool) ([]*model.ModelAlias, error)
+	FindActiveByModelIDs(ctx context.Context, modelIDs []string) ([]*model.ModelAlias, error)
+}
+
+type RoutingRuleRepository interface {
+	BaseRepository[model.RoutingRule]
+	FindOrdered(ctx context.Context, activeOnly bool) ([]*model.RoutingRule, error)
+}
+
 type UserAPIKeyRepository interface {
 	BaseRepository[model.UserAPIKey]
 	FindByAPIKey(ctx context.Context, apiKey string) (*model.UserAPIKey, error)
@@ -72,23 +103,78 @@ type UserAPIKeyRepository interface {
 	ValidateKey(ctx context.Context, apiKey string) (*model.UserAPIKey, error)
 }
 
+// PaymentRecordFilter selects a page of a user's payments
+type PaymentRecordFilter struct {
+	UserID        string
+	From          *time.Time // Created at or after
+	To            *time.Time // Created before
+	Status        string
+	PaymentMethod string
+	MinAmount     *money.Amount
+	SortBy        string // created_at (default) or amount
+	SortOrder     string // SortDesc (default) or SortAsc
+	Cursor        string // Where the previous page ended; empty for the first page
+	Limit         int
+}
+
 type PaymentRecordRepository interface {
 	BaseRepository[model.PaymentRecord]
 	FindByUserID(ctx context.Context, userID string) ([]*model.PaymentRecord, error)
+	// FindPage returns a page of payments and the cursor of the next page,
+	// empty on the last one
+	FindPage(ctx context.Context, filter *PaymentRecordFilter) ([]*model.PaymentRecord, string, error)
 	FindByTransactionID(ctx context.Context, transactionID string) (*model.PaymentRecord, error)
 	FindByStatus(ctx context.Context, status string) ([]*model.PaymentRecord, error)
-	UpdateStatus(ctx context.Context, paymentID, status string, paidAt *time.Time) error
-	GetUserTotalPaid(ctx context.Context, userID string) (float64, error)
+	UpdateStatus(ctx context.Context, paymentID, status string, transactionID *string, paidAt *time.Time, from ...string) (bool, error)
+	GetUserTotalPaid(ctx context.Context, userID string) (money.Amount, error)
+}
+
+// BillingRecordFilter selects a page of a user's billing records
+type BillingRecordFilter struct {
+	UserID    string
+	From      *time.Time // Created at or after
+	To        *time.Time // Created before
+	ModelID   string
+	APIKeyID  string
+	MinCost   *money.Amount
+	SortBy    string // created_at (default), cost or total_tokens
+	SortOrder string // SortDesc (default) or SortAsc
+	Cursor    string // Where the previous page ended; empty for the first page
+	Limit     int
 }
 
 type BillingRecordRepository interface {
 	BaseRepository[model.BillingRecord]
 	FindByUserID(ctx context.Context, userID string) ([]*model.BillingRecord, error)
+	// FindPage returns a page of records with their models and providers, and
+	// the cursor of the next page, empty on the last one
+	FindPage(ctx context.Context, filter *BillingRecordFilter) ([]*model.BillingRecord, string, error)
 	FindByAPIKeyID(ctx context.Context, apiKeyID string) ([]*model.BillingRecord, error)
 	FindByModelID(ctx context.Context, modelID string) ([]*model.BillingRecord, error)
 	GetUserUsage(ctx context.Context, userID string, startDate, endDate *time.Time) ([]*model.BillingRecord, error)
-	GetTotalCostByUser(ctx context.Context, userID string) (float64, error)
+	GetTotalCostByUser(ctx context.Context, userID string) (money.Amount, error)
 	GetDailyUsage(ctx context.Context, userID string, date time.Time) ([]*model.BillingRecord, error)
+	GetAPIKeyUsage(ctx context.Context, apiKeyID string, since time.Time) (requests int64, tokens int64, err error)
+	// CreateBatchTx inserts records within tx, skipping those whose request
+	// ID is already stored. It returns the inserted records with their IDs.
+	CreateBatchTx(ctx context.Context, tx *gorm.DB, records []*model.BillingRecord) ([]*model.BillingRecord, error)
+}
+
+type LedgerRepository interface {
+	BaseRepository[model.LedgerEntry]
+	// Post appends an entry and applies it to the account's running balance in
+	// one transaction. It reports false when the entry's reference was
+	// already posted with the same type.
+	Post(ctx context.Context, entry *model.LedgerEntry) (bool, error)
+	// PostTx posts within tx, so that the entry commits with its source record
+	PostTx(ctx context.Context, tx *gorm.DB, entry *model.LedgerEntry) (bool, error)
+	FindAccount(ctx context.Context, userID string) (*model.LedgerAccount, error)
+	FindEntriesByUserID(ctx context.Context, userID string, limit, offset int) ([]*model.LedgerEntry, int64, error)
+	// FindAccountsWithSums returns every account along with its balances
+	// recomputed from its entries, both read from one snapshot
+	FindAccountsWithSums(ctx context.Context) ([]*model.LedgerAccount, map[string]*model.LedgerAccount, error)
+	// RebuildAccount sets an account's balances to the sum of its entries
+	RebuildAccount(ctx context.Context, userID string) (*model.LedgerAccount, error)
 }
 
 type ModelStatisticRepository interface {
@@ -98,6 +184,8 @@ type ModelStatisticRepository interface {
 	GetDailyStatistics(ctx context.Context, date time.Time) ([]*model.ModelStatistic, error)
 	UpdateStatistics(ctx context.Context, modelID string, date time.Time, requests, tokens int, avgResponseTime, successRate float64) error
 	GetTopModels(ctx context.Context, limit int, startDate, endDate time.Time) ([]*model.ModelStatistic, error)
+	RecordRequest(ctx context.Context, modelID string, date time.Time, tokens int, responseTimeMs float64, success bool) error
+	SummarizeSince(ctx context.Context, since time.Time) (map[string]*model.ModelStatistic, error)
 }
 
 type SystemConfigRepository interface {
@@ -126,7 +214,7 @@ type UserUsageRepository interface {
 	BaseRepository[model.UserUsage]
 	FindByUserAndDate(ctx context.Context, userID string, date time.Time) (*model.UserUsage, error)
 	FindByUserID(ctx context.Context, userID string, limit, offset int) ([]*model.UserUsage, error)
-	IncrementUsage(ctx context.Context, userID string, date time.Time, requests, tokens int, cost float64, modelUsage model.JSONB) error
+	IncrementUsage(ctx context.Context, userID string, date time.Time, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error
 	GetUsageForPeriod(ctx context.Context, userID string, startDate, endDate time.Time) ([]*model.UserUsage, error)
 	ResetDailyUsage(ctx context.Context, date time.Time) error
 	FindExceededUsage(ctx context.Context, date time.Time) ([]*model.UserUsage, error)
@@ -136,7 +224,19 @@ type MonthlyUsageRepository interface {
 	BaseRepository[model.MonthlyUsage]
 	FindByUserAndMonth(ctx context.Context, userID string, yearMonth string) (*model.MonthlyUsage, error)
 	FindByUserID(ctx context.Context, userID string, limit, offset int) ([]*model.MonthlyUsage, error)
-	IncrementUsage(ctx context.Context, userID string, yearMonth string, requests, tokens int, cost float64, modelUsage model.JSONB) error
+	IncrementUsage(ctx context.Context, userID string, yearMonth string, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error
+	GetUsageForMonths(ctx context.Context, userID string, startMonth, endMonth string) ([]*model.MonthlyUsage, error)
 	GetMonthlySummary(ctx context.Context, yearMonth string) ([]*model.MonthlyUsage, error)
 	ResetMonthlyUsage(ctx context.Context, yearMonth string) error
 }
+
+type QuotaSnapshotRepository interface {
+	BaseRepository[model.QuotaSnapshot]
+	// Record stores a snapshot. It reports false for the rollover of a
+	// window that was already rolled over.
+	Record(ctx context.Context, snapshot *model.QuotaSnapshot) (bool, error)
+	FindByUserID(ctx context.Context, userID string, limit, offset int) ([]*model.QuotaSnapshot, error)
+	// FindLatestBucket returns the newest window of a period rolled over for
+	// a user, or "" if there is none
+	FindLatestBucket(ctx context.Context, userID, period string) (string, error)
+}
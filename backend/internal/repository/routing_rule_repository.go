@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"massrouter.ai/backend/internal/model"
+)
+
+type routingRuleRepository struct {
+	*GormRepository[model.RoutingRule]
+}
+
+func NewRoutingRuleRepository(db *gorm.DB) RoutingRuleRepository {
+	return &routingRuleRepository{
+		GormRepository: NewGormRepository[model.RoutingRule](db),
+	}
+}
+
+// FindOrdered returns rules in the order they are checked
+func (r *routingRuleRepository) FindOrdered(ctx context.Context, activeOnly bool) ([]*model.RoutingRule, error) {
+	var rules []*model.RoutingRule
+	db := r.db.WithContext(ctx)
+	if activeOnly {
+		db = db.Where("is_active = ?", true)
+	}
+
+	if err := db.Order("priority ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to find routing rules: %w", err)
+	}
+	return rules, nil
+}
@@ -18,6 +18,7 @@ import (
 	proxyController "massrouter.ai/backend/internal/controller/proxy"
 	"massrouter.ai/backend/internal/controller/user"
 	"massrouter.ai/backend/internal/middleware"
+	"massrouter.ai/backend/internal/repository"
 	"massrouter.ai/backend/internal/service"
 	pkgAuth "massrouter.ai/backend/pkg/auth"
 	"massrouter.ai/backend/pkg/cache"
@@ -30,6 +31,8 @@ type Server struct {
 	db          *database.Database
 	redisClient *cache.RedisClient
 	jwtManager  *pkgAuth.JWTManager
+	apiKeyRepo  repository.UserAPIKeyRepository
+	quotaRepo   repository.UserQuotaRepository
 	router      *gin.Engine
 	httpServer  *http.Server
 
@@ -45,6 +48,7 @@ type Server struct {
 
 	// Services
 	billingService service.BillingService
+	quotaService   service.QuotaService
 }
 
 func NewServer(
@@ -53,6 +57,8 @@ func NewServer(
 	db *database.Database,
 	redisClient *cache.RedisClient,
 	jwtManager *pkgAuth.JWTManager,
+	apiKeyRepo repository.UserAPIKeyRepository,
+	quotaRepo repository.UserQuotaRepository,
 	healthController *health.Controller,
 	authController *auth.Controller,
 	oauthController *oauth.Controller,
@@ -62,6 +68,7 @@ func NewServer(
 	adminController *admin.Controller,
 	proxyController *proxyController.Controller,
 	billingService service.BillingService,
+	quotaService service.QuotaService,
 ) *Server {
 	server := &Server{
 		cfg:               cfg,
@@ -69,6 +76,8 @@ func NewServer(
 		db:                db,
 		redisClient:       redisClient,
 		jwtManager:        jwtManager,
+		apiKeyRepo:        apiKeyRepo,
+		quotaRepo:         quotaRepo,
 		healthController:  healthController,
 		authController:    authController,
 		oauthController:   oauthController,
@@ -78,6 +87,7 @@ func NewServer(
 		adminController:   adminController,
 		proxyController:   proxyController,
 		billingService:    billingService,
+		quotaService:      quotaService,
 	}
 
 	server.setupRouter()
@@ -153,8 +163,12 @@ func (s *Server) setupRouter() {
 			publicModelGroup.GET("/:id", s.modelController.GetModelDetails)
 			publicModelGroup.GET("/providers", s.modelController.GetModelProviders)
 			publicModelGroup.GET("/categories", s.modelController.GetModelCategories)
+			publicModelGroup.GET("/aliases", s.modelController.ListModelAliases)
 		}
 
+		// Payment gateway webhooks, authenticated by their signatures
+		api.POST("/billing/webhooks/:gateway", s.billingController.ProcessPaymentWebhook)
+
 		// Protected routes (require authentication)
 		protected := api.Group("")
 		protected.Use(middleware.JWTAuth(s.jwtManager))
@@ -186,20 +200,22 @@ func (s *Server) setupRouter() {
 				billingGroup.GET("/balance", s.billingController.GetBalance)
 				billingGroup.GET("/payments", s.billingController.GetPaymentHistory)
 				billingGroup.POST("/payments", s.billingController.CreatePayment)
+				billingGroup.POST("/payments/:id/sandbox", s.billingController.SimulateSandboxPayment)
 				billingGroup.GET("/records", s.billingController.GetBillingRecords)
+				billingGroup.GET("/ledger", s.billingController.GetLedgerEntries)
 				billingGroup.POST("/calculate-cost", s.billingController.CalculateCost)
-				billingGroup.POST("/webhook", s.billingController.ProcessPaymentWebhook)
 			}
+		}
 
-			// Proxy routes for AI model access
-			proxyGroup := protected.Group("/chat")
-			// Apply user-based rate limiting if Redis is available
-			if s.redisClient != nil {
-				proxyGroup.Use(middleware.AuthRateLimit(s.redisClient.Client))
-			}
-			{
-				proxyGroup.POST("/completions", s.proxyController.ChatCompletion)
-			}
+		// Proxy routes for AI model access, authenticated with API keys
+		proxyGroup := api.Group("/chat")
+		proxyGroup.Use(middleware.APIKeyAuth(s.apiKeyRepo))
+		// Apply the key's and user's configured rate limits if Redis is available
+		if s.redisClient != nil {
+			proxyGroup.Use(middleware.NewUsageRateLimiter(s.redisClient.Client, s.quotaRepo).Limit())
+		}
+		{
+			proxyGroup.POST("/completions", s.proxyController.ChatCompletion)
 		}
 	}
 
@@ -211,14 +227,41 @@ func (s *Server) setupRouter() {
 		adminGroup.GET("/users", s.adminController.ListUsers)
 		adminGroup.GET("/users/:id", s.adminController.GetUserDetails)
 		adminGroup.PUT("/users/:id", s.adminController.UpdateUser)
+		adminGroup.POST("/users/:id/ledger-entries", s.adminController.PostLedgerEntry)
 
 		// Model provider management
 		adminGroup.POST("/providers", s.adminController.CreateModelProvider)
 		adminGroup.PUT("/providers/:id", s.adminController.UpdateModelProvider)
+		adminGroup.GET("/providers/:id/credentials", s.adminController.ListProviderCredentials)
+		adminGroup.POST("/providers/:id/credentials", s.adminController.CreateProviderCredential)
+		adminGroup.PUT("/credentials/:id", s.adminController.UpdateProviderCredential)
+		adminGroup.DELETE("/credentials/:id", s.adminController.DeleteProviderCredential)
 
 		// Model management
 		adminGroup.POST("/models", s.adminController.CreateModel)
 		adminGroup.PUT("/models/:id", s.adminController.UpdateModel)
+		adminGroup.GET("/models/:id/deployments", s.adminController.ListModelDeployments)
+		adminGroup.POST("/models/:id/deployments", s.adminController.CreateModelDeployment)
+		adminGroup.PUT("/deployments/:id", s.adminController.UpdateModelDeployment)
+		adminGroup.DELETE("/deployments/:id", s.adminController.DeleteModelDeployment)
+
+		// Model alias and routing rule management
+		adminGroup.GET("/aliases", s.adminController.ListModelAliases)
+		adminGroup.POST("/aliases", s.adminController.CreateModelAlias)
+		adminGroup.PUT("/aliases/:id", s.adminController.UpdateModelAlias)
+		adminGroup.DELETE("/aliases/:id", s.adminController.DeleteModelAlias)
+		adminGroup.GET("/routing-rules", s.adminController.ListRoutingRules)
+		adminGroup.POST("/routing-rules", s.adminController.CreateRoutingRule)
+		adminGroup.PUT("/routing-rules/:id", s.adminController.UpdateRoutingRule)
+		adminGroup.DELETE("/routing-rules/:id", s.adminController.DeleteRoutingRule)
+
+		// Billing queue and its dead letters
+		adminGroup.GET("/billing/queue", s.adminController.GetBillingQueueStatus)
+		adminGroup.GET("/billing/dead-letters", s.adminController.ListBillingDeadLetters)
+		adminGroup.POST("/billing/dead-letters/replay", s.adminController.ReplayBillingDeadLetters)
+		adminGroup.POST("/billing/dead-letters/:id/replay", s.adminController.ReplayBillingDeadLetters)
+		adminGroup.DELETE("/billing/dead-letters", s.adminController.PurgeBillingDeadLetters)
+		adminGroup.DELETE("/billing/dead-letters/:id", s.adminController.PurgeBillingDeadLetters)
 
 		// System management
 		adminGroup.GET("/stats", s.adminController.GetSystemStats)
@@ -255,6 +298,12 @@ func (s *Server) Start() error {
 		s.logger.Info().Msg("Billing worker started")
 	}
 
+	// Start writing quota usage counted in Redis to the database and
+	// rolling over ended quota windows
+	if s.quotaService != nil {
+		s.quotaService.StartQuotaJobs()
+	}
+
 	s.httpServer = &http.Server{
 		Addr:         ":" + s.cfg.Server.Port,
 		Handler:      s.router,
@@ -271,10 +320,16 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.billingService.StopBillingWorker()
 	}
 
+	var err error
 	if s.httpServer != nil {
-		return s.httpServer.Shutdown(ctx)
+		err = s.httpServer.Shutdown(ctx)
+	}
+
+	// Once calls have drained, a last flush writes their quota usage
+	if s.quotaService != nil {
+		s.quotaService.StopQuotaJobs()
 	}
-	return nil
+	return err
 }
 
 func (s *Server) Router() *gin.Engine {
@@ -9,19 +9,25 @@ import (
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
 	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/money"
 )
 
 var _ = (*gorm.DB)(nil)
 
 type adminService struct {
-	userRepo      repository.UserRepository
-	apiKeyRepo    repository.UserAPIKeyRepository
-	paymentRepo   repository.PaymentRecordRepository
-	billingRepo   repository.BillingRecordRepository
-	modelRepo     repository.ModelRepository
-	providerRepo  repository.ModelProviderRepository
-	statisticRepo repository.ModelStatisticRepository
-	configRepo    repository.SystemConfigRepository
+	userRepo       repository.UserRepository
+	apiKeyRepo     repository.UserAPIKeyRepository
+	paymentRepo    repository.PaymentRecordRepository
+	billingRepo    repository.BillingRecordRepository
+	modelRepo      repository.ModelRepository
+	providerRepo   repository.ModelProviderRepository
+	statisticRepo  repository.ModelStatisticRepository
+	configRepo     repository.SystemConfigRepository
+	deploymentRepo repository.ModelDeploymentRepository
+	credentialRepo repository.ProviderCredentialRepository
+	aliasRepo      repository.ModelAliasRepository
+	ruleRepo       repository.RoutingRuleRepository
+	breakers       CircuitBreakerService
 }
 
 func NewAdminService(
@@ -33,16 +39,26 @@ func NewAdminService(
 	providerRepo repository.ModelProviderRepository,
 	statisticRepo repository.ModelStatisticRepository,
 	configRepo repository.SystemConfigRepository,
+	deploymentRepo repository.ModelDeploymentRepository,
+	credentialRepo repository.ProviderCredentialRepository,
+	aliasRepo repository.ModelAliasRepository,
+	ruleRepo repository.RoutingRuleRepository,
+	breakers CircuitBreakerService,
 ) AdminService {
 	return &adminService{
-		userRepo:      userRepo,
-		apiKeyRepo:    apiKeyRepo,
-		paymentRepo:   paymentRepo,
-		billingRepo:   billingRepo,
-		modelRepo:     modelRepo,
-		providerRepo:  providerRepo,
-		statisticRepo: statisticRepo,
-		configRepo:    configRepo,
+		userRepo:       userRepo,
+		apiKeyRepo:     apiKeyRepo,
+		paymentRepo:    paymentRepo,
+		billingRepo:    billingRepo,
+		modelRepo:      modelRepo,
+		providerRepo:   providerRepo,
+		statisticRepo:  statisticRepo,
+		configRepo:     configRepo,
+		deploymentRepo: deploymentRepo,
+		credentialRepo: credentialRepo,
+		aliasRepo:      aliasRepo,
+		ruleRepo:       ruleRepo,
+		breakers:       breakers,
 	}
 }
 
@@ -246,12 +262,13 @@ func (s *adminService) GetUserDetails(ctx context.Context, userID string) (*Admi
 		}
 	}
 
-	avgDailyCost := 0.0
+	var avgDailyCost money.Amount
 	if len(records) > 0 {
 		firstRecord := records[len(records)-1]
-		days := time.Since(firstRecord.CreatedAt).Hours() / 24
-		if days > 0 {
-			avgDailyCost = totalUsed / days
+		// Whole minutes keep the division exact
+		minutes := int64(time.Since(firstRecord.CreatedAt) / time.Minute)
+		if minutes > 0 {
+			avgDailyCost = totalUsed.MulDiv(24*60, minutes, money.HalfUp)
 		}
 	}
 
@@ -489,6 +506,418 @@ func (s *adminService) UpdateModel(ctx context.Context, modelID string, req *Upd
 	return nil
 }
 
+func (s *adminService) ListModelDeployments(ctx context.Context, modelID string) ([]*model.ModelDeployment, error) {
+	modelObj, err := s.modelRepo.FindByID(ctx, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, fmt.Errorf("model not found")
+	}
+
+	deployments, err := s.deploymentRepo.FindByModelID(ctx, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model deployments: %w", err)
+	}
+	return deployments, nil
+}
+
+func (s *adminService) CreateModelDeployment(ctx context.Context, modelID string, req *CreateModelDeploymentRequest) (*model.ModelDeployment, error) {
+	modelObj, err := s.modelRepo.FindByID(ctx, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, fmt.Errorf("model not found")
+	}
+
+	provider, err := s.providerRepo.FindByID(ctx, req.ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider: %w", err)
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider not found")
+	}
+
+	weight := 1
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+
+	deployment := &model.ModelDeployment{
+		ModelID:       modelID,
+		ProviderID:    req.ProviderID,
+		UpstreamModel: req.UpstreamModel,
+		Priority:      req.Priority,
+		Weight:        weight,
+		InputPrice:    req.InputPrice,
+		OutputPrice:   req.OutputPrice,
+		IsActive:      true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	if err := s.deploymentRepo.Create(ctx, deployment); err != nil {
+		return nil, fmt.Errorf("failed to create model deployment: %w", err)
+	}
+
+	deployment.Provider = *provider
+	return deployment, nil
+}
+
+func (s *adminService) UpdateModelDeployment(ctx context.Context, deploymentID string, req *UpdateModelDeploymentRequest) error {
+	deployment, err := s.deploymentRepo.FindByID(ctx, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to get model deployment: %w", err)
+	}
+	if deployment == nil {
+		return fmt.Errorf("deployment not found")
+	}
+
+	if req.UpstreamModel != nil {
+		deployment.UpstreamModel = *req.UpstreamModel
+	}
+	if req.Priority != nil {
+		deployment.Priority = *req.Priority
+	}
+	if req.Weight != nil {
+		deployment.Weight = *req.Weight
+	}
+	if req.InputPrice != nil {
+		deployment.InputPrice = req.InputPrice
+	}
+	if req.OutputPrice != nil {
+		deployment.OutputPrice = req.OutputPrice
+	}
+	if req.IsActive != nil {
+		deployment.IsActive = *req.IsActive
+	}
+	deployment.UpdatedAt = time.Now()
+
+	if err := s.deploymentRepo.Update(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to update model deployment: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) DeleteModelDeployment(ctx context.Context, deploymentID string) error {
+	deployment, err := s.deploymentRepo.FindByID(ctx, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to get model deployment: %w", err)
+	}
+	if deployment == nil {
+		return fmt.Errorf("deployment not found")
+	}
+
+	if err := s.deploymentRepo.Delete(ctx, deploymentID); err != nil {
+		return fmt.Errorf("failed to delete model deployment: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) ListProviderCredentials(ctx context.Context, providerID string) ([]*model.ProviderCredential, error) {
+	provider, err := s.providerRepo.FindByID(ctx, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider: %w", err)
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider not found")
+	}
+
+	credentials, err := s.credentialRepo.FindByProviderID(ctx, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list provider credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+func (s *adminService) CreateProviderCredential(ctx context.Context, providerID string, req *CreateProviderCredentialRequest) (*model.ProviderCredential, error) {
+	provider, err := s.providerRepo.FindByID(ctx, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider: %w", err)
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider not found")
+	}
+
+	weight := 1
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+
+	credential := &model.ProviderCredential{
+		ProviderID: providerID,
+		Name:       req.Name,
+		APIKey:     req.APIKey,
+		MaskedKey:  model.MaskAPIKey(req.APIKey),
+		Weight:     weight,
+		Status:     model.CredentialStatusActive,
+		RPMLimit:   req.RPMLimit,
+		TPMLimit:   req.TPMLimit,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := s.credentialRepo.Create(ctx, credential); err != nil {
+		return nil, fmt.Errorf("failed to create provider credential: %w", err)
+	}
+	return credential, nil
+}
+
+func (s *adminService) UpdateProviderCredential(ctx context.Context, credentialID string, req *UpdateProviderCredentialRequest) error {
+	credential, err := s.credentialRepo.FindByID(ctx, credentialID)
+	if err != nil {
+		return fmt.Errorf("failed to get provider credential: %w", err)
+	}
+	if credential == nil {
+		return fmt.Errorf("credential not found")
+	}
+
+	if req.Name != nil {
+		credential.Name = *req.Name
+	}
+	if req.Weight != nil {
+		credential.Weight = *req.Weight
+	}
+	if req.RPMLimit != nil {
+		credential.RPMLimit = *req.RPMLimit
+	}
+	if req.TPMLimit != nil {
+		credential.TPMLimit = *req.TPMLimit
+	}
+	if req.Status != nil {
+		credential.Status = *req.Status
+		if credential.Status == model.CredentialStatusActive {
+			// Re-enabling a key gives it a clean slate
+			credential.AuthFailures = 0
+			credential.CooldownUntil = nil
+			credential.LastError = ""
+		}
+	}
+	credential.UpdatedAt = time.Now()
+
+	if err := s.credentialRepo.Update(ctx, credential); err != nil {
+		return fmt.Errorf("failed to update provider credential: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) DeleteProviderCredential(ctx context.Context, credentialID string) error {
+	credential, err := s.credentialRepo.FindByID(ctx, credentialID)
+	if err != nil {
+		return fmt.Errorf("failed to get provider credential: %w", err)
+	}
+	if credential == nil {
+		return fmt.Errorf("credential not found")
+	}
+
+	if err := s.credentialRepo.Delete(ctx, credentialID); err != nil {
+		return fmt.Errorf("failed to delete provider credential: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) ListModelAliases(ctx context.Context) ([]*model.ModelAlias, error) {
+	aliases, err := s.aliasRepo.FindAllWithModels(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+func (s *adminService) CreateModelAlias(ctx context.Context, req *CreateModelAliasRequest) (*model.ModelAlias, error) {
+	existing, err := s.aliasRepo.FindByName(ctx, req.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check alias: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("alias with this name already exists")
+	}
+
+	// Model names are resolved before aliases, so such an alias would never apply
+	shadowing, err := s.modelRepo.FindActiveByName(ctx, req.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check model names: %w", err)
+	}
+	if shadowing != nil {
+		return nil, fmt.Errorf("model with this name already exists")
+	}
+
+	modelObj, err := s.modelRepo.FindByID(ctx, req.ModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, fmt.Errorf("model not found")
+	}
+
+	alias := &model.ModelAlias{
+		Name:        req.Name,
+		Description: req.Description,
+		ModelID:     req.ModelID,
+		IsActive:    true,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if err := s.aliasRepo.Create(ctx, alias); err != nil {
+		return nil, fmt.Errorf("failed to create model alias: %w", err)
+	}
+
+	alias.Model = *modelObj
+	return alias, nil
+}
+
+func (s *adminService) UpdateModelAlias(ctx context.Context, aliasID string, req *UpdateModelAliasRequest) error {
+	alias, err := s.aliasRepo.FindByID(ctx, aliasID)
+	if err != nil {
+		return fmt.Errorf("failed to get model alias: %w", err)
+	}
+	if alias == nil {
+		return fmt.Errorf("alias not found")
+	}
+
+	if req.ModelID != nil {
+		modelObj, err := s.modelRepo.FindByID(ctx, *req.ModelID)
+		if err != nil {
+			return fmt.Errorf("failed to get model: %w", err)
+		}
+		if modelObj == nil {
+			return fmt.Errorf("model not found")
+		}
+		alias.ModelID = *req.ModelID
+	}
+	if req.Description != nil {
+		alias.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		alias.IsActive = *req.IsActive
+	}
+	alias.UpdatedAt = time.Now()
+
+	if err := s.aliasRepo.Update(ctx, alias); err != nil {
+		return fmt.Errorf("failed to update model alias: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) DeleteModelAlias(ctx context.Context, aliasID string) error {
+	alias, err := s.aliasRepo.FindByID(ctx, aliasID)
+	if err != nil {
+		return fmt.Errorf("failed to get model alias: %w", err)
+	}
+	if alias == nil {
+		return fmt.Errorf("alias not found")
+	}
+
+	if err := s.aliasRepo.Delete(ctx, aliasID); err != nil {
+		return fmt.Errorf("failed to delete model alias: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) ListRoutingRules(ctx context.Context) ([]*model.RoutingRule, error) {
+	rules, err := s.ruleRepo.FindOrdered(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routing rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (s *adminService) CreateRoutingRule(ctx context.Context, req *CreateRoutingRuleRequest) (*model.RoutingRule, error) {
+	modelObj, err := s.modelRepo.FindByID(ctx, req.TargetModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, fmt.Errorf("model not found")
+	}
+
+	conditions, err := req.Conditions.ToJSONB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode routing conditions: %w", err)
+	}
+
+	rule := &model.RoutingRule{
+		Name:          req.Name,
+		Description:   req.Description,
+		Priority:      req.Priority,
+		Conditions:    conditions,
+		TargetModelID: req.TargetModelID,
+		IsActive:      true,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	if err := s.ruleRepo.Create(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to create routing rule: %w", err)
+	}
+
+	rule.TargetModel = *modelObj
+	return rule, nil
+}
+
+func (s *adminService) UpdateRoutingRule(ctx context.Context, ruleID string, req *UpdateRoutingRuleRequest) error {
+	rule, err := s.ruleRepo.FindByID(ctx, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to get routing rule: %w", err)
+	}
+	if rule == nil {
+		return fmt.Errorf("rule not found")
+	}
+
+	if req.TargetModelID != nil {
+		modelObj, err := s.modelRepo.FindByID(ctx, *req.TargetModelID)
+		if err != nil {
+			return fmt.Errorf("failed to get model: %w", err)
+		}
+		if modelObj == nil {
+			return fmt.Errorf("model not found")
+		}
+		rule.TargetModelID = *req.TargetModelID
+	}
+	if req.Conditions != nil {
+		conditions, err := req.Conditions.ToJSONB()
+		if err != nil {
+			return fmt.Errorf("failed to encode routing conditions: %w", err)
+		}
+		rule.Conditions = conditions
+	}
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+	rule.UpdatedAt = time.Now()
+
+	if err := s.ruleRepo.Update(ctx, rule); err != nil {
+		return fmt.Errorf("failed to update routing rule: %w", err)
+	}
+	return nil
+}
+
+func (s *adminService) DeleteRoutingRule(ctx context.Context, ruleID string) error {
+	rule, err := s.ruleRepo.FindByID(ctx, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to get routing rule: %w", err)
+	}
+	if rule == nil {
+		return fmt.Errorf("rule not found")
+	}
+
+	if err := s.ruleRepo.Delete(ctx, ruleID); err != nil {
+		return fmt.Errorf("failed to delete routing rule: %w", err)
+	}
+	return nil
+}
+
 func (s *adminService) GetSystemStats(ctx context.Context) (*SystemStats, error) {
 	totalUsers, err := s.userRepo.Count(ctx)
 	if err != nil {
@@ -502,7 +931,7 @@ func (s *adminService) GetSystemStats(ctx context.Context) (*SystemStats, error)
 		activeUsers = totalUsers // fallback to total users
 	}
 
-	var totalRevenue float64
+	var totalRevenue money.Amount
 	totalRequests, err := s.billingRepo.Count(ctx)
 	if err != nil {
 		log.Printf("failed to count total requests: %v", err)
@@ -557,7 +986,7 @@ func (s *adminService) GetSystemStats(ctx context.Context) (*SystemStats, error)
 		yesterdayRecords = nil
 	}
 	var dailyRequests int64
-	var dailyRevenue float64
+	var dailyRevenue money.Amount
 	for _, record := range yesterdayRecords {
 		dailyRequests++
 		dailyRevenue += record.Cost
@@ -579,6 +1008,7 @@ func (s *adminService) GetSystemStats(ctx context.Context) (*SystemStats, error)
 			Memory:   45.2,
 			CPU:      12.5,
 		},
+		CircuitBreakers: s.breakers.Snapshot(),
 	}, nil
 }
 
@@ -643,7 +1073,7 @@ func (s *adminService) getTopModels(ctx context.Context, limit int) ([]*ModelSta
 			modelName = modelObj.Name
 		}
 
-		revenue := float64(stat.TotalTokens) * 0.0001
+		revenue := money.MustParse("0.0001").Mul(int64(stat.TotalTokens))
 
 		modelStats[i] = &ModelStats{
 			ModelID:     stat.ModelID,
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/cache"
+)
+
+const (
+	apiKeyUsageKeyPrefix = "apikey:usage:"
+
+	apiKeyUsageRequestsField = "requests"
+	apiKeyUsageTokensField   = "tokens"
+
+	// apiKeySeedAttempts bounds how often a reservation is retried when the
+	// counters expire between being seeded and being checked
+	apiKeySeedAttempts = 3
+)
+
+// reserveAPIKeyUsageScript checks a call against the monthly caps ARGV[1]
+// (requests) and ARGV[2] (tokens), where -1 is uncapped, and counts it with
+// ARGV[3] tokens, keeping the counters KEYS[1] until ARGV[4] (ms). It returns
+// the status, the failed cap (1 requests, 2 tokens) and the usage before the
+// call. The status is 1 when the call was counted, 0 when a cap was reached
+// and -1 when the counters are missing.
+var reserveAPIKeyUsageScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {-1, 0, 0, 0}
+end
+local requests = tonumber(redis.call('HGET', KEYS[1], 'requests') or '0')
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens') or '0')
+local requestLimit = tonumber(ARGV[1])
+local tokenLimit = tonumber(ARGV[2])
+if requestLimit >= 0 and requests + 1 > requestLimit then
+	return {0, 1, requests, tokens}
+end
+if tokenLimit >= 0 and tokens + tonumber(ARGV[3]) > tokenLimit then
+	return {0, 2, requests, tokens}
+end
+redis.call('HINCRBY', KEYS[1], 'requests', 1)
+redis.call('HINCRBY', KEYS[1], 'tokens', ARGV[3])
+redis.call('PEXPIREAT', KEYS[1], ARGV[4])
+return {1, 0, requests, tokens}
+`)
+
+// adjustAPIKeyUsageScript adds ARGV[1] requests and ARGV[2] tokens to the
+// counters KEYS[1], if they still exist
+var adjustAPIKeyUsageScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], 'requests', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'tokens', ARGV[2])
+return 1
+`)
+
+type apiKeyPolicyService struct {
+	billingRepo repository.BillingRecordRepository
+	redisClient *cache.RedisClient
+}
+
+func NewAPIKeyPolicyService(
+	billingRepo repository.BillingRecordRepository,
+	redisClient *cache.RedisClient,
+) APIKeyPolicyService {
+	return &apiKeyPolicyService{
+		billingRepo: billingRepo,
+		redisClient: redisClient,
+	}
+}
+
+func (s *apiKeyPolicyService) Authorize(ctx context.Context, key *model.UserAPIKey, modelObj *model.Model, action string, tokens int) (*APIKeyAuthorization, error) {
+	permissions, err := apiKeyPermissionSet(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API key permissions: %w", err)
+	}
+
+	if !allowsModel(permissions, modelObj, action) {
+		return &APIKeyAuthorization{
+			Allowed: false,
+			Reason:  fmt.Sprintf("API key is not allowed to %s model %s", action, modelObj.Name),
+			MissingPermission: &model.Permission{
+				ResourceType: "model",
+				ResourceID:   modelObj.ID,
+				Action:       action,
+			},
+		}, nil
+	}
+
+	now := time.Now().UTC()
+	result := &APIKeyAuthorization{
+		Allowed:   true,
+		NextReset: startOfNextMonth(now),
+	}
+
+	// Keys without caps have nothing to check or count
+	if permissions.MaxRequestsPerMonth == nil && permissions.MaxTokensPerMonth == nil {
+		return result, nil
+	}
+
+	// A cap that is not set is passed as -1
+	requestLimit, tokenLimit := int64(-1), int64(-1)
+	if limit := permissions.MaxRequestsPerMonth; limit != nil {
+		requestLimit = *limit
+		result.MonthlyRequestsLimit = *limit
+	}
+	if limit := permissions.MaxTokensPerMonth; limit != nil {
+		tokenLimit = *limit
+		result.MonthlyTokensLimit = *limit
+	}
+
+	if s.redisClient != nil {
+		err := s.reserveUsage(ctx, key.ID, now, requestLimit, tokenLimit, tokens, result)
+		if err == nil {
+			return result, nil
+		}
+		// Concurrent calls are then only checked against billing records,
+		// which each of them may see before the others are billed
+		fmt.Printf("Checking API key caps against billing records: %v\n", err)
+	}
+	if err := s.checkStoredUsage(ctx, key.ID, now, requestLimit, tokenLimit, tokens, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// reserveUsage checks a call against the key's caps and counts it in Redis,
+// setting result.Reservation when the call is allowed
+func (s *apiKeyPolicyService) reserveUsage(ctx context.Context, keyID string, now time.Time, requestLimit, tokenLimit int64, tokens int, result *APIKeyAuthorization) error {
+	reservation := &APIKeyReservation{KeyID: keyID, Month: now.Format("2006-01"), Tokens: tokens}
+	usageKey := apiKeyUsageKey(reservation.KeyID, reservation.Month)
+	for attempt := 0; attempt < apiKeySeedAttempts; attempt++ {
+		if err := s.ensureMonthlyUsage(ctx, keyID, now); err != nil {
+			return err
+		}
+
+		values, err := reserveAPIKeyUsageScript.Run(ctx, s.redisClient.Client, []string{usageKey},
+			requestLimit, tokenLimit, tokens, apiKeyUsageExpiry(now).UnixMilli(),
+		).Int64Slice()
+		if err != nil {
+			return fmt.Errorf("failed to reserve API key usage: %w", err)
+		}
+
+		switch values[0] {
+		case -1:
+			// The counters expired after being seeded
+			continue
+		case 0:
+			result.MonthlyRequests, result.MonthlyTokens = values[2], values[3]
+			denyAPIKeyUsage(result, values[1] == 1)
+			return nil
+		default:
+			result.MonthlyRequests, result.MonthlyTokens = values[2], values[3]
+			result.Reservation = reservation
+			return nil
+		}
+	}
+	return fmt.Errorf("API key usage kept expiring while reserving")
+}
+
+// checkStoredUsage checks a call against the key's usage in billing records,
+// reserving nothing
+func (s *apiKeyPolicyService) checkStoredUsage(ctx context.Context, keyID string, now time.Time, requestLimit, tokenLimit int64, tokens int, result *APIKeyAuthorization) error {
+	requests, used, err := s.billingRepo.GetAPIKeyUsage(ctx, keyID, startOfMonth(now))
+	if err != nil {
+		return err
+	}
+	result.MonthlyRequests, result.MonthlyTokens = requests, used
+
+	if requestLimit >= 0 && requests+1 > requestLimit {
+		denyAPIKeyUsage(result, true)
+	} else if tokenLimit >= 0 && used+int64(tokens) > tokenLimit {
+		denyAPIKeyUsage(result, false)
+	}
+	return nil
+}
+
+// denyAPIKeyUsage marks a call as over the key's request or token cap
+func denyAPIKeyUsage(result *APIKeyAuthorization, requestCap bool) {
+	result.Allowed = false
+	if requestCap {
+		result.Reason = "API key monthly request limit exceeded"
+		result.ExceededLimit = "max_requests_per_month"
+	} else {
+		result.Reason = "API key monthly token limit exceeded"
+		result.ExceededLimit = "max_tokens_per_month"
+	}
+}
+
+func (s *apiKeyPolicyService) RecordUsage(ctx context.Context, reservation *APIKeyReservation, tokens int) error {
+	if reservation == nil {
+		return nil
+	}
+	return s.adjustUsage(ctx, reservation, 0, int64(tokens-reservation.Tokens))
+}
+
+func (s *apiKeyPolicyService) ReleaseUsage(ctx context.Context, reservation *APIKeyReservation) error {
+	if reservation == nil {
+		return nil
+	}
+	return s.adjustUsage(ctx, reservation, -1, -int64(reservation.Tokens))
+}
+
+// adjustUsage corrects the counters a reservation was counted in. Counters
+// that expired are left alone, to be seeded from billing records again.
+func (s *apiKeyPolicyService) adjustUsage(ctx context.Context, reservation *APIKeyReservation, requests, tokens int64) error {
+	if requests == 0 && tokens == 0 {
+		return nil
+	}
+	key := apiKeyUsageKey(reservation.KeyID, reservation.Month)
+	if err := adjustAPIKeyUsageScript.Run(ctx, s.redisClient.Client, []string{key}, requests, tokens).Err(); err != nil {
+		return fmt.Errorf("failed to record API key usage: %w", err)
+	}
+	return nil
+}
+
+// ensureMonthlyUsage seeds the month's counters from billing records when
+// they are missing from Redis, e.g. after a flush, so that a lost cache never
+// resets a key's caps.
+func (s *apiKeyPolicyService) ensureMonthlyUsage(ctx context.Context, keyID string, now time.Time) error {
+	key := apiKeyUsageKey(keyID, now.Format("2006-01"))
+	exists, err := s.redisClient.Client.Exists(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check API key usage: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	requests, tokens, err := s.billingRepo.GetAPIKeyUsage(ctx, keyID, startOfMonth(now))
+	if err != nil {
+		return err
+	}
+
+	// HSETNX keeps counts written by a concurrent request that got here first
+	pipe := s.redisClient.Client.TxPipeline()
+	pipe.HSetNX(ctx, key, apiKeyUsageRequestsField, requests)
+	pipe.HSetNX(ctx, key, apiKeyUsageTokensField, tokens)
+	pipe.ExpireAt(ctx, key, apiKeyUsageExpiry(now))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to seed API key usage: %w", err)
+	}
+	return nil
+}
+
+// Permits checks the key's permissions alone, without its monthly caps
+func (s *apiKeyPolicyService) Permits(key *model.UserAPIKey, modelObj *model.Model, action string) bool {
+	permissions, err := apiKeyPermissionSet(key)
+	if err != nil {
+		return false
+	}
+	return allowsModel(permissions, modelObj, action)
+}
+
+// allowsModel checks a model permission. Permissions may name a model by ID,
+// as the portal does, or by name.
+func allowsModel(permissions *model.PermissionSet, modelObj *model.Model, action string) bool {
+	return permissions.Allows("model", modelObj.ID, action) || permissions.Allows("model", modelObj.Name, action)
+}
+
+// apiKeyPermissionSet returns the key's permissions. Keys stored without any
+// permissions predate permission sets and keep full access.
+func apiKeyPermissionSet(key *model.UserAPIKey) (*model.PermissionSet, error) {
+	if len(key.Permissions) == 0 {
+		return model.NewFullAccessPermissionSet(), nil
+	}
+	return model.PermissionSetFromJSONB(key.Permissions)
+}
+
+func apiKeyUsageKey(keyID, month string) string {
+	return apiKeyUsageKeyPrefix + keyID + ":" + month
+}
+
+// apiKeyUsageExpiry keeps a month's counters a day past its end
+func apiKeyUsageExpiry(now time.Time) time.Time {
+	return startOfNextMonth(now).Add(24 * time.Hour)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func startOfNextMonth(t time.Time) time.Time {
+	return startOfMonth(t).AddDate(0, 1, 0)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/cache"
+)
+
+// mockAPIKeyUsageRepository reports a key's usage this month from billing
+// records
+type mockAPIKeyUsageRepository struct {
+	repository.BillingRecordRepository
+	requests int64
+	tokens   int64
+	calls    int
+}
+
+func (m *mockAPIKeyUsageRepository) GetAPIKeyUsage(ctx context.Context, apiKeyID string, since time.Time) (int64, int64, error) {
+	m.calls++
+	return m.requests, m.tokens, nil
+}
+
+func TestAPIKeyPolicyService_AuthorizeWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	modelObj := &model.Model{ID: "model-1", Name: "gpt-4o"}
+
+	// Nothing listens on the port, so every Redis call fails
+	unreachable := &cache.RedisClient{Client: redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})}
+	defer unreachable.Client.Close()
+
+	capped := func(requests, tokens int64) *model.UserAPIKey {
+		permissions := model.NewFullAccessPermissionSet()
+		permissions.MaxRequestsPerMonth = &requests
+		permissions.MaxTokensPerMonth = &tokens
+		key := &model.UserAPIKey{ID: "key-1"}
+		key.Permissions = permissions.ToJSONB()
+		return key
+	}
+
+	tests := []struct {
+		name      string
+		key       *model.UserAPIKey
+		allowed   bool
+		exceeded  string
+		readsRepo bool
+	}{
+		{name: "no caps", key: &model.UserAPIKey{ID: "key-1"}, allowed: true},
+		{name: "under caps", key: capped(11, 1000), allowed: true, readsRepo: true},
+		{name: "request cap", key: capped(10, 1000), exceeded: "max_requests_per_month", readsRepo: true},
+		{name: "token cap", key: capped(11, 600), exceeded: "max_tokens_per_month", readsRepo: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockAPIKeyUsageRepository{requests: 10, tokens: 500}
+			service := NewAPIKeyPolicyService(repo, unreachable)
+
+			authz, err := service.Authorize(ctx, tt.key, modelObj, model.ActionChat, 200)
+			if err != nil {
+				t.Fatalf("Authorize() error = %v, want a check against billing records", err)
+			}
+			if authz.Allowed != tt.allowed || authz.ExceededLimit != tt.exceeded {
+				t.Errorf("Authorize() = allowed %v, exceeded %q, want %v, %q", authz.Allowed, authz.ExceededLimit, tt.allowed, tt.exceeded)
+			}
+			if authz.Reservation != nil {
+				t.Errorf("Authorize() reserved %+v without Redis", authz.Reservation)
+			}
+			if (repo.calls > 0) != tt.readsRepo {
+				t.Errorf("billing records read %d times, want reads %v", repo.calls, tt.readsRepo)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"massrouter.ai/backend/pkg/money"
+	"massrouter.ai/backend/pkg/utils"
+)
+
+const (
+	// inFlightHoldTTL is how long a hold lasts if its call never settles, as
+	// when the router instance serving it crashes
+	inFlightHoldTTL = 15 * time.Minute
+
+	// settledHoldTTL keeps a settled hold until the billing worker has stored
+	// its record, so the charge is never missing from both the holds and the
+	// stored balance
+	settledHoldTTL = time.Hour
+
+	// holdReserveAttempts bounds how often a reservation is retried when the
+	// stored balance changes while it is being made
+	holdReserveAttempts = 3
+)
+
+// A user's holds are kept in three keys sharing a hash tag, so the scripts
+// can run on a Redis cluster:
+//
+//	balance_hold:{user}:expiry   sorted set of hold IDs by expiry (ms)
+//	balance_hold:{user}:amount   hash of hold ID to amount in money units
+//	balance_hold:{user}:version  bumped whenever a billing record is stored
+func holdKeys(userID string) []string {
+	prefix := "balance_hold:{" + userID + "}:"
+	return []string{prefix + "expiry", prefix + "amount", prefix + "version"}
+}
+
+// holdNowLua sets now to the Redis time in ms. Holds are timed by Redis so
+// that router instances with skewed clocks agree on which have expired.
+const holdNowLua = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// pruneHoldsLua drops expired holds and sets held to the sum of the rest
+const pruneHoldsLua = holdNowLua + `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)
+if #expired > 0 then
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+	redis.call('HDEL', KEYS[2], unpack(expired))
+end
+local held = 0
+for _, v in ipairs(redis.call('HVALS', KEYS[2])) do
+	held = held + tonumber(v)
+end
+`
+
+// setHoldLua stores hold ARGV[1] for amount ARGV[2] with a TTL of ARGV[3] ms,
+// keeping the keys alive as long as their longest hold
+const setHoldLua = `
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+local expireAt = math.ceil(tonumber(last[2]))
+redis.call('PEXPIREAT', KEYS[1], expireAt)
+redis.call('PEXPIREAT', KEYS[2], expireAt)
+`
+
+// reserveHoldScript places a hold if the available balance ARGV[4], read from
+// the database at version ARGV[5], covers it on top of the other holds. It
+// returns 1 when the hold was placed, 0 when the balance is insufficient and
+// -1 when a billing record was stored since the balance was read, followed by
+// the amount already held.
+var reserveHoldScript = redis.NewScript(pruneHoldsLua + `
+if (redis.call('GET', KEYS[3]) or '0') ~= ARGV[5] then
+	return {-1, held}
+end
+if tonumber(ARGV[4]) - held < tonumber(ARGV[2]) then
+	return {0, held}
+end
+` + setHoldLua + `
+return {1, held}
+`)
+
+// settleHoldScript changes a hold to the call's actual cost and keeps it until
+// the billing record is stored. A hold that already expired is placed again.
+var settleHoldScript = redis.NewScript(pruneHoldsLua + setHoldLua + `
+return 1
+`)
+
+// heldAmountScript returns the sum of the unexpired holds, without
+// changing them
+var heldAmountScript = redis.NewScript(holdNowLua + `
+local held = 0
+for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. now, '+inf')) do
+	held = held + tonumber(redis.call('HGET', KEYS[2], id) or '0')
+end
+return held
+`)
+
+// releaseHoldScript removes hold ARGV[1]. When ARGV[2] is 1 its billing
+// record was stored, and the version is bumped so that reservations which
+// read the balance before then try again.
+var releaseHoldScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if ARGV[2] == '1' then
+	redis.call('INCR', KEYS[3])
+	redis.call('EXPIRE', KEYS[3], 86400)
+end
+return 1
+`)
+
+func (s *billingService) ReserveBalance(ctx context.Context, userID string, amount money.Amount) (*BalanceReservation, error) {
+	if s.redisClient == nil {
+		// Without Redis there is nowhere to share holds, so the balance can
+		// only be checked
+		balance, err := s.storedBalance(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		return &BalanceReservation{
+			Allowed:   balance.Available >= amount,
+			Amount:    amount,
+			Balance:   balance.Balance,
+			Held:      balance.Held,
+			Available: balance.Available,
+		}, nil
+	}
+
+	holdID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate hold id: %w", err)
+	}
+
+	keys := holdKeys(userID)
+	for attempt := 0; attempt < holdReserveAttempts; attempt++ {
+		// The version is read first: if a record is stored after this, the
+		// balance below may or may not include it, and the script refuses
+		version, err := s.redisClient.Client.Get(ctx, keys[2]).Result()
+		if err == redis.Nil {
+			version = "0"
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read balance version: %w", err)
+		}
+
+		balance, err := s.storedBalance(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := reserveHoldScript.Run(ctx, s.redisClient.Client, keys,
+			holdID, formatAmount(amount), inFlightHoldTTL.Milliseconds(), formatAmount(balance.Available), version,
+		).Slice()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve balance: %w", err)
+		}
+		status, _ := result[0].(int64)
+		otherHolds, _ := result[1].(int64)
+		held := balance.Held + money.Amount(otherHolds)
+
+		switch status {
+		case -1:
+			continue
+		case 0:
+			return &BalanceReservation{
+				Amount:    amount,
+				Balance:   balance.Balance,
+				Held:      held,
+				Available: balance.Balance - held,
+			}, nil
+		default:
+			return &BalanceReservation{
+				Allowed:   true,
+				HoldID:    holdID,
+				Amount:    amount,
+				Balance:   balance.Balance,
+				Held:      held,
+				Available: balance.Balance - held,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("balance kept changing while reserving")
+}
+
+func (s *billingService) ReleaseBalance(ctx context.Context, userID, holdID string) error {
+	return s.releaseHold(ctx, userID, holdID, false)
+}
+
+// settleHold changes a hold to the actual cost of its call
+func (s *billingService) settleHold(ctx context.Context, userID, holdID string, cost money.Amount) error {
+	if s.redisClient == nil || holdID == "" {
+		return nil
+	}
+	err := settleHoldScript.Run(ctx, s.redisClient.Client, holdKeys(userID),
+		holdID, formatAmount(cost), settledHoldTTL.Milliseconds(),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to settle balance hold: %w", err)
+	}
+	return nil
+}
+
+// releaseHold removes a hold; stored reports that its call's billing record
+// is now part of the stored balance
+func (s *billingService) releaseHold(ctx context.Context, userID, holdID string, stored bool) error {
+	if s.redisClient == nil || (holdID == "" && !stored) {
+		return nil
+	}
+	flag := "0"
+	if stored {
+		flag = "1"
+	}
+	if err := releaseHoldScript.Run(ctx, s.redisClient.Client, holdKeys(userID), holdID, flag).Err(); err != nil {
+		return fmt.Errorf("failed to release balance hold: %w", err)
+	}
+	return nil
+}
+
+// heldAmount is the total of the user's unexpired holds
+func (s *billingService) heldAmount(ctx context.Context, userID string) (money.Amount, error) {
+	if s.redisClient == nil {
+		return 0, nil
+	}
+
+	held, err := heldAmountScript.Run(ctx, s.redisClient.Client, holdKeys(userID)[:2]).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return money.Amount(held), nil
+}
+
+// Amounts are kept in Redis as whole money units, which Lua adds exactly
+func formatAmount(amount money.Amount) string {
+	return strconv.FormatInt(amount.Units(), 10)
+}
+
+func parseAmount(value interface{}) money.Amount {
+	s, _ := value.(string)
+	units, _ := strconv.ParseInt(s, 10, 64)
+	return money.Amount(units)
+}
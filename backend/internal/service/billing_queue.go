@@ -0,0 +1,613 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"massrouter.ai/backend/pkg/utils"
+)
+
+// Billing jobs are entries of a Redis stream read by a consumer group, so any
+// number of consumers across router instances share the work:
+//
+//	stream:billing:records  stream of jobs, each in an entry's "job" field
+//	queue:billing:retry     sorted set of failed jobs by next attempt (ms)
+//	queue:billing:dead      hash of jobs given up on, by request ID
+//
+// An entry stays pending in the group until its record is stored, the job is
+// scheduled for a retry or it is dead-lettered; it is then acknowledged and
+// deleted, so the stream holds only the jobs not yet done. Entries a consumer
+// left pending for longer than the claim idle time are taken over by another,
+// so a consumer that dies loses nothing.
+const (
+	billingStreamKey     = "stream:billing:records"
+	billingGroup         = "billing-workers"
+	billingRetryKey      = "queue:billing:retry"
+	billingDeadLetterKey = "queue:billing:dead"
+
+	// Jobs were once kept in a list; any left there are moved to the stream
+	billingLegacyQueueKey = "queue:billing:records"
+
+	// billingMaxAttempts is how often a job is tried before it is
+	// dead-lettered
+	billingMaxAttempts = 5
+
+	// billingRetryBaseDelay is the backoff before the first retry; it doubles
+	// up to billingRetryMaxDelay
+	billingRetryBaseDelay = 2 * time.Second
+	billingRetryMaxDelay  = 5 * time.Minute
+
+	// billingPollInterval bounds how long a consumer waits for new entries,
+	// and how often due retries are put back on the stream
+	billingPollInterval = time.Second
+
+	// billingClaimInterval is how often a consumer looks for entries left
+	// pending by consumers that died
+	billingClaimInterval = 30 * time.Second
+
+	// billingConsumerMaxIdle is how long a consumer with nothing pending may
+	// be silent before it is removed from the group, as when its router
+	// instance was replaced
+	billingConsumerMaxIdle = time.Hour
+
+	// billingRequeueBatch bounds the retries and legacy jobs moved at once
+	billingRequeueBatch = 100
+)
+
+// BillingWorkerOptions sizes the billing consumers a router instance runs
+type BillingWorkerOptions struct {
+	Consumers int           // Consumers reading the billing stream in this process
+	BatchSize int           // Entries read, and records stored, in one transaction
+	ClaimIdle time.Duration // How long an entry may stay unacknowledged before another consumer takes it over
+}
+
+// withDefaults fills in options that are unset
+func (o BillingWorkerOptions) withDefaults() BillingWorkerOptions {
+	if o.Consumers <= 0 {
+		o.Consumers = 1
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.ClaimIdle <= 0 {
+		o.ClaimIdle = 2 * time.Minute
+	}
+	return o
+}
+
+// billingJob is a billing record waiting to be stored
+type billingJob struct {
+	ID        string                      `json:"id"` // The request ID, which makes storing the record idempotent
+	Attempts  int                         `json:"attempts,omitempty"`
+	LastError string                      `json:"last_error,omitempty"`
+	Request   *CreateBillingRecordRequest `json:"request"`
+}
+
+// billingEntry is a job read from the stream
+type billingEntry struct {
+	id  string // The stream entry ID
+	job *billingJob
+}
+
+// billingNowLua sets now to the Redis clock in ms, so that instances with
+// skewed clocks agree on when retries are due
+const billingNowLua = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// retryBillingEntryScript acknowledges entry ARGV[2] of group ARGV[1] and
+// schedules job ARGV[3] in its place, due in ARGV[4] ms. It does nothing if
+// the entry was acknowledged already, by a consumer that took it over.
+var retryBillingEntryScript = redis.NewScript(billingNowLua + `
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XDEL', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], now + tonumber(ARGV[4]), ARGV[3])
+return 1
+`)
+
+// deadLetterBillingEntryScript acknowledges entry ARGV[2] of group ARGV[1]
+// and stores dead letter ARGV[4] under ID ARGV[3], unless the entry was
+// acknowledged already
+var deadLetterBillingEntryScript = redis.NewScript(`
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XDEL', KEYS[1], ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[3], ARGV[4])
+return 1
+`)
+
+// requeueBillingJobsScript adds up to ARGV[1] retries that are due to the
+// stream
+var requeueBillingJobsScript = redis.NewScript(billingNowLua + `
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, ARGV[1])
+for _, job in ipairs(due) do
+	redis.call('ZREM', KEYS[2], job)
+	redis.call('XADD', KEYS[1], '*', 'job', job)
+end
+return #due
+`)
+
+// drainLegacyBillingJobsScript moves up to ARGV[1] jobs from the list jobs
+// were once kept in to the stream, oldest first
+var drainLegacyBillingJobsScript = redis.NewScript(`
+local moved = 0
+while moved < tonumber(ARGV[1]) do
+	local job = redis.call('RPOP', KEYS[1])
+	if not job then
+		break
+	end
+	redis.call('XADD', KEYS[2], '*', 'job', job)
+	moved = moved + 1
+end
+return moved
+`)
+
+// replayBillingDeadLetterScript adds dead letter ARGV[1] back to the stream
+// as job ARGV[2]. Two admins replaying the same letter queue it once.
+var replayBillingDeadLetterScript = redis.NewScript(`
+if redis.call('HDEL', KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('XADD', KEYS[1], '*', 'job', ARGV[2])
+return 1
+`)
+
+// enqueueBillingRecord adds a billing record to the stream for the consumers
+func (s *billingService) enqueueBillingRecord(ctx context.Context, req *CreateBillingRecordRequest) error {
+	jobData, err := json.Marshal(&billingJob{ID: req.RequestID, Request: req})
+	if err != nil {
+		return fmt.Errorf("failed to marshal billing record: %w", err)
+	}
+	return s.redisClient.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: billingStreamKey,
+		Values: map[string]interface{}{"job": jobData},
+	}).Err()
+}
+
+// decodeBillingJob reads a queued job. Jobs queued before jobs had an
+// envelope are the bare request.
+func decodeBillingJob(raw string) (*billingJob, error) {
+	var job billingJob
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal billing job: %w", err)
+	}
+	if job.Request == nil {
+		var req CreateBillingRecordRequest
+		if err := json.Unmarshal([]byte(raw), &req); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal billing job: %w", err)
+		}
+		job = billingJob{ID: req.RequestID, Request: &req}
+	}
+	if job.Request.UserID == "" {
+		return nil, fmt.Errorf("billing job has no user")
+	}
+	if job.ID == "" {
+		job.ID = job.Request.RequestID
+	}
+	if job.Request.RequestID == "" {
+		// The ID must not change between attempts, so a job without one is
+		// keyed by its content
+		sum := sha256.Sum256([]byte(raw))
+		job.Request.RequestID = "job_" + hex.EncodeToString(sum[:16])
+		job.ID = job.Request.RequestID
+	}
+	return &job, nil
+}
+
+// billingRetryDelay returns how long to wait before retrying a job that
+// failed for the given time (1 for the first). The delay doubles with each
+// attempt up to billingRetryMaxDelay, and is jittered over its upper half so
+// that jobs failing together during an outage do not retry together.
+func billingRetryDelay(attempt int) time.Duration {
+	delay := billingRetryBaseDelay
+	for i := 1; i < attempt && delay < billingRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > billingRetryMaxDelay {
+		delay = billingRetryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// billingConsumerName names a consumer uniquely across router instances
+func billingConsumerName(index int) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "router"
+	}
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), index)
+}
+
+// ensureBillingGroup creates the consumer group, and the stream with it. The
+// group starts at the beginning of the stream, so jobs added before any
+// consumer ran are read too.
+func (s *billingService) ensureBillingGroup(ctx context.Context) error {
+	err := s.redisClient.Client.XGroupCreateMkStream(ctx, billingStreamKey, billingGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create billing consumer group: %w", err)
+	}
+	return nil
+}
+
+// runBillingConsumer reads and stores billing jobs until the worker stops
+func (s *billingService) runBillingConsumer(consumer string) {
+	defer s.workers.Done()
+	ctx := context.Background()
+
+	claimStart := "0-0"
+	var lastClaim time.Time
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+
+		// Take over entries left pending by consumers that died. The scan
+		// goes on from where it stopped until it has covered the group.
+		if time.Since(lastClaim) >= billingClaimInterval {
+			messages, next, err := s.redisClient.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   billingStreamKey,
+				Group:    billingGroup,
+				MinIdle:  s.workerOptions.ClaimIdle,
+				Start:    claimStart,
+				Count:    int64(s.workerOptions.BatchSize),
+				Consumer: consumer,
+			}).Result()
+			if err != nil {
+				s.billingStreamError(ctx, "Error claiming billing entries", err)
+				lastClaim = time.Now()
+			} else {
+				claimStart = next
+				if next == "0-0" {
+					lastClaim = time.Now()
+				}
+				if len(messages) > 0 {
+					fmt.Printf("Consumer %s took over %d pending billing entries\n", consumer, len(messages))
+					s.processBillingEntries(ctx, messages)
+					continue
+				}
+			}
+		}
+
+		// Read new entries, waiting briefly so that stopChan is checked
+		streams, err := s.redisClient.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    billingGroup,
+			Consumer: consumer,
+			Streams:  []string{billingStreamKey, ">"},
+			Count:    int64(s.workerOptions.BatchSize),
+			Block:    billingPollInterval,
+		}).Result()
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			s.billingStreamError(ctx, "Error reading from billing stream", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			s.processBillingEntries(ctx, stream.Messages)
+		}
+	}
+}
+
+// billingStreamError logs a stream error, creating the consumer group again
+// if it is gone, as after the stream key was deleted
+func (s *billingService) billingStreamError(ctx context.Context, message string, err error) {
+	if strings.HasPrefix(err.Error(), "NOGROUP") {
+		if err := s.ensureBillingGroup(ctx); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return
+	}
+	fmt.Printf("%s: %v\n", message, err)
+}
+
+// processBillingEntries stores the records of a batch of entries in one
+// transaction, then acknowledges, retries or dead-letters each entry
+func (s *billingService) processBillingEntries(ctx context.Context, messages []redis.XMessage) {
+	started := time.Now()
+
+	var done []string
+	entries := make([]*billingEntry, 0, len(messages))
+	for _, msg := range messages {
+		raw, ok := msg.Values["job"].(string)
+		if !ok {
+			// Claimed after it was deleted; nothing is left to store
+			done = append(done, msg.ID)
+			continue
+		}
+		job, err := decodeBillingJob(raw)
+		if err != nil {
+			// A job that can't be read never will be, so it isn't retried
+			sum := sha256.Sum256([]byte(raw))
+			s.deadLetterBillingEntry(ctx, msg.ID, &BillingDeadLetter{
+				ID:       "invalid_" + hex.EncodeToString(sum[:16]),
+				Payload:  raw,
+				Attempts: 1,
+				Error:    err.Error(),
+				FailedAt: time.Now(),
+			})
+			continue
+		}
+		entries = append(entries, &billingEntry{id: msg.ID, job: job})
+	}
+
+	stored := 0
+	if len(entries) > 0 {
+		reqs := make([]*CreateBillingRecordRequest, len(entries))
+		for i, entry := range entries {
+			reqs[i] = entry.job.Request
+		}
+		err := s.createBillingRecords(ctx, reqs)
+		switch {
+		case err == nil:
+			for _, entry := range entries {
+				done = append(done, entry.id)
+			}
+			stored = len(entries)
+		case len(entries) == 1:
+			s.failBillingEntry(ctx, entries[0], err)
+		default:
+			// One bad record fails the whole batch, so each is stored on
+			// its own to find it
+			for _, entry := range entries {
+				if err := s.createBillingRecords(ctx, []*CreateBillingRecordRequest{entry.job.Request}); err != nil {
+					s.failBillingEntry(ctx, entry, err)
+					continue
+				}
+				done = append(done, entry.id)
+				stored++
+			}
+		}
+	}
+
+	if len(done) > 0 {
+		// Entries that fail to be acknowledged are taken over once idle,
+		// and their request IDs keep them from being billed again
+		if _, err := s.redisClient.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAck(ctx, billingStreamKey, billingGroup, done...)
+			pipe.XDel(ctx, billingStreamKey, done...)
+			return nil
+		}); err != nil {
+			fmt.Printf("Failed to acknowledge billing entries: %v\n", err)
+		}
+	}
+
+	if stored == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.lastProcessedAt = time.Now()
+	s.totalProcessed += int64(stored)
+	s.processingTimes = append(s.processingTimes, time.Since(started)/time.Duration(stored))
+	if len(s.processingTimes) > 100 {
+		s.processingTimes = s.processingTimes[1:]
+	}
+	s.mu.Unlock()
+}
+
+// failBillingEntry schedules a failed job for another attempt, or
+// dead-letters it once it has used all of its attempts
+func (s *billingService) failBillingEntry(ctx context.Context, entry *billingEntry, cause error) {
+	s.mu.Lock()
+	s.errorsLastHour++
+	s.mu.Unlock()
+
+	job := entry.job
+	job.Attempts++
+	job.LastError = cause.Error()
+	if job.Attempts >= billingMaxAttempts {
+		fmt.Printf("Billing job %s failed %d times, moving it to the dead letters: %v\n", job.ID, job.Attempts, cause)
+		s.deadLetterBillingEntry(ctx, entry.id, &BillingDeadLetter{
+			ID:       job.ID,
+			Request:  job.Request,
+			Attempts: job.Attempts,
+			Error:    job.LastError,
+			FailedAt: time.Now(),
+		})
+		return
+	}
+
+	retry, err := json.Marshal(job)
+	if err != nil {
+		fmt.Printf("Failed to marshal billing job %s: %v\n", job.ID, err)
+		return
+	}
+	delay := billingRetryDelay(job.Attempts)
+	fmt.Printf("Billing job %s failed (attempt %d), retrying in %s: %v\n", job.ID, job.Attempts, delay, cause)
+	if err := retryBillingEntryScript.Run(ctx, s.redisClient.Client, []string{billingStreamKey, billingRetryKey},
+		billingGroup, entry.id, retry, delay.Milliseconds()).Err(); err != nil {
+		fmt.Printf("Failed to schedule retry of billing job %s: %v\n", job.ID, err)
+	}
+}
+
+// deadLetterBillingEntry moves an entry to the dead letters
+func (s *billingService) deadLetterBillingEntry(ctx context.Context, entryID string, letter *BillingDeadLetter) {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		fmt.Printf("Failed to marshal dead letter %s: %v\n", letter.ID, err)
+		return
+	}
+	if err := deadLetterBillingEntryScript.Run(ctx, s.redisClient.Client, []string{billingStreamKey, billingDeadLetterKey},
+		billingGroup, entryID, letter.ID, data).Err(); err != nil {
+		fmt.Printf("Failed to dead-letter billing job %s: %v\n", letter.ID, err)
+	}
+}
+
+// maintainBillingStream puts due retries back on the stream and removes
+// consumers that are gone until the worker stops
+func (s *billingService) maintainBillingStream() {
+	defer s.workers.Done()
+	ctx := context.Background()
+
+	ticker := time.NewTicker(billingPollInterval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := requeueBillingJobsScript.Run(ctx, s.redisClient.Client, []string{billingStreamKey, billingRetryKey},
+			billingRequeueBatch).Result(); err != nil {
+			fmt.Printf("Failed to requeue billing jobs: %v\n", err)
+		}
+
+		moved, err := drainLegacyBillingJobsScript.Run(ctx, s.redisClient.Client,
+			[]string{billingLegacyQueueKey, billingStreamKey},
+			billingRequeueBatch).Int()
+		if err != nil {
+			fmt.Printf("Failed to move queued billing jobs to the stream: %v\n", err)
+		} else if moved > 0 {
+			fmt.Printf("Moved %d queued billing jobs to the stream\n", moved)
+		}
+
+		if time.Since(lastPrune) >= time.Minute {
+			s.pruneBillingConsumers(ctx)
+			lastPrune = time.Now()
+		}
+	}
+}
+
+// pruneBillingConsumers removes consumers that have been silent for long and
+// have nothing pending. A consumer with pending entries is kept: removing it
+// would drop its entries from the group instead of letting them be claimed.
+func (s *billingService) pruneBillingConsumers(ctx context.Context) {
+	consumers, err := s.redisClient.Client.XInfoConsumers(ctx, billingStreamKey, billingGroup).Result()
+	if err != nil {
+		fmt.Printf("Failed to list billing consumers: %v\n", err)
+		return
+	}
+	for _, consumer := range consumers {
+		if consumer.Pending > 0 || consumer.Idle < billingConsumerMaxIdle {
+			continue
+		}
+		if err := s.redisClient.Client.XGroupDelConsumer(ctx, billingStreamKey, billingGroup, consumer.Name).Err(); err != nil {
+			fmt.Printf("Failed to remove billing consumer %s: %v\n", consumer.Name, err)
+		}
+	}
+}
+
+func (s *billingService) ListBillingDeadLetters(ctx context.Context) ([]*BillingDeadLetter, error) {
+	if s.redisClient == nil {
+		return nil, fmt.Errorf("billing queue is not available")
+	}
+
+	values, err := s.redisClient.HGetAll(ctx, billingDeadLetterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead letters: %w", err)
+	}
+
+	letters := make([]*BillingDeadLetter, 0, len(values))
+	for id, value := range values {
+		var letter BillingDeadLetter
+		if err := json.Unmarshal([]byte(value), &letter); err != nil {
+			letter = BillingDeadLetter{ID: id, Payload: value, Error: err.Error()}
+		}
+		letters = append(letters, &letter)
+	}
+	// Latest failure first
+	sort.Slice(letters, func(i, j int) bool {
+		if !letters[i].FailedAt.Equal(letters[j].FailedAt) {
+			return letters[i].FailedAt.After(letters[j].FailedAt)
+		}
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, nil
+}
+
+func (s *billingService) ReplayBillingDeadLetters(ctx context.Context, ids ...string) (int, error) {
+	letters, err := s.selectBillingDeadLetters(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, letter := range letters {
+		// The job starts over with all of its attempts
+		job := []byte(letter.Payload)
+		if letter.Request != nil {
+			if job, err = json.Marshal(&billingJob{ID: letter.ID, Request: letter.Request}); err != nil {
+				return replayed, fmt.Errorf("failed to marshal billing job: %w", err)
+			}
+		}
+		n, err := replayBillingDeadLetterScript.Run(ctx, s.redisClient.Client, []string{billingStreamKey, billingDeadLetterKey},
+			letter.ID, job).Int()
+		if err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter: %w", err)
+		}
+		replayed += n
+	}
+	return replayed, nil
+}
+
+func (s *billingService) PurgeBillingDeadLetters(ctx context.Context, ids ...string) (int, error) {
+	letters, err := s.selectBillingDeadLetters(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(letters) == 0 {
+		return 0, nil
+	}
+
+	fields := make([]string, len(letters))
+	for i, letter := range letters {
+		fields[i] = letter.ID
+	}
+	n, err := s.redisClient.Client.HDel(ctx, billingDeadLetterKey, fields...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+	return int(n), nil
+}
+
+// selectBillingDeadLetters returns the dead letters with the given IDs, or
+// all of them when no IDs are given
+func (s *billingService) selectBillingDeadLetters(ctx context.Context, ids []string) ([]*BillingDeadLetter, error) {
+	letters, err := s.ListBillingDeadLetters(ctx)
+	if err != nil || len(ids) == 0 {
+		return letters, err
+	}
+
+	byID := make(map[string]*BillingDeadLetter, len(letters))
+	for _, letter := range letters {
+		byID[letter.ID] = letter
+	}
+	selected := make([]*BillingDeadLetter, 0, len(ids))
+	for _, id := range ids {
+		letter, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("dead letter not found")
+		}
+		selected = append(selected, letter)
+	}
+	return selected, nil
+}
+
+// newBillingRequestID returns an idempotency key for a billing record whose
+// caller didn't give one
+func newBillingRequestID() string {
+	id, err := utils.GenerateRandomString(24)
+	if err != nil {
+		return fmt.Sprintf("req_%d", time.Now().UnixNano())
+	}
+	return "req_" + id
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDecodeBillingJob(t *testing.T) {
+	req := &CreateBillingRecordRequest{UserID: "user-1", ModelID: "model-1", RequestID: "req_1", TotalTokens: 10}
+	envelope, _ := json.Marshal(&billingJob{ID: "req_1", Attempts: 2, Request: req})
+	legacy, _ := json.Marshal(req)
+
+	for name, raw := range map[string][]byte{"envelope": envelope, "legacy": legacy} {
+		job, err := decodeBillingJob(string(raw))
+		if err != nil {
+			t.Fatalf("%s: decodeBillingJob() error = %v", name, err)
+		}
+		if job.ID != "req_1" || job.Request.UserID != "user-1" || job.Request.TotalTokens != 10 {
+			t.Errorf("%s: decodeBillingJob() = %+v", name, job)
+		}
+	}
+
+	// A job queued without a request ID is keyed by its content, and keeps
+	// that key through its retries
+	keyless, _ := json.Marshal(&CreateBillingRecordRequest{UserID: "user-1", ModelID: "model-1"})
+	first, err := decodeBillingJob(string(keyless))
+	if err != nil {
+		t.Fatalf("decodeBillingJob() error = %v", err)
+	}
+	again, _ := decodeBillingJob(string(keyless))
+	if first.ID == "" || first.ID != again.ID || first.Request.RequestID != first.ID {
+		t.Errorf("keyless job IDs = %q, %q", first.ID, again.ID)
+	}
+	first.Attempts++
+	retried, _ := json.Marshal(first)
+	if job, _ := decodeBillingJob(string(retried)); job.ID != first.ID {
+		t.Errorf("retried job ID = %q, want %q", job.ID, first.ID)
+	}
+
+	for _, raw := range []string{"not json", `{"model_id":"model-1"}`} {
+		if _, err := decodeBillingJob(raw); err == nil {
+			t.Errorf("decodeBillingJob(%s) succeeded, want error", raw)
+		}
+	}
+}
+
+func TestBillingRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, billingRetryBaseDelay},
+		{2, 2 * billingRetryBaseDelay},
+		{3, 4 * billingRetryBaseDelay},
+		{20, billingRetryMaxDelay},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			delay := billingRetryDelay(tt.attempt)
+			if delay < tt.max/2 || delay > tt.max {
+				t.Fatalf("billingRetryDelay(%d) = %s, want between %s and %s", tt.attempt, delay, tt.max/2, tt.max)
+			}
+		}
+	}
+}
@@ -2,28 +2,39 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"massrouter.ai/backend/internal/model"
 	"massrouter.ai/backend/internal/repository"
 	"massrouter.ai/backend/pkg/cache"
+	"massrouter.ai/backend/pkg/money"
+	"massrouter.ai/backend/pkg/payment"
+	"massrouter.ai/backend/pkg/tokenizer"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 )
 
-const (
-	billingQueueKey = "queue:billing:records"
-)
+// ErrInvalidCursor is returned for a history cursor that is malformed or
+// came from another listing
+var ErrInvalidCursor = repository.ErrInvalidCursor
 
 type billingService struct {
 	paymentRepo     repository.PaymentRecordRepository
 	billingRepo     repository.BillingRecordRepository
 	modelRepo       repository.ModelRepository
+	ledgerRepo      repository.LedgerRepository
 	redisClient     *cache.RedisClient
+	gateways        payment.Gateways
+	validator       *validator.Validate
+	workerOptions   BillingWorkerOptions
 	stopChan        chan struct{}
+	workers         sync.WaitGroup
 	mu              sync.RWMutex
 	workerRunning   bool
 	lastProcessedAt time.Time
@@ -36,30 +47,53 @@ func NewBillingService(
 	paymentRepo repository.PaymentRecordRepository,
 	billingRepo repository.BillingRecordRepository,
 	modelRepo repository.ModelRepository,
+	ledgerRepo repository.LedgerRepository,
 	redisClient *cache.RedisClient,
+	gateways payment.Gateways,
+	workerOptions BillingWorkerOptions,
 ) BillingService {
 	return &billingService{
 		paymentRepo:   paymentRepo,
 		billingRepo:   billingRepo,
 		modelRepo:     modelRepo,
+		ledgerRepo:    ledgerRepo,
 		redisClient:   redisClient,
+		gateways:      gateways,
+		validator:     validator.New(),
+		workerOptions: workerOptions.withDefaults(),
 		stopChan:      make(chan struct{}),
 		workerRunning: false,
 	}
 }
 
 func (s *billingService) GetBalance(ctx context.Context, userID string) (*BalanceInfo, error) {
-	totalPaid, err := s.paymentRepo.GetUserTotalPaid(ctx, userID)
+	balance, err := s.storedBalance(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total paid: %w", err)
+		return nil, err
 	}
 
-	totalUsed, err := s.billingRepo.GetTotalCostByUser(ctx, userID)
+	held, err := s.heldAmount(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total used: %w", err)
+		return nil, fmt.Errorf("failed to get held balance: %w", err)
 	}
+	balance.Held += held
+	balance.Available -= held
+	return balance, nil
+}
 
-	balance := totalPaid - totalUsed
+// storedBalance is the balance of the user's ledger account, without the
+// holds of calls in flight
+func (s *billingService) storedBalance(ctx context.Context, userID string) (*BalanceInfo, error) {
+	account, err := s.ledgerRepo.FindAccount(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger account: %w", err)
+	}
+
+	var balance, ledgerHeld money.Amount
+	if account != nil {
+		balance = account.Balance
+		ledgerHeld = account.Held
+	}
 	isOverdue := balance < 0
 
 	var nextBilling *time.Time
@@ -70,41 +104,44 @@ func (s *billingService) GetBalance(ctx context.Context, userID string) (*Balanc
 
 	return &BalanceInfo{
 		Balance:     balance,
+		Held:        ledgerHeld,
+		Available:   balance - ledgerHeld,
 		CreditLimit: 0,
 		NextBilling: nextBilling,
 		IsOverdue:   isOverdue,
 	}, nil
 }
 
-func (s *billingService) GetPaymentHistory(ctx context.Context, userID string, page, limit int) (*PaymentHistoryResponse, error) {
-	if page <= 0 {
-		page = 1
-	}
+func (s *billingService) GetPaymentHistory(ctx context.Context, userID string, req *PaymentHistoryRequest) (*PaymentHistoryResponse, error) {
+	limit := req.Limit
 	if limit <= 0 {
 		limit = 20
 	}
-	offset := (page - 1) * limit
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
 
-	payments, err := s.paymentRepo.FindByUserID(ctx, userID)
+	payments, next, err := s.paymentRepo.FindPage(ctx, &repository.PaymentRecordFilter{
+		UserID:        userID,
+		From:          req.From,
+		To:            req.To,
+		Status:        req.Status,
+		PaymentMethod: req.PaymentMethod,
+		MinAmount:     req.MinAmount,
+		SortBy:        req.SortBy,
+		SortOrder:     req.SortOrder,
+		Cursor:        req.Cursor,
+		Limit:         limit,
+	})
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to get payment history: %w", err)
 	}
 
-	total := int64(len(payments))
-
-	start := offset
-	if start > len(payments) {
-		start = len(payments)
-	}
-	end := start + limit
-	if end > len(payments) {
-		end = len(payments)
-	}
-
-	pagedPayments := payments[start:end]
-
-	paymentItems := make([]*PaymentItem, len(pagedPayments))
-	for i, payment := range pagedPayments {
+	paymentItems := make([]*PaymentItem, len(payments))
+	for i, payment := range payments {
 		paymentItems[i] = &PaymentItem{
 			ID:            payment.ID,
 			Amount:        payment.Amount,
@@ -118,10 +155,10 @@ func (s *billingService) GetPaymentHistory(ctx context.Context, userID string, p
 	}
 
 	return &PaymentHistoryResponse{
-		Payments: paymentItems,
-		Total:    total,
-		Page:     page,
-		Limit:    limit,
+		Payments:   paymentItems,
+		NextCursor: next,
+		HasMore:    next != "",
+		Limit:      limit,
 	}, nil
 }
 
@@ -129,13 +166,26 @@ func (s *billingService) CreatePayment(ctx context.Context, userID string, req *
 	if req.Amount <= 0 {
 		return nil, fmt.Errorf("payment amount must be positive")
 	}
+	gateway := s.gateways.Lookup(req.PaymentMethod)
+	if gateway == nil {
+		return nil, fmt.Errorf("unsupported payment method")
+	}
+	currency, err := money.LookupCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	// Payments are charged in whole minor units, so an amount that would
+	// have to be rounded is refused rather than charged differently
+	if !currency.Exact(req.Amount) {
+		return nil, fmt.Errorf("payment amount %s has more than %d decimal places for %s", req.Amount, currency.Digits, currency.Code)
+	}
 
 	payment := &model.PaymentRecord{
 		UserID:        userID,
 		Amount:        req.Amount,
-		Currency:      req.Currency,
-		PaymentMethod: req.PaymentMethod,
-		Status:        "pending",
+		Currency:      currency.Code,
+		PaymentMethod: gateway.Name,
+		Status:        paymentStatusPending,
 		Metadata:      model.JSONB{"return_url": req.ReturnURL},
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
@@ -146,56 +196,60 @@ func (s *billingService) CreatePayment(ctx context.Context, userID string, req *
 	}
 
 	expiresAt := time.Now().Add(30 * time.Minute)
+	paymentURL := fmt.Sprintf("/payments/%s/process", payment.ID)
+	if gateway.Signer != nil {
+		// There is no checkout page for the sandbox; the payment is settled
+		// through the API
+		paymentURL = fmt.Sprintf("/api/v1/billing/payments/%s/sandbox", payment.ID)
+	}
 
 	return &PaymentInfo{
 		ID:         payment.ID,
 		Amount:     payment.Amount,
 		Currency:   payment.Currency,
 		Status:     payment.Status,
-		PaymentURL: fmt.Sprintf("/payments/%s/process", payment.ID),
+		PaymentURL: paymentURL,
 		ExpiresAt:  &expiresAt,
 	}, nil
 }
 
-func (s *billingService) ProcessPaymentWebhook(ctx context.Context, payload []byte, signature string) error {
-	return nil
-}
-
-func (s *billingService) GetBillingRecords(ctx context.Context, userID string, page, limit int) (*BillingRecordsResponse, error) {
-	if page <= 0 {
-		page = 1
-	}
+func (s *billingService) GetBillingRecords(ctx context.Context, userID string, req *BillingRecordsRequest) (*BillingRecordsResponse, error) {
+	limit := req.Limit
 	if limit <= 0 {
 		limit = 20
 	}
-	offset := (page - 1) * limit
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
 
-	records, err := s.billingRepo.FindByUserID(ctx, userID)
+	// Records come with their models and providers, so a page is read in a
+	// fixed number of queries
+	records, next, err := s.billingRepo.FindPage(ctx, &repository.BillingRecordFilter{
+		UserID:    userID,
+		From:      req.From,
+		To:        req.To,
+		ModelID:   req.ModelID,
+		APIKeyID:  req.APIKeyID,
+		MinCost:   req.MinCost,
+		SortBy:    req.SortBy,
+		SortOrder: req.SortOrder,
+		Cursor:    req.Cursor,
+		Limit:     limit,
+	})
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to get billing records: %w", err)
 	}
 
-	total := int64(len(records))
-
-	start := offset
-	if start > len(records) {
-		start = len(records)
-	}
-	end := start + limit
-	if end > len(records) {
-		end = len(records)
-	}
-
-	pagedRecords := records[start:end]
-
-	recordItems := make([]*BillingRecordItem, len(pagedRecords))
-	for i, record := range pagedRecords {
-		modelObj, _ := s.modelRepo.FindByID(ctx, record.ModelID)
+	recordItems := make([]*BillingRecordItem, len(records))
+	for i, record := range records {
 		modelName := "Unknown"
 		providerName := "Unknown"
-		if modelObj != nil {
-			modelName = modelObj.Name
-			providerName = modelObj.Provider.Name
+		if record.Model.ID != "" {
+			modelName = record.Model.Name
+			providerName = record.Model.Provider.Name
 		}
 
 		recordItems[i] = &BillingRecordItem{
@@ -206,15 +260,27 @@ func (s *billingService) GetBillingRecords(ctx context.Context, userID string, p
 	}
 
 	return &BillingRecordsResponse{
-		Records: recordItems,
-		Total:   total,
-		Page:    page,
-		Limit:   limit,
+		Records:    recordItems,
+		NextCursor: next,
+		HasMore:    next != "",
+		Limit:      limit,
 	}, nil
 }
 
 func (s *billingService) CalculateCost(ctx context.Context, modelID string, inputTokens, outputTokens int) (*CostCalculation, error) {
-	modelObj, err := s.modelRepo.FindByID(ctx, modelID)
+	modelObj, err := s.modelRepo.FindByIDWithProvider(ctx, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, fmt.Errorf("model not found")
+	}
+
+	return modelCost(modelObj, inputTokens, outputTokens), nil
+}
+
+func (s *billingService) CalculatePromptCost(ctx context.Context, modelID string, prompt *tokenizer.Prompt, outputTokens int) (*CostCalculation, error) {
+	modelObj, err := s.modelRepo.FindByIDWithProvider(ctx, modelID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model: %w", err)
 	}
@@ -222,8 +288,16 @@ func (s *billingService) CalculateCost(ctx context.Context, modelID string, inpu
 		return nil, fmt.Errorf("model not found")
 	}
 
-	inputCost := float64(inputTokens) * modelObj.InputPrice / 1000.0
-	outputCost := float64(outputTokens) * modelObj.OutputPrice / 1000.0
+	tok := tokenizer.ForModel(modelObj.Name, modelObj.TokenizerEncoding())
+	calculation := modelCost(modelObj, tok.CountPrompt(prompt), outputTokens)
+	calculation.Tokenizer = tok.Encoding()
+	return calculation, nil
+}
+
+// modelCost prices a call at the model's list prices
+func modelCost(modelObj *model.Model, inputTokens, outputTokens int) *CostCalculation {
+	inputCost := tokenCost(modelObj.InputPrice, inputTokens)
+	outputCost := tokenCost(modelObj.OutputPrice, outputTokens)
 	totalCost := inputCost + outputCost
 
 	return &CostCalculation{
@@ -234,22 +308,54 @@ func (s *billingService) CalculateCost(ctx context.Context, modelID string, inpu
 		TotalCost:    totalCost,
 		ModelName:    modelObj.Name,
 		ProviderName: modelObj.Provider.Name,
+	}
+}
+
+// tokenCost prices tokens at a rate per thousand. Each side of a call is
+// rounded half-up to the money scale on its own, so a charge is the sum of
+// its displayed parts.
+func tokenCost(pricePerThousand money.Amount, tokens int) money.Amount {
+	return pricePerThousand.MulDiv(int64(tokens), 1000, money.HalfUp)
+}
+
+// CalculateDeploymentCost prices a call at the rates of the deployment that
+// served it
+func (s *billingService) CalculateDeploymentCost(ctx context.Context, modelObj *model.Model, deployment *model.ModelDeployment, inputTokens, outputTokens int) (*CostCalculation, error) {
+	inputPrice, outputPrice := deployment.Prices(modelObj)
+
+	inputCost := tokenCost(inputPrice, inputTokens)
+	outputCost := tokenCost(outputPrice, outputTokens)
+	totalCost := inputCost + outputCost
+
+	return &CostCalculation{
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		InputCost:    inputCost,
+		OutputCost:   outputCost,
+		TotalCost:    totalCost,
+		ModelName:    modelObj.Name,
+		ProviderName: deployment.Provider.Name,
 	}, nil
 }
 
 func (s *billingService) CreateBillingRecord(ctx context.Context, req *CreateBillingRecordRequest) error {
+	if req.RequestID == "" {
+		req.RequestID = newBillingRequestID()
+	}
+
 	// If Redis client is not available, fallback to synchronous creation
 	if s.redisClient == nil {
 		return s.createBillingRecordSync(ctx, req)
 	}
 
-	// Push to Redis queue for asynchronous processing
-	jobData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal billing record: %w", err)
+	// The call's hold now covers its actual cost until the worker stores
+	// the record
+	if err := s.settleHold(ctx, req.UserID, req.HoldID, req.Cost); err != nil {
+		fmt.Printf("Failed to settle balance hold %s: %v\n", req.HoldID, err)
 	}
 
-	if err := s.redisClient.LPush(ctx, billingQueueKey, jobData); err != nil {
+	// Add to the billing stream for asynchronous processing
+	if err := s.enqueueBillingRecord(ctx, req); err != nil {
 		// If queue fails, fallback to synchronous creation
 		return s.createBillingRecordSync(ctx, req)
 	}
@@ -258,107 +364,130 @@ func (s *billingService) CreateBillingRecord(ctx context.Context, req *CreateBil
 }
 
 func (s *billingService) createBillingRecordSync(ctx context.Context, req *CreateBillingRecordRequest) error {
-	billingRecord := &model.BillingRecord{
-		UserID:         req.UserID,
-		APIKeyID:       req.APIKeyID,
-		ModelID:        req.ModelID,
-		RequestTokens:  req.RequestTokens,
-		ResponseTokens: req.ResponseTokens,
-		TotalTokens:    req.TotalTokens,
-		Cost:           req.Cost,
-		Metadata:       req.Metadata,
-		CreatedAt:      time.Now(),
+	return s.createBillingRecords(ctx, []*CreateBillingRecordRequest{req})
+}
+
+// createBillingRecords stores billing records and their debits in one
+// transaction. Records whose request ID was already stored are skipped, so a
+// job delivered twice is billed once.
+func (s *billingService) createBillingRecords(ctx context.Context, reqs []*CreateBillingRecordRequest) error {
+	records := make([]*model.BillingRecord, 0, len(reqs))
+	seen := make(map[string]bool, len(reqs))
+	for _, req := range reqs {
+		if req.RequestID == "" {
+			req.RequestID = newBillingRequestID()
+		}
+		if seen[req.RequestID] {
+			continue
+		}
+		seen[req.RequestID] = true
+
+		records = append(records, &model.BillingRecord{
+			UserID:         req.UserID,
+			APIKeyID:       req.APIKeyID,
+			ModelID:        req.ModelID,
+			RequestID:      &req.RequestID,
+			RequestTokens:  req.RequestTokens,
+			ResponseTokens: req.ResponseTokens,
+			TotalTokens:    req.TotalTokens,
+			Cost:           req.Cost,
+			Metadata:       req.Metadata,
+			CreatedAt:      time.Now(),
+		})
 	}
 
-	if err := s.billingRepo.Create(ctx, billingRecord); err != nil {
-		return fmt.Errorf("failed to create billing record: %w", err)
+	// The records and their debits commit together, so the account balance
+	// always matches the stored records
+	err := s.billingRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		inserted, err := s.billingRepo.CreateBatchTx(ctx, tx, records)
+		if err != nil {
+			return err
+		}
+		for _, billingRecord := range inserted {
+			if billingRecord.Cost <= 0 {
+				continue
+			}
+			_, err := s.ledgerRepo.PostTx(ctx, tx, &model.LedgerEntry{
+				UserID:        billingRecord.UserID,
+				Type:          model.LedgerEntryDebit,
+				Amount:        -billingRecord.Cost,
+				ReferenceType: model.LedgerRefBillingRecord,
+				ReferenceID:   &billingRecord.ID,
+				Description:   "Usage",
+				Metadata:      model.JSONB{"model_id": billingRecord.ModelID, "total_tokens": billingRecord.TotalTokens},
+				CreatedAt:     billingRecord.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The costs are part of the stored balance now, so they are no longer
+	// held
+	for _, req := range reqs {
+		if err := s.releaseHold(ctx, req.UserID, req.HoldID, true); err != nil {
+			fmt.Printf("Failed to release balance hold %s: %v\n", req.HoldID, err)
+		}
 	}
 
 	return nil
 }
 
+// StartBillingWorker starts the configured number of consumers of the
+// billing stream in this process, and the upkeep of the stream
 func (s *billingService) StartBillingWorker() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.workerRunning {
+	// Without Redis, billing records are stored as they are created
+	if s.workerRunning || s.redisClient == nil {
 		return
 	}
+	if err := s.ensureBillingGroup(context.Background()); err != nil {
+		// The consumers create the group once Redis is reachable
+		fmt.Printf("%v\n", err)
+	}
 
 	s.workerRunning = true
-	go s.processBillingQueue()
+	for i := 0; i < s.workerOptions.Consumers; i++ {
+		s.workers.Add(1)
+		go s.runBillingConsumer(billingConsumerName(i))
+	}
+	s.workers.Add(1)
+	go s.maintainBillingStream()
 }
 
+// StopBillingWorker stops the consumers, waiting for each to finish the batch
+// in hand so that it is acknowledged rather than taken over later
 func (s *billingService) StopBillingWorker() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.workerRunning {
+		s.mu.Unlock()
 		return
 	}
-
 	close(s.stopChan)
 	s.workerRunning = false
-}
+	s.mu.Unlock()
 
-func (s *billingService) processBillingQueue() {
-	for {
-		select {
-		case <-s.stopChan:
-			return
-		default:
-			// Try to process a job from the queue
-			ctx := context.Background()
-
-			// Use BRPop with timeout of 5 seconds to allow checking stopChan
-			result, err := s.redisClient.BRPop(ctx, 5*time.Second, billingQueueKey)
-			if err != nil {
-				// If error is due to timeout (redis.Nil), continue to check stopChan
-				if err == redis.Nil {
-					continue
-				}
-				// Log error and continue
-				fmt.Printf("Error reading from billing queue: %v\n", err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
-
-			if len(result) < 2 {
-				continue
-			}
-
-			jobData := result[1]
-			var req CreateBillingRecordRequest
-			if err := json.Unmarshal([]byte(jobData), &req); err != nil {
-				fmt.Printf("Failed to unmarshal billing record: %v\n", err)
-				continue
-			}
+	s.workers.Wait()
+}
 
-			// Process the billing record synchronously
-			if err := s.createBillingRecordSync(ctx, &req); err != nil {
-				fmt.Printf("Failed to create billing record: %v\n", err)
-				// Optionally: push to dead letter queue or retry
-				// For now, just log the error
-			} else {
-				fmt.Printf("Successfully processed billing record for user %s, cost: %.6f\n", req.UserID, req.Cost)
-				// Update statistics
-				s.mu.Lock()
-				s.lastProcessedAt = time.Now()
-				s.totalProcessed++
-				s.mu.Unlock()
-			}
+func (s *billingService) GetQueueStatus(ctx context.Context) (*QueueStatus, error) {
+	status := &QueueStatus{}
+	if s.redisClient != nil {
+		if err := s.streamStatus(ctx, status); err != nil {
+			return nil, err
 		}
 	}
-}
 
-func (s *billingService) GetQueueStatus(ctx context.Context) (*QueueStatus, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// TODO: Implement Redis LLen method in RedisClient
-	// For now, return 0 queue length
-	queueLen := int64(0)
-
 	// Calculate average processing time
 	var avgProcessingTime float64
 	if len(s.processingTimes) > 0 {
@@ -369,12 +498,50 @@ func (s *billingService) GetQueueStatus(ctx context.Context) (*QueueStatus, erro
 		avgProcessingTime = total.Seconds() / float64(len(s.processingTimes))
 	}
 
-	return &QueueStatus{
-		QueueLength:       queueLen,
-		WorkerRunning:     s.workerRunning,
-		LastProcessedAt:   s.lastProcessedAt,
-		TotalProcessed:    s.totalProcessed,
-		ErrorsLastHour:    s.errorsLastHour,
-		AvgProcessingTime: avgProcessingTime,
-	}, nil
+	status.WorkerRunning = s.workerRunning
+	status.LocalConsumers = s.workerOptions.Consumers
+	status.LastProcessedAt = s.lastProcessedAt
+	status.TotalProcessed = s.totalProcessed
+	status.ErrorsLastHour = s.errorsLastHour
+	status.AvgProcessingTime = avgProcessingTime
+	return status, nil
+}
+
+// streamStatus reads the backlog of the billing stream and its group
+func (s *billingService) streamStatus(ctx context.Context, status *QueueStatus) error {
+	var (
+		length   *redis.IntCmd
+		groups   *redis.XInfoGroupsCmd
+		retrying *redis.IntCmd
+		dead     *redis.IntCmd
+	)
+	_, err := s.redisClient.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.XLen(ctx, billingStreamKey)
+		groups = pipe.XInfoGroups(ctx, billingStreamKey)
+		retrying = pipe.ZCard(ctx, billingRetryKey)
+		dead = pipe.HLen(ctx, billingDeadLetterKey)
+		return nil
+	})
+	// The stream and its group don't exist until the first worker starts
+	if err != nil && !strings.Contains(err.Error(), "no such key") {
+		return fmt.Errorf("failed to get billing stream status: %w", err)
+	}
+
+	status.QueueLength = length.Val()
+	for _, group := range groups.Val() {
+		if group.Name == billingGroup {
+			status.PendingCount = group.Pending
+			status.Consumers = group.Consumers
+		}
+	}
+	// Done entries are deleted, so the entries not yet delivered are those
+	// that aren't pending. Redis's own lag is unknown once entries have been
+	// deleted.
+	status.ConsumerLag = status.QueueLength - status.PendingCount
+	if status.ConsumerLag < 0 {
+		status.ConsumerLag = 0
+	}
+	status.Retrying = retrying.Val()
+	status.DeadLetters = dead.Val()
+	return nil
 }
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+// Circuit breaker states
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half_open"
+)
+
+// circuitBreakerService keeps a breaker for each provider key in memory, so
+// every instance judges upstream health from the calls it makes itself
+type circuitBreakerService struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+type circuitBreaker struct {
+	providerID   string
+	providerName string
+	credentialID string
+	credential   string
+
+	state       string
+	failures    int // Consecutive
+	lastError   string
+	openedAt    time.Time
+	probing     bool // A half-open probe is in flight
+	probeSentAt time.Time
+}
+
+func NewCircuitBreakerService(threshold int, openTimeout time.Duration) CircuitBreakerService {
+	return &circuitBreakerService{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		now:         time.Now,
+		breakers:    make(map[string]*circuitBreaker),
+	}
+}
+
+func (s *circuitBreakerService) Allow(provider *model.ModelProvider, credential *model.ProviderCredential) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.breaker(provider, credential)
+	now := s.now()
+	switch b.state {
+	case BreakerStateOpen:
+		if now.Before(b.openedAt.Add(s.openTimeout)) {
+			return false
+		}
+		b.state = BreakerStateHalfOpen
+	case BreakerStateHalfOpen:
+		// A probe whose outcome never arrived, such as one whose client went
+		// away, must not hold the breaker half-open forever
+		if b.probing && now.Before(b.probeSentAt.Add(s.openTimeout)) {
+			return false
+		}
+	default:
+		return true
+	}
+
+	b.probing = true
+	b.probeSentAt = now
+	return true
+}
+
+func (s *circuitBreakerService) RecordSuccess(provider *model.ModelProvider, credential *model.ProviderCredential) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.breaker(provider, credential)
+	if b.state != BreakerStateClosed {
+		log.Printf("Circuit breaker for provider %s credential %s closed", b.providerName, b.credential)
+	}
+	b.state = BreakerStateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (s *circuitBreakerService) RecordFailure(provider *model.ModelProvider, credential *model.ProviderCredential, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.breaker(provider, credential)
+	b.failures++
+	b.lastError = reason
+
+	// A failed probe reopens the breaker straight away
+	if b.state == BreakerStateHalfOpen || (b.state == BreakerStateClosed && b.failures >= s.threshold) {
+		b.state = BreakerStateOpen
+		b.openedAt = s.now()
+		b.probing = false
+		log.Printf("Circuit breaker for provider %s credential %s opened after %d consecutive failures: %s",
+			b.providerName, b.credential, b.failures, reason)
+	}
+}
+
+func (s *circuitBreakerService) Snapshot() []*CircuitBreakerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	statuses := make([]*CircuitBreakerStatus, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		status := &CircuitBreakerStatus{
+			ProviderID:          b.providerID,
+			ProviderName:        b.providerName,
+			CredentialID:        b.credentialID,
+			Credential:          b.credential,
+			State:               b.state,
+			ConsecutiveFailures: b.failures,
+			LastError:           b.lastError,
+		}
+		if b.state == BreakerStateOpen {
+			openedAt := b.openedAt
+			retryAt := b.openedAt.Add(s.openTimeout)
+			status.OpenedAt = &openedAt
+			status.RetryAt = &retryAt
+			if !now.Before(retryAt) {
+				// The next call will be let through as a probe
+				status.State = BreakerStateHalfOpen
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].ProviderName != statuses[j].ProviderName {
+			return statuses[i].ProviderName < statuses[j].ProviderName
+		}
+		return statuses[i].Credential < statuses[j].Credential
+	})
+	return statuses
+}
+
+// breaker returns the breaker for a provider key, creating a closed one the
+// first time the key is seen. Callers must hold s.mu.
+func (s *circuitBreakerService) breaker(provider *model.ModelProvider, credential *model.ProviderCredential) *circuitBreaker {
+	key := provider.ID + "/" + credential.ID
+	b, ok := s.breakers[key]
+	if !ok {
+		b = &circuitBreaker{
+			providerID:   provider.ID,
+			credentialID: credential.ID,
+			state:        BreakerStateClosed,
+		}
+		s.breakers[key] = b
+	}
+	// Names can change while the process runs
+	b.providerName = provider.Name
+	b.credential = credential.MaskedKey
+	return b
+}
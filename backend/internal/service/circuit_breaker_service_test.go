@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s := NewCircuitBreakerService(3, 30*time.Second).(*circuitBreakerService)
+	s.now = func() time.Time { return now }
+
+	provider := &model.ModelProvider{ID: "p", Name: "openai"}
+	credential := &model.ProviderCredential{ID: "c", MaskedKey: "sk-1...abcd"}
+
+	for i := 0; i < 3; i++ {
+		if !s.Allow(provider, credential) {
+			t.Fatalf("Allow() = false after %d failures, want true below the threshold", i)
+		}
+		s.RecordFailure(provider, credential, "upstream returned 502")
+	}
+
+	if s.Allow(provider, credential) {
+		t.Fatal("Allow() = true after reaching the threshold, want the breaker open")
+	}
+	if got := s.Snapshot()[0].State; got != BreakerStateOpen {
+		t.Errorf("Snapshot() state = %s, want %s", got, BreakerStateOpen)
+	}
+
+	t.Run("half-open lets one probe through", func(t *testing.T) {
+		now = now.Add(31 * time.Second)
+		if !s.Allow(provider, credential) {
+			t.Fatal("Allow() = false after the open timeout, want a probe")
+		}
+		if s.Allow(provider, credential) {
+			t.Error("Allow() = true while a probe is in flight, want false")
+		}
+	})
+
+	t.Run("failed probe reopens", func(t *testing.T) {
+		s.RecordFailure(provider, credential, "upstream returned 503")
+		if s.Allow(provider, credential) {
+			t.Error("Allow() = true after a failed probe, want the breaker open")
+		}
+	})
+
+	t.Run("successful probe closes", func(t *testing.T) {
+		now = now.Add(31 * time.Second)
+		if !s.Allow(provider, credential) {
+			t.Fatal("Allow() = false after the open timeout, want a probe")
+		}
+		s.RecordSuccess(provider, credential)
+		status := s.Snapshot()[0]
+		if status.State != BreakerStateClosed || status.ConsecutiveFailures != 0 {
+			t.Errorf("Snapshot() = %s with %d failures, want closed with 0", status.State, status.ConsecutiveFailures)
+		}
+		if !s.Allow(provider, credential) || !s.Allow(provider, credential) {
+			t.Error("Allow() = false on a closed breaker, want true")
+		}
+	})
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/cache"
+)
+
+const (
+	credentialKeyPrefix = "provider_credential:"
+
+	// defaultCredentialCooldown rests a rate limited key when the upstream does
+	// not say for how long; maxCredentialCooldown caps what it may ask for.
+	defaultCredentialCooldown = time.Minute
+	maxCredentialCooldown     = 10 * time.Minute
+
+	// credentialAuthFailureLimit is how many consecutive 401s disable a key
+	credentialAuthFailureLimit = 3
+)
+
+type credentialService struct {
+	credentialRepo repository.ProviderCredentialRepository
+	redisClient    *cache.RedisClient
+
+	// Round-robin positions used when Redis is unavailable
+	mu       sync.Mutex
+	counters map[string]*atomic.Uint64
+}
+
+func NewCredentialService(
+	credentialRepo repository.ProviderCredentialRepository,
+	redisClient *cache.RedisClient,
+) CredentialService {
+	return &credentialService{
+		credentialRepo: credentialRepo,
+		redisClient:    redisClient,
+		counters:       make(map[string]*atomic.Uint64),
+	}
+}
+
+// credentialUsage is what a credential has used in the current minute
+type credentialUsage struct {
+	requests int64
+	tokens   int64
+}
+
+func (s *credentialService) Acquire(ctx context.Context, provider *model.ModelProvider, exclude map[string]bool) (*model.ProviderCredential, error) {
+	// Providers without a credential pool use their own key
+	if len(provider.Credentials) == 0 {
+		if provider.APIKey == "" || exclude[""] {
+			return nil, nil
+		}
+		return &model.ProviderCredential{
+			ProviderID: provider.ID,
+			Name:       "default",
+			APIKey:     provider.APIKey,
+			MaskedKey:  model.MaskAPIKey(provider.APIKey),
+			Weight:     1,
+			Status:     model.CredentialStatusActive,
+		}, nil
+	}
+
+	now := time.Now()
+	var weighted, standby []*model.ProviderCredential
+	for i := range provider.Credentials {
+		credential := &provider.Credentials[i]
+		if exclude[credential.ID] || !credential.Available(now) {
+			continue
+		}
+		if credential.Weight > 0 {
+			weighted = append(weighted, credential)
+		} else {
+			standby = append(standby, credential)
+		}
+	}
+
+	// Zero-weight keys only take traffic once the weighted ones are spent
+	for _, candidates := range [][]*model.ProviderCredential{weighted, standby} {
+		if len(candidates) == 0 {
+			continue
+		}
+
+		usage := s.currentUsage(ctx, candidates, now)
+		candidates, usage = withinBudget(candidates, usage)
+		if len(candidates) == 0 {
+			continue
+		}
+
+		var credential *model.ProviderCredential
+		if strategy, _ := provider.Config["credential_strategy"].(string); strategy == model.CredentialStrategyLeastLoaded {
+			credential = leastLoaded(candidates, usage)
+		} else {
+			credential = roundRobin(candidates, s.nextPosition(ctx, provider.ID))
+		}
+
+		s.countRequest(ctx, credential, now)
+		return credential, nil
+	}
+
+	return nil, nil
+}
+
+func (s *credentialService) ReportResponse(ctx context.Context, credential *model.ProviderCredential, statusCode int, retryAfter time.Duration) error {
+	// The provider's own key is not tracked
+	if credential.ID == "" {
+		return nil
+	}
+
+	switch {
+	case statusCode == 429:
+		cooldown := retryAfter
+		if cooldown <= 0 {
+			cooldown = defaultCredentialCooldown
+		} else if cooldown > maxCredentialCooldown {
+			cooldown = maxCredentialCooldown
+		}
+		until := time.Now().Add(cooldown)
+		credential.CooldownUntil = &until
+		if err := s.credentialRepo.SetCooldown(ctx, credential.ID, until, "rate limited by upstream"); err != nil {
+			return err
+		}
+	case statusCode == 401:
+		credential.AuthFailures++
+		if err := s.credentialRepo.RecordAuthFailure(ctx, credential.ID, credentialAuthFailureLimit, "authentication failed upstream"); err != nil {
+			return err
+		}
+		if credential.AuthFailures >= credentialAuthFailureLimit {
+			log.Printf("Disabled credential %s of provider %s after %d authentication failures", credential.MaskedKey, credential.ProviderID, credential.AuthFailures)
+		}
+	case statusCode >= 200 && statusCode < 300 && credential.AuthFailures > 0:
+		credential.AuthFailures = 0
+		if err := s.credentialRepo.ResetAuthFailures(ctx, credential.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *credentialService) RecordTokens(ctx context.Context, credential *model.ProviderCredential, tokens int) error {
+	if credential.ID == "" || tokens <= 0 || s.redisClient == nil {
+		return nil
+	}
+
+	key := credentialUsageKey(credential.ID, "tokens", time.Now())
+	pipe := s.redisClient.Client.Pipeline()
+	pipe.IncrBy(ctx, key, int64(tokens))
+	pipe.Expire(ctx, key, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record credential tokens: %w", err)
+	}
+	return nil
+}
+
+// currentUsage loads this minute's request and token counts for the
+// candidates. Without Redis, or if it fails, all counts are zero.
+func (s *credentialService) currentUsage(ctx context.Context, candidates []*model.ProviderCredential, now time.Time) []credentialUsage {
+	usage := make([]credentialUsage, len(candidates))
+	if s.redisClient == nil {
+		return usage
+	}
+
+	keys := make([]string, 0, len(candidates)*2)
+	for _, c := range candidates {
+		keys = append(keys, credentialUsageKey(c.ID, "requests", now), credentialUsageKey(c.ID, "tokens", now))
+	}
+	values, err := s.redisClient.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return usage
+	}
+	for i := range candidates {
+		usage[i].requests = redisInt(values[i*2])
+		usage[i].tokens = redisInt(values[i*2+1])
+	}
+	return usage
+}
+
+func (s *credentialService) countRequest(ctx context.Context, credential *model.ProviderCredential, now time.Time) {
+	if credential.ID == "" || s.redisClient == nil {
+		return
+	}
+
+	key := credentialUsageKey(credential.ID, "requests", now)
+	pipe := s.redisClient.Client.Pipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*time.Minute)
+	_, _ = pipe.Exec(ctx)
+}
+
+// nextPosition advances the provider's round-robin position, shared across
+// instances through Redis when it is available
+func (s *credentialService) nextPosition(ctx context.Context, providerID string) uint64 {
+	if s.redisClient != nil {
+		n, err := s.redisClient.Client.Incr(ctx, credentialKeyPrefix+"rr:"+providerID).Result()
+		if err == nil {
+			return uint64(n)
+		}
+	}
+
+	s.mu.Lock()
+	counter, ok := s.counters[providerID]
+	if !ok {
+		counter = &atomic.Uint64{}
+		s.counters[providerID] = counter
+	}
+	s.mu.Unlock()
+	return counter.Add(1)
+}
+
+// withinBudget drops the credentials that have used up their per-minute
+// request or token budget
+func withinBudget(candidates []*model.ProviderCredential, usage []credentialUsage) ([]*model.ProviderCredential, []credentialUsage) {
+	keptCredentials := make([]*model.ProviderCredential, 0, len(candidates))
+	keptUsage := make([]credentialUsage, 0, len(usage))
+	for i, c := range candidates {
+		if c.RPMLimit > 0 && usage[i].requests >= int64(c.RPMLimit) {
+			continue
+		}
+		if c.TPMLimit > 0 && usage[i].tokens >= int64(c.TPMLimit) {
+			continue
+		}
+		keptCredentials = append(keptCredentials, c)
+		keptUsage = append(keptUsage, usage[i])
+	}
+	return keptCredentials, keptUsage
+}
+
+// roundRobin picks the credential at position n of a cycle in which each
+// credential appears as many times as its weight
+func roundRobin(candidates []*model.ProviderCredential, n uint64) *model.ProviderCredential {
+	total := 0
+	for _, c := range candidates {
+		total += max(c.Weight, 1)
+	}
+
+	pos := int(n % uint64(total))
+	for _, c := range candidates {
+		if pos < max(c.Weight, 1) {
+			return c
+		}
+		pos -= max(c.Weight, 1)
+	}
+	return candidates[0]
+}
+
+// leastLoaded picks the credential that has used the smallest share of its
+// per-minute budget. Credentials without budgets are compared on requests per
+// unit of weight.
+func leastLoaded(candidates []*model.ProviderCredential, usage []credentialUsage) *model.ProviderCredential {
+	best, bestLoad := 0, credentialLoad(candidates[0], usage[0])
+	for i := 1; i < len(candidates); i++ {
+		if load := credentialLoad(candidates[i], usage[i]); load < bestLoad {
+			best, bestLoad = i, load
+		}
+	}
+	return candidates[best]
+}
+
+func credentialLoad(c *model.ProviderCredential, usage credentialUsage) float64 {
+	if c.RPMLimit <= 0 && c.TPMLimit <= 0 {
+		return float64(usage.requests) / float64(max(c.Weight, 1))
+	}
+
+	var load float64
+	if c.RPMLimit > 0 {
+		load = float64(usage.requests) / float64(c.RPMLimit)
+	}
+	if c.TPMLimit > 0 {
+		load = max(load, float64(usage.tokens)/float64(c.TPMLimit))
+	}
+	return load
+}
+
+func credentialUsageKey(credentialID, dimension string, now time.Time) string {
+	return credentialKeyPrefix + credentialID + ":" + dimension + ":" + strconv.FormatInt(now.Unix()/60, 10)
+}
+
+// redisInt converts an HMGET value, which is nil for a missing field
+func redisInt(value interface{}) int64 {
+	str, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(str, 10, 64)
+	return n
+}
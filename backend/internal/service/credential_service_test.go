@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+func TestCredentialSelection(t *testing.T) {
+	a := &model.ProviderCredential{ID: "a", Weight: 1}
+	b := &model.ProviderCredential{ID: "b", Weight: 2, RPMLimit: 10}
+	candidates := []*model.ProviderCredential{a, b}
+
+	t.Run("round robin follows weights", func(t *testing.T) {
+		var got []string
+		for n := uint64(0); n < 6; n++ {
+			got = append(got, roundRobin(candidates, n).ID)
+		}
+		want := []string{"a", "b", "b", "a", "b", "b"}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("roundRobin() sequence = %v, want %v", got, want)
+			}
+		}
+	})
+
+	t.Run("exhausted budgets are skipped", func(t *testing.T) {
+		usage := []credentialUsage{{requests: 50}, {requests: 10}}
+		kept, _ := withinBudget(candidates, usage)
+		if len(kept) != 1 || kept[0].ID != "a" {
+			t.Errorf("withinBudget() kept %d credentials, want only a", len(kept))
+		}
+	})
+
+	t.Run("least loaded prefers spare budget", func(t *testing.T) {
+		c := &model.ProviderCredential{ID: "c", RPMLimit: 100}
+		d := &model.ProviderCredential{ID: "d", RPMLimit: 10, TPMLimit: 1000}
+		usage := []credentialUsage{{requests: 60}, {requests: 2, tokens: 100}}
+		if got := leastLoaded([]*model.ProviderCredential{c, d}, usage); got.ID != "d" {
+			t.Errorf("leastLoaded() = %s, want d", got.ID)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+)
+
+var (
+	// ErrInvalidLedgerEntry is returned for a manual entry whose type or
+	// amount the ledger does not accept
+	ErrInvalidLedgerEntry = errors.New("invalid ledger entry")
+	// ErrLedgerReferenceNotFound is returned when a manual entry references
+	// a record the user does not have
+	ErrLedgerReferenceNotFound = errors.New("ledger entry reference not found")
+)
+
+type ledgerService struct {
+	ledgerRepo  repository.LedgerRepository
+	paymentRepo repository.PaymentRecordRepository
+	billingRepo repository.BillingRecordRepository
+}
+
+func NewLedgerService(
+	ledgerRepo repository.LedgerRepository,
+	paymentRepo repository.PaymentRecordRepository,
+	billingRepo repository.BillingRecordRepository,
+) LedgerService {
+	return &ledgerService{
+		ledgerRepo:  ledgerRepo,
+		paymentRepo: paymentRepo,
+		billingRepo: billingRepo,
+	}
+}
+
+func (s *ledgerService) Post(ctx context.Context, entry *model.LedgerEntry) (bool, error) {
+	posted, err := s.ledgerRepo.Post(ctx, entry)
+	if err != nil {
+		return false, fmt.Errorf("failed to post ledger entry: %w", err)
+	}
+	return posted, nil
+}
+
+func (s *ledgerService) PostManualEntry(ctx context.Context, userID, adminID string, req *PostLedgerEntryRequest) (*model.LedgerEntry, bool, error) {
+	if err := s.checkReference(ctx, userID, req.ReferenceType, req.ReferenceID); err != nil {
+		return nil, false, err
+	}
+
+	entry := &model.LedgerEntry{
+		UserID:        userID,
+		Type:          req.Type,
+		Amount:        req.Amount,
+		ReferenceType: req.ReferenceType,
+		ReferenceID:   &req.ReferenceID,
+		Description:   req.Description,
+		Metadata:      model.JSONB{"posted_by": adminID},
+	}
+	if err := entry.Validate(); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidLedgerEntry, err)
+	}
+
+	posted, err := s.Post(ctx, entry)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, posted, nil
+}
+
+// checkReference checks that a manual entry's payment or billing record
+// belongs to the user. Admin request IDs reference nothing stored.
+func (s *ledgerService) checkReference(ctx context.Context, userID, referenceType, referenceID string) error {
+	var owner string
+	switch referenceType {
+	case model.LedgerRefPaymentRecord:
+		payment, err := s.paymentRepo.FindByID(ctx, referenceID)
+		if err != nil {
+			return fmt.Errorf("failed to get payment record: %w", err)
+		}
+		if payment != nil {
+			owner = payment.UserID
+		}
+	case model.LedgerRefBillingRecord:
+		record, err := s.billingRepo.FindByID(ctx, referenceID)
+		if err != nil {
+			return fmt.Errorf("failed to get billing record: %w", err)
+		}
+		if record != nil {
+			owner = record.UserID
+		}
+	default:
+		return nil
+	}
+	if owner != userID {
+		return ErrLedgerReferenceNotFound
+	}
+	return nil
+}
+
+func (s *ledgerService) GetAccount(ctx context.Context, userID string) (*model.LedgerAccount, error) {
+	account, err := s.ledgerRepo.FindAccount(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		// An account opens with its first entry
+		return &model.LedgerAccount{UserID: userID}, nil
+	}
+	return account, nil
+}
+
+func (s *ledgerService) GetEntries(ctx context.Context, userID string, page, limit int) (*LedgerEntriesResponse, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	entries, total, err := s.ledgerRepo.FindEntriesByUserID(ctx, userID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LedgerEntriesResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}, nil
+}
+
+func (s *ledgerService) Reconcile(ctx context.Context, fix bool) (*LedgerReconciliation, error) {
+	accounts, sums, err := s.ledgerRepo.FindAccountsWithSums(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LedgerReconciliation{
+		Accounts:  len(accounts),
+		CheckedAt: time.Now(),
+	}
+	check := func(userID string, recorded *model.LedgerAccount) {
+		expected := sums[userID]
+		if expected == nil {
+			expected = &model.LedgerAccount{UserID: userID}
+		}
+		drift := &LedgerDrift{
+			UserID:          userID,
+			ExpectedBalance: expected.Balance,
+			ExpectedHeld:    expected.Held,
+		}
+		if recorded != nil {
+			drift.RecordedBalance = recorded.Balance
+			drift.RecordedHeld = recorded.Held
+		} else {
+			drift.MissingAccount = true
+		}
+		if !drift.MissingAccount &&
+			drift.RecordedBalance == drift.ExpectedBalance &&
+			drift.RecordedHeld == drift.ExpectedHeld {
+			return
+		}
+		report.Drifts = append(report.Drifts, drift)
+	}
+
+	seen := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		seen[account.UserID] = true
+		check(account.UserID, account)
+	}
+	for userID := range sums {
+		// Entries are posted together with their account, so this only
+		// happens if an account row was deleted
+		if !seen[userID] {
+			check(userID, nil)
+		}
+	}
+	sort.Slice(report.Drifts, func(i, j int) bool {
+		return report.Drifts[i].UserID < report.Drifts[j].UserID
+	})
+
+	if fix {
+		for _, drift := range report.Drifts {
+			// The account is rebuilt under its lock, so postings made since
+			// the check above are included
+			if _, err := s.ledgerRepo.RebuildAccount(ctx, drift.UserID); err != nil {
+				return report, fmt.Errorf("failed to rebuild account of user %s: %w", drift.UserID, err)
+			}
+			drift.Fixed = true
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/money"
+)
+
+// mockLedgerRepository serves accounts and entry sums from memory
+type mockLedgerRepository struct {
+	repository.LedgerRepository
+	accounts map[string]*model.LedgerAccount
+	sums     map[string]*model.LedgerAccount
+	posted   []*model.LedgerEntry
+}
+
+func (m *mockLedgerRepository) Post(ctx context.Context, entry *model.LedgerEntry) (bool, error) {
+	for _, e := range m.posted {
+		if e.ReferenceType == entry.ReferenceType && *e.ReferenceID == *entry.ReferenceID && e.Type == entry.Type {
+			return false, nil
+		}
+	}
+	m.posted = append(m.posted, entry)
+	return true, nil
+}
+
+// mockLedgerPaymentRepository finds payment records by ID
+type mockLedgerPaymentRepository struct {
+	repository.PaymentRecordRepository
+	payments map[string]*model.PaymentRecord
+}
+
+func (m *mockLedgerPaymentRepository) FindByID(ctx context.Context, id string) (*model.PaymentRecord, error) {
+	return m.payments[id], nil
+}
+
+func (m *mockLedgerRepository) FindAccountsWithSums(ctx context.Context) ([]*model.LedgerAccount, map[string]*model.LedgerAccount, error) {
+	accounts := make([]*model.LedgerAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, m.sums, nil
+}
+
+func (m *mockLedgerRepository) RebuildAccount(ctx context.Context, userID string) (*model.LedgerAccount, error) {
+	sum := m.sums[userID]
+	m.accounts[userID] = &model.LedgerAccount{UserID: userID, Balance: sum.Balance, Held: sum.Held}
+	return m.accounts[userID], nil
+}
+
+func TestLedgerService_Reconcile(t *testing.T) {
+	repo := &mockLedgerRepository{
+		accounts: map[string]*model.LedgerAccount{
+			"in-step":    {UserID: "in-step", Balance: money.MustParse("10.1") + money.MustParse("0.2")},
+			"drifted":    {UserID: "drifted", Balance: money.FromInt(5), Held: money.FromInt(1)},
+			"no-entries": {UserID: "no-entries"},
+		},
+		sums: map[string]*model.LedgerAccount{
+			"in-step": {UserID: "in-step", Balance: money.MustParse("10.3")},
+			"drifted": {UserID: "drifted", Balance: money.MustParse("4.25"), Held: money.FromInt(1)},
+			"orphan":  {UserID: "orphan", Balance: money.FromInt(2)},
+		},
+	}
+	svc := NewLedgerService(repo, nil, nil)
+
+	report, err := svc.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if report.Accounts != 3 {
+		t.Errorf("Accounts = %d, want 3", report.Accounts)
+	}
+	if len(report.Drifts) != 2 {
+		t.Fatalf("Drifts = %d, want 2", len(report.Drifts))
+	}
+
+	drifted, orphan := report.Drifts[0], report.Drifts[1]
+	if drifted.UserID != "drifted" || drifted.RecordedBalance != money.FromInt(5) || drifted.ExpectedBalance != money.MustParse("4.25") || drifted.Fixed {
+		t.Errorf("unexpected drift %+v", drifted)
+	}
+	if orphan.UserID != "orphan" || !orphan.MissingAccount || orphan.ExpectedBalance != money.FromInt(2) {
+		t.Errorf("unexpected drift %+v", orphan)
+	}
+
+	report, err = svc.Reconcile(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Reconcile(fix) error = %v", err)
+	}
+	for _, drift := range report.Drifts {
+		if !drift.Fixed {
+			t.Errorf("drift of %s not fixed", drift.UserID)
+		}
+	}
+	if repo.accounts["drifted"].Balance != money.MustParse("4.25") {
+		t.Errorf("drifted balance = %s after fix, want 4.25", repo.accounts["drifted"].Balance)
+	}
+
+	report, err = svc.Reconcile(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reconcile() after fix error = %v", err)
+	}
+	if len(report.Drifts) != 0 {
+		t.Errorf("Drifts after fix = %d, want 0", len(report.Drifts))
+	}
+}
+
+func TestLedgerService_PostManualEntry(t *testing.T) {
+	ctx := context.Background()
+	paymentID := "6f1c7a0e-2b8d-4c1e-9a53-0d3f1b2a4c5e"
+	requestID := "0b9e4c7d-51a2-4f36-8e0d-7a6c3b2f1e90"
+
+	repo := &mockLedgerRepository{}
+	payments := &mockLedgerPaymentRepository{payments: map[string]*model.PaymentRecord{
+		paymentID: {ID: paymentID, UserID: "user-1"},
+	}}
+	svc := NewLedgerService(repo, payments, nil)
+
+	refund := &PostLedgerEntryRequest{
+		Type:          model.LedgerEntryRefund,
+		Amount:        money.MustParse("-5"),
+		ReferenceType: model.LedgerRefPaymentRecord,
+		ReferenceID:   paymentID,
+		Description:   "Refund of unused credit",
+	}
+	entry, posted, err := svc.PostManualEntry(ctx, "user-1", "admin-1", refund)
+	if err != nil || !posted {
+		t.Fatalf("PostManualEntry() = %v, %v, want posted", posted, err)
+	}
+	if entry.UserID != "user-1" || *entry.ReferenceID != paymentID || entry.Metadata["posted_by"] != "admin-1" {
+		t.Errorf("posted entry = %+v", entry)
+	}
+
+	// Retrying the request posts nothing more
+	if _, posted, err := svc.PostManualEntry(ctx, "user-1", "admin-1", refund); err != nil || posted {
+		t.Errorf("PostManualEntry() retry = %v, %v, want not posted", posted, err)
+	}
+
+	// Another user's payment cannot be refunded to this one
+	if _, _, err := svc.PostManualEntry(ctx, "user-2", "admin-1", refund); !errors.Is(err, ErrLedgerReferenceNotFound) {
+		t.Errorf("PostManualEntry() for another user's payment error = %v, want ErrLedgerReferenceNotFound", err)
+	}
+
+	// A refund pays money out, so it cannot be positive
+	adjustment := &PostLedgerEntryRequest{
+		Type:          model.LedgerEntryRefund,
+		Amount:        money.FromInt(5),
+		ReferenceType: model.LedgerRefAdminRequest,
+		ReferenceID:   requestID,
+		Description:   "Wrong sign",
+	}
+	if _, _, err := svc.PostManualEntry(ctx, "user-1", "admin-1", adjustment); !errors.Is(err, ErrInvalidLedgerEntry) {
+		t.Errorf("PostManualEntry() with a positive refund error = %v, want ErrInvalidLedgerEntry", err)
+	}
+	adjustment.Type = model.LedgerEntryAdjustment
+	if _, posted, err := svc.PostManualEntry(ctx, "user-1", "admin-1", adjustment); err != nil || !posted {
+		t.Errorf("PostManualEntry() adjustment = %v, %v, want posted", posted, err)
+	}
+	if len(repo.posted) != 2 {
+		t.Errorf("posted %d entries, want 2", len(repo.posted))
+	}
+}
@@ -16,17 +16,20 @@ type modelService struct {
 	modelRepo     repository.ModelRepository
 	providerRepo  repository.ModelProviderRepository
 	statisticRepo repository.ModelStatisticRepository
+	aliasRepo     repository.ModelAliasRepository
 }
 
 func NewModelService(
 	modelRepo repository.ModelRepository,
 	providerRepo repository.ModelProviderRepository,
 	statisticRepo repository.ModelStatisticRepository,
+	aliasRepo repository.ModelAliasRepository,
 ) ModelService {
 	return &modelService{
 		modelRepo:     modelRepo,
 		providerRepo:  providerRepo,
 		statisticRepo: statisticRepo,
+		aliasRepo:     aliasRepo,
 	}
 }
 
@@ -58,6 +61,9 @@ func (s *modelService) ListModels(ctx context.Context, req *ListModelsRequest) (
 			ProviderName: m.Provider.Name,
 		}
 	}
+	if err := s.attachAliases(ctx, modelInfos); err != nil {
+		return nil, err
+	}
 
 	totalPages := int((total + int64(limit) - 1) / int64(limit))
 
@@ -70,6 +76,28 @@ func (s *modelService) ListModels(ctx context.Context, req *ListModelsRequest) (
 	}, nil
 }
 
+// attachAliases fills in the active aliases that resolve to each model
+func (s *modelService) attachAliases(ctx context.Context, modelInfos []*ModelInfo) error {
+	modelIDs := make([]string, len(modelInfos))
+	for i, info := range modelInfos {
+		modelIDs[i] = info.ID
+	}
+
+	aliases, err := s.aliasRepo.FindActiveByModelIDs(ctx, modelIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get model aliases: %w", err)
+	}
+
+	byModel := make(map[string][]string)
+	for _, alias := range aliases {
+		byModel[alias.ModelID] = append(byModel[alias.ModelID], alias.Name)
+	}
+	for _, info := range modelInfos {
+		info.Aliases = byModel[info.ID]
+	}
+	return nil
+}
+
 func (s *modelService) searchModelsWithFilters(ctx context.Context, req *ListModelsRequest, limit, offset int) ([]*model.Model, int64, error) {
 	var models []*model.Model
 	db := s.modelRepo.GetDB().WithContext(ctx).Model(&model.Model{}).Where("is_active = ?", true).Preload("Provider")
@@ -242,6 +270,9 @@ func (s *modelService) SearchModels(ctx context.Context, query string, filters *
 			ProviderName: m.Provider.Name,
 		}
 	}
+	if err := s.attachAliases(ctx, modelInfos); err != nil {
+		return nil, err
+	}
 
 	return &ListModelsResponse{
 		Models:     modelInfos,
@@ -268,3 +299,22 @@ func (s *modelService) GetModelCategories(ctx context.Context) ([]string, error)
 	}
 	return categories, nil
 }
+
+func (s *modelService) ListModelAliases(ctx context.Context) ([]*ModelAliasInfo, error) {
+	aliases, err := s.aliasRepo.FindAllWithModels(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model aliases: %w", err)
+	}
+
+	aliasInfos := make([]*ModelAliasInfo, len(aliases))
+	for i, alias := range aliases {
+		aliasInfos[i] = &ModelAliasInfo{
+			Name:         alias.Name,
+			Description:  alias.Description,
+			ModelID:      alias.ModelID,
+			ModelName:    alias.Model.Name,
+			ProviderName: alias.Model.Provider.Name,
+		}
+	}
+	return aliasInfos, nil
+}
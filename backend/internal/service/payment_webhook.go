@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/payment"
+)
+
+// Payment record statuses
+const (
+	paymentStatusPending   = "pending"
+	paymentStatusCompleted = "completed"
+	paymentStatusFailed    = "failed"
+)
+
+// ProcessPaymentWebhook applies a gateway's notice that a payment succeeded
+// or failed. Gateways deliver webhooks at least once, so applying the same
+// event again changes nothing: the status only moves forward, and the credit
+// of a completed payment is posted once per payment record.
+func (s *billingService) ProcessPaymentWebhook(ctx context.Context, gatewayName string, payload []byte, signature string) error {
+	gateway := s.gateways.Lookup(gatewayName)
+	if gateway == nil {
+		return fmt.Errorf("unknown payment gateway")
+	}
+
+	event, err := gateway.ParseWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+	if err := s.validator.Var(event.PaymentID, "uuid"); err != nil {
+		return fmt.Errorf("payment not found")
+	}
+
+	paymentRecord, err := s.paymentRepo.FindByID(ctx, event.PaymentID)
+	if err != nil {
+		return fmt.Errorf("failed to get payment: %w", err)
+	}
+	if paymentRecord == nil || paymentRecord.PaymentMethod != gateway.Name {
+		return fmt.Errorf("payment not found")
+	}
+	if paymentRecord.Status == paymentStatusCompleted &&
+		paymentRecord.TransactionID != nil && *paymentRecord.TransactionID != event.TransactionID {
+		return fmt.Errorf("payment transaction mismatch")
+	}
+
+	// A transaction ID belongs to one payment; the same charge must not
+	// complete a second one
+	existing, err := s.paymentRepo.FindByTransactionID(ctx, event.TransactionID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != paymentRecord.ID {
+		return fmt.Errorf("payment transaction mismatch")
+	}
+
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		return s.completePayment(ctx, paymentRecord, event)
+	case payment.EventPaymentFailed:
+		return s.failPayment(ctx, paymentRecord, event)
+	}
+	return nil
+}
+
+// completePayment marks a payment completed and credits the user's balance
+func (s *billingService) completePayment(ctx context.Context, paymentRecord *model.PaymentRecord, event *payment.Event) error {
+	if event.Amount != paymentRecord.Amount || !strings.EqualFold(event.Currency, paymentRecord.Currency) {
+		return fmt.Errorf("payment amount mismatch")
+	}
+
+	paidAt := paymentRecord.PaidAt
+	if paymentRecord.Status != paymentStatusCompleted {
+		now := time.Now()
+		paidAt = &now
+		// A payment that failed may still succeed when the gateway retries
+		// the charge
+		if _, err := s.paymentRepo.UpdateStatus(ctx, paymentRecord.ID, paymentStatusCompleted, &event.TransactionID, paidAt,
+			paymentStatusPending, paymentStatusFailed); err != nil {
+			return err
+		}
+	}
+	if paidAt == nil {
+		now := time.Now()
+		paidAt = &now
+	}
+
+	// Posted on every delivery, so a credit that failed after the status
+	// changed is posted when the gateway retries; the ledger drops
+	// duplicates of the same payment
+	_, err := s.ledgerRepo.Post(ctx, &model.LedgerEntry{
+		UserID:        paymentRecord.UserID,
+		Type:          model.LedgerEntryCredit,
+		Amount:        paymentRecord.Amount,
+		ReferenceType: model.LedgerRefPaymentRecord,
+		ReferenceID:   &paymentRecord.ID,
+		Description:   "Payment",
+		Metadata: model.JSONB{
+			"payment_method": paymentRecord.PaymentMethod,
+			"transaction_id": event.TransactionID,
+			"event_id":       event.ID,
+		},
+		CreatedAt: *paidAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to credit payment: %w", err)
+	}
+	return nil
+}
+
+// failPayment marks a pending payment failed. A completed payment stays
+// completed: a late failure notice can't take back a charge that succeeded.
+func (s *billingService) failPayment(ctx context.Context, paymentRecord *model.PaymentRecord, event *payment.Event) error {
+	if paymentRecord.Status != paymentStatusPending {
+		return nil
+	}
+	if _, err := s.paymentRepo.UpdateStatus(ctx, paymentRecord.ID, paymentStatusFailed, &event.TransactionID, nil,
+		paymentStatusPending); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SimulateSandboxPayment plays the sandbox gateway for one of the user's
+// sandbox payments: it signs the webhook the gateway would send and
+// processes it like any other
+func (s *billingService) SimulateSandboxPayment(ctx context.Context, userID, paymentID string, succeed bool) (*PaymentItem, error) {
+	gateway := s.gateways.Lookup(payment.Sandbox)
+	if gateway == nil {
+		return nil, fmt.Errorf("sandbox payments are not enabled")
+	}
+	if err := s.validator.Var(paymentID, "uuid"); err != nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+
+	paymentRecord, err := s.paymentRepo.FindByID(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if paymentRecord == nil || paymentRecord.UserID != userID || paymentRecord.PaymentMethod != payment.Sandbox {
+		return nil, fmt.Errorf("payment not found")
+	}
+
+	transactionID := "sandbox_" + paymentRecord.ID
+	if paymentRecord.TransactionID != nil {
+		transactionID = *paymentRecord.TransactionID
+	}
+	event := &payment.Event{
+		ID:            fmt.Sprintf("evt_sandbox_%d", time.Now().UnixNano()),
+		Type:          payment.EventPaymentSucceeded,
+		PaymentID:     paymentRecord.ID,
+		TransactionID: transactionID,
+		Amount:        paymentRecord.Amount,
+		Currency:      paymentRecord.Currency,
+	}
+	if !succeed {
+		event.Type = payment.EventPaymentFailed
+		event.Reason = "declined in sandbox"
+	}
+
+	payload, signature, err := gateway.Webhook(event)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ProcessPaymentWebhook(ctx, payment.Sandbox, payload, signature); err != nil {
+		return nil, err
+	}
+
+	paymentRecord, err = s.paymentRepo.FindByID(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	return &PaymentItem{
+		ID:            paymentRecord.ID,
+		Amount:        paymentRecord.Amount,
+		Currency:      paymentRecord.Currency,
+		PaymentMethod: paymentRecord.PaymentMethod,
+		Status:        paymentRecord.Status,
+		TransactionID: paymentRecord.TransactionID,
+		CreatedAt:     paymentRecord.CreatedAt,
+		PaidAt:        paymentRecord.PaidAt,
+	}, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/money"
+	"massrouter.ai/backend/pkg/payment"
+)
+
+// mockPaymentRecordRepository keeps payment records in memory
+type mockPaymentRecordRepository struct {
+	repository.PaymentRecordRepository
+	payments map[string]*model.PaymentRecord
+}
+
+func (m *mockPaymentRecordRepository) FindByID(ctx context.Context, id string) (*model.PaymentRecord, error) {
+	record, ok := m.payments[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (m *mockPaymentRecordRepository) FindByTransactionID(ctx context.Context, transactionID string) (*model.PaymentRecord, error) {
+	for _, record := range m.payments {
+		if record.TransactionID != nil && *record.TransactionID == transactionID {
+			copied := *record
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockPaymentRecordRepository) UpdateStatus(ctx context.Context, paymentID, status string, transactionID *string, paidAt *time.Time, from ...string) (bool, error) {
+	record := m.payments[paymentID]
+	if record == nil {
+		return false, nil
+	}
+	if len(from) > 0 {
+		allowed := false
+		for _, s := range from {
+			allowed = allowed || record.Status == s
+		}
+		if !allowed {
+			return false, nil
+		}
+	}
+	record.Status = status
+	if transactionID != nil {
+		id := *transactionID
+		record.TransactionID = &id
+	}
+	if paidAt != nil {
+		record.PaidAt = paidAt
+	}
+	return true, nil
+}
+
+// postingLedgerRepository records posted entries, dropping repeats of a
+// reference like the real ledger
+type postingLedgerRepository struct {
+	repository.LedgerRepository
+	entries []*model.LedgerEntry
+}
+
+func (m *postingLedgerRepository) Post(ctx context.Context, entry *model.LedgerEntry) (bool, error) {
+	for _, e := range m.entries {
+		if e.Type == entry.Type && e.ReferenceType == entry.ReferenceType && *e.ReferenceID == *entry.ReferenceID {
+			return false, nil
+		}
+	}
+	m.entries = append(m.entries, entry)
+	return true, nil
+}
+
+func TestProcessPaymentWebhook(t *testing.T) {
+	const paymentID = "7a1c2e4f-0b3d-4c5e-8f90-123456789abc"
+	ctx := context.Background()
+
+	sandbox, err := payment.NewSandboxGateway("", 0)
+	if err != nil {
+		t.Fatalf("NewSandboxGateway() error = %v", err)
+	}
+	newService := func() (*billingService, *mockPaymentRecordRepository, *postingLedgerRepository) {
+		paymentRepo := &mockPaymentRecordRepository{payments: map[string]*model.PaymentRecord{
+			paymentID: {ID: paymentID, UserID: "user-1", Amount: money.MustParse("25.5"), Currency: "CNY", PaymentMethod: payment.Sandbox, Status: paymentStatusPending},
+		}}
+		ledgerRepo := &postingLedgerRepository{}
+		gateways := payment.Gateways{}
+		gateways.Add(sandbox)
+		return &billingService{paymentRepo: paymentRepo, ledgerRepo: ledgerRepo, gateways: gateways, validator: validator.New()}, paymentRepo, ledgerRepo
+	}
+	webhook := func(eventType string, amount money.Amount) ([]byte, string) {
+		payload, signature, err := sandbox.Webhook(&payment.Event{
+			ID:            "evt_1",
+			Type:          eventType,
+			PaymentID:     paymentID,
+			TransactionID: "txn_1",
+			Amount:        amount,
+			Currency:      "CNY",
+		})
+		if err != nil {
+			t.Fatalf("Webhook() error = %v", err)
+		}
+		return payload, signature
+	}
+
+	t.Run("SucceededIsCreditedOnce", func(t *testing.T) {
+		svc, paymentRepo, ledgerRepo := newService()
+		payload, signature := webhook(payment.EventPaymentSucceeded, money.MustParse("25.5"))
+
+		for i := 0; i < 2; i++ {
+			if err := svc.ProcessPaymentWebhook(ctx, payment.Sandbox, payload, signature); err != nil {
+				t.Fatalf("delivery %d: ProcessPaymentWebhook() error = %v", i+1, err)
+			}
+		}
+
+		record := paymentRepo.payments[paymentID]
+		if record.Status != paymentStatusCompleted || record.TransactionID == nil || *record.TransactionID != "txn_1" || record.PaidAt == nil {
+			t.Errorf("payment = %+v, want completed with txn_1", record)
+		}
+		if len(ledgerRepo.entries) != 1 || ledgerRepo.entries[0].Amount != money.MustParse("25.5") || ledgerRepo.entries[0].Type != model.LedgerEntryCredit {
+			t.Errorf("ledger entries = %+v, want one credit of 25.5", ledgerRepo.entries)
+		}
+
+		// A late failure notice doesn't undo the payment
+		payload, signature = webhook(payment.EventPaymentFailed, 0)
+		if err := svc.ProcessPaymentWebhook(ctx, payment.Sandbox, payload, signature); err != nil {
+			t.Fatalf("ProcessPaymentWebhook(failed) error = %v", err)
+		}
+		if paymentRepo.payments[paymentID].Status != paymentStatusCompleted {
+			t.Errorf("status = %s after late failure, want completed", paymentRepo.payments[paymentID].Status)
+		}
+	})
+
+	t.Run("RejectsBadDeliveries", func(t *testing.T) {
+		svc, paymentRepo, ledgerRepo := newService()
+		payload, signature := webhook(payment.EventPaymentSucceeded, money.MustParse("25.5"))
+		underpaid, underpaidSignature := webhook(payment.EventPaymentSucceeded, money.MustParse("2.55"))
+
+		tests := []struct {
+			name      string
+			gateway   string
+			payload   []byte
+			signature string
+			want      string
+		}{
+			{"unknown gateway", "acme", payload, signature, "unknown payment gateway"},
+			{"bad signature", payment.Sandbox, payload, "t=1,v1=00", "invalid webhook signature: timestamp outside tolerance"},
+			{"amount mismatch", payment.Sandbox, underpaid, underpaidSignature, "payment amount mismatch"},
+		}
+		for _, tt := range tests {
+			err := svc.ProcessPaymentWebhook(ctx, tt.gateway, tt.payload, tt.signature)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+			}
+		}
+		if paymentRepo.payments[paymentID].Status != paymentStatusPending || len(ledgerRepo.entries) != 0 {
+			t.Errorf("rejected webhooks changed the payment or the ledger")
+		}
+	})
+
+	t.Run("SandboxFailure", func(t *testing.T) {
+		svc, _, ledgerRepo := newService()
+		item, err := svc.SimulateSandboxPayment(ctx, "user-1", paymentID, false)
+		if err != nil {
+			t.Fatalf("SimulateSandboxPayment() error = %v", err)
+		}
+		if item.Status != paymentStatusFailed || len(ledgerRepo.entries) != 0 {
+			t.Errorf("status = %s with %d entries, want failed and no credit", item.Status, len(ledgerRepo.entries))
+		}
+
+		if _, err := svc.SimulateSandboxPayment(ctx, "user-2", paymentID, true); err == nil || err.Error() != "payment not found" {
+			t.Errorf("another user's payment: error = %v, want payment not found", err)
+		}
+	})
+}
@@ -0,0 +1,623 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
+)
+
+const (
+	// quotaPendingKey is the set of windows with counted usage that is not
+	// yet written to the database, as "day|<user>|2006-01-02" or
+	// "month|<user>|2006-01"
+	quotaPendingKey = "quota:pending"
+
+	// quotaCounterGrace keeps a window's totals past its end, so that calls
+	// started in it can still be settled
+	quotaCounterGrace = 24 * time.Hour
+
+	// quotaSeedAttempts bounds how often a reservation is retried when the
+	// totals expire between being seeded and being checked
+	quotaSeedAttempts = 3
+
+	// quotaFlushBatch is how many pending windows are taken at a time
+	quotaFlushBatch = 100
+
+	// quotaFlushLease is how long a flush has to write a window's usage
+	// before another flush may take it over
+	quotaFlushLease = time.Minute
+
+	quotaDay   = "day"
+	quotaMonth = "month"
+)
+
+// A user's usage in a window is counted in hashes sharing a hash tag:
+//
+//	quota:{user}:day:2006-01-02           totals, seeded from the database
+//	quota:{user}:day:2006-01-02:pending   usage not yet written to the database
+//	quota:{user}:day:2006-01-02:flushing  usage being written to the database
+//
+// and likewise quota:{user}:month:2006-01. Their fields are "requests",
+// "tokens" and "cost" (in money units), and "<usage key>|requests" and so on
+// for the models and categories of ModelUsage.
+func quotaCounterKeys(userID, period, window string) (string, string) {
+	totals := "quota:{" + userID + "}:" + period + ":" + window
+	return totals, totals + ":pending"
+}
+
+// quotaFlushingKey is the usage of a window a flush took, kept until it is
+// in the database
+func quotaFlushingKey(userID, period, window string) string {
+	totals, _ := quotaCounterKeys(userID, period, window)
+	return totals + ":flushing"
+}
+
+// quotaFlushingWindow is the pending window, as "day|<user>|2006-01-02", of
+// a key from quotaFlushingKey
+func quotaFlushingWindow(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "quota:{")
+	if !ok {
+		return "", false
+	}
+	userID, rest, ok := strings.Cut(rest, "}:")
+	if !ok {
+		return "", false
+	}
+	rest, ok = strings.CutSuffix(rest, ":flushing")
+	if !ok {
+		return "", false
+	}
+	period, window, ok := strings.Cut(rest, ":")
+	if !ok || userID == "" || window == "" {
+		return "", false
+	}
+	return period + "|" + userID + "|" + window, true
+}
+
+// quotaField is the counter field of a ModelUsage key, or of the totals when
+// the key is empty
+func quotaField(usageKey, name string) string {
+	if usageKey == "" {
+		return name
+	}
+	return usageKey + "|" + name
+}
+
+// seedQuotaScript fills the totals KEYS[1] with the field, value pairs from
+// ARGV[2] on, unless another instance already did, and expires them at
+// ARGV[1] (ms). The seeded field keeps a window without usage from looking
+// unseeded.
+var seedQuotaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'seeded', 1, unpack(ARGV, 2))
+redis.call('PEXPIREAT', KEYS[1], ARGV[1])
+return 1
+`)
+
+// quotaUsageScript checks and counts usage in the daily and monthly totals
+// KEYS[1] and KEYS[2], also adding it to their pending usage KEYS[3] and
+// KEYS[4]. ARGV[1] is the number of checks, each given as the window (1 or
+// 2), field, amount and limit; the field, amount pairs to add to both windows
+// follow. It returns the status, the failed check and the usage it found,
+// then the requests, tokens and cost of each window before the call. The
+// status is 1 when the usage was counted, 0 when a check failed and -1 when
+// the totals to check are missing.
+var quotaUsageScript = redis.NewScript(`
+local checks = tonumber(ARGV[1])
+if checks > 0 and (redis.call('EXISTS', KEYS[1]) == 0 or redis.call('EXISTS', KEYS[2]) == 0) then
+	return {-1, 0, 0}
+end
+local function used(w, field)
+	return tonumber(redis.call('HGET', KEYS[w], field) or '0')
+end
+local usage = {}
+for w = 1, 2 do
+	for _, field in ipairs({'requests', 'tokens', 'cost'}) do
+		table.insert(usage, used(w, field))
+	end
+end
+for i = 1, checks do
+	local arg = 2 + (i - 1) * 4
+	local current = used(tonumber(ARGV[arg]), ARGV[arg + 1])
+	if current + tonumber(ARGV[arg + 2]) > tonumber(ARGV[arg + 3]) then
+		return {0, i, current, unpack(usage)}
+	end
+end
+for w = 1, 2 do
+	local seeded = redis.call('EXISTS', KEYS[w]) == 1
+	for i = 2 + checks * 4, #ARGV, 2 do
+		if seeded then
+			redis.call('HINCRBY', KEYS[w], ARGV[i], ARGV[i + 1])
+		end
+		redis.call('HINCRBY', KEYS[w + 2], ARGV[i], ARGV[i + 1])
+	end
+end
+return {1, 0, 0, unpack(usage)}
+`)
+
+// takePendingScript moves the pending usage KEYS[1] into the flushing usage
+// KEYS[2], adding to what an earlier flush failed to write, and leases it
+// until ARGV[2] (ms). It returns "1" and the usage's field, value pairs, or
+// "0" while another flush holds the lease at ARGV[1] (ms).
+var takePendingScript = redis.NewScript(`
+if tonumber(redis.call('HGET', KEYS[2], 'lease') or '0') > tonumber(ARGV[1]) then
+	return {'0'}
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return {'1'}
+	end
+	redis.call('RENAME', KEYS[1], KEYS[2])
+else
+	local pending = redis.call('HGETALL', KEYS[1])
+	for i = 1, #pending, 2 do
+		redis.call('HINCRBY', KEYS[2], pending[i], pending[i + 1])
+	end
+	redis.call('DEL', KEYS[1])
+end
+redis.call('HSET', KEYS[2], 'lease', ARGV[2])
+local usage = {'1'}
+local fields = redis.call('HGETALL', KEYS[2])
+for i = 1, #fields, 2 do
+	if fields[i] ~= 'lease' then
+		table.insert(usage, fields[i])
+		table.insert(usage, fields[i + 1])
+	end
+end
+return usage
+`)
+
+// endFlushScript deletes the flushing usage KEYS[1] once it is written when
+// ARGV[2] is 1, or gives up its lease for the next flush when it is 0. It
+// returns 0 when the lease ARGV[1] was lost to another flush.
+var endFlushScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'lease') ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '1' then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('HDEL', KEYS[1], 'lease')
+end
+return 1
+`)
+
+// usageKeys are the ModelUsage keys the reservation's usage is counted under,
+// after the totals
+func (r *QuotaReservation) usageKeys() []string {
+	keys := []string{"", r.ModelID}
+	if r.Category != "" {
+		keys = append(keys, model.CategoryUsageKey(r.Category))
+	}
+	return keys
+}
+
+// counterArgs lists the field, amount pairs that add usage to the counters
+func (r *QuotaReservation) counterArgs(requests, tokens int64, cost money.Amount) []interface{} {
+	var args []interface{}
+	for _, key := range r.usageKeys() {
+		for _, add := range []struct {
+			name   string
+			amount int64
+		}{{"requests", requests}, {"tokens", tokens}, {"cost", cost.Units()}} {
+			if add.amount != 0 {
+				args = append(args, quotaField(key, add.name), add.amount)
+			}
+		}
+	}
+	return args
+}
+
+// quotaLimitCheck is one limit a call is checked against in Redis
+type quotaLimitCheck struct {
+	monthly   bool
+	field     string
+	amount    int64
+	limit     int64
+	limitType string // e.g. "daily_requests"
+	cost      bool   // Amounts are in money units
+	reason    string // Set for the quota's own limits
+	scope     string // "model" or "category" for ModelLimits
+	key       string
+}
+
+// quotaLimitChecks lists the limits a call is checked against, in the order
+// the database check applies them
+func quotaLimitChecks(quota *model.UserQuota, limits *model.ModelLimits, r *QuotaReservation) []quotaLimitCheck {
+	tokens, cost := int64(r.Tokens), r.Cost.Units()
+	checks := []quotaLimitCheck{
+		{false, "requests", 1, int64(quota.DailyRequestLimit), "daily_requests", false, "daily request limit exceeded", "", ""},
+		{false, "tokens", tokens, int64(quota.DailyTokenLimit), "daily_tokens", false, "daily token limit exceeded", "", ""},
+		{false, "cost", cost, quota.DailyCostLimit.Units(), "daily_cost", true, "daily cost limit exceeded", "", ""},
+		{true, "requests", 1, int64(quota.MonthlyRequestLimit), "monthly_requests", false, "monthly request limit exceeded", "", ""},
+		{true, "tokens", tokens, int64(quota.MonthlyTokenLimit), "monthly_tokens", false, "monthly token limit exceeded", "", ""},
+		{true, "cost", cost, quota.MonthlyCostLimit.Units(), "monthly_cost", true, "monthly cost limit exceeded", "", ""},
+	}
+
+	scoped := func(scope, key, usageKey string, limit model.ModelLimit) {
+		// Zero caps of a model limit are unlimited
+		for _, c := range []quotaLimitCheck{
+			{false, "requests", 1, int64(limit.DailyRequests), "daily_requests", false, "", scope, key},
+			{false, "tokens", tokens, int64(limit.DailyTokens), "daily_tokens", false, "", scope, key},
+			{false, "cost", cost, limit.DailyCost.Units(), "daily_cost", true, "", scope, key},
+			{true, "requests", 1, int64(limit.MonthlyRequests), "monthly_requests", false, "", scope, key},
+			{true, "tokens", tokens, int64(limit.MonthlyTokens), "monthly_tokens", false, "", scope, key},
+			{true, "cost", cost, limit.MonthlyCost.Units(), "monthly_cost", true, "", scope, key},
+		} {
+			if c.limit > 0 {
+				c.field = quotaField(usageKey, c.field)
+				checks = append(checks, c)
+			}
+		}
+	}
+	if limit, ok := limits.Models[r.ModelID]; ok {
+		scoped("model", r.ModelID, r.ModelID, limit)
+	}
+	if limit, ok := limits.Categories[r.Category]; ok && r.Category != "" {
+		scoped("category", r.Category, model.CategoryUsageKey(r.Category), limit)
+	}
+	return checks
+}
+
+// reserveQuota checks the call against the user's limits and counts its
+// estimated usage in one step, so that concurrent calls cannot together pass
+// a limit
+func (s *quotaService) reserveQuota(ctx context.Context, quota *model.UserQuota, userID, modelID string, tokens int, cost money.Amount, now time.Time) (*QuotaCheckResult, error) {
+	limits, err := model.ModelLimitsFromJSONB(quota.ModelLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse model limits: %w", err)
+	}
+	category, err := s.modelCategory(ctx, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	window := quotaWindowAt(now, quota.Timezone, quota.ResetDay)
+	reservation := &QuotaReservation{
+		UserID:    userID,
+		ModelID:   modelID,
+		Category:  category,
+		Date:      window.date,
+		YearMonth: window.yearMonth,
+		Tokens:    tokens,
+		Cost:      cost,
+		Counted:   true,
+	}
+	checks := quotaLimitChecks(quota, limits, reservation)
+
+	args := []interface{}{len(checks)}
+	for _, c := range checks {
+		window := 1
+		if c.monthly {
+			window = 2
+		}
+		args = append(args, window, c.field, c.amount, c.limit)
+	}
+	args = append(args, reservation.counterArgs(1, int64(tokens), cost)...)
+
+	for attempt := 0; attempt < quotaSeedAttempts; attempt++ {
+		if err := s.seedQuotaCounters(ctx, reservation, window.dayEnd, window.monthEnd); err != nil {
+			return nil, err
+		}
+
+		values, err := quotaUsageScript.Run(ctx, s.redisClient.Client, reservation.counterKeys(), args...).Int64Slice()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve quota: %w", err)
+		}
+		if values[0] == -1 {
+			continue
+		}
+
+		result := &QuotaCheckResult{
+			Allowed:              true,
+			DailyRequests:        int(values[3]),
+			DailyRequestsLimit:   quota.DailyRequestLimit,
+			DailyTokens:          int(values[4]),
+			DailyTokensLimit:     quota.DailyTokenLimit,
+			DailyCost:            money.Amount(values[5]),
+			DailyCostLimit:       quota.DailyCostLimit,
+			MonthlyRequests:      int(values[6]),
+			MonthlyRequestsLimit: quota.MonthlyRequestLimit,
+			MonthlyTokens:        int(values[7]),
+			MonthlyTokensLimit:   quota.MonthlyTokenLimit,
+			MonthlyCost:          money.Amount(values[8]),
+			MonthlyCostLimit:     quota.MonthlyCostLimit,
+			NextReset:            window.dayEnd,
+		}
+		if values[0] == 1 {
+			// The usage is counted either way, so the call goes ahead
+			if err := s.markQuotaPending(ctx, reservation); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+			result.Reservation = reservation
+			return result, nil
+		}
+
+		failed := checks[values[1]-1]
+		result.Allowed = false
+		result.Reason = failed.reason
+		if failed.scope != "" {
+			exceeded := &ModelLimitExceeded{
+				Scope:     failed.scope,
+				Key:       failed.key,
+				LimitType: failed.limitType,
+				Used:      float64(values[2]),
+				Limit:     float64(failed.limit),
+			}
+			if failed.cost {
+				exceeded.Used = money.Amount(values[2]).Float64()
+				exceeded.Limit = money.Amount(failed.limit).Float64()
+			}
+			result.Reason = fmt.Sprintf("%s limit exceeded for %s %s", strings.ReplaceAll(failed.limitType, "_", " "), failed.scope, failed.key)
+			result.ModelLimit = exceeded
+		}
+		if failed.monthly {
+			result.NextReset = window.monthEnd
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("quota counters kept expiring while reserving")
+}
+
+// counterKeys are the daily and monthly totals of the reservation's windows,
+// then their pending usage
+func (r *QuotaReservation) counterKeys() []string {
+	dayTotals, dayPending := quotaCounterKeys(r.UserID, quotaDay, r.Date)
+	monthTotals, monthPending := quotaCounterKeys(r.UserID, quotaMonth, r.YearMonth)
+	return []string{dayTotals, monthTotals, dayPending, monthPending}
+}
+
+// seedQuotaCounters loads the totals of the reservation's windows from the
+// database when they are missing from Redis
+func (s *quotaService) seedQuotaCounters(ctx context.Context, r *QuotaReservation, dayEnd, monthEnd time.Time) error {
+	keys := r.counterKeys()
+	exists := make([]*redis.IntCmd, 2)
+	_, err := s.redisClient.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := range exists {
+			exists[i] = pipe.Exists(ctx, keys[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check quota counters: %w", err)
+	}
+
+	if exists[0].Val() == 0 {
+		date, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			return fmt.Errorf("invalid quota window %q: %w", r.Date, err)
+		}
+		usage, err := s.usageRepo.FindByUserAndDate(ctx, r.UserID, date)
+		if err != nil {
+			return fmt.Errorf("failed to get daily usage: %w", err)
+		}
+		if err := s.seedQuotaWindow(ctx, keys[0], dayEnd, usage.RequestCount, usage.TokenCount, usage.TotalCost, usage.ModelUsage); err != nil {
+			return err
+		}
+	}
+	if exists[1].Val() == 0 {
+		usage, err := s.monthlyRepo.FindByUserAndMonth(ctx, r.UserID, r.YearMonth)
+		if err != nil {
+			return fmt.Errorf("failed to get monthly usage: %w", err)
+		}
+		if err := s.seedQuotaWindow(ctx, keys[1], monthEnd, usage.RequestCount, usage.TokenCount, usage.TotalCost, usage.ModelUsage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *quotaService) seedQuotaWindow(ctx context.Context, key string, end time.Time, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error {
+	args := []interface{}{end.Add(quotaCounterGrace).UnixMilli(), "requests", requests, "tokens", tokens, "cost", cost.Units()}
+	for usageKey := range modelUsage {
+		entry := model.ModelUsageEntryFromJSONB(modelUsage, usageKey)
+		args = append(args,
+			quotaField(usageKey, "requests"), entry.Requests,
+			quotaField(usageKey, "tokens"), entry.Tokens,
+			quotaField(usageKey, "cost"), entry.Cost.Units(),
+		)
+	}
+	if err := seedQuotaScript.Run(ctx, s.redisClient.Client, []string{key}, args...).Err(); err != nil {
+		return fmt.Errorf("failed to seed quota counters: %w", err)
+	}
+	return nil
+}
+
+// adjustQuotaCounters adds usage to the counters of a reservation's windows
+// without checking it
+func (s *quotaService) adjustQuotaCounters(ctx context.Context, r *QuotaReservation, requests, tokens int64, cost money.Amount) error {
+	args := r.counterArgs(requests, tokens, cost)
+	if len(args) == 0 {
+		return nil
+	}
+	args = append([]interface{}{0}, args...)
+	if err := quotaUsageScript.Run(ctx, s.redisClient.Client, r.counterKeys(), args...).Err(); err != nil {
+		return fmt.Errorf("failed to adjust quota counters: %w", err)
+	}
+	return s.markQuotaPending(ctx, r)
+}
+
+// markQuotaPending queues the reservation's windows for the next flush
+func (s *quotaService) markQuotaPending(ctx context.Context, r *QuotaReservation) error {
+	err := s.redisClient.Client.SAdd(ctx, quotaPendingKey,
+		quotaDay+"|"+r.UserID+"|"+r.Date,
+		quotaMonth+"|"+r.UserID+"|"+r.YearMonth,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("failed to queue quota usage: %w", err)
+	}
+	return nil
+}
+
+// clearQuotaCounters drops a window's counters, along with its usage not yet
+// written to the database
+func (s *quotaService) clearQuotaCounters(ctx context.Context, userID, period, window string) error {
+	if s.redisClient == nil {
+		return nil
+	}
+	totals, pending := quotaCounterKeys(userID, period, window)
+	flushing := quotaFlushingKey(userID, period, window)
+	if err := s.redisClient.Client.Del(ctx, totals, pending, flushing).Err(); err != nil {
+		return fmt.Errorf("failed to clear quota counters: %w", err)
+	}
+	return nil
+}
+
+// flushUsage writes the usage counted since the last flush to the database.
+// Windows that fail to be written keep their usage for the next flush.
+func (s *quotaService) flushUsage(ctx context.Context) {
+	var failed []interface{}
+	for {
+		windows, err := s.redisClient.Client.SPopN(ctx, quotaPendingKey, quotaFlushBatch).Result()
+		if err != nil {
+			fmt.Printf("Failed to take pending quota usage: %v\n", err)
+			break
+		}
+		for _, window := range windows {
+			if err := s.flushWindow(ctx, window); err != nil {
+				fmt.Printf("Failed to flush quota usage of %s: %v\n", window, err)
+				failed = append(failed, window)
+			}
+		}
+		if len(windows) < quotaFlushBatch {
+			break
+		}
+	}
+
+	if len(failed) > 0 {
+		if err := s.redisClient.Client.SAdd(ctx, quotaPendingKey, failed...).Err(); err != nil {
+			fmt.Printf("Failed to requeue quota usage: %v\n", err)
+		}
+	}
+}
+
+// flushWindow writes the pending usage of one window to the database. The
+// usage is moved to the window's flushing key first and deleted only once it
+// is written, so usage a failed or interrupted flush took is written by a
+// later one.
+func (s *quotaService) flushWindow(ctx context.Context, window string) error {
+	parts := strings.SplitN(window, "|", 3)
+	if len(parts) != 3 {
+		// Nothing can be done with it, so it is dropped
+		fmt.Printf("Dropping malformed pending quota window %q\n", window)
+		return nil
+	}
+	period, userID, name := parts[0], parts[1], parts[2]
+	if period != quotaDay && period != quotaMonth {
+		fmt.Printf("Dropping pending quota usage of unknown window %q\n", window)
+		return nil
+	}
+	_, pendingKey := quotaCounterKeys(userID, period, name)
+	flushingKey := quotaFlushingKey(userID, period, name)
+
+	now := time.Now()
+	lease := strconv.FormatInt(now.Add(quotaFlushLease).UnixMilli(), 10)
+	values, err := takePendingScript.Run(ctx, s.redisClient.Client, []string{pendingKey, flushingKey},
+		now.UnixMilli(), lease).StringSlice()
+	if err != nil {
+		return fmt.Errorf("failed to take pending usage: %w", err)
+	}
+	if values[0] == "0" {
+		return fmt.Errorf("another flush is writing its usage")
+	}
+	if len(values) == 1 {
+		return nil
+	}
+
+	pending := make(map[string]int64, len(values)/2)
+	for i := 1; i+1 < len(values); i += 2 {
+		pending[values[i]], _ = strconv.ParseInt(values[i+1], 10, 64)
+	}
+	requests, tokens, cost, modelUsage := pendingUsage(pending)
+
+	if period == quotaDay {
+		var date time.Time
+		if date, err = time.Parse("2006-01-02", name); err == nil {
+			err = s.usageRepo.IncrementUsage(ctx, userID, date, requests, tokens, cost, modelUsage)
+		}
+	} else {
+		err = s.monthlyRepo.IncrementUsage(ctx, userID, name, requests, tokens, cost, modelUsage)
+	}
+
+	written := 0
+	if err == nil {
+		written = 1
+	}
+	held, endErr := endFlushScript.Run(ctx, s.redisClient.Client, []string{flushingKey}, lease, written).Int()
+	switch {
+	case err != nil:
+		return err
+	case endErr != nil:
+		// The usage stays in the flushing key and is written again
+		return fmt.Errorf("failed to clear flushed usage: %w", endErr)
+	case held == 0:
+		fmt.Printf("Quota usage of %s took longer than its lease to flush and may be counted twice\n", window)
+	}
+	return nil
+}
+
+// requeueFlushingUsage queues the windows whose usage a flush took but did
+// not finish writing, as when an instance stopped mid-flush
+func (s *quotaService) requeueFlushingUsage(ctx context.Context) error {
+	iter := s.redisClient.Client.Scan(ctx, 0, "quota:{*}:*:flushing", quotaFlushBatch).Iterator()
+	var windows []interface{}
+	for iter.Next(ctx) {
+		if window, ok := quotaFlushingWindow(iter.Val()); ok {
+			windows = append(windows, window)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to find flushing quota usage: %w", err)
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+	if err := s.redisClient.Client.SAdd(ctx, quotaPendingKey, windows...).Err(); err != nil {
+		return fmt.Errorf("failed to queue flushing quota usage: %w", err)
+	}
+	fmt.Printf("Queued %d quota windows left mid-flush\n", len(windows))
+	return nil
+}
+
+// pendingUsage turns the fields of a window's pending usage back into the
+// increments of its usage row
+func pendingUsage(pending map[string]int64) (requests, tokens int, cost money.Amount, modelUsage model.JSONB) {
+	var totals model.ModelUsageEntry
+	entries := make(map[string]*model.ModelUsageEntry)
+	for field, amount := range pending {
+		entry, name := &totals, field
+		if i := strings.LastIndex(field, "|"); i >= 0 {
+			usageKey := field[:i]
+			if entries[usageKey] == nil {
+				entries[usageKey] = &model.ModelUsageEntry{}
+			}
+			entry, name = entries[usageKey], field[i+1:]
+		}
+		switch name {
+		case "requests":
+			entry.Requests += int(amount)
+		case "tokens":
+			entry.Tokens += int(amount)
+		case "cost":
+			entry.Cost += money.Amount(amount)
+		}
+	}
+
+	modelUsage = model.JSONB{}
+	for usageKey, entry := range entries {
+		modelUsage[usageKey] = model.JSONB{
+			"requests": entry.Requests,
+			"tokens":   entry.Tokens,
+			"cost":     entry.Cost,
+		}
+	}
+	return totals.Requests, totals.Tokens, totals.Cost, modelUsage
+}
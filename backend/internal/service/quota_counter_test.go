@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
+)
+
+func TestQuotaLimitChecks(t *testing.T) {
+	quota := model.DefaultQuota()
+	limits := &model.ModelLimits{
+		Models:     map[string]model.ModelLimit{"gpt-4o": {DailyRequests: 5}},
+		Categories: map[string]model.ModelLimit{"premium": {MonthlyCost: money.FromInt(20)}},
+	}
+	r := &QuotaReservation{ModelID: "gpt-4o", Category: "premium", Tokens: 100, Cost: money.MustParse("0.5")}
+
+	checks := quotaLimitChecks(&quota, limits, r)
+	want := []struct {
+		field     string
+		limitType string
+		monthly   bool
+	}{
+		{"requests", "daily_requests", false},
+		{"tokens", "daily_tokens", false},
+		{"cost", "daily_cost", false},
+		{"requests", "monthly_requests", true},
+		{"tokens", "monthly_tokens", true},
+		{"cost", "monthly_cost", true},
+		// Zero caps of model limits are left out
+		{"gpt-4o|requests", "daily_requests", false},
+		{"category:premium|cost", "monthly_cost", true},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("quotaLimitChecks() returned %d checks, want %d", len(checks), len(want))
+	}
+	for i, w := range want {
+		c := checks[i]
+		if c.field != w.field || c.limitType != w.limitType || c.monthly != w.monthly {
+			t.Errorf("check %d = %s %s (monthly %v), want %s %s (monthly %v)", i, c.field, c.limitType, c.monthly, w.field, w.limitType, w.monthly)
+		}
+	}
+	if checks[2].amount != money.MustParse("0.5").Units() || checks[7].limit != money.FromInt(20).Units() {
+		t.Errorf("cost checks are not in money units: %+v, %+v", checks[2], checks[7])
+	}
+}
+
+func TestPendingUsage(t *testing.T) {
+	r := &QuotaReservation{ModelID: "gpt-4o", Category: "premium", Tokens: 100, Cost: money.MustParse("0.5")}
+
+	// A reservation, then its correction to fewer tokens at a higher cost
+	pending := make(map[string]int64)
+	for _, args := range [][]interface{}{
+		r.counterArgs(1, 100, money.MustParse("0.5")),
+		r.counterArgs(0, -40, money.MustParse("0.25")),
+	} {
+		for i := 0; i < len(args); i += 2 {
+			pending[args[i].(string)] += args[i+1].(int64)
+		}
+	}
+
+	requests, tokens, cost, modelUsage := pendingUsage(pending)
+	if requests != 1 || tokens != 60 || cost != money.MustParse("0.75") {
+		t.Errorf("pendingUsage() totals = %d, %d, %s, want 1, 60, 0.75", requests, tokens, cost)
+	}
+	for _, key := range []string{"gpt-4o", "category:premium"} {
+		entry := model.ModelUsageEntryFromJSONB(modelUsage, key)
+		if entry.Requests != 1 || entry.Tokens != 60 || entry.Cost != money.MustParse("0.75") {
+			t.Errorf("pendingUsage() %s = %+v, want 1 request, 60 tokens, 0.75", key, entry)
+		}
+	}
+}
+
+func TestSettleQuotaWithoutRedis(t *testing.T) {
+	ctx := context.Background()
+	userID := "test-user-settle"
+
+	usageRepo := &mockUserUsageRepository{dailyUsage: make(map[string]*model.UserUsage)}
+	monthlyRepo := &mockMonthlyUsageRepository{monthlyUsage: make(map[string]*model.MonthlyUsage)}
+	service := &quotaService{
+		quotaRepo:   &mockUserQuotaRepository{quotas: make(map[string]*model.UserQuota)},
+		usageRepo:   usageRepo,
+		monthlyRepo: monthlyRepo,
+	}
+
+	result, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
+	if err != nil {
+		t.Fatalf("CheckQuota failed: %v", err)
+	}
+	if !result.Allowed || result.Reservation == nil || result.Reservation.Counted {
+		t.Fatalf("CheckQuota() = %+v, want an allowed call with an uncounted reservation", result)
+	}
+
+	// Nothing was counted, so releasing changes nothing and settling records
+	// the actual usage
+	if err := service.ReleaseQuota(ctx, result.Reservation); err != nil {
+		t.Fatalf("ReleaseQuota failed: %v", err)
+	}
+	if err := service.SettleQuota(ctx, result.Reservation, 80, money.MustParse("0.4")); err != nil {
+		t.Fatalf("SettleQuota failed: %v", err)
+	}
+
+	daily, _ := usageRepo.FindByUserAndDate(ctx, userID, time.Now())
+	if daily.RequestCount != 1 || daily.TokenCount != 80 || daily.TotalCost != money.MustParse("0.4") {
+		t.Errorf("daily usage = %d requests, %d tokens, %s, want 1, 80, 0.4", daily.RequestCount, daily.TokenCount, daily.TotalCost)
+	}
+}
+
+func TestQuotaFlushingWindow(t *testing.T) {
+	for _, period := range []struct{ name, window string }{{quotaDay, "2026-10-16"}, {quotaMonth, "2026-10"}} {
+		key := quotaFlushingKey("user-1", period.name, period.window)
+		window, ok := quotaFlushingWindow(key)
+		if want := period.name + "|user-1|" + period.window; !ok || window != want {
+			t.Errorf("quotaFlushingWindow(%q) = %q, %v, want %q", key, window, ok, want)
+		}
+	}
+
+	for _, key := range []string{
+		"quota:{user-1}:day:2026-10-16",
+		"quota:{user-1}:day:2026-10-16:pending",
+		"quota:{user-1}:flushing",
+		"quota:{}:day:2026-10-16:flushing",
+		"quota:pending",
+	} {
+		if window, ok := quotaFlushingWindow(key); ok {
+			t.Errorf("quotaFlushingWindow(%q) = %q, want no window", key, window)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+)
+
+const (
+	// How often ended quota windows are looked for
+	quotaRolloverInterval = time.Minute
+	// Time calls that started before a window ended get to settle into it
+	// before it is snapshotted
+	quotaRolloverDelay = 5 * time.Minute
+	// How far back windows that ended while no instance was running are
+	// still rolled over
+	quotaRolloverLookbackDays   = 31
+	quotaRolloverLookbackMonths = 12
+)
+
+func (s *quotaService) StartQuotaJobs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobsRunning {
+		return
+	}
+	s.jobsRunning = true
+	s.stopChan = make(chan struct{})
+	s.jobs.Add(1)
+	go s.runQuotaJobs(s.stopChan)
+}
+
+// StopQuotaJobs stops the jobs after a last flush, so that usage counted
+// before shutdown reaches the database
+func (s *quotaService) StopQuotaJobs() {
+	s.mu.Lock()
+	if !s.jobsRunning {
+		s.mu.Unlock()
+		return
+	}
+	close(s.stopChan)
+	s.jobsRunning = false
+	s.mu.Unlock()
+
+	s.jobs.Wait()
+}
+
+func (s *quotaService) runQuotaJobs(stop <-chan struct{}) {
+	defer s.jobs.Done()
+
+	// Without Redis, usage is written to the database as it is recorded
+	var flush <-chan time.Time
+	if s.redisClient != nil {
+		if err := s.requeueFlushingUsage(context.Background()); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		ticker := time.NewTicker(s.flushInterval)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	rollover := time.NewTicker(quotaRolloverInterval)
+	defer rollover.Stop()
+
+	for {
+		select {
+		case <-stop:
+			if s.redisClient != nil {
+				s.flushUsage(context.Background())
+			}
+			return
+		case <-flush:
+			s.flushUsage(context.Background())
+		case now := <-rollover.C:
+			if _, err := s.rolloverQuotas(context.Background(), now); err != nil {
+				fmt.Printf("Failed to roll over quotas: %v\n", err)
+			}
+		}
+	}
+}
+
+// rolloverQuotas snapshots, for every active quota, the days and billing
+// cycles that ended in the quota's timezone since the last ones rolled over,
+// including those missed while no instance was running. Windows without usage
+// are skipped. Every instance runs this, and the snapshot table keeps one
+// rollover per window. It returns the number of snapshots recorded.
+func (s *quotaService) rolloverQuotas(ctx context.Context, now time.Time) (int, error) {
+	if s.snapshotRepo == nil {
+		return 0, nil
+	}
+	quotas, err := s.quotaRepo.FindActiveQuotas(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get active quotas: %w", err)
+	}
+	if s.rolledOver == nil {
+		s.rolledOver = make(map[string]string)
+	}
+
+	recorded := 0
+	for _, quota := range quotas {
+		window := quotaWindowAt(now, quota.Timezone, quota.ResetDay)
+
+		if now.Sub(window.dayStart) >= quotaRolloverDelay {
+			n, err := s.rolloverDays(ctx, quota, window)
+			recorded += n
+			if err != nil {
+				fmt.Printf("Failed to roll over daily quota of user %s: %v\n", quota.UserID, err)
+			}
+		}
+
+		if now.Sub(window.monthStart) >= quotaRolloverDelay {
+			n, err := s.rolloverMonths(ctx, quota, window)
+			recorded += n
+			if err != nil {
+				fmt.Printf("Failed to roll over monthly quota of user %s: %v\n", quota.UserID, err)
+			}
+		}
+	}
+	return recorded, nil
+}
+
+// lastRollover returns the newest window of a period rolled over for a user,
+// or "" if there is none
+func (s *quotaService) lastRollover(ctx context.Context, userID, period string) (string, error) {
+	if bucket, ok := s.rolledOver[userID+"|"+period]; ok {
+		return bucket, nil
+	}
+	return s.snapshotRepo.FindLatestBucket(ctx, userID, period)
+}
+
+// rolloverDays snapshots, oldest first, the days before the current one back
+// to the last day rolled over, or at most quotaRolloverLookbackDays. Failed
+// rollovers are tried again on the next run.
+func (s *quotaService) rolloverDays(ctx context.Context, quota *model.UserQuota, current quotaWindow) (int, error) {
+	last, err := s.lastRollover(ctx, quota.UserID, model.QuotaPeriodDaily)
+	if err != nil {
+		return 0, err
+	}
+	var ended []quotaWindow
+	for w := current.previousDay(quota.Timezone, quota.ResetDay); w.date > last && len(ended) < quotaRolloverLookbackDays; w = w.previousDay(quota.Timezone, quota.ResetDay) {
+		ended = append(ended, w)
+	}
+	if len(ended) == 0 {
+		return 0, nil
+	}
+
+	for _, w := range ended {
+		if err := s.flushPendingUsage(ctx, quotaDay, quota.UserID, w.date); err != nil {
+			return 0, err
+		}
+	}
+	newest, oldest := ended[0], ended[len(ended)-1]
+	rows, err := s.usageRepo.GetUsageForPeriod(ctx, quota.UserID, oldest.dayStart, newest.dayStart)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get daily usage: %w", err)
+	}
+	usage := make(map[string]*model.UserUsage, len(rows))
+	for _, row := range rows {
+		usage[row.Date.Format("2006-01-02")] = row
+	}
+
+	recorded := 0
+	for i := len(ended) - 1; i >= 0; i-- {
+		u, ok := usage[ended[i].date]
+		if !ok {
+			continue
+		}
+		ok, err := s.recordSnapshot(ctx, dailySnapshot(quota, ended[i], u, model.QuotaSnapshotRollover))
+		if err != nil {
+			return recorded, err
+		}
+		if ok {
+			recorded++
+		}
+	}
+	s.rolledOver[quota.UserID+"|"+model.QuotaPeriodDaily] = newest.date
+	return recorded, nil
+}
+
+// rolloverMonths snapshots, oldest first, the billing cycles before the
+// current one back to the last cycle rolled over, or at most
+// quotaRolloverLookbackMonths. Failed rollovers are tried again on the next
+// run.
+func (s *quotaService) rolloverMonths(ctx context.Context, quota *model.UserQuota, current quotaWindow) (int, error) {
+	last, err := s.lastRollover(ctx, quota.UserID, model.QuotaPeriodMonthly)
+	if err != nil {
+		return 0, err
+	}
+	var ended []quotaWindow
+	for w := current.previousMonth(quota.Timezone, quota.ResetDay); w.yearMonth > last && len(ended) < quotaRolloverLookbackMonths; w = w.previousMonth(quota.Timezone, quota.ResetDay) {
+		ended = append(ended, w)
+	}
+	if len(ended) == 0 {
+		return 0, nil
+	}
+
+	for _, w := range ended {
+		if err := s.flushPendingUsage(ctx, quotaMonth, quota.UserID, w.yearMonth); err != nil {
+			return 0, err
+		}
+	}
+	newest, oldest := ended[0], ended[len(ended)-1]
+	rows, err := s.monthlyRepo.GetUsageForMonths(ctx, quota.UserID, oldest.yearMonth, newest.yearMonth)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get monthly usage: %w", err)
+	}
+	usage := make(map[string]*model.MonthlyUsage, len(rows))
+	for _, row := range rows {
+		usage[row.YearMonth] = row
+	}
+
+	recorded := 0
+	for i := len(ended) - 1; i >= 0; i-- {
+		u, ok := usage[ended[i].yearMonth]
+		if !ok {
+			continue
+		}
+		ok, err := s.recordSnapshot(ctx, monthlySnapshot(quota, ended[i], u, model.QuotaSnapshotRollover))
+		if err != nil {
+			return recorded, err
+		}
+		if ok {
+			recorded++
+		}
+	}
+	s.rolledOver[quota.UserID+"|"+model.QuotaPeriodMonthly] = newest.yearMonth
+	return recorded, nil
+}
+
+// snapshotDailyUsage records the usage of the window's day, including usage
+// still pending in Redis, and returns its usage row
+func (s *quotaService) snapshotDailyUsage(ctx context.Context, quota *model.UserQuota, window quotaWindow, reason string) (*model.UserUsage, error) {
+	if err := s.flushPendingUsage(ctx, quotaDay, quota.UserID, window.date); err != nil {
+		return nil, err
+	}
+	usage, err := s.usageRepo.FindByUserAndDate(ctx, quota.UserID, window.dayStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily usage: %w", err)
+	}
+	if _, err := s.recordSnapshot(ctx, dailySnapshot(quota, window, usage, reason)); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// snapshotMonthlyUsage records the usage of the window's billing cycle,
+// including usage still pending in Redis, and returns its usage row
+func (s *quotaService) snapshotMonthlyUsage(ctx context.Context, quota *model.UserQuota, window quotaWindow, reason string) (*model.MonthlyUsage, error) {
+	if err := s.flushPendingUsage(ctx, quotaMonth, quota.UserID, window.yearMonth); err != nil {
+		return nil, err
+	}
+	usage, err := s.monthlyRepo.FindByUserAndMonth(ctx, quota.UserID, window.yearMonth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monthly usage: %w", err)
+	}
+	if _, err := s.recordSnapshot(ctx, monthlySnapshot(quota, window, usage, reason)); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// flushPendingUsage writes a window's usage counted in Redis to the database
+// ahead of the next flush
+func (s *quotaService) flushPendingUsage(ctx context.Context, period, userID, bucket string) error {
+	if s.redisClient == nil {
+		return nil
+	}
+	return s.flushWindow(ctx, period+"|"+userID+"|"+bucket)
+}
+
+// recordSnapshot stores a snapshot, if there is somewhere to keep it
+func (s *quotaService) recordSnapshot(ctx context.Context, snapshot *model.QuotaSnapshot) (bool, error) {
+	if s.snapshotRepo == nil {
+		return false, nil
+	}
+	snapshot.IsExceeded = snapshot.RequestCount > snapshot.RequestLimit ||
+		snapshot.TokenCount > snapshot.TokenLimit ||
+		snapshot.TotalCost > snapshot.CostLimit
+	if snapshot.ModelUsage == nil {
+		snapshot.ModelUsage = model.JSONB{}
+	}
+	return s.snapshotRepo.Record(ctx, snapshot)
+}
+
+func dailySnapshot(quota *model.UserQuota, window quotaWindow, usage *model.UserUsage, reason string) *model.QuotaSnapshot {
+	return &model.QuotaSnapshot{
+		UserID:       quota.UserID,
+		Period:       model.QuotaPeriodDaily,
+		Bucket:       window.date,
+		Reason:       reason,
+		Timezone:     quota.Timezone,
+		StartsAt:     window.dayStart,
+		EndsAt:       window.dayEnd,
+		RequestCount: usage.RequestCount,
+		TokenCount:   usage.TokenCount,
+		TotalCost:    usage.TotalCost,
+		ModelUsage:   usage.ModelUsage,
+		RequestLimit: quota.DailyRequestLimit,
+		TokenLimit:   quota.DailyTokenLimit,
+		CostLimit:    quota.DailyCostLimit,
+	}
+}
+
+func monthlySnapshot(quota *model.UserQuota, window quotaWindow, usage *model.MonthlyUsage, reason string) *model.QuotaSnapshot {
+	return &model.QuotaSnapshot{
+		UserID:       quota.UserID,
+		Period:       model.QuotaPeriodMonthly,
+		Bucket:       window.yearMonth,
+		Reason:       reason,
+		Timezone:     quota.Timezone,
+		StartsAt:     window.monthStart,
+		EndsAt:       window.monthEnd,
+		RequestCount: usage.RequestCount,
+		TokenCount:   usage.TokenCount,
+		TotalCost:    usage.TotalCost,
+		ModelUsage:   usage.ModelUsage,
+		RequestLimit: quota.MonthlyRequestLimit,
+		TokenLimit:   quota.MonthlyTokenLimit,
+		CostLimit:    quota.MonthlyCostLimit,
+	}
+}
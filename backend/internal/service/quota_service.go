@@ -3,27 +3,55 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"massrouter.ai/backend/internal/model"
 	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/cache"
+	"massrouter.ai/backend/pkg/money"
 )
 
 type quotaService struct {
-	quotaRepo   repository.UserQuotaRepository
-	usageRepo   repository.UserUsageRepository
-	monthlyRepo repository.MonthlyUsageRepository
+	quotaRepo    repository.UserQuotaRepository
+	usageRepo    repository.UserUsageRepository
+	monthlyRepo  repository.MonthlyUsageRepository
+	snapshotRepo repository.QuotaSnapshotRepository
+	modelRepo    repository.ModelRepository
+	redisClient  *cache.RedisClient
+
+	// Usage counted in Redis is written to the database every flushInterval
+	flushInterval time.Duration
+	mu            sync.Mutex
+	jobsRunning   bool
+	stopChan      chan struct{}
+	jobs          sync.WaitGroup
+
+	// Last window rolled over per user and period, only touched by the jobs
+	rolledOver map[string]string
 }
 
 func NewQuotaService(
 	quotaRepo repository.UserQuotaRepository,
 	usageRepo repository.UserUsageRepository,
 	monthlyRepo repository.MonthlyUsageRepository,
+	snapshotRepo repository.QuotaSnapshotRepository,
+	modelRepo repository.ModelRepository,
+	redisClient *cache.RedisClient,
+	flushInterval time.Duration,
 ) QuotaService {
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Second
+	}
 	return &quotaService{
-		quotaRepo:   quotaRepo,
-		usageRepo:   usageRepo,
-		monthlyRepo: monthlyRepo,
+		quotaRepo:     quotaRepo,
+		usageRepo:     usageRepo,
+		monthlyRepo:   monthlyRepo,
+		snapshotRepo:  snapshotRepo,
+		modelRepo:     modelRepo,
+		redisClient:   redisClient,
+		flushInterval: flushInterval,
 	}
 }
 
@@ -67,13 +95,22 @@ func (s *quotaService) UpdateUserQuota(ctx context.Context, userID string, req *
 	if req.PerHourRateLimit != nil {
 		quota.PerHourRateLimit = *req.PerHourRateLimit
 	}
+	if req.PerMinuteTokenLimit != nil {
+		quota.PerMinuteTokenLimit = *req.PerMinuteTokenLimit
+	}
 	if req.ResetDay != nil {
 		quota.ResetDay = *req.ResetDay
 	}
 	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
 		quota.Timezone = req.Timezone
 	}
 	if req.ModelLimits != nil {
+		if _, err := model.ModelLimitsFromJSONB(req.ModelLimits); err != nil {
+			return fmt.Errorf("invalid model limits: %w", err)
+		}
 		quota.ModelLimits = req.ModelLimits
 	}
 	if req.IsActive != nil {
@@ -87,7 +124,7 @@ func (s *quotaService) UpdateUserQuota(ctx context.Context, userID string, req *
 	return nil
 }
 
-func (s *quotaService) CheckQuota(ctx context.Context, userID string, tokens int, cost float64) (*QuotaCheckResult, error) {
+func (s *quotaService) CheckQuota(ctx context.Context, userID string, modelID string, tokens int, cost money.Amount) (*QuotaCheckResult, error) {
 	// Get user quota
 	quota, err := s.quotaRepo.FindByUserID(ctx, userID)
 	if err != nil {
@@ -102,12 +139,27 @@ func (s *quotaService) CheckQuota(ctx context.Context, userID string, tokens int
 		}, nil
 	}
 
-	// Get today's date and current month
 	now := time.Now()
-	yearMonth := now.Format("2006-01")
+	if s.redisClient != nil {
+		result, err := s.reserveQuota(ctx, quota, userID, modelID, tokens, cost, now)
+		if err == nil {
+			return result, nil
+		}
+		// Concurrent calls are then only checked against stored usage, which
+		// each of them may see before the others are recorded
+		fmt.Printf("Checking quota against the database: %v\n", err)
+	}
+	return s.checkStoredQuota(ctx, quota, userID, modelID, tokens, cost, now)
+}
+
+// checkStoredQuota checks a call against the usage stored in the database,
+// reserving nothing
+func (s *quotaService) checkStoredQuota(ctx context.Context, quota *model.UserQuota, userID string, modelID string, tokens int, cost money.Amount, now time.Time) (*QuotaCheckResult, error) {
+	window := quotaWindowAt(now, quota.Timezone, quota.ResetDay)
+	yearMonth := window.yearMonth
 
 	// Get daily usage
-	dailyUsage, err := s.usageRepo.FindByUserAndDate(ctx, userID, now)
+	dailyUsage, err := s.usageRepo.FindByUserAndDate(ctx, userID, window.dayStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get daily usage: %w", err)
 	}
@@ -249,8 +301,7 @@ func (s *quotaService) CheckQuota(ctx context.Context, userID string, tokens int
 		}, nil
 	}
 
-	// All checks passed
-	return &QuotaCheckResult{
+	result := &QuotaCheckResult{
 		Allowed:              true,
 		DailyRequests:        dailyUsage.RequestCount,
 		DailyRequestsLimit:   quota.DailyRequestLimit,
@@ -265,24 +316,180 @@ func (s *quotaService) CheckQuota(ctx context.Context, userID string, tokens int
 		MonthlyCost:          monthlyUsage.TotalCost,
 		MonthlyCostLimit:     quota.MonthlyCostLimit,
 		NextReset:            s.getNextDailyReset(now, quota.Timezone),
-	}, nil
+	}
+
+	// Check per-model and per-category limits
+	exceeded, err := s.checkModelLimits(ctx, quota, modelID, dailyUsage.ModelUsage, monthlyUsage.ModelUsage, tokens, cost)
+	if err != nil {
+		return nil, err
+	}
+	if exceeded != nil {
+		result.Allowed = false
+		result.Reason = fmt.Sprintf("%s limit exceeded for %s %s", strings.ReplaceAll(exceeded.LimitType, "_", " "), exceeded.Scope, exceeded.Key)
+		result.ModelLimit = exceeded
+		if strings.HasPrefix(exceeded.LimitType, "monthly_") {
+			result.NextReset = s.getNextMonthlyReset(now, quota.ResetDay, quota.Timezone)
+		}
+		return result, nil
+	}
+
+	// The call's usage is recorded in full once it is settled
+	result.Reservation = &QuotaReservation{
+		UserID:    userID,
+		ModelID:   modelID,
+		Date:      window.date,
+		YearMonth: yearMonth,
+		Tokens:    tokens,
+		Cost:      cost,
+	}
+	return result, nil
 }
 
-func (s *quotaService) RecordUsage(ctx context.Context, userID string, modelID string, tokens int, cost float64) error {
-	now := time.Now()
-	yearMonth := now.Format("2006-01")
+func (s *quotaService) SettleQuota(ctx context.Context, reservation *QuotaReservation, tokens int, cost money.Amount) error {
+	if reservation == nil {
+		return nil
+	}
+	if !reservation.Counted {
+		quota, err := s.quotaRepo.FindByUserID(ctx, reservation.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get quota: %w", err)
+		}
+		date, err := time.Parse("2006-01-02", reservation.Date)
+		if err != nil {
+			return fmt.Errorf("invalid quota window %q: %w", reservation.Date, err)
+		}
+		return s.recordStoredUsage(ctx, quota, reservation.ModelID, date, reservation.YearMonth, tokens, cost)
+	}
+	return s.adjustQuotaCounters(ctx, reservation, 0, int64(tokens-reservation.Tokens), cost-reservation.Cost)
+}
+
+func (s *quotaService) ReleaseQuota(ctx context.Context, reservation *QuotaReservation) error {
+	if reservation == nil || !reservation.Counted {
+		return nil
+	}
+	return s.adjustQuotaCounters(ctx, reservation, -1, -int64(reservation.Tokens), -reservation.Cost)
+}
+
+// checkModelLimits returns the first per-model or per-category limit in the
+// quota that the call would exceed, or nil if there is none
+func (s *quotaService) checkModelLimits(ctx context.Context, quota *model.UserQuota, modelID string, dailyUsage, monthlyUsage model.JSONB, tokens int, cost money.Amount) (*ModelLimitExceeded, error) {
+	limits, err := model.ModelLimitsFromJSONB(quota.ModelLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse model limits: %w", err)
+	}
+	if limits.IsEmpty() {
+		return nil, nil
+	}
+
+	if limit, ok := limits.Models[modelID]; ok {
+		if exceeded := checkModelLimit("model", modelID, limit, dailyUsage, monthlyUsage, modelID, tokens, cost); exceeded != nil {
+			return exceeded, nil
+		}
+	}
+
+	if len(limits.Categories) > 0 {
+		category, err := s.modelCategory(ctx, modelID)
+		if err != nil {
+			return nil, err
+		}
+		if limit, ok := limits.Categories[category]; ok && category != "" {
+			usageKey := model.CategoryUsageKey(category)
+			if exceeded := checkModelLimit("category", category, limit, dailyUsage, monthlyUsage, usageKey, tokens, cost); exceeded != nil {
+				return exceeded, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// checkModelLimit projects the call onto the usage recorded under usageKey
+// and returns the first of the limit's caps it would exceed
+func checkModelLimit(scope, key string, limit model.ModelLimit, dailyUsage, monthlyUsage model.JSONB, usageKey string, tokens int, cost money.Amount) *ModelLimitExceeded {
+	daily := model.ModelUsageEntryFromJSONB(dailyUsage, usageKey)
+	monthly := model.ModelUsageEntryFromJSONB(monthlyUsage, usageKey)
+
+	// Caps are compared as integers, costs in money units, so a cost limit is
+	// hit exactly at the limit
+	checks := []struct {
+		limitType string
+		limit     int64
+		used      int64
+		add       int64
+		cost      bool
+	}{
+		{"daily_requests", int64(limit.DailyRequests), int64(daily.Requests), 1, false},
+		{"daily_tokens", int64(limit.DailyTokens), int64(daily.Tokens), int64(tokens), false},
+		{"daily_cost", limit.DailyCost.Units(), daily.Cost.Units(), cost.Units(), true},
+		{"monthly_requests", int64(limit.MonthlyRequests), int64(monthly.Requests), 1, false},
+		{"monthly_tokens", int64(limit.MonthlyTokens), int64(monthly.Tokens), int64(tokens), false},
+		{"monthly_cost", limit.MonthlyCost.Units(), monthly.Cost.Units(), cost.Units(), true},
+	}
+
+	for _, check := range checks {
+		if check.limit > 0 && check.used+check.add > check.limit {
+			exceeded := &ModelLimitExceeded{
+				Scope:     scope,
+				Key:       key,
+				LimitType: check.limitType,
+				Used:      float64(check.used),
+				Limit:     float64(check.limit),
+			}
+			if check.cost {
+				exceeded.Used = money.Amount(check.used).Float64()
+				exceeded.Limit = money.Amount(check.limit).Float64()
+			}
+			return exceeded
+		}
+	}
+	return nil
+}
+
+// modelCategory returns the model's category, or "" when models can't be looked up
+func (s *quotaService) modelCategory(ctx context.Context, modelID string) (string, error) {
+	if s.modelRepo == nil {
+		return "", nil
+	}
+	modelObj, err := s.modelRepo.FindByID(ctx, modelID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get model for quota check: %w", err)
+	}
+	return modelObj.Category, nil
+}
+
+func (s *quotaService) RecordUsage(ctx context.Context, userID string, modelID string, tokens int, cost money.Amount) error {
+	quota, err := s.quotaRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get quota: %w", err)
+	}
+	window := quotaWindowAt(time.Now(), quota.Timezone, quota.ResetDay)
+	return s.recordStoredUsage(ctx, quota, modelID, window.dayStart, window.yearMonth, tokens, cost)
+}
+
+// recordStoredUsage adds a call's usage to the user's stored usage of a day
+// and billing cycle
+func (s *quotaService) recordStoredUsage(ctx context.Context, quota *model.UserQuota, modelID string, date time.Time, yearMonth string, tokens int, cost money.Amount) error {
+	userID := quota.UserID
 
 	// Prepare model usage data
-	modelUsage := model.JSONB{
-		modelID: model.JSONB{
-			"requests": 1,
-			"tokens":   tokens,
-			"cost":     cost,
-		},
+	entry := model.JSONB{
+		"requests": 1,
+		"tokens":   tokens,
+		"cost":     cost,
+	}
+	modelUsage := model.JSONB{modelID: entry}
+
+	// Usage is also accumulated per category for category limits
+	category, err := s.modelCategory(ctx, modelID)
+	if err != nil {
+		return err
+	}
+	if category != "" {
+		modelUsage[model.CategoryUsageKey(category)] = entry
 	}
 
 	// Update daily usage
-	if err := s.usageRepo.IncrementUsage(ctx, userID, now, 1, tokens, cost, modelUsage); err != nil {
+	if err := s.usageRepo.IncrementUsage(ctx, userID, date, 1, tokens, cost, modelUsage); err != nil {
 		return fmt.Errorf("failed to update daily usage: %w", err)
 	}
 
@@ -292,12 +499,7 @@ func (s *quotaService) RecordUsage(ctx context.Context, userID string, modelID s
 	}
 
 	// Check if limits are exceeded and update is_exceeded flag
-	quota, err := s.quotaRepo.FindByUserID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get quota for exceeded check: %w", err)
-	}
-
-	dailyUsage, err := s.usageRepo.FindByUserAndDate(ctx, userID, now)
+	dailyUsage, err := s.usageRepo.FindByUserAndDate(ctx, userID, date)
 	if err != nil {
 		return fmt.Errorf("failed to get daily usage for exceeded check: %w", err)
 	}
@@ -358,14 +560,34 @@ func (s *quotaService) GetUsageHistory(ctx context.Context, userID string, start
 	return usage, nil
 }
 
+func (s *quotaService) GetQuotaSnapshots(ctx context.Context, userID string, limit, offset int) ([]*model.QuotaSnapshot, error) {
+	if s.snapshotRepo == nil {
+		return nil, nil
+	}
+	snapshots, err := s.snapshotRepo.FindByUserID(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// ResetDailyQuota clears the usage of the user's current day, keeping a
+// reset snapshot of it. Ended days need no reset: each window has usage rows
+// and counters of its own, which the rollover snapshots as they are.
 func (s *quotaService) ResetDailyQuota(ctx context.Context, userID string) error {
-	// Reset today's usage
-	now := time.Now()
+	quota, err := s.quotaRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get quota: %w", err)
+	}
 
-	// Get today's usage record
-	dailyUsage, err := s.usageRepo.FindByUserAndDate(ctx, userID, now)
+	// Reset today's usage, keeping a snapshot of what it was
+	window := quotaWindowAt(time.Now(), quota.Timezone, quota.ResetDay)
+	dailyUsage, err := s.snapshotDailyUsage(ctx, quota, window, model.QuotaSnapshotReset)
 	if err != nil {
-		return fmt.Errorf("failed to get daily usage: %w", err)
+		return err
+	}
+	if err := s.clearQuotaCounters(ctx, userID, quotaDay, window.date); err != nil {
+		return err
 	}
 
 	// Reset the usage
@@ -381,15 +603,22 @@ func (s *quotaService) ResetDailyQuota(ctx context.Context, userID string) error
 	return nil
 }
 
+// ResetMonthlyQuota clears the usage of the user's current billing cycle,
+// keeping a reset snapshot of it
 func (s *quotaService) ResetMonthlyQuota(ctx context.Context, userID string) error {
-	// Reset current month's usage
-	now := time.Now()
-	yearMonth := now.Format("2006-01")
+	quota, err := s.quotaRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get quota: %w", err)
+	}
 
-	// Get current month's usage record
-	monthlyUsage, err := s.monthlyRepo.FindByUserAndMonth(ctx, userID, yearMonth)
+	// Reset the billing cycle's usage, keeping a snapshot of what it was
+	window := quotaWindowAt(time.Now(), quota.Timezone, quota.ResetDay)
+	monthlyUsage, err := s.snapshotMonthlyUsage(ctx, quota, window, model.QuotaSnapshotReset)
 	if err != nil {
-		return fmt.Errorf("failed to get monthly usage: %w", err)
+		return err
+	}
+	if err := s.clearQuotaCounters(ctx, userID, quotaMonth, window.yearMonth); err != nil {
+		return err
 	}
 
 	// Reset the usage
@@ -406,58 +635,9 @@ func (s *quotaService) ResetMonthlyQuota(ctx context.Context, userID string) err
 }
 
 func (s *quotaService) getNextDailyReset(now time.Time, timezone string) time.Time {
-	// For simplicity, assume reset at midnight in the specified timezone
-	// In production, you'd use time.LoadLocation to handle timezone correctly
-	loc, err := time.LoadLocation(timezone)
-	if err != nil {
-		// Default to UTC if timezone is invalid
-		loc = time.UTC
-	}
-
-	// Get tomorrow's date at midnight
-	tomorrow := now.In(loc).Add(24 * time.Hour)
-	nextReset := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 0, 0, 0, loc)
-	return nextReset
+	return quotaWindowAt(now, timezone, 1).dayEnd
 }
 
 func (s *quotaService) getNextMonthlyReset(now time.Time, resetDay int, timezone string) time.Time {
-	loc, err := time.LoadLocation(timezone)
-	if err != nil {
-		loc = time.UTC
-	}
-
-	current := now.In(loc)
-	year := current.Year()
-	month := current.Month()
-
-	// Adjust reset day if it's beyond the last day of the month
-	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
-	actualResetDay := resetDay
-	if actualResetDay > lastDay {
-		actualResetDay = lastDay
-	}
-
-	// Calculate next reset date
-	resetDate := time.Date(year, month, actualResetDay, 0, 0, 0, 0, loc)
-
-	// If reset date has already passed this month, move to next month
-	if current.After(resetDate) || current.Equal(resetDate) {
-		// Move to next month
-		month++
-		if month > 12 {
-			month = 1
-			year++
-		}
-
-		// Recalculate last day for next month
-		lastDay = time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
-		actualResetDay = resetDay
-		if actualResetDay > lastDay {
-			actualResetDay = lastDay
-		}
-
-		resetDate = time.Date(year, month, actualResetDay, 0, 0, 0, 0, loc)
-	}
-
-	return resetDate
+	return quotaWindowAt(now, timezone, resetDay).monthEnd
 }
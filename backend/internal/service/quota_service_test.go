@@ -7,8 +7,23 @@ import (
 
 	"gorm.io/gorm"
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/money"
 )
 
+// usageCost reads a cost accumulated in a model usage map
+func usageCost(v interface{}) money.Amount {
+	switch val := v.(type) {
+	case money.Amount:
+		return val
+	case float64:
+		return money.FromFloat(val)
+	case int:
+		return money.FromInt(int64(val))
+	}
+	return 0
+}
+
 // Mock repositories for testing
 type mockUserQuotaRepository struct {
 	quotas map[string]*model.UserQuota
@@ -22,10 +37,10 @@ func (m *mockUserQuotaRepository) FindByUserID(ctx context.Context, userID strin
 			UserID:              userID,
 			DailyRequestLimit:   100,
 			DailyTokenLimit:     10000,
-			DailyCostLimit:      10.0,
+			DailyCostLimit:      money.FromInt(10),
 			MonthlyRequestLimit: 1000,
 			MonthlyTokenLimit:   100000,
-			MonthlyCostLimit:    100.0,
+			MonthlyCostLimit:    money.FromInt(100),
 			PerMinuteRateLimit:  10,
 			PerHourRateLimit:    100,
 			ResetDay:            1,
@@ -47,10 +62,10 @@ func (m *mockUserQuotaRepository) CreateDefaultQuota(ctx context.Context, userID
 		UserID:              userID,
 		DailyRequestLimit:   100,
 		DailyTokenLimit:     10000,
-		DailyCostLimit:      10.0,
+		DailyCostLimit:      money.FromInt(10),
 		MonthlyRequestLimit: 1000,
 		MonthlyTokenLimit:   100000,
-		MonthlyCostLimit:    100.0,
+		MonthlyCostLimit:    money.FromInt(100),
 		PerMinuteRateLimit:  10,
 		PerHourRateLimit:    100,
 		ResetDay:            1,
@@ -146,7 +161,7 @@ func (m *mockUserUsageRepository) FindByUserAndDate(ctx context.Context, userID
 	return usage, nil
 }
 
-func (m *mockUserUsageRepository) IncrementUsage(ctx context.Context, userID string, date time.Time, requests, tokens int, cost float64, modelUsage model.JSONB) error {
+func (m *mockUserUsageRepository) IncrementUsage(ctx context.Context, userID string, date time.Time, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error {
 	key := userID + "_" + date.Format("2006-01-02")
 	usage, exists := m.dailyUsage[key]
 	if !exists {
@@ -210,28 +225,8 @@ func (m *mockUserUsageRepository) IncrementUsage(ctx context.Context, userID str
 
 							merged[k] = existingVal + newValInt
 						case "cost":
-							// Accumulate floats
-							existingVal := 0.0
-							if v, ok := merged[k]; ok {
-								switch val := v.(type) {
-								case float64:
-									existingVal = val
-								case int:
-									existingVal = float64(val)
-								}
-							}
-
-							var newValFloat float64
-							switch val := newVal.(type) {
-							case float64:
-								newValFloat = val
-							case int:
-								newValFloat = float64(val)
-							default:
-								newValFloat = 0.0
-							}
-
-							merged[k] = existingVal + newValFloat
+							// Accumulate amounts
+							merged[k] = usageCost(merged[k]) + usageCost(newVal)
 						default:
 							merged[k] = newVal
 						}
@@ -384,7 +379,7 @@ func (m *mockMonthlyUsageRepository) FindByUserAndMonth(ctx context.Context, use
 	return usage, nil
 }
 
-func (m *mockMonthlyUsageRepository) IncrementUsage(ctx context.Context, userID, yearMonth string, requests, tokens int, cost float64, modelUsage model.JSONB) error {
+func (m *mockMonthlyUsageRepository) IncrementUsage(ctx context.Context, userID, yearMonth string, requests, tokens int, cost money.Amount, modelUsage model.JSONB) error {
 	key := userID + "_" + yearMonth
 	usage, exists := m.monthlyUsage[key]
 	if !exists {
@@ -448,28 +443,8 @@ func (m *mockMonthlyUsageRepository) IncrementUsage(ctx context.Context, userID,
 
 							merged[k] = existingVal + newValInt
 						case "cost":
-							// Accumulate floats
-							existingVal := 0.0
-							if v, ok := merged[k]; ok {
-								switch val := v.(type) {
-								case float64:
-									existingVal = val
-								case int:
-									existingVal = float64(val)
-								}
-							}
-
-							var newValFloat float64
-							switch val := newVal.(type) {
-							case float64:
-								newValFloat = val
-							case int:
-								newValFloat = float64(val)
-							default:
-								newValFloat = 0.0
-							}
-
-							merged[k] = existingVal + newValFloat
+							// Accumulate amounts
+							merged[k] = usageCost(merged[k]) + usageCost(newVal)
 						default:
 							merged[k] = newVal
 						}
@@ -564,6 +539,16 @@ func (m *mockMonthlyUsageRepository) FindByUserID(ctx context.Context, userID st
 	return result, nil
 }
 
+func (m *mockMonthlyUsageRepository) GetUsageForMonths(ctx context.Context, userID string, startMonth, endMonth string) ([]*model.MonthlyUsage, error) {
+	var result []*model.MonthlyUsage
+	for _, usage := range m.monthlyUsage {
+		if usage.UserID == userID && usage.YearMonth >= startMonth && usage.YearMonth <= endMonth {
+			result = append(result, usage)
+		}
+	}
+	return result, nil
+}
+
 func (m *mockMonthlyUsageRepository) GetMonthlySummary(ctx context.Context, yearMonth string) ([]*model.MonthlyUsage, error) {
 	var result []*model.MonthlyUsage
 	for _, usage := range m.monthlyUsage {
@@ -611,7 +596,7 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 
 	// Test 1: Check quota for new user (should pass)
 	t.Run("NewUserQuotaCheckPasses", func(t *testing.T) {
-		result, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("CheckQuota failed: %v", err)
 		}
@@ -636,10 +621,10 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 			UserID:              userID,
 			DailyRequestLimit:   2, // Very low
 			DailyTokenLimit:     10000,
-			DailyCostLimit:      10.0,
+			DailyCostLimit:      money.FromInt(10),
 			MonthlyRequestLimit: 1000,
 			MonthlyTokenLimit:   100000,
-			MonthlyCostLimit:    100.0,
+			MonthlyCostLimit:    money.FromInt(100),
 			PerMinuteRateLimit:  10,
 			PerHourRateLimit:    100,
 			ResetDay:            1,
@@ -648,7 +633,7 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 		}
 
 		// First request should pass
-		result1, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result1, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("First CheckQuota failed: %v", err)
 		}
@@ -657,12 +642,12 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 		}
 
 		// Record the usage (simulate a successful API call)
-		if err := service.RecordUsage(ctx, userID, "test-model", 100, 0.5); err != nil {
+		if err := service.RecordUsage(ctx, userID, "test-model", 100, money.MustParse("0.5")); err != nil {
 			t.Fatalf("RecordUsage failed: %v", err)
 		}
 
 		// Second request should also pass (2nd request, limit is 2)
-		result2, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result2, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("Second CheckQuota failed: %v", err)
 		}
@@ -671,12 +656,12 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 		}
 
 		// Record second usage
-		if err := service.RecordUsage(ctx, userID, "test-model", 100, 0.5); err != nil {
+		if err := service.RecordUsage(ctx, userID, "test-model", 100, money.MustParse("0.5")); err != nil {
 			t.Fatalf("RecordUsage failed: %v", err)
 		}
 
 		// Third request should fail (exceeds daily limit of 2)
-		result3, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result3, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("Third CheckQuota failed: %v", err)
 		}
@@ -694,10 +679,10 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 			UserID:              userID,
 			DailyRequestLimit:   100,
 			DailyTokenLimit:     10000,
-			DailyCostLimit:      10.0,
+			DailyCostLimit:      money.FromInt(10),
 			MonthlyRequestLimit: 1000,
 			MonthlyTokenLimit:   100000,
-			MonthlyCostLimit:    100.0,
+			MonthlyCostLimit:    money.FromInt(100),
 			PerMinuteRateLimit:  10,
 			PerHourRateLimit:    100,
 			ResetDay:            1,
@@ -705,7 +690,7 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 			IsActive:            false, // Inactive quota
 		}
 
-		result, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("CheckQuota failed: %v", err)
 		}
@@ -724,10 +709,10 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 			UserID:              userID,
 			DailyRequestLimit:   100,
 			DailyTokenLimit:     150, // Low token limit
-			DailyCostLimit:      10.0,
+			DailyCostLimit:      money.FromInt(10),
 			MonthlyRequestLimit: 1000,
 			MonthlyTokenLimit:   100000,
-			MonthlyCostLimit:    100.0,
+			MonthlyCostLimit:    money.FromInt(100),
 			PerMinuteRateLimit:  10,
 			PerHourRateLimit:    100,
 			ResetDay:            1,
@@ -740,7 +725,7 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 		monthlyRepo.monthlyUsage = make(map[string]*model.MonthlyUsage)
 
 		// First request with 100 tokens should pass
-		result1, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result1, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("First CheckQuota failed: %v", err)
 		}
@@ -749,12 +734,12 @@ func TestQuotaService_CheckQuota(t *testing.T) {
 		}
 
 		// Record usage
-		if err := service.RecordUsage(ctx, userID, "test-model", 100, 0.5); err != nil {
+		if err := service.RecordUsage(ctx, userID, "test-model", 100, money.MustParse("0.5")); err != nil {
 			t.Fatalf("RecordUsage failed: %v", err)
 		}
 
 		// Second request with 100 tokens should fail (200 > 150 limit)
-		result2, err := service.CheckQuota(ctx, userID, 100, 0.5)
+		result2, err := service.CheckQuota(ctx, userID, "test-model", 100, money.MustParse("0.5"))
 		if err != nil {
 			t.Fatalf("Second CheckQuota failed: %v", err)
 		}
@@ -796,7 +781,7 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 		monthlyRepo.monthlyUsage = make(map[string]*model.MonthlyUsage)
 
 		// Record first usage
-		if err := service.RecordUsage(ctx, userID, modelID, 100, 0.75); err != nil {
+		if err := service.RecordUsage(ctx, userID, modelID, 100, money.MustParse("0.75")); err != nil {
 			t.Fatalf("First RecordUsage failed: %v", err)
 		}
 
@@ -813,8 +798,8 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 		if dailyUsage.TokenCount != 100 {
 			t.Errorf("Expected daily token count to be 100, got %d", dailyUsage.TokenCount)
 		}
-		if dailyUsage.TotalCost != 0.75 {
-			t.Errorf("Expected daily total cost to be 0.75, got %f", dailyUsage.TotalCost)
+		if dailyUsage.TotalCost != money.MustParse("0.75") {
+			t.Errorf("Expected daily total cost to be 0.75, got %s", dailyUsage.TotalCost)
 		}
 
 		// Check model usage in daily record
@@ -851,18 +836,7 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 				t.Errorf("Expected model tokens to be 100, got %v", modelData["tokens"])
 			}
 
-			// Handle both float64 and int types for cost
-			var cost float64
-			switch v := modelData["cost"].(type) {
-			case float64:
-				cost = v
-			case int:
-				cost = float64(v)
-			default:
-				t.Errorf("Expected model cost to be float64 or int, got %T", modelData["cost"])
-				cost = 0
-			}
-			if cost != 0.75 {
+			if cost := usageCost(modelData["cost"]); cost != money.MustParse("0.75") {
 				t.Errorf("Expected model cost to be 0.75, got %v", modelData["cost"])
 			}
 		} else {
@@ -882,12 +856,12 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 		if monthlyUsage.TokenCount != 100 {
 			t.Errorf("Expected monthly token count to be 100, got %d", monthlyUsage.TokenCount)
 		}
-		if monthlyUsage.TotalCost != 0.75 {
-			t.Errorf("Expected monthly total cost to be 0.75, got %f", monthlyUsage.TotalCost)
+		if monthlyUsage.TotalCost != money.MustParse("0.75") {
+			t.Errorf("Expected monthly total cost to be 0.75, got %s", monthlyUsage.TotalCost)
 		}
 
 		// Record second usage
-		if err := service.RecordUsage(ctx, userID, modelID, 200, 1.5); err != nil {
+		if err := service.RecordUsage(ctx, userID, modelID, 200, money.MustParse("1.5")); err != nil {
 			t.Fatalf("Second RecordUsage failed: %v", err)
 		}
 
@@ -899,8 +873,8 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 		if dailyUsage2.TokenCount != 300 {
 			t.Errorf("Expected daily token count to be 300 after second usage, got %d", dailyUsage2.TokenCount)
 		}
-		if dailyUsage2.TotalCost != 2.25 {
-			t.Errorf("Expected daily total cost to be 2.25 after second usage, got %f", dailyUsage2.TotalCost)
+		if dailyUsage2.TotalCost != money.MustParse("2.25") {
+			t.Errorf("Expected daily total cost to be 2.25 after second usage, got %s", dailyUsage2.TotalCost)
 		}
 
 		// Verify model usage updated
@@ -935,18 +909,7 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 				t.Errorf("Expected model tokens to be 300 after second usage, got %v", modelData["tokens"])
 			}
 
-			// Handle both float64 and int types for cost
-			var cost float64
-			switch v := modelData["cost"].(type) {
-			case float64:
-				cost = v
-			case int:
-				cost = float64(v)
-			default:
-				t.Errorf("Expected model cost to be float64 or int, got %T", modelData["cost"])
-				cost = 0
-			}
-			if cost != 2.25 {
+			if cost := usageCost(modelData["cost"]); cost != money.MustParse("2.25") {
 				t.Errorf("Expected model cost to be 2.25 after second usage, got %v", modelData["cost"])
 			}
 		}
@@ -959,10 +922,10 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 			UserID:              userID,
 			DailyRequestLimit:   1, // Very low
 			DailyTokenLimit:     100,
-			DailyCostLimit:      1.0,
+			DailyCostLimit:      money.FromInt(1),
 			MonthlyRequestLimit: 10,
 			MonthlyTokenLimit:   1000,
-			MonthlyCostLimit:    10.0,
+			MonthlyCostLimit:    money.FromInt(10),
 			PerMinuteRateLimit:  10,
 			PerHourRateLimit:    100,
 			ResetDay:            1,
@@ -975,12 +938,12 @@ func TestQuotaService_RecordUsage(t *testing.T) {
 		monthlyRepo.monthlyUsage = make(map[string]*model.MonthlyUsage)
 
 		// Record usage that exceeds daily request limit
-		if err := service.RecordUsage(ctx, userID, modelID, 50, 0.5); err != nil {
+		if err := service.RecordUsage(ctx, userID, modelID, 50, money.MustParse("0.5")); err != nil {
 			t.Fatalf("RecordUsage failed: %v", err)
 		}
 
 		// Record second usage that puts us over the limit
-		if err := service.RecordUsage(ctx, userID, modelID, 50, 0.5); err != nil {
+		if err := service.RecordUsage(ctx, userID, modelID, 50, money.MustParse("0.5")); err != nil {
 			t.Fatalf("Second RecordUsage failed: %v", err)
 		}
 
@@ -1021,7 +984,7 @@ func TestQuotaService_ResetQuotas(t *testing.T) {
 	// Test: Reset daily quota
 	t.Run("ResetDailyQuota", func(t *testing.T) {
 		// Record some usage
-		if err := service.RecordUsage(ctx, userID, "test-model", 100, 1.0); err != nil {
+		if err := service.RecordUsage(ctx, userID, "test-model", 100, money.FromInt(1)); err != nil {
 			t.Fatalf("RecordUsage failed: %v", err)
 		}
 
@@ -1052,7 +1015,7 @@ func TestQuotaService_ResetQuotas(t *testing.T) {
 			t.Errorf("Expected token count to be 0 after reset, got %d", dailyUsageAfterReset.TokenCount)
 		}
 		if dailyUsageAfterReset.TotalCost != 0 {
-			t.Errorf("Expected total cost to be 0 after reset, got %f", dailyUsageAfterReset.TotalCost)
+			t.Errorf("Expected total cost to be 0 after reset, got %s", dailyUsageAfterReset.TotalCost)
 		}
 		if dailyUsageAfterReset.IsExceeded {
 			t.Error("Expected IsExceeded to be false after reset")
@@ -1062,7 +1025,7 @@ func TestQuotaService_ResetQuotas(t *testing.T) {
 	// Test: Reset monthly quota
 	t.Run("ResetMonthlyQuota", func(t *testing.T) {
 		// Record some usage
-		if err := service.RecordUsage(ctx, userID, "test-model", 500, 5.0); err != nil {
+		if err := service.RecordUsage(ctx, userID, "test-model", 500, money.FromInt(5)); err != nil {
 			t.Fatalf("RecordUsage failed: %v", err)
 		}
 
@@ -1094,10 +1057,138 @@ func TestQuotaService_ResetQuotas(t *testing.T) {
 			t.Errorf("Expected monthly token count to be 0 after reset, got %d", monthlyUsageAfterReset.TokenCount)
 		}
 		if monthlyUsageAfterReset.TotalCost != 0 {
-			t.Errorf("Expected monthly total cost to be 0 after reset, got %f", monthlyUsageAfterReset.TotalCost)
+			t.Errorf("Expected monthly total cost to be 0 after reset, got %s", monthlyUsageAfterReset.TotalCost)
 		}
 		if monthlyUsageAfterReset.IsExceeded {
 			t.Error("Expected monthly IsExceeded to be false after reset")
 		}
 	})
 }
+
+// mockModelRepository only implements the lookups the quota service makes
+type mockModelRepository struct {
+	repository.ModelRepository
+	models map[string]*model.Model
+}
+
+func (m *mockModelRepository) FindByID(ctx context.Context, id string) (*model.Model, error) {
+	modelObj, exists := m.models[id]
+	if !exists {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return modelObj, nil
+}
+
+func TestQuotaService_ModelLimits(t *testing.T) {
+	ctx := context.Background()
+	userID := "test-user-models"
+
+	quotaRepo := &mockUserQuotaRepository{
+		quotas: make(map[string]*model.UserQuota),
+	}
+	usageRepo := &mockUserUsageRepository{
+		dailyUsage: make(map[string]*model.UserUsage),
+	}
+	monthlyRepo := &mockMonthlyUsageRepository{
+		monthlyUsage: make(map[string]*model.MonthlyUsage),
+	}
+	modelRepo := &mockModelRepository{
+		models: map[string]*model.Model{
+			"gpt-4o":        {ID: "gpt-4o", Category: "premium"},
+			"claude-3-opus": {ID: "claude-3-opus", Category: "premium"},
+			"gpt-3.5-turbo": {ID: "gpt-3.5-turbo", Category: "standard"},
+		},
+	}
+
+	service := &quotaService{
+		quotaRepo:   quotaRepo,
+		usageRepo:   usageRepo,
+		monthlyRepo: monthlyRepo,
+		modelRepo:   modelRepo,
+	}
+
+	setLimits := func(limits model.JSONB) {
+		quota := model.DefaultQuota()
+		quota.UserID = userID
+		quota.ModelLimits = limits
+		quotaRepo.quotas[userID] = &quota
+		usageRepo.dailyUsage = make(map[string]*model.UserUsage)
+		monthlyRepo.monthlyUsage = make(map[string]*model.MonthlyUsage)
+	}
+
+	t.Run("ModelDailyRequestLimit", func(t *testing.T) {
+		setLimits(model.JSONB{
+			"models": map[string]interface{}{
+				"gpt-4o": map[string]interface{}{"daily_requests": 2},
+			},
+		})
+
+		for i := 0; i < 2; i++ {
+			result, err := service.CheckQuota(ctx, userID, "gpt-4o", 100, money.MustParse("0.5"))
+			if err != nil {
+				t.Fatalf("CheckQuota failed: %v", err)
+			}
+			if !result.Allowed {
+				t.Fatalf("Request %d should pass, but failed: %s", i+1, result.Reason)
+			}
+			if err := service.RecordUsage(ctx, userID, "gpt-4o", 100, money.MustParse("0.5")); err != nil {
+				t.Fatalf("RecordUsage failed: %v", err)
+			}
+		}
+
+		result, err := service.CheckQuota(ctx, userID, "gpt-4o", 100, money.MustParse("0.5"))
+		if err != nil {
+			t.Fatalf("CheckQuota failed: %v", err)
+		}
+		if result.Allowed {
+			t.Fatal("Third request should fail on the model limit, but it passed")
+		}
+		if result.ModelLimit == nil {
+			t.Fatal("Expected the exceeded model limit to be reported")
+		}
+		if result.ModelLimit.Scope != "model" || result.ModelLimit.Key != "gpt-4o" || result.ModelLimit.LimitType != "daily_requests" {
+			t.Errorf("Unexpected model limit: %+v", result.ModelLimit)
+		}
+
+		// Other models are not affected
+		result, err = service.CheckQuota(ctx, userID, "gpt-3.5-turbo", 100, money.MustParse("0.5"))
+		if err != nil {
+			t.Fatalf("CheckQuota failed: %v", err)
+		}
+		if !result.Allowed {
+			t.Errorf("Unlimited model should pass, but failed: %s", result.Reason)
+		}
+	})
+
+	t.Run("CategoryMonthlyCostLimit", func(t *testing.T) {
+		setLimits(model.JSONB{
+			"categories": map[string]interface{}{
+				"premium": map[string]interface{}{"monthly_cost": 1.0},
+			},
+		})
+
+		if err := service.RecordUsage(ctx, userID, "gpt-4o", 100, money.MustParse("0.6")); err != nil {
+			t.Fatalf("RecordUsage failed: %v", err)
+		}
+
+		// The category's cost is shared across its models
+		result, err := service.CheckQuota(ctx, userID, "claude-3-opus", 100, money.MustParse("0.6"))
+		if err != nil {
+			t.Fatalf("CheckQuota failed: %v", err)
+		}
+		if result.Allowed {
+			t.Fatal("Request should fail on the category limit, but it passed")
+		}
+		if result.ModelLimit == nil || result.ModelLimit.Scope != "category" || result.ModelLimit.Key != "premium" || result.ModelLimit.LimitType != "monthly_cost" {
+			t.Errorf("Unexpected model limit: %+v", result.ModelLimit)
+		}
+
+		result, err = service.CheckQuota(ctx, userID, "gpt-3.5-turbo", 100, money.MustParse("0.6"))
+		if err != nil {
+			t.Fatalf("CheckQuota failed: %v", err)
+		}
+		if !result.Allowed {
+			t.Errorf("Model in another category should pass, but failed: %s", result.Reason)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"time"
+)
+
+// quotaWindow is the day and billing cycle a moment falls in, in a user's
+// timezone. Usage is stored by the window's date and by the month its cycle
+// starts in.
+type quotaWindow struct {
+	date       string // "2006-01-02"
+	dayStart   time.Time
+	dayEnd     time.Time
+	yearMonth  string // "2006-01"
+	monthStart time.Time
+	monthEnd   time.Time
+}
+
+// quotaLocation returns the timezone of a quota, falling back to UTC for
+// names that don't load
+func quotaLocation(timezone string) *time.Location {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// quotaWindowAt returns the window now falls in. Days start at local
+// midnight, so they last 23 or 25 hours across DST changes. Billing cycles
+// start at midnight on resetDay, or on the last day of months shorter than
+// that.
+func quotaWindowAt(now time.Time, timezone string, resetDay int) quotaWindow {
+	loc := quotaLocation(timezone)
+	local := now.In(loc)
+
+	year, month, day := local.Date()
+	w := quotaWindow{
+		date:     local.Format("2006-01-02"),
+		dayStart: time.Date(year, month, day, 0, 0, 0, 0, loc),
+		dayEnd:   time.Date(year, month, day+1, 0, 0, 0, 0, loc),
+	}
+
+	// Noon on the first is a time every month has
+	cycle := time.Date(year, month, 1, 12, 0, 0, 0, loc)
+	if local.Before(cycleStart(cycle, resetDay)) {
+		cycle = cycle.AddDate(0, -1, 0)
+	}
+	w.yearMonth = cycle.Format("2006-01")
+	w.monthStart = cycleStart(cycle, resetDay)
+	w.monthEnd = cycleStart(cycle.AddDate(0, 1, 0), resetDay)
+	return w
+}
+
+// cycleStart is the start of the billing cycle beginning in month's month
+func cycleStart(month time.Time, resetDay int) time.Time {
+	lastDay := time.Date(month.Year(), month.Month()+1, 0, 12, 0, 0, 0, month.Location()).Day()
+	day := resetDay
+	if day < 1 {
+		day = 1
+	}
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, month.Location())
+}
+
+// previousDay is the daily window before w
+func (w quotaWindow) previousDay(timezone string, resetDay int) quotaWindow {
+	return quotaWindowAt(w.dayStart.Add(-time.Nanosecond), timezone, resetDay)
+}
+
+// previousMonth is the billing cycle before w's
+func (w quotaWindow) previousMonth(timezone string, resetDay int) quotaWindow {
+	return quotaWindowAt(w.monthStart.Add(-time.Nanosecond), timezone, resetDay)
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/money"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestQuotaWindowDays(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	shanghai := mustLoadLocation(t, "Asia/Shanghai")
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		timezone string
+		date     string
+		dayStart time.Time
+		length   time.Duration
+	}{
+		{
+			name:     "DST starts",
+			now:      time.Date(2026, 3, 8, 12, 0, 0, 0, newYork),
+			timezone: "America/New_York",
+			date:     "2026-03-08",
+			dayStart: time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC),
+			length:   23 * time.Hour,
+		},
+		{
+			name:     "DST ends",
+			now:      time.Date(2026, 11, 1, 23, 59, 0, 0, newYork),
+			timezone: "America/New_York",
+			date:     "2026-11-01",
+			dayStart: time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC),
+			length:   25 * time.Hour,
+		},
+		{
+			name:     "ahead of UTC",
+			now:      time.Date(2026, 10, 16, 17, 30, 0, 0, time.UTC),
+			timezone: "Asia/Shanghai",
+			date:     "2026-10-17",
+			dayStart: time.Date(2026, 10, 17, 0, 0, 0, 0, shanghai),
+			length:   24 * time.Hour,
+		},
+		{
+			name:     "at midnight",
+			now:      time.Date(2026, 10, 17, 0, 0, 0, 0, shanghai),
+			timezone: "Asia/Shanghai",
+			date:     "2026-10-17",
+			dayStart: time.Date(2026, 10, 17, 0, 0, 0, 0, shanghai),
+			length:   24 * time.Hour,
+		},
+		{
+			name:     "unknown timezone",
+			now:      time.Date(2026, 10, 16, 17, 30, 0, 0, time.UTC),
+			timezone: "Mars/Olympus_Mons",
+			date:     "2026-10-16",
+			dayStart: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+			length:   24 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := quotaWindowAt(tt.now, tt.timezone, 1)
+			if w.date != tt.date {
+				t.Errorf("date = %s, want %s", w.date, tt.date)
+			}
+			if !w.dayStart.Equal(tt.dayStart) {
+				t.Errorf("dayStart = %s, want %s", w.dayStart, tt.dayStart)
+			}
+			if got := w.dayEnd.Sub(w.dayStart); got != tt.length {
+				t.Errorf("day lasts %s, want %s", got, tt.length)
+			}
+		})
+	}
+}
+
+func TestQuotaWindowBillingCycles(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		now        time.Time
+		timezone   string
+		resetDay   int
+		yearMonth  string
+		monthStart time.Time
+		monthEnd   time.Time
+	}{
+		{
+			name:       "first of the month",
+			now:        time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC),
+			timezone:   "UTC",
+			resetDay:   1,
+			yearMonth:  "2026-12",
+			monthStart: date(2026, 12, 1),
+			monthEnd:   date(2027, 1, 1),
+		},
+		{
+			name:       "day 31 before February's last day",
+			now:        time.Date(2026, 2, 27, 12, 0, 0, 0, time.UTC),
+			timezone:   "UTC",
+			resetDay:   31,
+			yearMonth:  "2026-01",
+			monthStart: date(2026, 1, 31),
+			monthEnd:   date(2026, 2, 28),
+		},
+		{
+			name:       "day 31 on February's last day",
+			now:        time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC),
+			timezone:   "UTC",
+			resetDay:   31,
+			yearMonth:  "2026-02",
+			monthStart: date(2026, 2, 28),
+			monthEnd:   date(2026, 3, 31),
+		},
+		{
+			name:       "day 30 after February",
+			now:        time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+			timezone:   "UTC",
+			resetDay:   30,
+			yearMonth:  "2026-02",
+			monthStart: date(2026, 2, 28),
+			monthEnd:   date(2026, 3, 30),
+		},
+		{
+			name:       "day 30 in a leap year",
+			now:        time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC),
+			timezone:   "UTC",
+			resetDay:   30,
+			yearMonth:  "2028-02",
+			monthStart: date(2028, 2, 29),
+			monthEnd:   date(2028, 3, 30),
+		},
+		{
+			name:       "cycle starts at local midnight",
+			now:        time.Date(2026, 11, 15, 0, 0, 0, 0, newYork),
+			timezone:   "America/New_York",
+			resetDay:   15,
+			yearMonth:  "2026-11",
+			monthStart: time.Date(2026, 11, 15, 0, 0, 0, 0, newYork),
+			monthEnd:   time.Date(2026, 12, 15, 0, 0, 0, 0, newYork),
+		},
+		{
+			name:       "just before the cycle starts",
+			now:        time.Date(2026, 11, 15, 0, 0, 0, 0, newYork).Add(-time.Nanosecond),
+			timezone:   "America/New_York",
+			resetDay:   15,
+			yearMonth:  "2026-10",
+			monthStart: time.Date(2026, 10, 15, 0, 0, 0, 0, newYork),
+			monthEnd:   time.Date(2026, 11, 15, 0, 0, 0, 0, newYork),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := quotaWindowAt(tt.now, tt.timezone, tt.resetDay)
+			if w.yearMonth != tt.yearMonth {
+				t.Errorf("yearMonth = %s, want %s", w.yearMonth, tt.yearMonth)
+			}
+			if !w.monthStart.Equal(tt.monthStart) || !w.monthEnd.Equal(tt.monthEnd) {
+				t.Errorf("cycle = %s to %s, want %s to %s", w.monthStart, w.monthEnd, tt.monthStart, tt.monthEnd)
+			}
+		})
+	}
+}
+
+func TestQuotaWindowPrevious(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	w := quotaWindowAt(time.Date(2026, 3, 9, 8, 0, 0, 0, newYork), "America/New_York", 31)
+	day := w.previousDay("America/New_York", 31)
+	if day.date != "2026-03-08" || day.dayEnd.Sub(day.dayStart) != 23*time.Hour || !day.dayEnd.Equal(w.dayStart) {
+		t.Errorf("previousDay() = %s from %s to %s", day.date, day.dayStart, day.dayEnd)
+	}
+	month := w.previousMonth("America/New_York", 31)
+	if month.yearMonth != "2026-01" || !month.monthEnd.Equal(w.monthStart) {
+		t.Errorf("previousMonth() = %s ending %s, want 2026-01 ending %s", month.yearMonth, month.monthEnd, w.monthStart)
+	}
+}
+
+type mockQuotaSnapshotRepository struct {
+	repository.QuotaSnapshotRepository
+	snapshots []*model.QuotaSnapshot
+}
+
+func (m *mockQuotaSnapshotRepository) Record(ctx context.Context, snapshot *model.QuotaSnapshot) (bool, error) {
+	for _, s := range m.snapshots {
+		if snapshot.Reason == model.QuotaSnapshotRollover && s.Reason == snapshot.Reason &&
+			s.UserID == snapshot.UserID && s.Period == snapshot.Period && s.Bucket == snapshot.Bucket {
+			return false, nil
+		}
+	}
+	m.snapshots = append(m.snapshots, snapshot)
+	return true, nil
+}
+
+func (m *mockQuotaSnapshotRepository) FindLatestBucket(ctx context.Context, userID, period string) (string, error) {
+	latest := ""
+	for _, s := range m.snapshots {
+		if s.Reason == model.QuotaSnapshotRollover && s.UserID == userID && s.Period == period && s.Bucket > latest {
+			latest = s.Bucket
+		}
+	}
+	return latest, nil
+}
+
+func TestRolloverQuotas(t *testing.T) {
+	ctx := context.Background()
+	userID := "test-user-rollover"
+	shanghai := mustLoadLocation(t, "Asia/Shanghai")
+
+	quota := model.DefaultQuota()
+	quota.UserID = userID
+	quota.Timezone = "Asia/Shanghai"
+	quota.DailyRequestLimit = 1
+
+	usageRepo := &mockUserUsageRepository{dailyUsage: make(map[string]*model.UserUsage)}
+	// The 13th was the last day rolled over before the scheduler went down.
+	// An admin reset the 14th, which still has to roll over.
+	snapshotRepo := &mockQuotaSnapshotRepository{snapshots: []*model.QuotaSnapshot{
+		{UserID: userID, Period: model.QuotaPeriodDaily, Bucket: "2026-10-13", Reason: model.QuotaSnapshotRollover},
+		{UserID: userID, Period: model.QuotaPeriodDaily, Bucket: "2026-10-14", Reason: model.QuotaSnapshotReset},
+	}}
+	service := &quotaService{
+		quotaRepo:    &mockUserQuotaRepository{quotas: map[string]*model.UserQuota{userID: &quota}},
+		usageRepo:    usageRepo,
+		monthlyRepo:  &mockMonthlyUsageRepository{monthlyUsage: make(map[string]*model.MonthlyUsage)},
+		snapshotRepo: snapshotRepo,
+	}
+
+	// Calls on the 12th and 14th in Shanghai, while the scheduler was down
+	for _, date := range []int{12, 14} {
+		missed := time.Date(2026, 10, date, 0, 0, 0, 0, shanghai)
+		if err := usageRepo.IncrementUsage(ctx, userID, missed, 1, 100, money.MustParse("0.5"), model.JSONB{}); err != nil {
+			t.Fatalf("IncrementUsage failed: %v", err)
+		}
+	}
+
+	// Two calls on the 16th in Shanghai, the second after 16:00 UTC
+	day := time.Date(2026, 10, 16, 0, 0, 0, 0, shanghai)
+	for i := 0; i < 2; i++ {
+		if err := usageRepo.IncrementUsage(ctx, userID, day, 1, 100, money.MustParse("0.5"), model.JSONB{}); err != nil {
+			t.Fatalf("IncrementUsage failed: %v", err)
+		}
+	}
+
+	// The first run catches up on the 14th, but not the 12th, which was
+	// rolled over before. Calls get a few minutes to settle into the day
+	// before it rolls over.
+	midnight := time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		now  time.Time
+		want int
+	}{
+		{midnight.Add(-time.Minute), 1},
+		{midnight.Add(2 * time.Minute), 0},
+		{midnight.Add(quotaRolloverDelay), 1},
+		{midnight.Add(time.Hour), 0},
+	} {
+		recorded, err := service.rolloverQuotas(ctx, tt.now)
+		if err != nil {
+			t.Fatalf("rolloverQuotas(%s) failed: %v", tt.now, err)
+		}
+		if recorded != tt.want {
+			t.Errorf("rolloverQuotas(%s) recorded %d snapshots, want %d", tt.now, recorded, tt.want)
+		}
+	}
+
+	// The cycles before October had no usage, so only the days were recorded
+	if len(snapshotRepo.snapshots) != 4 {
+		t.Fatalf("recorded %d snapshots, want 4", len(snapshotRepo.snapshots))
+	}
+	if s := snapshotRepo.snapshots[2]; s.Period != model.QuotaPeriodDaily || s.Bucket != "2026-10-14" || s.Reason != model.QuotaSnapshotRollover {
+		t.Errorf("snapshot = %s %s %s, want daily 2026-10-14 rollover", s.Period, s.Bucket, s.Reason)
+	}
+	s := snapshotRepo.snapshots[3]
+	if s.Period != model.QuotaPeriodDaily || s.Bucket != "2026-10-16" {
+		t.Errorf("snapshot = %s %s, want daily 2026-10-16", s.Period, s.Bucket)
+	}
+	if !s.StartsAt.Equal(day) || !s.EndsAt.Equal(midnight) {
+		t.Errorf("snapshot covers %s to %s, want %s to %s", s.StartsAt, s.EndsAt, day, midnight)
+	}
+	if s.RequestCount != 2 || s.TokenCount != 200 || s.TotalCost != money.FromInt(1) || !s.IsExceeded {
+		t.Errorf("snapshot usage = %d requests, %d tokens, %s (exceeded %v), want 2, 200, 1 (exceeded)", s.RequestCount, s.TokenCount, s.TotalCost, s.IsExceeded)
+	}
+
+	// A new instance rolls the day over again, which the repository ignores
+	service.rolledOver = nil
+	if recorded, err := service.rolloverQuotas(ctx, midnight.Add(time.Hour)); err != nil || recorded != 0 {
+		t.Errorf("rolloverQuotas() on a new instance = %d, %v, want 0, nil", recorded, err)
+	}
+}
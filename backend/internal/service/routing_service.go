@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/internal/repository"
+)
+
+const (
+	// autoRoutingStatsWindow is how far back model statistics are considered
+	autoRoutingStatsWindow = 7 * 24 * time.Hour
+
+	// A model's success rate only counts once it has served
+	// autoRoutingMinSamples recent requests; below autoRoutingMinSuccessRate
+	// (percent) it is not chosen.
+	autoRoutingMinSamples     = 20
+	autoRoutingMinSuccessRate = 50.0
+)
+
+// ErrNoCapableModel is returned for an auto-routed request that no active
+// model can serve within its requirements
+var ErrNoCapableModel = errors.New("no model meets the request's requirements")
+
+type routingService struct {
+	modelRepo      repository.ModelRepository
+	deploymentRepo repository.ModelDeploymentRepository
+	aliasRepo      repository.ModelAliasRepository
+	ruleRepo       repository.RoutingRuleRepository
+	statisticRepo  repository.ModelStatisticRepository
+}
+
+func NewRoutingService(
+	modelRepo repository.ModelRepository,
+	deploymentRepo repository.ModelDeploymentRepository,
+	aliasRepo repository.ModelAliasRepository,
+	ruleRepo repository.RoutingRuleRepository,
+	statisticRepo repository.ModelStatisticRepository,
+) RoutingService {
+	return &routingService{
+		modelRepo:      modelRepo,
+		deploymentRepo: deploymentRepo,
+		aliasRepo:      aliasRepo,
+		ruleRepo:       ruleRepo,
+		statisticRepo:  statisticRepo,
+	}
+}
+
+func (s *routingService) ResolveRoute(ctx context.Context, req *model.RoutingRequest) (*Route, error) {
+	route, err := s.resolveModel(ctx, req)
+	if err != nil || route == nil {
+		return nil, err
+	}
+	modelObj := route.Model
+
+	deployments, err := s.deploymentRepo.FindActiveByModelID(ctx, modelObj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Models without deployments are served by their own provider
+	if len(deployments) == 0 {
+		deployments = []*model.ModelDeployment{model.DefaultDeployment(modelObj)}
+	}
+
+	route.Deployments = orderDeployments(deployments, rand.IntN)
+	return route, nil
+}
+
+// resolveModel finds the model a request is for, without its deployments
+func (s *routingService) resolveModel(ctx context.Context, req *model.RoutingRequest) (*Route, error) {
+	rules, err := s.ruleRepo.FindOrdered(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		conditions, err := model.RoutingConditionsFromJSONB(rule.Conditions)
+		if err != nil {
+			log.Printf("Skipping routing rule %s with invalid conditions: %v", rule.ID, err)
+			continue
+		}
+		if !conditions.Matches(req) {
+			continue
+		}
+
+		modelObj, err := s.modelRepo.FindActiveByID(ctx, rule.TargetModelID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find model: %w", err)
+		}
+		// A rule pointing at a deactivated model does not apply
+		if modelObj != nil {
+			return &Route{Model: modelObj, Rule: rule}, nil
+		}
+	}
+
+	if req.Model == model.AutoModelName {
+		return s.resolveAuto(ctx, req)
+	}
+
+	modelObj, err := s.modelRepo.FindActiveByName(ctx, req.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find model: %w", err)
+	}
+	if modelObj != nil {
+		return &Route{Model: modelObj}, nil
+	}
+
+	alias, err := s.aliasRepo.FindActiveByName(ctx, req.Model)
+	if err != nil {
+		return nil, err
+	}
+	if alias == nil {
+		return nil, nil
+	}
+	modelObj, err = s.modelRepo.FindActiveByID(ctx, alias.ModelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, nil
+	}
+	return &Route{Model: modelObj, Alias: alias}, nil
+}
+
+// resolveAuto picks the model for a request to the auto model
+func (s *routingService) resolveAuto(ctx context.Context, req *model.RoutingRequest) (*Route, error) {
+	models, err := s.modelRepo.FindActiveModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.statisticRepo.SummarizeSince(ctx, time.Now().Add(-autoRoutingStatsWindow))
+	if err != nil {
+		// Rank on price and capability alone rather than fail the request
+		log.Printf("Auto routing without model statistics: %v", err)
+		stats = nil
+	}
+
+	ranked := rankAutoCandidates(models, stats, req)
+	if len(ranked) == 0 {
+		return nil, ErrNoCapableModel
+	}
+
+	// Reload the winner with its provider credentials
+	modelObj, err := s.modelRepo.FindActiveByID(ctx, ranked[0].ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find model: %w", err)
+	}
+	if modelObj == nil {
+		return nil, ErrNoCapableModel
+	}
+	return &Route{Model: modelObj, Auto: true}, nil
+}
+
+func (s *routingService) RecordOutcome(ctx context.Context, modelID string, tokens int, latency time.Duration, success bool) error {
+	latencyMs := float64(latency) / float64(time.Millisecond)
+	return s.statisticRepo.RecordRequest(ctx, modelID, time.Now(), tokens, latencyMs, success)
+}
+
+// autoCandidate is a model able to serve an auto-routed request
+type autoCandidate struct {
+	model        *model.Model
+	expectedCost float64
+	latencyMs    float64 // 0 when unknown
+}
+
+// rankAutoCandidates returns the models that meet the request's requirements,
+// cheapest first. A model's estimated cost is divided by its recent success
+// rate, so a cheap model that often fails ranks as less cheap; models below
+// autoRoutingMinSuccessRate, or slower than the client's latency target, are
+// left out. Models without recent statistics are assumed to be reliable.
+func rankAutoCandidates(models []*model.Model, stats map[string]*model.ModelStatistic, req *model.RoutingRequest) []*model.Model {
+	candidates := make([]autoCandidate, 0, len(models))
+	for _, m := range models {
+		if req.AllowModel != nil && !req.AllowModel(m) {
+			continue
+		}
+		if (req.HasImages && !m.HasCapability(model.CapabilityVision)) ||
+			(req.HasTools && !m.HasCapability(model.CapabilityTools)) ||
+			(req.JSONMode && !m.HasCapability(model.CapabilityJSONMode)) {
+			continue
+		}
+		if m.ContextLength != nil && req.InputTokens+req.OutputTokens > *m.ContextLength {
+			continue
+		}
+
+		inputPrice, outputPrice := m.InputPrice, m.OutputPrice
+		if m.IsFree {
+			inputPrice, outputPrice = 0, 0
+		}
+		if (req.MaxInputPrice != nil && inputPrice > *req.MaxInputPrice) ||
+			(req.MaxOutputPrice != nil && outputPrice > *req.MaxOutputPrice) {
+			continue
+		}
+
+		candidate := autoCandidate{
+			model:        m,
+			expectedCost: (tokenCost(inputPrice, req.InputTokens) + tokenCost(outputPrice, req.OutputTokens)).Float64(),
+		}
+		if stat := stats[m.ID]; stat != nil {
+			if req.MaxLatencyMs != nil && stat.AvgResponseTime > *req.MaxLatencyMs {
+				continue
+			}
+			candidate.latencyMs = stat.AvgResponseTime
+			if stat.TotalRequests >= autoRoutingMinSamples {
+				if stat.SuccessRate < autoRoutingMinSuccessRate {
+					continue
+				}
+				candidate.expectedCost /= stat.SuccessRate / 100
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.expectedCost != b.expectedCost {
+			return a.expectedCost < b.expectedCost
+		}
+		// Prefer the model known to be faster; unknown latency goes last
+		if a.latencyMs != b.latencyMs {
+			return b.latencyMs == 0 || (a.latencyMs != 0 && a.latencyMs < b.latencyMs)
+		}
+		return a.model.Name < b.model.Name
+	})
+
+	ranked := make([]*model.Model, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = c.model
+	}
+	return ranked
+}
+
+// orderDeployments returns the order in which to try deployments, which must
+// be sorted by priority. Within a priority, deployments are drawn at random in
+// proportion to their weight; zero-weight deployments only serve as standbys
+// after the weighted ones.
+func orderDeployments(deployments []*model.ModelDeployment, intN func(int) int) []*model.ModelDeployment {
+	ordered := make([]*model.ModelDeployment, 0, len(deployments))
+	for start := 0; start < len(deployments); {
+		end := start
+		for end < len(deployments) && deployments[end].Priority == deployments[start].Priority {
+			end++
+		}
+		ordered = append(ordered, weightedShuffle(deployments[start:end], intN)...)
+		start = end
+	}
+	return ordered
+}
+
+func weightedShuffle(deployments []*model.ModelDeployment, intN func(int) int) []*model.ModelDeployment {
+	remaining := make([]*model.ModelDeployment, 0, len(deployments))
+	var standby []*model.ModelDeployment
+	total := 0
+	for _, d := range deployments {
+		if d.Weight > 0 {
+			remaining = append(remaining, d)
+			total += d.Weight
+		} else {
+			standby = append(standby, d)
+		}
+	}
+
+	shuffled := make([]*model.ModelDeployment, 0, len(deployments))
+	for len(remaining) > 0 {
+		pick := intN(total)
+		for i, d := range remaining {
+			if pick < d.Weight {
+				shuffled = append(shuffled, d)
+				total -= d.Weight
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			pick -= d.Weight
+		}
+	}
+	return append(shuffled, standby...)
+}
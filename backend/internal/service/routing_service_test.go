@@ -0,0 +1,96 @@
+package service
+
+import (
+	"testing"
+
+	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
+)
+
+func TestOrderDeployments(t *testing.T) {
+	primaryA := &model.ModelDeployment{ID: "a", Priority: 0, Weight: 1}
+	primaryB := &model.ModelDeployment{ID: "b", Priority: 0, Weight: 3}
+	standby := &model.ModelDeployment{ID: "standby", Priority: 0, Weight: 0}
+	fallback := &model.ModelDeployment{ID: "fallback", Priority: 1, Weight: 1}
+	deployments := []*model.ModelDeployment{primaryA, primaryB, standby, fallback}
+
+	tests := []struct {
+		name string
+		pick int
+		want []string
+	}{
+		{name: "draw lands on first weight", pick: 0, want: []string{"a", "b", "standby", "fallback"}},
+		{name: "draw lands on second weight", pick: 1, want: []string{"b", "a", "standby", "fallback"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intN := func(n int) int { return min(tt.pick, n-1) }
+			got := orderDeployments(deployments, intN)
+			if len(got) != len(tt.want) {
+				t.Fatalf("orderDeployments() returned %d deployments, want %d", len(got), len(tt.want))
+			}
+			for i, d := range got {
+				if d.ID != tt.want[i] {
+					t.Errorf("orderDeployments()[%d] = %s, want %s", i, d.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRankAutoCandidates(t *testing.T) {
+	contextLength := 1000
+	cheap := &model.Model{ID: "cheap", Name: "cheap", InputPrice: money.MustParse("0.1"), OutputPrice: money.MustParse("0.2"), Capabilities: model.JSONB{}}
+	vision := &model.Model{ID: "vision", Name: "vision", InputPrice: money.FromInt(1), OutputPrice: money.FromInt(2), Capabilities: model.JSONB{"vision": true}}
+	flaky := &model.Model{ID: "flaky", Name: "flaky", InputPrice: money.MustParse("0.05"), OutputPrice: money.MustParse("0.1"), Capabilities: model.JSONB{"vision": true}}
+	small := &model.Model{ID: "small", Name: "small", InputPrice: money.MustParse("0.01"), OutputPrice: money.MustParse("0.01"), ContextLength: &contextLength}
+	models := []*model.Model{vision, cheap, flaky, small}
+
+	stats := map[string]*model.ModelStatistic{
+		"flaky": {ModelID: "flaky", TotalRequests: 100, SuccessRate: 40, AvgResponseTime: 500},
+		"cheap": {ModelID: "cheap", TotalRequests: 100, SuccessRate: 100, AvgResponseTime: 3000},
+	}
+	maxLatency := 1000.0
+
+	tests := []struct {
+		name string
+		req  *model.RoutingRequest
+		want []string
+	}{
+		{
+			name: "cheapest first, unreliable left out",
+			req:  &model.RoutingRequest{InputTokens: 100, OutputTokens: 100},
+			want: []string{"small", "cheap", "vision"},
+		},
+		{
+			name: "vision required",
+			req:  &model.RoutingRequest{InputTokens: 100, OutputTokens: 100, HasImages: true},
+			want: []string{"vision"},
+		},
+		{
+			name: "prompt exceeds context length",
+			req:  &model.RoutingRequest{InputTokens: 2000, OutputTokens: 100},
+			want: []string{"cheap", "vision"},
+		},
+		{
+			name: "latency target",
+			req:  &model.RoutingRequest{InputTokens: 2000, OutputTokens: 100, MaxLatencyMs: &maxLatency},
+			want: []string{"vision"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankAutoCandidates(models, stats, tt.req)
+			if len(got) != len(tt.want) {
+				t.Fatalf("rankAutoCandidates() returned %d models, want %d", len(got), len(tt.want))
+			}
+			for i, m := range got {
+				if m.ID != tt.want[i] {
+					t.Errorf("rankAutoCandidates()[%d] = %s, want %s", i, m.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"massrouter.ai/backend/internal/model"
+	"massrouter.ai/backend/pkg/money"
+	"massrouter.ai/backend/pkg/tokenizer"
 )
 
 type AuthService interface {
@@ -35,19 +37,48 @@ type ModelService interface {
 	SearchModels(ctx context.Context, query string, filters *ModelFilters) (*ListModelsResponse, error)
 	GetModelProviders(ctx context.Context) ([]*model.ModelProvider, error)
 	GetModelCategories(ctx context.Context) ([]string, error)
+	ListModelAliases(ctx context.Context) ([]*ModelAliasInfo, error)
 }
 
 type BillingService interface {
 	GetBalance(ctx context.Context, userID string) (*BalanceInfo, error)
-	GetPaymentHistory(ctx context.Context, userID string, page, limit int) (*PaymentHistoryResponse, error)
+	GetPaymentHistory(ctx context.Context, userID string, req *PaymentHistoryRequest) (*PaymentHistoryResponse, error)
 	CreatePayment(ctx context.Context, userID string, req *CreatePaymentRequest) (*PaymentInfo, error)
-	ProcessPaymentWebhook(ctx context.Context, payload []byte, signature string) error
-	GetBillingRecords(ctx context.Context, userID string, page, limit int) (*BillingRecordsResponse, error)
+	ProcessPaymentWebhook(ctx context.Context, gateway string, payload []byte, signature string) error
+	SimulateSandboxPayment(ctx context.Context, userID, paymentID string, succeed bool) (*PaymentItem, error)
+	GetBillingRecords(ctx context.Context, userID string, req *BillingRecordsRequest) (*BillingRecordsResponse, error)
 	CalculateCost(ctx context.Context, modelID string, inputTokens, outputTokens int) (*CostCalculation, error)
+	// Price a prompt whose input tokens are counted with the model's tokenizer
+	CalculatePromptCost(ctx context.Context, modelID string, prompt *tokenizer.Prompt, outputTokens int) (*CostCalculation, error)
+	CalculateDeploymentCost(ctx context.Context, modelObj *model.Model, deployment *model.ModelDeployment, inputTokens, outputTokens int) (*CostCalculation, error)
+	// Hold the most a call may cost until its billing record is stored
+	ReserveBalance(ctx context.Context, userID string, amount money.Amount) (*BalanceReservation, error)
+	// Drop the hold of a call that will not be billed
+	ReleaseBalance(ctx context.Context, userID, holdID string) error
 	CreateBillingRecord(ctx context.Context, req *CreateBillingRecordRequest) error
 	StartBillingWorker()
 	StopBillingWorker()
 	GetQueueStatus(ctx context.Context) (*QueueStatus, error)
+	// Billing jobs the worker gave up on, latest first
+	ListBillingDeadLetters(ctx context.Context) ([]*BillingDeadLetter, error)
+	// Queue dead letters again, or all of them when no IDs are given
+	ReplayBillingDeadLetters(ctx context.Context, ids ...string) (int, error)
+	// Drop dead letters, or all of them when no IDs are given
+	PurgeBillingDeadLetters(ctx context.Context, ids ...string) (int, error)
+}
+
+type LedgerService interface {
+	// Post appends an entry to the ledger and applies it to the account's
+	// balance; it reports false if the entry's reference was already posted
+	Post(ctx context.Context, entry *model.LedgerEntry) (bool, error)
+	// Post an admin's refund, adjustment, hold or release. It reports false
+	// if an entry of the type was already posted for the reference.
+	PostManualEntry(ctx context.Context, userID, adminID string, req *PostLedgerEntryRequest) (*model.LedgerEntry, bool, error)
+	GetAccount(ctx context.Context, userID string) (*model.LedgerAccount, error)
+	GetEntries(ctx context.Context, userID string, page, limit int) (*LedgerEntriesResponse, error)
+	// Recompute balances from the ledger and report accounts that drifted,
+	// correcting them if fix is set
+	Reconcile(ctx context.Context, fix bool) (*LedgerReconciliation, error)
 }
 
 type AdminService interface {
@@ -58,6 +89,22 @@ type AdminService interface {
 	UpdateModelProvider(ctx context.Context, providerID string, req *UpdateModelProviderRequest) error
 	CreateModel(ctx context.Context, req *CreateModelRequest) (*model.Model, error)
 	UpdateModel(ctx context.Context, modelID string, req *UpdateModelRequest) error
+	ListModelDeployments(ctx context.Context, modelID string) ([]*model.ModelDeployment, error)
+	CreateModelDeployment(ctx context.Context, modelID string, req *CreateModelDeploymentRequest) (*model.ModelDeployment, error)
+	UpdateModelDeployment(ctx context.Context, deploymentID string, req *UpdateModelDeploymentRequest) error
+	DeleteModelDeployment(ctx context.Context, deploymentID string) error
+	ListProviderCredentials(ctx context.Context, providerID string) ([]*model.ProviderCredential, error)
+	CreateProviderCredential(ctx context.Context, providerID string, req *CreateProviderCredentialRequest) (*model.ProviderCredential, error)
+	UpdateProviderCredential(ctx context.Context, credentialID string, req *UpdateProviderCredentialRequest) error
+	DeleteProviderCredential(ctx context.Context, credentialID string) error
+	ListModelAliases(ctx context.Context) ([]*model.ModelAlias, error)
+	CreateModelAlias(ctx context.Context, req *CreateModelAliasRequest) (*model.ModelAlias, error)
+	UpdateModelAlias(ctx context.Context, aliasID string, req *UpdateModelAliasRequest) error
+	DeleteModelAlias(ctx context.Context, aliasID string) error
+	ListRoutingRules(ctx context.Context) ([]*model.RoutingRule, error)
+	CreateRoutingRule(ctx context.Context, req *CreateRoutingRuleRequest) (*model.RoutingRule, error)
+	UpdateRoutingRule(ctx context.Context, ruleID string, req *UpdateRoutingRuleRequest) error
+	DeleteRoutingRule(ctx context.Context, ruleID string) error
 	GetSystemStats(ctx context.Context) (*SystemStats, error)
 	UpdateSystemConfig(ctx context.Context, key, value string) error
 }
@@ -67,20 +114,90 @@ type QuotaService interface {
 	GetUserQuota(ctx context.Context, userID string) (*model.UserQuota, error)
 	UpdateUserQuota(ctx context.Context, userID string, req *UpdateQuotaRequest) error
 
-	// Check if user has quota for an API call
-	CheckQuota(ctx context.Context, userID string, tokens int, cost float64) (*QuotaCheckResult, error)
+	// Check if user has quota for an API call. An allowed call's estimated
+	// usage is reserved, and must be settled or released once the call ends.
+	CheckQuota(ctx context.Context, userID string, modelID string, tokens int, cost money.Amount) (*QuotaCheckResult, error)
+
+	// Correct a reservation to the actual usage of its successful call
+	SettleQuota(ctx context.Context, reservation *QuotaReservation, tokens int, cost money.Amount) error
+
+	// Give back a reservation whose call failed
+	ReleaseQuota(ctx context.Context, reservation *QuotaReservation) error
 
 	// Record usage after successful API call
-	RecordUsage(ctx context.Context, userID string, modelID string, tokens int, cost float64) error
+	RecordUsage(ctx context.Context, userID string, modelID string, tokens int, cost money.Amount) error
 
 	// Get usage statistics
 	GetDailyUsage(ctx context.Context, userID string, date time.Time) (*model.UserUsage, error)
 	GetMonthlyUsage(ctx context.Context, userID string, yearMonth string) (*model.MonthlyUsage, error)
 	GetUsageHistory(ctx context.Context, userID string, startDate, endDate time.Time) ([]*model.UserUsage, error)
 
+	// Get the usage of ended and reset windows, newest first
+	GetQuotaSnapshots(ctx context.Context, userID string, limit, offset int) ([]*model.QuotaSnapshot, error)
+
 	// Reset quotas (admin only)
 	ResetDailyQuota(ctx context.Context, userID string) error
 	ResetMonthlyQuota(ctx context.Context, userID string) error
+
+	// Write usage counted in Redis to the database and snapshot ended
+	// windows in the background
+	StartQuotaJobs()
+	StopQuotaJobs()
+}
+
+type RoutingService interface {
+	// Resolve a request to the model and the deployments to try for it, in
+	// order. The first matching routing rule decides the model; otherwise the
+	// requested name is looked up as a model name, then as an alias. Returns
+	// nil when nothing matches an active model. Requests for the auto model
+	// are given the cheapest model that meets their requirements.
+	ResolveRoute(ctx context.Context, req *model.RoutingRequest) (*Route, error)
+
+	// Record how a call to a model went, for the statistics auto routing uses
+	RecordOutcome(ctx context.Context, modelID string, tokens int, latency time.Duration, success bool) error
+}
+
+type CredentialService interface {
+	// Pick the credential to call a provider with, skipping those in exclude.
+	// Returns nil when none is available or within its per-minute budget.
+	Acquire(ctx context.Context, provider *model.ModelProvider, exclude map[string]bool) (*model.ProviderCredential, error)
+
+	// Update a credential's health from the upstream response: a 429 rests it
+	// for a cooldown, repeated 401s disable it
+	ReportResponse(ctx context.Context, credential *model.ProviderCredential, statusCode int, retryAfter time.Duration) error
+
+	// Count tokens a call used against the credential's per-minute budget
+	RecordTokens(ctx context.Context, credential *model.ProviderCredential, tokens int) error
+}
+
+type CircuitBreakerService interface {
+	// Report whether a provider key may be called. An open breaker fails fast
+	// until its open period ends, then lets a single probe through.
+	Allow(provider *model.ModelProvider, credential *model.ProviderCredential) bool
+
+	// Record the outcome of a call: any response short of a server error
+	// counts as a success, a transport error or server error as a failure
+	RecordSuccess(provider *model.ModelProvider, credential *model.ProviderCredential)
+	RecordFailure(provider *model.ModelProvider, credential *model.ProviderCredential, reason string)
+
+	// Current state of every breaker this instance has used
+	Snapshot() []*CircuitBreakerStatus
+}
+
+type APIKeyPolicyService interface {
+	// Check whether an API key may perform an action on a model, including its
+	// monthly request and token caps. An allowed call is counted against the
+	// caps up front with its estimated tokens.
+	Authorize(ctx context.Context, key *model.UserAPIKey, modelObj *model.Model, action string, tokens int) (*APIKeyAuthorization, error)
+
+	// Correct a call's reservation to its actual tokens after a successful call
+	RecordUsage(ctx context.Context, reservation *APIKeyReservation, tokens int) error
+
+	// Give back the reservation of a call that failed
+	ReleaseUsage(ctx context.Context, reservation *APIKeyReservation) error
+
+	// Check only whether the key's permissions allow an action on a model
+	Permits(key *model.UserAPIKey, modelObj *model.Model, action string) bool
 }
 
 // Request/Response types
@@ -129,38 +246,38 @@ type RotateAPIKeyRequest struct {
 type UserProfile struct {
 	User       *model.User         `json:"user"`
 	APIKeys    []*model.UserAPIKey `json:"api_keys,omitempty"`
-	Balance    float64             `json:"balance"`
-	TotalUsage float64             `json:"total_usage"`
+	Balance    money.Amount        `json:"balance"`
+	TotalUsage money.Amount        `json:"total_usage"`
 }
 
 type UserBalance struct {
-	Balance      float64    `json:"balance"`
-	TotalPaid    float64    `json:"total_paid"`
-	TotalUsed    float64    `json:"total_used"`
-	LastPayment  *time.Time `json:"last_payment,omitempty"`
-	LastActivity *time.Time `json:"last_activity,omitempty"`
+	Balance      money.Amount `json:"balance"`
+	TotalPaid    money.Amount `json:"total_paid"`
+	TotalUsed    money.Amount `json:"total_used"`
+	LastPayment  *time.Time   `json:"last_payment,omitempty"`
+	LastActivity *time.Time   `json:"last_activity,omitempty"`
 }
 
 type UsageStatistics struct {
 	DailyUsage  []*DailyUsage `json:"daily_usage"`
-	TotalCost   float64       `json:"total_cost"`
+	TotalCost   money.Amount  `json:"total_cost"`
 	TotalTokens int64         `json:"total_tokens"`
 	TopModels   []*ModelUsage `json:"top_models"`
 }
 
 type DailyUsage struct {
-	Date     time.Time `json:"date"`
-	Cost     float64   `json:"cost"`
-	Tokens   int64     `json:"tokens"`
-	Requests int       `json:"requests"`
+	Date     time.Time    `json:"date"`
+	Cost     money.Amount `json:"cost"`
+	Tokens   int64        `json:"tokens"`
+	Requests int          `json:"requests"`
 }
 
 type ModelUsage struct {
-	ModelID   string  `json:"model_id"`
-	ModelName string  `json:"model_name"`
-	Cost      float64 `json:"cost"`
-	Tokens    int64   `json:"tokens"`
-	Requests  int     `json:"requests"`
+	ModelID   string       `json:"model_id"`
+	ModelName string       `json:"model_name"`
+	Cost      money.Amount `json:"cost"`
+	Tokens    int64        `json:"tokens"`
+	Requests  int          `json:"requests"`
 }
 
 type ListModelsRequest struct {
@@ -184,6 +301,16 @@ type ListModelsResponse struct {
 
 type ModelInfo struct {
 	*model.Model
+	ProviderName string   `json:"provider_name"`
+	Aliases      []string `json:"aliases,omitempty"` // Alias names that resolve to the model
+}
+
+// ModelAliasInfo is an alias as listed to API consumers
+type ModelAliasInfo struct {
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	ModelID      string `json:"model_id"`
+	ModelName    string `json:"model_name"`
 	ProviderName string `json:"provider_name"`
 }
 
@@ -196,59 +323,92 @@ type ModelDetails struct {
 }
 
 type ModelFilters struct {
-	Categories []string `json:"categories,omitempty"`
-	Providers  []string `json:"providers,omitempty"`
-	MinPrice   float64  `json:"min_price,omitempty"`
-	MaxPrice   float64  `json:"max_price,omitempty"`
-	IsFree     *bool    `json:"is_free,omitempty"`
+	Categories []string     `json:"categories,omitempty"`
+	Providers  []string     `json:"providers,omitempty"`
+	MinPrice   money.Amount `json:"min_price,omitempty"`
+	MaxPrice   money.Amount `json:"max_price,omitempty"`
+	IsFree     *bool        `json:"is_free,omitempty"`
 }
 
 type BalanceInfo struct {
-	Balance     float64    `json:"balance"`
-	CreditLimit float64    `json:"credit_limit,omitempty"`
-	NextBilling *time.Time `json:"next_billing,omitempty"`
-	IsOverdue   bool       `json:"is_overdue"`
+	Balance     money.Amount `json:"balance"`
+	Held        money.Amount `json:"held"`      // Reserved by calls in flight
+	Available   money.Amount `json:"available"` // Balance less held
+	CreditLimit money.Amount `json:"credit_limit,omitempty"`
+	NextBilling *time.Time   `json:"next_billing,omitempty"`
+	IsOverdue   bool         `json:"is_overdue"`
 }
 
 type CreatePaymentRequest struct {
-	Amount        float64 `json:"amount" validate:"required,min=0.01"`
-	Currency      string  `json:"currency" validate:"required,len=3"`
-	PaymentMethod string  `json:"payment_method" validate:"required"`
-	ReturnURL     string  `json:"return_url,omitempty"`
+	Amount        money.Amount `json:"amount" validate:"required,gt=0"`
+	Currency      string       `json:"currency" validate:"required,len=3"`
+	PaymentMethod string       `json:"payment_method" validate:"required"`
+	ReturnURL     string       `json:"return_url,omitempty"`
+}
+
+// SandboxPaymentRequest is how a sandbox payment ends
+type SandboxPaymentRequest struct {
+	Outcome string `json:"outcome" validate:"oneof=succeeded failed"`
 }
 
 type PaymentInfo struct {
-	ID         string     `json:"id"`
-	Amount     float64    `json:"amount"`
-	Currency   string     `json:"currency"`
-	Status     string     `json:"status"`
-	PaymentURL string     `json:"payment_url,omitempty"`
-	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	ID         string       `json:"id"`
+	Amount     money.Amount `json:"amount"`
+	Currency   string       `json:"currency"`
+	Status     string       `json:"status"`
+	PaymentURL string       `json:"payment_url,omitempty"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"`
+}
+
+// PaymentHistoryRequest filters and pages a user's payments
+type PaymentHistoryRequest struct {
+	Cursor        string        `json:"cursor,omitempty"` // next_cursor of the previous page
+	Limit         int           `json:"limit" validate:"min=1,max=100"`
+	From          *time.Time    `json:"from,omitempty"` // Created at or after
+	To            *time.Time    `json:"to,omitempty"`   // Created before
+	Status        string        `json:"status,omitempty" validate:"omitempty,oneof=pending completed failed"`
+	PaymentMethod string        `json:"payment_method,omitempty"`
+	MinAmount     *money.Amount `json:"min_amount,omitempty"`
+	SortBy        string        `json:"sort_by,omitempty" validate:"omitempty,oneof=created_at amount"`
+	SortOrder     string        `json:"sort_order,omitempty" validate:"omitempty,oneof=asc desc"`
 }
 
 type PaymentHistoryResponse struct {
-	Payments []*PaymentItem `json:"payments"`
-	Total    int64          `json:"total"`
-	Page     int            `json:"page"`
-	Limit    int            `json:"limit"`
+	Payments   []*PaymentItem `json:"payments"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Empty on the last page
+	HasMore    bool           `json:"has_more"`
+	Limit      int            `json:"limit"`
 }
 
 type PaymentItem struct {
-	ID            string     `json:"id"`
-	Amount        float64    `json:"amount"`
-	Currency      string     `json:"currency"`
-	PaymentMethod string     `json:"payment_method"`
-	Status        string     `json:"status"`
-	TransactionID string     `json:"transaction_id,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
-	PaidAt        *time.Time `json:"paid_at,omitempty"`
+	ID            string       `json:"id"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	PaymentMethod string       `json:"payment_method"`
+	Status        string       `json:"status"`
+	TransactionID *string      `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	PaidAt        *time.Time   `json:"paid_at,omitempty"`
+}
+
+// BillingRecordsRequest filters and pages a user's billing records
+type BillingRecordsRequest struct {
+	Cursor    string        `json:"cursor,omitempty"` // next_cursor of the previous page
+	Limit     int           `json:"limit" validate:"min=1,max=100"`
+	From      *time.Time    `json:"from,omitempty"` // Created at or after
+	To        *time.Time    `json:"to,omitempty"`   // Created before
+	ModelID   string        `json:"model_id,omitempty" validate:"omitempty,uuid"`
+	APIKeyID  string        `json:"api_key_id,omitempty" validate:"omitempty,uuid"`
+	MinCost   *money.Amount `json:"min_cost,omitempty"`
+	SortBy    string        `json:"sort_by,omitempty" validate:"omitempty,oneof=created_at cost total_tokens"`
+	SortOrder string        `json:"sort_order,omitempty" validate:"omitempty,oneof=asc desc"`
 }
 
 type BillingRecordsResponse struct {
-	Records []*BillingRecordItem `json:"records"`
-	Total   int64                `json:"total"`
-	Page    int                  `json:"page"`
-	Limit   int                  `json:"limit"`
+	Records    []*BillingRecordItem `json:"records"`
+	NextCursor string               `json:"next_cursor,omitempty"` // Empty on the last page
+	HasMore    bool                 `json:"has_more"`
+	Limit      int                  `json:"limit"`
 }
 
 type BillingRecordItem struct {
@@ -258,13 +418,14 @@ type BillingRecordItem struct {
 }
 
 type CostCalculation struct {
-	InputTokens  int     `json:"input_tokens"`
-	OutputTokens int     `json:"output_tokens"`
-	InputCost    float64 `json:"input_cost"`
-	OutputCost   float64 `json:"output_cost"`
-	TotalCost    float64 `json:"total_cost"`
-	ModelName    string  `json:"model_name"`
-	ProviderName string  `json:"provider_name"`
+	InputTokens  int          `json:"input_tokens"`
+	OutputTokens int          `json:"output_tokens"`
+	InputCost    money.Amount `json:"input_cost"`
+	OutputCost   money.Amount `json:"output_cost"`
+	TotalCost    money.Amount `json:"total_cost"`
+	ModelName    string       `json:"model_name"`
+	ProviderName string       `json:"provider_name"`
+	Tokenizer    string       `json:"tokenizer,omitempty"` // Encoding input tokens were counted with
 }
 
 type ListUsersRequest struct {
@@ -287,11 +448,11 @@ type ListUsersResponse struct {
 
 type AdminUserInfo struct {
 	*model.User
-	TotalPaid      float64    `json:"total_paid"`
-	TotalUsed      float64    `json:"total_used"`
-	CurrentBalance float64    `json:"current_balance"`
-	APIKeysCount   int        `json:"api_keys_count"`
-	LastActivity   *time.Time `json:"last_activity,omitempty"`
+	TotalPaid      money.Amount `json:"total_paid"`
+	TotalUsed      money.Amount `json:"total_used"`
+	CurrentBalance money.Amount `json:"current_balance"`
+	APIKeysCount   int          `json:"api_keys_count"`
+	LastActivity   *time.Time   `json:"last_activity,omitempty"`
 }
 
 type AdminUserDetails struct {
@@ -310,11 +471,11 @@ type OAuthAccountInfo struct {
 }
 
 type UserStatistics struct {
-	TotalRequests int64   `json:"total_requests"`
-	TotalTokens   int64   `json:"total_tokens"`
-	TotalCost     float64 `json:"total_cost"`
-	AvgDailyCost  float64 `json:"avg_daily_cost"`
-	MostUsedModel string  `json:"most_used_model"`
+	TotalRequests int64        `json:"total_requests"`
+	TotalTokens   int64        `json:"total_tokens"`
+	TotalCost     money.Amount `json:"total_cost"`
+	AvgDailyCost  money.Amount `json:"avg_daily_cost"`
+	MostUsedModel string       `json:"most_used_model"`
 }
 
 type AdminUpdateUserRequest struct {
@@ -345,8 +506,8 @@ type CreateModelRequest struct {
 	Capabilities  map[string]interface{} `json:"capabilities" validate:"required"`
 	Category      string                 `json:"category,omitempty"`
 	PricingTier   string                 `json:"pricing_tier,omitempty"`
-	InputPrice    float64                `json:"input_price" validate:"required,min=0"`
-	OutputPrice   float64                `json:"output_price" validate:"required,min=0"`
+	InputPrice    money.Amount           `json:"input_price" validate:"required,min=0"`
+	OutputPrice   money.Amount           `json:"output_price" validate:"required,min=0"`
 	IsFree        bool                   `json:"is_free"`
 }
 
@@ -358,29 +519,106 @@ type UpdateModelRequest struct {
 	Capabilities  map[string]interface{} `json:"capabilities,omitempty"`
 	Category      string                 `json:"category,omitempty"`
 	PricingTier   string                 `json:"pricing_tier,omitempty"`
-	InputPrice    float64                `json:"input_price,omitempty" validate:"omitempty,min=0"`
-	OutputPrice   float64                `json:"output_price,omitempty" validate:"omitempty,min=0"`
+	InputPrice    money.Amount           `json:"input_price,omitempty" validate:"omitempty,min=0"`
+	OutputPrice   money.Amount           `json:"output_price,omitempty" validate:"omitempty,min=0"`
 	IsActive      *bool                  `json:"is_active,omitempty"`
 }
 
+type CreateModelDeploymentRequest struct {
+	ProviderID    string        `json:"provider_id" validate:"required"`
+	UpstreamModel string        `json:"upstream_model,omitempty"`
+	Priority      int           `json:"priority"`
+	Weight        *int          `json:"weight,omitempty" validate:"omitempty,min=0"`
+	InputPrice    *money.Amount `json:"input_price,omitempty" validate:"omitempty,min=0"`
+	OutputPrice   *money.Amount `json:"output_price,omitempty" validate:"omitempty,min=0"`
+}
+
+type UpdateModelDeploymentRequest struct {
+	UpstreamModel *string       `json:"upstream_model,omitempty"`
+	Priority      *int          `json:"priority,omitempty"`
+	Weight        *int          `json:"weight,omitempty" validate:"omitempty,min=0"`
+	InputPrice    *money.Amount `json:"input_price,omitempty" validate:"omitempty,min=0"`
+	OutputPrice   *money.Amount `json:"output_price,omitempty" validate:"omitempty,min=0"`
+	IsActive      *bool         `json:"is_active,omitempty"`
+}
+
+type CreateProviderCredentialRequest struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	APIKey   string `json:"api_key" validate:"required,max=512"`
+	Weight   *int   `json:"weight,omitempty" validate:"omitempty,min=0"`
+	RPMLimit int    `json:"rpm_limit,omitempty" validate:"min=0"`
+	TPMLimit int    `json:"tpm_limit,omitempty" validate:"min=0"`
+}
+
+type UpdateProviderCredentialRequest struct {
+	Name     *string `json:"name,omitempty" validate:"omitempty,max=255"`
+	Weight   *int    `json:"weight,omitempty" validate:"omitempty,min=0"`
+	RPMLimit *int    `json:"rpm_limit,omitempty" validate:"omitempty,min=0"`
+	TPMLimit *int    `json:"tpm_limit,omitempty" validate:"omitempty,min=0"`
+	Status   *string `json:"status,omitempty" validate:"omitempty,oneof=active disabled"`
+}
+
+type CreateModelAliasRequest struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description,omitempty"`
+	ModelID     string `json:"model_id" validate:"required"`
+}
+
+type UpdateModelAliasRequest struct {
+	Description *string `json:"description,omitempty"`
+	ModelID     *string `json:"model_id,omitempty"`
+	IsActive    *bool   `json:"is_active,omitempty"`
+}
+
+type CreateRoutingRuleRequest struct {
+	Name          string                  `json:"name" validate:"required,max=255"`
+	Description   string                  `json:"description,omitempty"`
+	Priority      int                     `json:"priority"`
+	Conditions    model.RoutingConditions `json:"conditions"`
+	TargetModelID string                  `json:"target_model_id" validate:"required"`
+}
+
+type UpdateRoutingRuleRequest struct {
+	Name          *string                  `json:"name,omitempty" validate:"omitempty,max=255"`
+	Description   *string                  `json:"description,omitempty"`
+	Priority      *int                     `json:"priority,omitempty"`
+	Conditions    *model.RoutingConditions `json:"conditions,omitempty"`
+	TargetModelID *string                  `json:"target_model_id,omitempty"`
+	IsActive      *bool                    `json:"is_active,omitempty"`
+}
+
 type SystemStats struct {
 	TotalUsers     int64          `json:"total_users"`
 	ActiveUsers    int64          `json:"active_users"`
 	TotalRequests  int64          `json:"total_requests"`
-	TotalRevenue   float64        `json:"total_revenue"`
+	TotalRevenue   money.Amount   `json:"total_revenue"`
 	DailyRequests  int64          `json:"daily_requests"`
-	DailyRevenue   float64        `json:"daily_revenue"`
+	DailyRevenue   money.Amount   `json:"daily_revenue"`
 	TopModels      []*ModelStats  `json:"top_models"`
 	RecentPayments []*PaymentItem `json:"recent_payments"`
 	ServerStatus   *ServerStatus  `json:"server_status"`
+
+	CircuitBreakers []*CircuitBreakerStatus `json:"circuit_breakers"`
 }
 
 type ModelStats struct {
-	ModelID     string  `json:"model_id"`
-	ModelName   string  `json:"model_name"`
-	Requests    int64   `json:"requests"`
-	Revenue     float64 `json:"revenue"`
-	SuccessRate float64 `json:"success_rate"`
+	ModelID     string       `json:"model_id"`
+	ModelName   string       `json:"model_name"`
+	Requests    int64        `json:"requests"`
+	Revenue     money.Amount `json:"revenue"`
+	SuccessRate float64      `json:"success_rate"`
+}
+
+type CircuitBreakerStatus struct {
+	ProviderID          string     `json:"provider_id"`
+	ProviderName        string     `json:"provider_name"`
+	CredentialID        string     `json:"credential_id,omitempty"` // Empty for the provider's own key
+	Credential          string     `json:"credential"`              // Masked key
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"` // When a probe is let through
 }
 
 type ServerStatus struct {
@@ -395,49 +633,172 @@ type ServerStatus struct {
 type UpdateQuotaRequest struct {
 	DailyRequestLimit   *int                   `json:"daily_request_limit,omitempty" validate:"omitempty,min=0"`
 	DailyTokenLimit     *int                   `json:"daily_token_limit,omitempty" validate:"omitempty,min=0"`
-	DailyCostLimit      *float64               `json:"daily_cost_limit,omitempty" validate:"omitempty,min=0"`
+	DailyCostLimit      *money.Amount          `json:"daily_cost_limit,omitempty" validate:"omitempty,min=0"`
 	MonthlyRequestLimit *int                   `json:"monthly_request_limit,omitempty" validate:"omitempty,min=0"`
 	MonthlyTokenLimit   *int                   `json:"monthly_token_limit,omitempty" validate:"omitempty,min=0"`
-	MonthlyCostLimit    *float64               `json:"monthly_cost_limit,omitempty" validate:"omitempty,min=0"`
-	PerMinuteRateLimit  *int                   `json:"per_minute_rate_limit,omitempty" validate:"omitempty,min=1,max=1000"`
-	PerHourRateLimit    *int                   `json:"per_hour_rate_limit,omitempty" validate:"omitempty,min=1,max=10000"`
+	MonthlyCostLimit    *money.Amount          `json:"monthly_cost_limit,omitempty" validate:"omitempty,min=0"`
+	PerMinuteRateLimit  *int                   `json:"per_minute_rate_limit,omitempty" validate:"omitempty,min=1,max=100000"`
+	PerHourRateLimit    *int                   `json:"per_hour_rate_limit,omitempty" validate:"omitempty,min=1,max=1000000"`
+	PerMinuteTokenLimit *int                   `json:"per_minute_token_limit,omitempty" validate:"omitempty,min=0"`
 	ResetDay            *int                   `json:"reset_day,omitempty" validate:"omitempty,min=1,max=31"`
 	Timezone            string                 `json:"timezone,omitempty"`
 	ModelLimits         map[string]interface{} `json:"model_limits,omitempty"`
 	IsActive            *bool                  `json:"is_active,omitempty"`
 }
 
+// Route is a model and the deployments to try for a call to it, in order
+type Route struct {
+	Model       *model.Model
+	Deployments []*model.ModelDeployment
+
+	// How the requested name was resolved; all unset for a model name
+	Rule  *model.RoutingRule
+	Alias *model.ModelAlias
+	Auto  bool
+}
+
+// APIKeyAuthorization is the outcome of checking an API key's permission set
+type APIKeyAuthorization struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	// MissingPermission is set when the key lacks the permission for the call
+	MissingPermission *model.Permission `json:"missing_permission,omitempty"`
+	// ExceededLimit names the monthly cap that was reached, if any
+	ExceededLimit        string    `json:"exceeded_limit,omitempty"`
+	MonthlyRequests      int64     `json:"monthly_requests"`
+	MonthlyRequestsLimit int64     `json:"monthly_requests_limit,omitempty"`
+	MonthlyTokens        int64     `json:"monthly_tokens"`
+	MonthlyTokensLimit   int64     `json:"monthly_tokens_limit,omitempty"`
+	NextReset            time.Time `json:"next_reset,omitempty"`
+	// Reservation is the usage an allowed call was counted for. It is nil
+	// when the key has no caps or they were checked without Redis.
+	Reservation *APIKeyReservation `json:"-"`
+}
+
+// APIKeyReservation is the usage an allowed call was counted for against its
+// API key's monthly caps
+type APIKeyReservation struct {
+	KeyID  string
+	Month  string // "2006-01"
+	Tokens int
+}
+
 type QuotaCheckResult struct {
-	Allowed              bool      `json:"allowed"`
-	Reason               string    `json:"reason,omitempty"`
-	DailyRequests        int       `json:"daily_requests"`
-	DailyRequestsLimit   int       `json:"daily_requests_limit"`
-	DailyTokens          int       `json:"daily_tokens"`
-	DailyTokensLimit     int       `json:"daily_tokens_limit"`
-	DailyCost            float64   `json:"daily_cost"`
-	DailyCostLimit       float64   `json:"daily_cost_limit"`
-	MonthlyRequests      int       `json:"monthly_requests"`
-	MonthlyRequestsLimit int       `json:"monthly_requests_limit"`
-	MonthlyTokens        int       `json:"monthly_tokens"`
-	MonthlyTokensLimit   int       `json:"monthly_tokens_limit"`
-	MonthlyCost          float64   `json:"monthly_cost"`
-	MonthlyCostLimit     float64   `json:"monthly_cost_limit"`
-	NextReset            time.Time `json:"next_reset"`
+	Allowed              bool         `json:"allowed"`
+	Reason               string       `json:"reason,omitempty"`
+	DailyRequests        int          `json:"daily_requests"`
+	DailyRequestsLimit   int          `json:"daily_requests_limit"`
+	DailyTokens          int          `json:"daily_tokens"`
+	DailyTokensLimit     int          `json:"daily_tokens_limit"`
+	DailyCost            money.Amount `json:"daily_cost"`
+	DailyCostLimit       money.Amount `json:"daily_cost_limit"`
+	MonthlyRequests      int          `json:"monthly_requests"`
+	MonthlyRequestsLimit int          `json:"monthly_requests_limit"`
+	MonthlyTokens        int          `json:"monthly_tokens"`
+	MonthlyTokensLimit   int          `json:"monthly_tokens_limit"`
+	MonthlyCost          money.Amount `json:"monthly_cost"`
+	MonthlyCostLimit     money.Amount `json:"monthly_cost_limit"`
+	NextReset            time.Time    `json:"next_reset"`
+	// ModelLimit is set when a per-model or per-category limit was hit
+	ModelLimit *ModelLimitExceeded `json:"model_limit,omitempty"`
+	// Reservation holds the usage counted for an allowed call
+	Reservation *QuotaReservation `json:"-"`
+}
+
+// QuotaReservation is the usage an allowed call was counted for up front, in
+// the windows it was counted in
+type QuotaReservation struct {
+	UserID    string
+	ModelID   string
+	Category  string // Model category, whose usage is counted too
+	Date      string // Daily window, "2006-01-02"
+	YearMonth string // Monthly window, "2006-01"
+	Tokens    int
+	Cost      money.Amount
+	// Counted is false when Redis was unavailable and nothing was reserved;
+	// the call's usage is then recorded in the database when it is settled
+	Counted bool
+}
+
+// ModelLimitExceeded names the per-model or per-category limit a call hit
+type ModelLimitExceeded struct {
+	Scope     string  `json:"scope"`      // "model" or "category"
+	Key       string  `json:"key"`        // Model ID or category name
+	LimitType string  `json:"limit_type"` // e.g. "daily_requests", "monthly_cost"
+	Used      float64 `json:"used"`
+	Limit     float64 `json:"limit"`
 }
 
 type CreateBillingRecordRequest struct {
 	UserID         string                 `json:"user_id"`
 	APIKeyID       *string                `json:"api_key_id,omitempty"`
 	ModelID        string                 `json:"model_id"`
+	RequestID      string                 `json:"request_id"` // Idempotency key; a call is billed once
 	RequestTokens  int                    `json:"request_tokens"`
 	ResponseTokens int                    `json:"response_tokens"`
 	TotalTokens    int                    `json:"total_tokens"`
-	Cost           float64                `json:"cost"`
+	Cost           money.Amount           `json:"cost"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	HoldID         string                 `json:"hold_id,omitempty"` // Balance hold the record settles
+}
+
+// PostLedgerEntryRequest is an admin's manual ledger entry. Amount is signed
+// as the ledger stores it. The reference is the payment or billing record the
+// entry corrects, or an ID the admin picks for the request; an entry is
+// posted once per reference and type, so retrying a request is safe.
+type PostLedgerEntryRequest struct {
+	Type          string       `json:"type" validate:"required,oneof=refund adjustment hold release"`
+	Amount        money.Amount `json:"amount" validate:"required"`
+	ReferenceType string       `json:"reference_type" validate:"required,oneof=payment_record billing_record admin_request"`
+	ReferenceID   string       `json:"reference_id" validate:"required,uuid"`
+	Description   string       `json:"description" validate:"required,max=500"`
+}
+
+type LedgerEntriesResponse struct {
+	Entries []*model.LedgerEntry `json:"entries"`
+	Total   int64                `json:"total"`
+	Page    int                  `json:"page"`
+	Limit   int                  `json:"limit"`
+}
+
+// LedgerReconciliation lists the accounts whose running balances differ from
+// the sum of their ledger entries
+type LedgerReconciliation struct {
+	Accounts  int            `json:"accounts"`
+	Drifts    []*LedgerDrift `json:"drifts"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+type LedgerDrift struct {
+	UserID          string       `json:"user_id"`
+	RecordedBalance money.Amount `json:"recorded_balance"`
+	ExpectedBalance money.Amount `json:"expected_balance"`
+	RecordedHeld    money.Amount `json:"recorded_held"`
+	ExpectedHeld    money.Amount `json:"expected_held"`
+	MissingAccount  bool         `json:"missing_account,omitempty"`
+	Fixed           bool         `json:"fixed,omitempty"`
+}
+
+// BalanceReservation is the outcome of reserving balance for a call. HoldID
+// is empty when no hold was placed, either because the balance was
+// insufficient or because holds are unavailable without Redis.
+type BalanceReservation struct {
+	Allowed   bool         `json:"allowed"`
+	HoldID    string       `json:"hold_id,omitempty"`
+	Amount    money.Amount `json:"amount"`
+	Balance   money.Amount `json:"balance"`
+	Held      money.Amount `json:"held"` // By other calls when the reservation was made
+	Available money.Amount `json:"available"`
 }
 
 type QueueStatus struct {
-	QueueLength       int64     `json:"queue_length"`
+	QueueLength       int64     `json:"queue_length"`    // Entries in the billing stream not yet done
+	PendingCount      int64     `json:"pending_count"`   // Entries delivered to a consumer and not yet acknowledged
+	ConsumerLag       int64     `json:"consumer_lag"`    // Entries not yet delivered to any consumer
+	Consumers         int64     `json:"consumers"`       // Consumers in the group, across router instances
+	LocalConsumers    int       `json:"local_consumers"` // Consumers this process runs
+	Retrying          int64     `json:"retrying"`        // Failed jobs waiting for another attempt
+	DeadLetters       int64     `json:"dead_letters"`
 	WorkerRunning     bool      `json:"worker_running"`
 	LastProcessedAt   time.Time `json:"last_processed_at,omitempty"`
 	TotalProcessed    int64     `json:"total_processed"`
@@ -445,6 +806,22 @@ type QueueStatus struct {
 	AvgProcessingTime float64   `json:"avg_processing_time"`
 }
 
+// BillingDeadLetter is a billing job the worker gave up on after its last
+// attempt failed
+type BillingDeadLetter struct {
+	ID       string                      `json:"id"` // The request ID the job bills
+	Request  *CreateBillingRecordRequest `json:"request,omitempty"`
+	Payload  string                      `json:"payload,omitempty"` // The job as queued, if it could not be read
+	Attempts int                         `json:"attempts"`
+	Error    string                      `json:"error"`
+	FailedAt time.Time                   `json:"failed_at"`
+}
+
+// BillingDeadLettersRequest selects dead letters; no IDs selects all of them
+type BillingDeadLettersRequest struct {
+	IDs []string `json:"ids" validate:"omitempty,max=1000"`
+}
+
 // OAuth-related request/response types
 type OAuthService interface {
 	GetEnabledProviders(ctx context.Context) ([]*OAuthProviderInfo, error)
@@ -8,6 +8,7 @@ import (
 
 	"massrouter.ai/backend/internal/model"
 	"massrouter.ai/backend/internal/repository"
+	"massrouter.ai/backend/pkg/money"
 	"massrouter.ai/backend/pkg/utils"
 )
 
@@ -353,7 +354,7 @@ func (s *userService) GetUsageStatistics(ctx context.Context, userID string, sta
 
 	usageMap := make(map[time.Time]*DailyUsage)
 	modelUsageMap := make(map[string]*ModelUsage)
-	var totalCost float64
+	var totalCost money.Amount
 	var totalTokens int64
 
 	for _, record := range records {
@@ -408,7 +409,7 @@ func (s *userService) GetUsageStatistics(ctx context.Context, userID string, sta
 	}, nil
 }
 
-func (s *userService) getUserBalance(ctx context.Context, userID string) (float64, error) {
+func (s *userService) getUserBalance(ctx context.Context, userID string) (money.Amount, error) {
 	balance, err := s.GetUserBalance(ctx, userID)
 	if err != nil {
 		return 0, err
@@ -7,7 +7,9 @@
 package internal
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"massrouter.ai/backend/internal/config"
 	"massrouter.ai/backend/internal/controller/admin"
@@ -23,6 +25,7 @@ import (
 	pkgAuth "massrouter.ai/backend/pkg/auth"
 	"massrouter.ai/backend/pkg/cache"
 	"massrouter.ai/backend/pkg/database"
+	"massrouter.ai/backend/pkg/payment"
 
 	"github.com/rs/zerolog"
 )
@@ -56,6 +59,49 @@ func setupLogger(cfg config.LogConfig) zerolog.Logger {
 	return logger
 }
 
+// newPaymentGateways sets up the gateways whose webhooks are accepted: the
+// configured gateway, which must post payment.Event bodies, and the sandbox.
+// Vendors' own webhook formats are not understood, so a vendor is connected
+// through a bridge that re-signs its notices as events.
+func newPaymentGateways(cfg *config.Config, logger zerolog.Logger) (payment.Gateways, error) {
+	gateways := payment.Gateways{}
+	tolerance := cfg.Payment.WebhookTolerance
+
+	if name := strings.ToLower(cfg.Payment.GatewayName); name != "" {
+		if name == payment.Sandbox {
+			return nil, fmt.Errorf("PAYMENT_GATEWAY_NAME cannot be %q", payment.Sandbox)
+		}
+		switch {
+		case cfg.Payment.GatewayHMACSecret != "" && cfg.Payment.GatewayRSAPublicKey != "":
+			return nil, fmt.Errorf("set either PAYMENT_GATEWAY_HMAC_SECRET or PAYMENT_GATEWAY_RSA_PUBLIC_KEY, not both")
+		case cfg.Payment.GatewayHMACSecret != "":
+			gateways.Add(&payment.Gateway{Name: name, Verifier: payment.NewHMACVerifier(cfg.Payment.GatewayHMACSecret, tolerance)})
+		case cfg.Payment.GatewayRSAPublicKey != "":
+			verifier, err := payment.NewRSAVerifier(cfg.Payment.GatewayRSAPublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PAYMENT_GATEWAY_RSA_PUBLIC_KEY: %w", err)
+			}
+			gateways.Add(&payment.Gateway{Name: name, Verifier: verifier})
+		default:
+			logger.Warn().Str("gateway", name).Msg("Payment gateway disabled: no PAYMENT_GATEWAY_HMAC_SECRET or PAYMENT_GATEWAY_RSA_PUBLIC_KEY")
+		}
+	}
+
+	if cfg.Payment.SandboxEnabled {
+		// Anyone could pay with the sandbox, so it must never reach production
+		if cfg.Server.Mode == "release" {
+			return nil, fmt.Errorf("the sandbox payment gateway cannot be enabled in release mode")
+		}
+		sandbox, err := payment.NewSandboxGateway(cfg.Payment.SandboxSecret, tolerance)
+		if err != nil {
+			return nil, err
+		}
+		gateways.Add(sandbox)
+		logger.Warn().Msg("Sandbox payments are enabled; payments through it credit balances without charging anyone")
+	}
+	return gateways, nil
+}
+
 // InitializeServer is a manually implemented version of the wire-generated function.
 func InitializeServer(cfg *config.Config) (*Server, error) {
 	// Setup logger
@@ -97,32 +143,57 @@ func InitializeServer(cfg *config.Config) (*Server, error) {
 	userRepo := repository.NewUserRepository(db.DB)
 	modelRepo := repository.NewModelRepository(db.DB)
 	modelProviderRepo := repository.NewModelProviderRepository(db.DB)
+	modelDeploymentRepo := repository.NewModelDeploymentRepository(db.DB)
+	providerCredentialRepo := repository.NewProviderCredentialRepository(db.DB)
+	modelAliasRepo := repository.NewModelAliasRepository(db.DB)
+	routingRuleRepo := repository.NewRoutingRuleRepository(db.DB)
 	userAPIKeyRepo := repository.NewUserAPIKeyRepository(db.DB)
 	billingRepo := repository.NewBillingRecordRepository(db.DB)
 	paymentRepo := repository.NewPaymentRecordRepository(db.DB)
 	statisticRepo := repository.NewModelStatisticRepository(db.DB)
 	configRepo := repository.NewSystemConfigRepository(db.DB)
+	ledgerRepo := repository.NewLedgerRepository(db.DB)
 
 	// Initialize quota repositories
 	quotaRepo := repository.NewUserQuotaRepository(db.DB)
 	usageRepo := repository.NewUserUsageRepository(db.DB)
 	monthlyRepo := repository.NewMonthlyUsageRepository(db.DB)
+	snapshotRepo := repository.NewQuotaSnapshotRepository(db.DB)
 
 	// Initialize services
 	authService := service.NewAuthService(userRepo, jwtManager)
 	userService := service.NewUserService(userRepo, userAPIKeyRepo, billingRepo, paymentRepo)
-	modelService := service.NewModelService(modelRepo, modelProviderRepo, statisticRepo)
-	billingService := service.NewBillingService(paymentRepo, billingRepo, modelRepo, redisClient)
+	modelService := service.NewModelService(modelRepo, modelProviderRepo, statisticRepo, modelAliasRepo)
+	// Setup payment gateways
+	gateways, err := newPaymentGateways(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	billingService := service.NewBillingService(paymentRepo, billingRepo, modelRepo, ledgerRepo, redisClient, gateways,
+		service.BillingWorkerOptions{
+			Consumers: cfg.Billing.Consumers,
+			BatchSize: cfg.Billing.BatchSize,
+			ClaimIdle: cfg.Billing.ClaimIdle,
+		},
+	)
+	ledgerService := service.NewLedgerService(ledgerRepo, paymentRepo, billingRepo)
+	breakerService := service.NewCircuitBreakerService(cfg.Upstream.BreakerThreshold, cfg.Upstream.BreakerOpenTimeout)
 	adminService := service.NewAdminService(
 		userRepo, userAPIKeyRepo, paymentRepo, billingRepo,
 		modelRepo, modelProviderRepo, statisticRepo, configRepo,
+		modelDeploymentRepo, providerCredentialRepo, modelAliasRepo, routingRuleRepo,
+		breakerService,
 	)
 
 	// Initialize quota service
-	quotaService := service.NewQuotaService(quotaRepo, usageRepo, monthlyRepo)
+	quotaService := service.NewQuotaService(quotaRepo, usageRepo, monthlyRepo, snapshotRepo, modelRepo, redisClient, cfg.Quota.FlushInterval)
+	apiKeyPolicyService := service.NewAPIKeyPolicyService(billingRepo, redisClient)
+	routingService := service.NewRoutingService(modelRepo, modelDeploymentRepo, modelAliasRepo, routingRuleRepo, statisticRepo)
+	credentialService := service.NewCredentialService(providerCredentialRepo, redisClient)
 
 	// Initialize controllers
-	healthController := health.NewController(db, redisClient)
+	healthController := health.NewController(db, redisClient, breakerService)
 	authController := auth.NewController(authService)
 	oauthProviderRepo := repository.NewOAuthProviderRepository(db.DB)
 	oauthAccountRepo := repository.NewOAuthAccountRepository(db.DB)
@@ -130,9 +201,16 @@ func InitializeServer(cfg *config.Config) (*Server, error) {
 	oauthController := oauth.NewController(oauthService)
 	userController := user.NewController(userService, authService, billingService)
 	modelController := model.NewController(modelService)
-	billingController := billing.NewController(billingService)
-	adminController := admin.NewController(adminService)
-	proxyController := proxyController.NewController(modelService, billingService, quotaService)
+	billingController := billing.NewController(billingService, ledgerService)
+	adminController := admin.NewController(adminService, billingService, ledgerService)
+	proxyController := proxyController.NewController(
+		billingService, quotaService, apiKeyPolicyService, routingService, credentialService, breakerService,
+		proxyController.RetryPolicy{
+			MaxRetries: cfg.Upstream.MaxRetries,
+			BaseDelay:  cfg.Upstream.RetryBaseDelay,
+			MaxDelay:   cfg.Upstream.RetryMaxDelay,
+		},
+	)
 
 	// Create and return server
 	return NewServer(
@@ -141,6 +219,8 @@ func InitializeServer(cfg *config.Config) (*Server, error) {
 		db,
 		redisClient,
 		jwtManager,
+		userAPIKeyRepo,
+		quotaRepo,
 		healthController,
 		authController,
 		oauthController,
@@ -150,5 +230,6 @@ func InitializeServer(cfg *config.Config) (*Server, error) {
 		adminController,
 		proxyController,
 		billingService,
+		quotaService,
 	), nil
 }
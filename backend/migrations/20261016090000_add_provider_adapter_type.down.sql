@@ -0,0 +1,6 @@
+-- Migration down: remove_provider_adapter_type
+-- Remove the adapter type from provider config
+
+UPDATE model_providers
+SET config = config - 'type'
+WHERE config ? 'type';
@@ -0,0 +1,11 @@
+-- Migration up: add_provider_adapter_type
+-- Record which API adapter the proxy uses for each provider in config.type,
+-- so the adapter no longer depends on the provider's display name
+
+UPDATE model_providers
+SET config = config || '{"type": "openai"}'::jsonb
+WHERE LOWER(name) IN ('openai', 'meta') AND NOT (config ? 'type');
+
+UPDATE model_providers
+SET config = config || '{"type": "cohere"}'::jsonb
+WHERE LOWER(name) = 'cohere' AND NOT (config ? 'type');
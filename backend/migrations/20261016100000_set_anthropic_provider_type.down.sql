@@ -0,0 +1,6 @@
+-- Migration down: unset_anthropic_provider_type
+-- Remove the Anthropic adapter type from provider config
+
+UPDATE model_providers
+SET config = config - 'type'
+WHERE config->>'type' = 'anthropic';
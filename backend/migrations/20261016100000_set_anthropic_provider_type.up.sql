@@ -0,0 +1,6 @@
+-- Migration up: set_anthropic_provider_type
+-- Route the Anthropic provider through the native Messages API adapter
+
+UPDATE model_providers
+SET config = config || '{"type": "anthropic"}'::jsonb
+WHERE LOWER(name) = 'anthropic' AND NOT (config ? 'type');
@@ -0,0 +1,6 @@
+-- Migration down: unset_gemini_provider_type
+-- Remove the Gemini adapter type from provider config
+
+UPDATE model_providers
+SET config = config - 'type'
+WHERE config->>'type' = 'gemini';
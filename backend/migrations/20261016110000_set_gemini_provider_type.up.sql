@@ -0,0 +1,6 @@
+-- Migration up: set_gemini_provider_type
+-- Route the Google provider through the native Gemini generateContent adapter
+
+UPDATE model_providers
+SET config = config || '{"type": "gemini"}'::jsonb
+WHERE LOWER(name) = 'google' AND NOT (config ? 'type');
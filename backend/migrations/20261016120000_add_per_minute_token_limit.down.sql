@@ -0,0 +1,5 @@
+-- Migration down: remove_per_minute_token_limit
+-- Remove the tokens-per-minute ceiling from user quotas
+
+ALTER TABLE user_quotas
+DROP COLUMN IF EXISTS per_minute_token_limit;
@@ -0,0 +1,5 @@
+-- Migration up: add_per_minute_token_limit
+-- Add a tokens-per-minute ceiling to user quotas, enforced by the proxy rate limiter
+
+ALTER TABLE user_quotas
+ADD COLUMN IF NOT EXISTS per_minute_token_limit INTEGER NOT NULL DEFAULT 40000;
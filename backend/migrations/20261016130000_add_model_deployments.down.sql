@@ -0,0 +1,4 @@
+-- Migration down: remove_model_deployments
+-- Drop model deployment chains
+
+DROP TABLE IF EXISTS model_deployments;
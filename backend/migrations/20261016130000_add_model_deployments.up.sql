@@ -0,0 +1,20 @@
+-- Migration up: add_model_deployments
+-- Let one public model be served by an ordered chain of provider deployments
+
+CREATE TABLE IF NOT EXISTS model_deployments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    model_id UUID NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    provider_id UUID NOT NULL REFERENCES model_providers(id) ON DELETE CASCADE,
+    upstream_model VARCHAR(255),
+    priority INTEGER NOT NULL DEFAULT 0,
+    weight INTEGER NOT NULL DEFAULT 1 CHECK (weight >= 0),
+    input_price DECIMAL(10,8),
+    output_price DECIMAL(10,8),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_deployments_model_id ON model_deployments(model_id);
+CREATE INDEX IF NOT EXISTS idx_model_deployments_provider_id ON model_deployments(provider_id);
+CREATE INDEX IF NOT EXISTS idx_model_deployments_is_active ON model_deployments(is_active);
@@ -0,0 +1,4 @@
+-- Migration down: remove_provider_credentials
+-- Drop per-provider credential pools; providers fall back to their single api_key
+
+DROP TABLE IF EXISTS provider_credentials;
@@ -0,0 +1,23 @@
+-- Migration up: add_provider_credentials
+-- Hold several upstream API keys per provider so calls can be spread across them
+
+CREATE TABLE IF NOT EXISTS provider_credentials (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    provider_id UUID NOT NULL REFERENCES model_providers(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    api_key VARCHAR(512) NOT NULL,
+    masked_key VARCHAR(32) NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 1 CHECK (weight >= 0),
+    status VARCHAR(50) NOT NULL DEFAULT 'active',
+    rpm_limit INTEGER NOT NULL DEFAULT 0,
+    tpm_limit INTEGER NOT NULL DEFAULT 0,
+    cooldown_until TIMESTAMP WITH TIME ZONE,
+    auth_failures INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_provider_credentials_provider_id ON provider_credentials(provider_id);
+CREATE INDEX IF NOT EXISTS idx_provider_credentials_status ON provider_credentials(status);
+
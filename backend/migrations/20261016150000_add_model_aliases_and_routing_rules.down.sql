@@ -0,0 +1,5 @@
+-- Migration down: remove_model_aliases_and_routing_rules
+-- Drop model aliases and routing rules
+
+DROP TABLE IF EXISTS routing_rules;
+DROP TABLE IF EXISTS model_aliases;
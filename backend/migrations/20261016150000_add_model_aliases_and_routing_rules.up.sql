@@ -0,0 +1,31 @@
+-- Migration up: add_model_aliases_and_routing_rules
+-- Let clients request models by admin-managed aliases and route requests by rule
+
+CREATE TABLE IF NOT EXISTS model_aliases (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    model_id UUID NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_aliases_model_id ON model_aliases(model_id);
+CREATE INDEX IF NOT EXISTS idx_model_aliases_is_active ON model_aliases(is_active);
+
+CREATE TABLE IF NOT EXISTS routing_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    priority INTEGER NOT NULL DEFAULT 0,
+    conditions JSONB NOT NULL DEFAULT '{}',
+    target_model_id UUID NOT NULL REFERENCES models(id) ON DELETE CASCADE,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_routing_rules_priority ON routing_rules(priority);
+CREATE INDEX IF NOT EXISTS idx_routing_rules_target_model_id ON routing_rules(target_model_id);
+CREATE INDEX IF NOT EXISTS idx_routing_rules_is_active ON routing_rules(is_active);
@@ -0,0 +1,8 @@
+-- Migration down: add_ledger
+-- Drop the balance ledger and its accounts
+
+DROP TRIGGER IF EXISTS ledger_entries_no_truncate ON ledger_entries;
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+DROP TABLE IF EXISTS ledger_entries;
+DROP FUNCTION IF EXISTS ledger_entries_append_only();
+DROP TABLE IF EXISTS ledger_accounts;
@@ -0,0 +1,71 @@
+-- Migration up: add_ledger
+-- Keep balances in an append-only ledger with a running balance per account
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    balance DECIMAL(18, 8) NOT NULL DEFAULT 0,
+    held DECIMAL(18, 8) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('credit', 'debit', 'refund', 'adjustment', 'hold', 'release')),
+    amount DECIMAL(18, 8) NOT NULL,
+    balance_after DECIMAL(18, 8) NOT NULL,
+    held_after DECIMAL(18, 8) NOT NULL,
+    reference_type VARCHAR(50),
+    reference_id UUID,
+    description TEXT,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((reference_type IS NULL) = (reference_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_user_id_created_at ON ledger_entries(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_created_at ON ledger_entries(created_at);
+-- A source record is posted at most once per entry type
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ledger_entries_reference
+    ON ledger_entries(reference_type, reference_id, type)
+    WHERE reference_id IS NOT NULL;
+
+-- Entries are never changed or removed, since the account balances are
+-- their running sum; corrections are new entries
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
+
+CREATE TRIGGER ledger_entries_no_truncate
+    BEFORE TRUNCATE ON ledger_entries
+    FOR EACH STATEMENT EXECUTE FUNCTION ledger_entries_append_only();
+
+-- Open the ledger with the payments and usage recorded so far
+WITH history AS (
+    SELECT user_id, 'credit' AS type, amount, 'payment_record' AS reference_type, id AS reference_id,
+           'Payment' AS description, COALESCE(paid_at, created_at) AS created_at
+    FROM payment_records
+    WHERE status = 'completed'
+    UNION ALL
+    SELECT user_id, 'debit', -cost, 'billing_record', id,
+           'Usage', created_at
+    FROM billing_records
+    WHERE cost > 0
+)
+INSERT INTO ledger_entries (user_id, type, amount, balance_after, held_after, reference_type, reference_id, description, created_at)
+SELECT user_id, type, amount,
+       SUM(amount) OVER (PARTITION BY user_id ORDER BY created_at, reference_id),
+       0, reference_type, reference_id, description, created_at
+FROM history;
+
+INSERT INTO ledger_accounts (user_id, balance, held)
+SELECT user_id, SUM(amount), 0
+FROM ledger_entries
+GROUP BY user_id;
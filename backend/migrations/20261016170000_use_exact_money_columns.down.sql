@@ -0,0 +1,27 @@
+-- Migration down: use_exact_money_columns
+-- Restore the original money column precisions. Values are rounded to the
+-- old scales, and ones too large for them make this fail.
+
+ALTER TABLE monthly_usage
+    ALTER COLUMN total_cost TYPE DECIMAL(10, 4);
+
+ALTER TABLE user_usage
+    ALTER COLUMN total_cost TYPE DECIMAL(10, 8);
+
+ALTER TABLE user_quotas
+    ALTER COLUMN daily_cost_limit TYPE DECIMAL(10, 4),
+    ALTER COLUMN monthly_cost_limit TYPE DECIMAL(10, 4);
+
+ALTER TABLE billing_records
+    ALTER COLUMN cost TYPE DECIMAL(10, 8);
+
+ALTER TABLE payment_records
+    ALTER COLUMN amount TYPE DECIMAL(10, 2);
+
+ALTER TABLE model_deployments
+    ALTER COLUMN input_price TYPE DECIMAL(10, 8),
+    ALTER COLUMN output_price TYPE DECIMAL(10, 8);
+
+ALTER TABLE models
+    ALTER COLUMN input_price TYPE DECIMAL(10, 8),
+    ALTER COLUMN output_price TYPE DECIMAL(10, 8);
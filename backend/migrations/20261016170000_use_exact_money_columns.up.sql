@@ -0,0 +1,27 @@
+-- Migration up: use_exact_money_columns
+-- Store every amount of money with the scale of money.Amount: 8 decimal
+-- places and room for balances above 99.99999999
+
+ALTER TABLE models
+    ALTER COLUMN input_price TYPE DECIMAL(18, 8),
+    ALTER COLUMN output_price TYPE DECIMAL(18, 8);
+
+ALTER TABLE model_deployments
+    ALTER COLUMN input_price TYPE DECIMAL(18, 8),
+    ALTER COLUMN output_price TYPE DECIMAL(18, 8);
+
+ALTER TABLE payment_records
+    ALTER COLUMN amount TYPE DECIMAL(18, 8);
+
+ALTER TABLE billing_records
+    ALTER COLUMN cost TYPE DECIMAL(18, 8);
+
+ALTER TABLE user_quotas
+    ALTER COLUMN daily_cost_limit TYPE DECIMAL(18, 8),
+    ALTER COLUMN monthly_cost_limit TYPE DECIMAL(18, 8);
+
+ALTER TABLE user_usage
+    ALTER COLUMN total_cost TYPE DECIMAL(18, 8);
+
+ALTER TABLE monthly_usage
+    ALTER COLUMN total_cost TYPE DECIMAL(18, 8);
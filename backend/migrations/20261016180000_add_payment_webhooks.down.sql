@@ -0,0 +1,4 @@
+-- Migration down: add_payment_webhooks
+-- Nothing to undo: NULL transaction IDs are valid under the unique index
+
+SELECT 1;
@@ -0,0 +1,5 @@
+-- Migration up: add_payment_webhooks
+-- A payment has no transaction ID until its gateway reports one. Empty
+-- strings collided on the unique index, so pending payments store NULL.
+
+UPDATE payment_records SET transaction_id = NULL WHERE transaction_id = '';
@@ -0,0 +1,5 @@
+-- Migration down: add_billing_request_id
+
+DROP INDEX IF EXISTS idx_billing_records_request_id;
+
+ALTER TABLE billing_records DROP COLUMN IF EXISTS request_id;
@@ -0,0 +1,7 @@
+-- Migration up: add_billing_request_id
+-- Billing jobs are delivered at least once; the request ID a record was billed
+-- for makes storing it again a no-op
+
+ALTER TABLE billing_records ADD COLUMN IF NOT EXISTS request_id VARCHAR(100);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_billing_records_request_id ON billing_records(request_id);
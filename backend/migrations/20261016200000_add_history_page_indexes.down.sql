@@ -0,0 +1,5 @@
+-- Migration down: add_history_page_indexes
+
+DROP INDEX IF EXISTS idx_payment_records_user_created_id;
+
+DROP INDEX IF EXISTS idx_billing_records_user_created_id;
@@ -0,0 +1,7 @@
+-- Migration up: add_history_page_indexes
+-- Billing and payment history is read a page at a time, newest first, by
+-- (created_at, id) within a user
+
+CREATE INDEX IF NOT EXISTS idx_billing_records_user_created_id ON billing_records(user_id, created_at, id);
+
+CREATE INDEX IF NOT EXISTS idx_payment_records_user_created_id ON payment_records(user_id, created_at, id);
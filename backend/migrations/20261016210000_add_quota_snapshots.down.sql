@@ -0,0 +1,3 @@
+-- Migration down: add_quota_snapshots
+
+DROP TABLE IF EXISTS quota_snapshots;
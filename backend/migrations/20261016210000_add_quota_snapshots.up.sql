@@ -0,0 +1,29 @@
+-- Migration up: add_quota_snapshots
+-- Usage of each daily and monthly quota window, kept when the window ends or
+-- is reset
+
+CREATE TABLE IF NOT EXISTS quota_snapshots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period VARCHAR(10) NOT NULL CHECK (period IN ('daily', 'monthly')),
+    bucket VARCHAR(10) NOT NULL,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('rollover', 'reset')),
+    timezone VARCHAR(100) NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    request_count INTEGER NOT NULL DEFAULT 0,
+    token_count INTEGER NOT NULL DEFAULT 0,
+    total_cost DECIMAL(18, 8) NOT NULL DEFAULT 0,
+    model_usage JSONB NOT NULL DEFAULT '{}',
+    request_limit INTEGER NOT NULL,
+    token_limit INTEGER NOT NULL,
+    cost_limit DECIMAL(18, 8) NOT NULL,
+    is_exceeded BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_snapshots_user_id_created_at ON quota_snapshots(user_id, created_at);
+-- A window rolls over once, however many instances run the scheduler
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quota_snapshots_rollover
+    ON quota_snapshots(user_id, period, bucket)
+    WHERE reason = 'rollover';
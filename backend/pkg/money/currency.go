@@ -0,0 +1,50 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is what the platform knows about a currency: how many decimal
+// places its smallest unit has, and how amounts are rounded to it
+type Currency struct {
+	Code     string
+	Digits   int
+	Rounding RoundingMode
+}
+
+// Currencies payments can be made in. Payments round half-up to the minor
+// unit, as card networks do.
+var currencies = map[string]Currency{
+	"CNY": {Code: "CNY", Digits: 2, Rounding: HalfUp},
+	"USD": {Code: "USD", Digits: 2, Rounding: HalfUp},
+	"EUR": {Code: "EUR", Digits: 2, Rounding: HalfUp},
+	"GBP": {Code: "GBP", Digits: 2, Rounding: HalfUp},
+	"HKD": {Code: "HKD", Digits: 2, Rounding: HalfUp},
+	"JPY": {Code: "JPY", Digits: 0, Rounding: HalfUp},
+	"KRW": {Code: "KRW", Digits: 0, Rounding: HalfUp},
+}
+
+// LookupCurrency returns the currency with an ISO 4217 code
+func LookupCurrency(code string) (Currency, error) {
+	c, ok := currencies[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, fmt.Errorf("unsupported currency: %s", code)
+	}
+	return c, nil
+}
+
+// Round rounds an amount to the currency's minor unit
+func (c Currency) Round(a Amount) Amount {
+	return a.Round(c.Digits, c.Rounding)
+}
+
+// Exact reports whether an amount is a whole number of minor units
+func (c Currency) Exact(a Amount) bool {
+	return c.Round(a) == a
+}
+
+// Format writes an amount with the currency's number of decimal places
+func (c Currency) Format(a Amount) string {
+	return c.Round(a).StringFixed(c.Digits)
+}
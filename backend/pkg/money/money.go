@@ -0,0 +1,300 @@
+// Package money does exact arithmetic on amounts of money. An Amount is a
+// whole number of 10^-8 units of a currency, the precision every money column
+// is stored with, so sums and comparisons never drift the way floats do.
+//
+// Rounding is always explicit. Usage charges are rounded half-up to Scale
+// when they are priced; payments are rounded to their currency's minor unit
+// with the currency's rule (see Currency).
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places an Amount holds
+const Scale = 8
+
+const unitsPerWhole = 100_000_000 // 10^Scale
+
+// Amount is an amount of money in units of 10^-Scale. Amounts add, subtract
+// and compare with the ordinary operators.
+type Amount int64
+
+// Zero is the zero amount
+const Zero Amount = 0
+
+// RoundingMode decides which way an amount between two representable values
+// goes
+type RoundingMode int
+
+const (
+	HalfUp   RoundingMode = iota // Ties away from zero
+	HalfEven                     // Ties to the even neighbour (banker's rounding)
+	Down                         // Toward zero
+	Up                           // Away from zero
+)
+
+// FromInt returns a whole number of currency units
+func FromInt(whole int64) Amount {
+	return Amount(whole * unitsPerWhole)
+}
+
+// FromFloat converts a float, rounding half-up to Scale. It is meant for
+// values that were floats to begin with, such as configuration; amounts from
+// the database or the API are parsed exactly.
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * unitsPerWhole))
+}
+
+// Parse reads a decimal string such as "12.5", "-0.00000150" or "3". It fails
+// on more than Scale decimal places rather than rounding silently.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid amount: empty")
+	}
+
+	neg := false
+	digits := s
+	switch digits[0] {
+	case '-':
+		neg = true
+		digits = digits[1:]
+	case '+':
+		digits = digits[1:]
+	}
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+	if len(frac) > Scale {
+		// Zeros past the scale carry no value
+		if strings.TrimRight(frac[Scale:], "0") != "" {
+			return 0, fmt.Errorf("invalid amount %q: more than %d decimal places", s, Scale)
+		}
+		frac = frac[:Scale]
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid amount: %q", s)
+			}
+		}
+	}
+
+	frac += strings.Repeat("0", Scale-len(frac))
+	units, err := strconv.ParseInt(strings.TrimLeft(whole, "0")+frac, 10, 64)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, fmt.Errorf("invalid amount %q: out of range", s)
+		}
+		return 0, fmt.Errorf("invalid amount: %q", s)
+	}
+	if neg {
+		units = -units
+	}
+	return Amount(units), nil
+}
+
+// MustParse is Parse for amounts known to be valid, such as constants
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Units is the amount as a whole number of 10^-Scale units
+func (a Amount) Units() int64 {
+	return int64(a)
+}
+
+// Float64 is the amount as a float, for display and statistics only
+func (a Amount) Float64() float64 {
+	return float64(a) / unitsPerWhole
+}
+
+// String formats the amount exactly, without trailing zeros
+func (a Amount) String() string {
+	s := a.StringFixed(Scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// StringFixed formats the amount with exactly digits decimal places,
+// rounding half-up if it has more
+func (a Amount) StringFixed(digits int) string {
+	if digits < 0 {
+		digits = 0
+	}
+	if digits > Scale {
+		digits = Scale
+	}
+	r := a.Round(digits, HalfUp)
+
+	units := int64(r)
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+	abs := new(big.Int).Abs(big.NewInt(units)).String()
+	if len(abs) <= Scale {
+		abs = strings.Repeat("0", Scale-len(abs)+1) + abs
+	}
+	whole, frac := abs[:len(abs)-Scale], abs[len(abs)-Scale:]
+	if digits == 0 {
+		return sign + whole
+	}
+	return sign + whole + "." + frac[:digits]
+}
+
+// Neg returns -a
+func (a Amount) Neg() Amount {
+	return -a
+}
+
+// IsZero reports whether the amount is zero
+func (a Amount) IsZero() bool {
+	return a == 0
+}
+
+// Mul returns a multiplied by n
+func (a Amount) Mul(n int64) Amount {
+	return Amount(int64(a) * n)
+}
+
+// MulDiv returns a * num / den, rounded with mode. The product is exact, so
+// prices per thousand tokens can be applied without intermediate rounding.
+func (a Amount) MulDiv(num, den int64, mode RoundingMode) Amount {
+	if den == 0 {
+		panic("money: division by zero")
+	}
+	n := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(num))
+	return Amount(divRound(n, big.NewInt(den), mode).Int64())
+}
+
+// Round rounds the amount to digits decimal places
+func (a Amount) Round(digits int, mode RoundingMode) Amount {
+	if digits >= Scale {
+		return a
+	}
+	if digits < 0 {
+		digits = 0
+	}
+	step := int64(math.Pow10(Scale - digits))
+	q := divRound(big.NewInt(int64(a)), big.NewInt(step), mode)
+	return Amount(q.Int64() * step)
+}
+
+// divRound divides n by d, rounding the quotient with mode
+func divRound(n, d *big.Int, mode RoundingMode) *big.Int {
+	if d.Sign() < 0 {
+		n, d = new(big.Int).Neg(n), new(big.Int).Neg(d)
+	}
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	away := false
+	switch mode {
+	case Down:
+	case Up:
+		away = true
+	case HalfUp, HalfEven:
+		// Compare twice the remainder with the divisor
+		twice := new(big.Int).Abs(r)
+		twice.Lsh(twice, 1)
+		switch twice.Cmp(d) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == HalfUp || q.Bit(0) == 1
+		}
+	}
+	if away {
+		if n.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// MarshalJSON writes the amount as an exact JSON number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a numeric string exactly
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if strings.ContainsAny(s, "eE") {
+		// Exponent notation from clients that format floats
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid amount: %q", s)
+		}
+		*a = FromFloat(f)
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value stores the amount as a decimal string, which Postgres reads into a
+// numeric column without loss
+func (a Amount) Value() (driver.Value, error) {
+	return a.StringFixed(Scale), nil
+}
+
+// Scan reads a numeric column. Values with more than Scale decimal places
+// fail instead of being rounded.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = FromInt(v)
+		return nil
+	case float64:
+		*a = FromFloat(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
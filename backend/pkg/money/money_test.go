@@ -0,0 +1,172 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"12.5", 1_250_000_000, false},
+		{"-0.00000150", -150, false},
+		{".5", 50_000_000, false},
+		{"+3", 300_000_000, false},
+		{"0.123456780000", 12_345_678, false},
+		{"0.000000001", 0, true},
+		{"1e3", 0, true},
+		{"12.3.4", 0, true},
+		{"", 0, true},
+		{"-", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0"},
+		{5, "0.00000005"},
+		{-150, "-0.0000015"},
+		{FromInt(12), "12"},
+		{MustParse("10.10"), "10.1"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("String(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := MustParse("1.005").StringFixed(2); got != "1.01" {
+		t.Errorf("StringFixed(2) = %q, want 1.01", got)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		digits int
+		mode   RoundingMode
+		want   string
+	}{
+		{"1.005", 2, HalfUp, "1.01"},
+		{"1.005", 2, HalfEven, "1"},
+		{"1.015", 2, HalfEven, "1.02"},
+		{"-1.005", 2, HalfUp, "-1.01"},
+		{"1.009", 2, Down, "1"},
+		{"-1.009", 2, Down, "-1"},
+		{"1.001", 2, Up, "1.01"},
+		{"2.5", 0, HalfEven, "2"},
+		{"1.23456789", 8, HalfUp, "1.23456789"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).Round(tt.digits, tt.mode).String(); got != tt.want {
+			t.Errorf("Round(%s, %d, %d) = %s, want %s", tt.in, tt.digits, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	// 1234 tokens at 0.00015 per thousand
+	price := MustParse("0.00015")
+	if got := price.MulDiv(1234, 1000, HalfUp).String(); got != "0.0001851" {
+		t.Errorf("MulDiv = %s, want 0.0001851", got)
+	}
+	// 500 tokens at one unit per thousand is half a unit
+	price = MustParse("0.00000001")
+	if got := price.MulDiv(500, 1000, HalfUp); got != 1 {
+		t.Errorf("MulDiv half-up = %d, want 1", got)
+	}
+	if got := price.MulDiv(500, 1000, HalfEven); got != 0 {
+		t.Errorf("MulDiv half-even = %d, want 0", got)
+	}
+}
+
+func TestSumsAreExact(t *testing.T) {
+	var total Amount
+	for i := 0; i < 10; i++ {
+		total += MustParse("0.1")
+	}
+	if total != FromInt(1) {
+		t.Errorf("ten times 0.1 = %s, want 1", total)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		Price Amount  `json:"price"`
+		Limit *Amount `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(`{"price": 0.00000015, "limit": "10.50"}`), &v); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	if v.Price != 15 || v.Limit == nil || *v.Limit != MustParse("10.5") {
+		t.Errorf("Unmarshal = %d, %v", v.Price, v.Limit)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal error = %v", err)
+	}
+	if string(data) != `{"price":0.00000015,"limit":10.5}` {
+		t.Errorf("Marshal = %s", data)
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	var a Amount
+	for _, src := range []interface{}{[]byte("123.45000000"), "123.45", int64(0), nil} {
+		if err := a.Scan(src); err != nil {
+			t.Errorf("Scan(%v) error = %v", src, err)
+		}
+	}
+	if err := a.Scan([]byte("0.123456789")); err == nil {
+		t.Error("Scan of more than 8 decimal places should fail")
+	}
+
+	a = MustParse("-7.25")
+	v, err := a.Value()
+	if err != nil || v != "-7.25000000" {
+		t.Errorf("Value() = %v, %v", v, err)
+	}
+	var back Amount
+	if err := back.Scan([]byte(v.(string))); err != nil || back != a {
+		t.Errorf("round trip = %s, %v", back, err)
+	}
+}
+
+func TestCurrency(t *testing.T) {
+	usd, err := LookupCurrency("usd")
+	if err != nil {
+		t.Fatalf("LookupCurrency error = %v", err)
+	}
+	if got := usd.Format(MustParse("10.005")); got != "10.01" {
+		t.Errorf("Format = %s, want 10.01", got)
+	}
+	if usd.Exact(MustParse("10.005")) || !usd.Exact(MustParse("10.5")) {
+		t.Error("Exact reports wrong precision for USD")
+	}
+
+	jpy, _ := LookupCurrency("JPY")
+	if got := jpy.Round(MustParse("1500.5")).String(); got != "1501" {
+		t.Errorf("JPY Round = %s, want 1501", got)
+	}
+	if _, err := LookupCurrency("XXX"); err == nil {
+		t.Error("LookupCurrency should reject unknown codes")
+	}
+}
@@ -0,0 +1,100 @@
+// Package payment verifies and reads the webhooks payment gateways send when
+// a payment succeeds or fails.
+//
+// Every gateway posts the same event body (see Event); what differs is how
+// the body is signed. HMAC gateways sign it with a shared secret and a
+// timestamp, RSA gateways with their private key. Vendors' own webhook
+// formats, such as Stripe's or Alipay's, are not parsed here.
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+// Event types
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+)
+
+// Event is a gateway's notice that a payment changed state
+type Event struct {
+	ID            string       `json:"id"`             // The gateway's event ID
+	Type          string       `json:"type"`           // EventPaymentSucceeded or EventPaymentFailed
+	PaymentID     string       `json:"payment_id"`     // Our payment record, passed to the gateway at checkout
+	TransactionID string       `json:"transaction_id"` // The gateway's ID for the charge
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+	Reason        string       `json:"reason,omitempty"` // Why a payment failed
+}
+
+// Verifier checks the signature a gateway sent with a webhook body
+type Verifier interface {
+	Verify(payload []byte, signature string) error
+}
+
+// Signer signs webhook bodies the way a gateway does
+type Signer interface {
+	Sign(payload []byte, at time.Time) string
+}
+
+// Gateway is a payment gateway webhooks are accepted from. Its name is the
+// payment method payments made through it are recorded with. Only gateways
+// this server plays itself, like the sandbox, have a Signer.
+type Gateway struct {
+	Name     string
+	Verifier Verifier
+	Signer   Signer
+}
+
+// Gateways are the configured gateways by name
+type Gateways map[string]*Gateway
+
+// Add registers a gateway under its name
+func (g Gateways) Add(gateway *Gateway) {
+	g[gateway.Name] = gateway
+}
+
+// Lookup returns the gateway with a name, or nil
+func (g Gateways) Lookup(name string) *Gateway {
+	return g[strings.ToLower(name)]
+}
+
+// ParseWebhook verifies a webhook's signature and reads its event
+func (g *Gateway) ParseWebhook(payload []byte, signature string) (*Event, error) {
+	if err := g.Verifier.Verify(payload, signature); err != nil {
+		return nil, err
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if err := event.validate(); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (e *Event) validate() error {
+	switch {
+	case e.ID == "":
+		return fmt.Errorf("invalid webhook payload: missing id")
+	case e.Type != EventPaymentSucceeded && e.Type != EventPaymentFailed:
+		return fmt.Errorf("invalid webhook payload: unknown event type %q", e.Type)
+	case e.PaymentID == "":
+		return fmt.Errorf("invalid webhook payload: missing payment_id")
+	case e.TransactionID == "":
+		return fmt.Errorf("invalid webhook payload: missing transaction_id")
+	case e.Type == EventPaymentSucceeded && e.Amount <= 0:
+		return fmt.Errorf("invalid webhook payload: amount must be positive")
+	case e.Currency == "":
+		return fmt.Errorf("invalid webhook payload: missing currency")
+	}
+	return nil
+}
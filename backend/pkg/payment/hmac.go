@@ -0,0 +1,86 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTolerance is how far a signed timestamp may be from now before the
+// webhook is refused as a replay
+const DefaultTolerance = 5 * time.Minute
+
+// HMACVerifier checks signatures of the form
+//
+//	t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+//
+// Several v1 values may be sent while a secret is being rotated; one match
+// is enough.
+type HMACVerifier struct {
+	Secret    []byte
+	Tolerance time.Duration
+
+	now func() time.Time
+}
+
+// NewHMACVerifier returns a verifier for a shared secret. A zero tolerance
+// means DefaultTolerance.
+func NewHMACVerifier(secret string, tolerance time.Duration) *HMACVerifier {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	return &HMACVerifier{Secret: []byte(secret), Tolerance: tolerance, now: time.Now}
+}
+
+func (v *HMACVerifier) Verify(payload []byte, signature string) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return fmt.Errorf("invalid webhook signature: expected t=...,v1=...")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook signature: bad timestamp")
+	}
+	age := v.now().Sub(time.Unix(seconds, 0))
+	if age > v.Tolerance || age < -v.Tolerance {
+		return fmt.Errorf("invalid webhook signature: timestamp outside tolerance")
+	}
+
+	expected := v.mac(timestamp, payload)
+	for _, sig := range signatures {
+		decoded, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid webhook signature")
+}
+
+// Sign returns the signature a gateway would send with payload at a time
+func (v *HMACVerifier) Sign(payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(v.mac(timestamp, payload))
+}
+
+func (v *HMACVerifier) mac(timestamp string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, v.Secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"massrouter.ai/backend/pkg/money"
+)
+
+const testPayload = `{"id":"evt_1","type":"payment.succeeded","payment_id":"p1","transaction_id":"txn_1","amount":"10.50","currency":"CNY"}`
+
+func TestHMACVerifier(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := NewHMACVerifier("secret", time.Minute)
+	v.now = func() time.Time { return now }
+
+	signature := v.Sign([]byte(testPayload), now)
+	if err := v.Verify([]byte(testPayload), signature); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// One matching signature is enough while a secret is being rotated
+	other := NewHMACVerifier("old-secret", time.Minute).Sign([]byte(testPayload), now)
+	rotated := signature + "," + other[strings.Index(other, "v1="):]
+	if err := v.Verify([]byte(testPayload), rotated); err != nil {
+		t.Errorf("Verify() with two signatures error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		payload   string
+		signature string
+	}{
+		{"tampered body", strings.Replace(testPayload, "10.50", "1050", 1), signature},
+		{"wrong secret", testPayload, other},
+		{"stale", testPayload, v.Sign([]byte(testPayload), now.Add(-2*time.Minute))},
+		{"malformed", testPayload, "deadbeef"},
+	}
+	for _, tt := range tests {
+		if err := v.Verify([]byte(tt.payload), tt.signature); err == nil {
+			t.Errorf("%s: Verify() succeeded, want error", tt.name)
+		}
+	}
+}
+
+func TestRSAVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	digest := sha256.Sum256([]byte(testPayload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15() error = %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(sig)
+
+	keys := map[string]string{
+		"pem":    string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		"base64": base64.StdEncoding.EncodeToString(der),
+	}
+	for format, publicKey := range keys {
+		v, err := NewRSAVerifier(publicKey)
+		if err != nil {
+			t.Fatalf("NewRSAVerifier(%s) error = %v", format, err)
+		}
+		if err := v.Verify([]byte(testPayload), signature); err != nil {
+			t.Errorf("Verify(%s) error = %v", format, err)
+		}
+		if err := v.Verify([]byte(testPayload+" "), signature); err == nil {
+			t.Errorf("Verify(%s) of a changed body succeeded", format)
+		}
+	}
+
+	if _, err := NewRSAVerifier("your_alipay_public_key"); err == nil {
+		t.Error("NewRSAVerifier() accepted a placeholder key")
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	gateway, err := NewSandboxGateway("", 0)
+	if err != nil {
+		t.Fatalf("NewSandboxGateway() error = %v", err)
+	}
+
+	payload, signature, err := gateway.Webhook(&Event{
+		ID:            "evt_1",
+		Type:          EventPaymentSucceeded,
+		PaymentID:     "p1",
+		TransactionID: "txn_1",
+		Amount:        money.MustParse("10.5"),
+		Currency:      "CNY",
+	})
+	if err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+	event, err := gateway.ParseWebhook(payload, signature)
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	if event.Amount != money.MustParse("10.5") || event.TransactionID != "txn_1" {
+		t.Errorf("ParseWebhook() = %+v", event)
+	}
+
+	payload, signature, _ = gateway.Webhook(&Event{ID: "evt_2", Type: "payment.disputed", PaymentID: "p1", TransactionID: "txn_1", Currency: "CNY"})
+	if _, err := gateway.ParseWebhook(payload, signature); err == nil {
+		t.Error("ParseWebhook() accepted an unknown event type")
+	}
+}
@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// RSAVerifier checks base64 RSASSA-PKCS1-v1_5 signatures over the SHA-256 of
+// the body, made with the gateway's private key
+type RSAVerifier struct {
+	PublicKey *rsa.PublicKey
+}
+
+// NewRSAVerifier returns a verifier for a gateway's public key, given as PEM
+// or as the bare base64 DER some gateways hand out
+func NewRSAVerifier(publicKey string) (*RSAVerifier, error) {
+	key, err := ParseRSAPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &RSAVerifier{PublicKey: key}, nil
+}
+
+func (v *RSAVerifier) Verify(payload []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return fmt.Errorf("invalid webhook signature: not base64")
+	}
+	digest := sha256.Sum256(payload)
+	if err := rsa.VerifyPKCS1v15(v.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		return fmt.Errorf("invalid webhook signature")
+	}
+	return nil
+}
+
+// ParseRSAPublicKey reads a PKIX or PKCS #1 RSA public key
+func ParseRSAPublicKey(data string) (*rsa.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(data)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA public key: neither PEM nor base64")
+		}
+		der = decoded
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("invalid RSA public key: not an RSA key")
+		}
+		return rsaKey, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RSA public key: %w", err)
+	}
+	return key, nil
+}
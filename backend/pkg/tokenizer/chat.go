@@ -0,0 +1,146 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Chat formatting overhead, as OpenAI counts it for its chat models
+const (
+	tokensPerMessage = 3 // <|start|>{role}\n ... <|end|>
+	tokensPerName    = 1
+	tokensReplyStart = 3 // Every reply is primed with <|start|>assistant<|message|>
+	tokensPerToolUse = 3
+
+	// Function definitions are rendered into the system prompt
+	tokensFunctionStart = 7
+	tokensFunctionsEnd  = 12
+	tokensPropertyStart = 3
+	tokensPropertyKey   = 3
+	tokensEnumStart     = -3
+	tokensEnumItem      = 3
+
+	// Images are billed by size and detail. Without the image to measure,
+	// high or auto detail is counted as a 1024x1024 image.
+	tokensImageLowDetail  = 85
+	tokensImageHighDetail = 765
+)
+
+// Prompt is the input of a call to be counted. Text is counted as-is;
+// messages and tools carry the chat format's overhead.
+type Prompt struct {
+	Text     string    `json:"text,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+	Tools    []Tool    `json:"tools,omitempty"`
+}
+
+// Message is a chat message reduced to what occupies the context window
+type Message struct {
+	Role       string     `json:"role"`
+	Name       string     `json:"name,omitempty"`
+	Content    string     `json:"content,omitempty"`
+	Images     []Image    `json:"images,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Image is an image part of a message
+type Image struct {
+	Detail string `json:"detail,omitempty"` // low, high or auto
+}
+
+// ToolCall is a tool invocation in an assistant message
+type ToolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// Tool is a function the model may call
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// CountPrompt returns the number of tokens a prompt takes up
+func (t *Tokenizer) CountPrompt(p *Prompt) int {
+	total := t.Count(p.Text)
+	if len(p.Messages) > 0 {
+		total += t.CountMessages(p.Messages)
+	}
+	if len(p.Tools) > 0 {
+		total += t.CountTools(p.Tools)
+	}
+	return total
+}
+
+// CountMessages returns the number of tokens a conversation takes up,
+// including the reply priming that follows it
+func (t *Tokenizer) CountMessages(messages []Message) int {
+	total := tokensReplyStart
+	for _, msg := range messages {
+		total += tokensPerMessage + t.Count(msg.Role) + t.Count(msg.Content)
+		if msg.Name != "" {
+			total += tokensPerName + t.Count(msg.Name)
+		}
+		for _, image := range msg.Images {
+			if image.Detail == "low" {
+				total += tokensImageLowDetail
+			} else {
+				total += tokensImageHighDetail
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			total += tokensPerToolUse + t.Count(call.Name) + t.Count(call.Arguments)
+		}
+	}
+	return total
+}
+
+// schemaProperty is the part of a JSON schema property that is rendered into
+// the prompt
+type schemaProperty struct {
+	Type        interface{}   `json:"type"`
+	Description string        `json:"description"`
+	Enum        []interface{} `json:"enum"`
+}
+
+// CountTools returns the number of tokens function definitions add to the
+// prompt
+func (t *Tokenizer) CountTools(tools []Tool) int {
+	total := 0
+	for _, tool := range tools {
+		total += tokensFunctionStart
+		total += t.Count(tool.Name + ":" + strings.TrimSuffix(tool.Description, "."))
+
+		var params struct {
+			Properties map[string]schemaProperty `json:"properties"`
+		}
+		if len(tool.Parameters) > 0 && json.Unmarshal(tool.Parameters, &params) != nil {
+			// A schema that is not an object is rendered as its raw text
+			total += t.Count(string(tool.Parameters))
+			continue
+		}
+		if len(params.Properties) == 0 {
+			continue
+		}
+
+		total += tokensPropertyStart
+		for key, prop := range params.Properties {
+			total += tokensPropertyKey
+			if len(prop.Enum) > 0 {
+				total += tokensEnumStart
+				for _, item := range prop.Enum {
+					total += tokensEnumItem + t.Count(fmt.Sprint(item))
+				}
+			}
+			propType := ""
+			if prop.Type != nil {
+				propType = fmt.Sprint(prop.Type)
+			}
+			total += t.Count(key + ":" + propType + ":" + strings.TrimSuffix(prop.Description, "."))
+		}
+	}
+	return total + tokensFunctionsEnd
+}
@@ -0,0 +1,112 @@
+// Package tokenizer counts tokens with the BPE vocabularies OpenAI models
+// use. The vocabularies are embedded in the binary, so counting never needs
+// the network.
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Supported encodings
+const (
+	EncodingO200K  = "o200k_base"  // GPT-4o, GPT-4.1, o-series
+	EncodingCL100K = "cl100k_base" // GPT-4, GPT-3.5, embeddings
+	EncodingP50K   = "p50k_base"   // Codex, text-davinci-002/003
+	EncodingR50K   = "r50k_base"   // GPT-3
+)
+
+// DefaultEncoding is used for models with no configured or known encoding.
+// Its large vocabulary stays close to the tokenizers of most current models,
+// including on CJK text.
+const DefaultEncoding = EncodingO200K
+
+func init() {
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// Tokenizer counts tokens in one encoding
+type Tokenizer struct {
+	encoding string
+	bpe      *tiktoken.Tiktoken
+}
+
+var (
+	mu         sync.Mutex
+	tokenizers = make(map[string]*Tokenizer)
+)
+
+// Get returns the tokenizer for an encoding. Vocabularies are loaded on first
+// use and shared afterwards.
+func Get(encoding string) (*Tokenizer, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if t, ok := tokenizers[encoding]; ok {
+		return t, nil
+	}
+	switch encoding {
+	case EncodingO200K, EncodingCL100K, EncodingP50K, EncodingR50K:
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+
+	bpe, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encoding %s: %w", encoding, err)
+	}
+	t := &Tokenizer{encoding: encoding, bpe: bpe}
+	tokenizers[encoding] = t
+	return t, nil
+}
+
+// ForModel returns the tokenizer for a model: the given encoding when set and
+// supported, otherwise the one its name implies, otherwise DefaultEncoding.
+func ForModel(modelName, encoding string) *Tokenizer {
+	if encoding == "" {
+		encoding = EncodingForModel(modelName)
+	}
+	if t, err := Get(encoding); err == nil {
+		return t
+	}
+	t, err := Get(DefaultEncoding)
+	if err != nil {
+		// The embedded vocabulary is part of the binary
+		panic(err)
+	}
+	return t
+}
+
+// EncodingForModel returns the encoding an OpenAI model name implies, or
+// DefaultEncoding for names it does not recognise. A provider prefix such as
+// "openai/" is ignored.
+func EncodingForModel(modelName string) string {
+	name := strings.ToLower(modelName[strings.LastIndex(modelName, "/")+1:])
+	if encoding, ok := tiktoken.MODEL_TO_ENCODING[name]; ok {
+		return encoding
+	}
+	for prefix, encoding := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(name, prefix) {
+			return encoding
+		}
+	}
+	return DefaultEncoding
+}
+
+// Encoding is the name of the tokenizer's encoding
+func (t *Tokenizer) Encoding() string {
+	return t.encoding
+}
+
+// Count returns the number of tokens in text. Special tokens such as
+// <|endoftext|> are counted as the plain text they are written as.
+func (t *Tokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return len(t.bpe.EncodeOrdinary(text))
+}
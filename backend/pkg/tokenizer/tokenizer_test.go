@@ -0,0 +1,76 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model, encoding, want string
+	}{
+		{"gpt-4o-mini", "", EncodingO200K},
+		{"openai/gpt-4-turbo", "", EncodingCL100K},
+		{"gpt-3.5-turbo", "", EncodingCL100K},
+		{"claude-3-5-sonnet", "", DefaultEncoding},
+		{"qwen-max", EncodingCL100K, EncodingCL100K},
+		{"gpt-4o", "no-such-encoding", DefaultEncoding},
+	}
+	for _, tt := range tests {
+		if got := ForModel(tt.model, tt.encoding).Encoding(); got != tt.want {
+			t.Errorf("ForModel(%q, %q) = %s, want %s", tt.model, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	cl100k := ForModel("gpt-4", "")
+	if got := cl100k.Count("tiktoken is great!"); got != 6 {
+		t.Errorf("Count() = %d, want 6", got)
+	}
+	if got := cl100k.Count("<|endoftext|>"); got <= 1 {
+		t.Errorf("Count() = %d for a special token's text, want it counted as text", got)
+	}
+
+	// Four bytes per token badly undercounts CJK text
+	text := "今天天气很好，我们去公园散步吧。"
+	if got := ForModel("gpt-4o", "").Count(text); got < len([]rune(text))/2 {
+		t.Errorf("Count(%q) = %d, want at least one token per two characters", text, got)
+	}
+}
+
+func TestCountPrompt(t *testing.T) {
+	tok := ForModel("gpt-4", "")
+
+	t.Run("messages", func(t *testing.T) {
+		got := tok.CountPrompt(&Prompt{Messages: []Message{{Role: "user", Content: "Hello"}}})
+		// Reply priming, message framing, "user" and "Hello"
+		if want := 3 + 3 + 1 + 1; got != want {
+			t.Errorf("CountPrompt() = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("tools add schema overhead", func(t *testing.T) {
+		messages := []Message{{Role: "user", Content: "What's the weather in Paris?"}}
+		tools := []Tool{{
+			Name:        "get_weather",
+			Description: "Get the current weather.",
+			Parameters: json.RawMessage(`{"type":"object","properties":{
+				"city":{"type":"string","description":"City name"},
+				"unit":{"type":"string","enum":["celsius","fahrenheit"]}}}`),
+		}}
+		without := tok.CountPrompt(&Prompt{Messages: messages})
+		with := tok.CountPrompt(&Prompt{Messages: messages, Tools: tools})
+		if with-without < 20 {
+			t.Errorf("tools added %d tokens, want the definition counted", with-without)
+		}
+	})
+
+	t.Run("images", func(t *testing.T) {
+		low := tok.CountMessages([]Message{{Role: "user", Images: []Image{{Detail: "low"}}}})
+		high := tok.CountMessages([]Message{{Role: "user", Images: []Image{{}}}})
+		if high-low != tokensImageHighDetail-tokensImageLowDetail {
+			t.Errorf("high detail image = %d tokens more than low, want %d", high-low, tokensImageHighDetail-tokensImageLowDetail)
+		}
+	})
+}